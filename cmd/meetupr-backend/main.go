@@ -1,15 +1,27 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"meetupr-backend/internal/auth"
 	"meetupr-backend/internal/db"
+	"meetupr-backend/internal/digest"
 	"meetupr-backend/internal/handlers"
+	"meetupr-backend/internal/mail"
+	"meetupr-backend/internal/meetup"
+	"meetupr-backend/internal/notify"
+	"meetupr-backend/internal/pubsub"
+	"meetupr-backend/internal/ratelimit"
+	"meetupr-backend/internal/recommend"
+	"meetupr-backend/internal/savedsearch"
 
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
@@ -53,13 +65,64 @@ func main() {
 
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins:     allowOrigins,
-		AllowMethods:     []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
+		AllowMethods:     []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions},
 		AllowHeaders:     []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization},
+		ExposeHeaders:    []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", echo.HeaderRetryAfter, "X-Next-Cursor"},
 		AllowCredentials: true,
 	}))
 
+	// Per-user rate limiters (see internal/ratelimit for the defaults)
+	searchLimiter := ratelimit.New(ratelimit.FromEnv("RATE_LIMIT_SEARCH", ratelimit.Search))
+	chatCreationLimiter := ratelimit.New(ratelimit.FromEnv("RATE_LIMIT_CHAT_CREATION", ratelimit.ChatCreation))
+	meetRequestLimiter := ratelimit.New(ratelimit.FromEnv("RATE_LIMIT_MEET_REQUEST", ratelimit.MeetRequest))
+
 	// Initialize and run the ChatHub
-	hub := handlers.NewHub()
+	// With REDIS_URL set, chat messages go through Redis so that every instance
+	// can deliver to its own connected clients.
+	var broker pubsub.Broker
+	if redisURL := os.Getenv("REDIS_URL"); redisURL != "" {
+		redisBroker, err := pubsub.NewRedisBroker(redisURL)
+		if err != nil {
+			log.Fatalf("Failed to initialize Redis broker: %v", err)
+		}
+		broker = redisBroker
+		log.Println("ChatHub: using Redis broker")
+	} else {
+		broker = pubsub.NewMemoryBroker()
+		log.Println("ChatHub: using in-memory broker (single instance only)")
+	}
+	defer broker.Close()
+
+	hub := handlers.NewHubWithBroker(broker)
+
+	// Web Push for users who aren't connected (enabled when the VAPID keys are set)
+	vapidPublicKey := os.Getenv("VAPID_PUBLIC_KEY")
+	var pushDispatcher *notify.Dispatcher
+	if vapidPublicKey != "" {
+		webPush, err := notify.NewWebPush(notify.WebPushConfig{
+			PublicKey:          vapidPublicKey,
+			PrivateKey:         os.Getenv("VAPID_PRIVATE_KEY"),
+			Subject:            os.Getenv("VAPID_SUBJECT"),
+			Subscriptions:      db.GetPushSubscriptions,
+			RemoveSubscription: db.RemovePushSubscription,
+		})
+		if err != nil {
+			log.Fatalf("Failed to initialize Web Push: %v", err)
+		}
+		coalesceWindow := notify.DefaultCoalesceWindow
+		if value := os.Getenv("PUSH_COALESCE_WINDOW"); value != "" {
+			if parsed, err := time.ParseDuration(value); err == nil {
+				coalesceWindow = parsed
+			} else {
+				log.Printf("Invalid PUSH_COALESCE_WINDOW %q, using %v", value, coalesceWindow)
+			}
+		}
+		pushDispatcher = notify.NewDispatcher(webPush, db.GetNotificationSettings, coalesceWindow)
+		hub.SetPush(pushDispatcher)
+		log.Println("Push notifications: enabled")
+	} else {
+		log.Println("Push notifications: disabled (VAPID_PUBLIC_KEY not set)")
+	}
 	go hub.Run()
 
 	// Public routes
@@ -83,25 +146,98 @@ func main() {
 	userGroup.POST("/register", handlers.RegisterUser, auth.EchoJWTMiddleware())
 	userGroup.GET("/me", handlers.GetMyProfile, auth.EchoJWTMiddleware())
 	userGroup.PUT("/me", handlers.UpdateMyProfile, auth.EchoJWTMiddleware())
-	userGroup.GET("", handlers.SearchUsers, auth.EchoJWTMiddleware())
+	userGroup.PATCH("/me", handlers.PatchMyProfile, auth.EchoJWTMiddleware())
+	userGroup.GET("/me/notification-settings", handlers.GetNotificationSettings, auth.EchoJWTMiddleware())
+	userGroup.PUT("/me/notification-settings", handlers.UpdateNotificationSettings, auth.EchoJWTMiddleware())
+	userGroup.GET("/me/email-preferences", handlers.GetEmailPreferences, auth.EchoJWTMiddleware())
+	userGroup.PUT("/me/email-preferences", handlers.UpdateEmailPreferences, auth.EchoJWTMiddleware())
+	userGroup.GET("/me/privacy", handlers.GetPrivacySettings, auth.EchoJWTMiddleware())
+	userGroup.PUT("/me/privacy", handlers.UpdatePrivacySettings, auth.EchoJWTMiddleware())
+	userGroup.GET("", handlers.SearchUsers, auth.EchoJWTMiddleware(), ratelimit.Middleware(searchLimiter))
 	userGroup.GET("/:userId", handlers.GetUserProfile, auth.EchoJWTMiddleware())
+	userGroup.POST("/:userId/block", handlers.BlockUser, auth.EchoJWTMiddleware())
+	userGroup.DELETE("/:userId/block", handlers.UnblockUser, auth.EchoJWTMiddleware())
+
+	// Recommendation feed ("おすすめ"); factor weights come from RECOMMEND_WEIGHT_* variables
+	apiV1.GET("/recommendations", handlers.GetRecommendations(recommend.WeightsFromEnv()), auth.EchoJWTMiddleware(), ratelimit.Middleware(searchLimiter))
+	apiV1.GET("/tandem", handlers.SearchTandemPartners, auth.EchoJWTMiddleware(), ratelimit.Middleware(searchLimiter))
+	apiV1.GET("/languages", handlers.GetLanguages)
 
 	// Interests routes
 	interestGroup := apiV1.Group("/interests")
 	interestGroup.GET("", handlers.GetInterests, auth.EchoJWTMiddleware())
+	interestGroup.GET("/categories", handlers.GetInterestCategories, auth.EchoJWTMiddleware())
+	interestGroup.POST("/proposals", handlers.CreateInterestProposal, auth.EchoJWTMiddleware())
+	interestGroup.GET("/proposals", handlers.GetMyInterestProposals, auth.EchoJWTMiddleware())
 
 	// Chat routes
 	chatGroup := apiV1.Group("/chats")
 	chatGroup.GET("", handlers.GetChats, auth.EchoJWTMiddleware())
 	// More specific routes must be defined before the generic one
-	chatGroup.GET("/with/:otherUserId", handlers.GetOrCreateChatWithUser, auth.EchoJWTMiddleware())
+	chatGroup.GET("/with/:otherUserId", handlers.GetOrCreateChatWithUser(hub), auth.EchoJWTMiddleware(), ratelimit.Middleware(chatCreationLimiter))
 	chatGroup.GET("/:chatId/messages", handlers.GetChatMessages, auth.EchoJWTMiddleware())
+	chatGroup.POST("/:chatId/read", handlers.MarkChatRead(hub), auth.EchoJWTMiddleware())
+	chatGroup.PUT("/:chatId/settings", handlers.UpdateChatSettings(hub), auth.EchoJWTMiddleware())
 	chatGroup.GET("/:chatId", handlers.GetChatDetail, auth.EchoJWTMiddleware())
+	chatGroup.POST("/groups", handlers.CreateGroupChat(hub), auth.EchoJWTMiddleware(), ratelimit.Middleware(chatCreationLimiter))
+	chatGroup.GET("/:chatId/members", handlers.GetChatMembers, auth.EchoJWTMiddleware())
+	chatGroup.POST("/:chatId/members", handlers.InviteChatMembers(hub), auth.EchoJWTMiddleware())
+	chatGroup.DELETE("/:chatId/members/:userId", handlers.RemoveChatMember(hub), auth.EchoJWTMiddleware())
+	chatGroup.POST("/:chatId/leave", handlers.LeaveChat(hub), auth.EchoJWTMiddleware())
+
+	// Event routes
+	eventGroup := apiV1.Group("/events")
+	eventGroup.POST("/:eventId/chat", handlers.JoinEventChat(hub), auth.EchoJWTMiddleware())
+
+	// Meetup routes; proposals and responses are sent as chat room frames
+	apiV1.GET("/campus-locations", handlers.GetCampusLocations, auth.EchoJWTMiddleware())
+	meetupGroup := apiV1.Group("/meetups", auth.EchoJWTMiddleware())
+	meetupGroup.GET("/:meetupId", handlers.GetMeetup)
+	meetupGroup.GET("/:meetupId/calendar.ics", handlers.GetMeetupCalendar)
+
+	// Meet request routes (anonymous "want to meet" button)
+	apiV1.POST("/meet-requests", handlers.CreateMeetRequest(hub), auth.EchoJWTMiddleware(), ratelimit.Middleware(meetRequestLimiter))
+
+	// Notification inbox routes
+	notificationGroup := apiV1.Group("/notifications", auth.EchoJWTMiddleware())
+	notificationGroup.GET("", handlers.GetNotifications)
+	notificationGroup.GET("/unread-count", handlers.GetUnreadNotificationCount)
+	notificationGroup.POST("/read-all", handlers.MarkAllNotificationsRead(hub))
+	notificationGroup.POST("/:notificationId/read", handlers.MarkNotificationRead(hub))
+
+	// Web Push routes
+	pushGroup := apiV1.Group("/push")
+	pushGroup.GET("/vapid-public-key", handlers.GetVapidPublicKey(vapidPublicKey))
+	pushGroup.POST("/subscriptions", handlers.SubscribePush, auth.EchoJWTMiddleware())
+	pushGroup.DELETE("/subscriptions", handlers.UnsubscribePush, auth.EchoJWTMiddleware())
+
+	// Email digest unsubscribe link (public: the token identifies the user)
+	apiV1.GET("/email/unsubscribe", handlers.ConfirmEmailUnsubscribe)
+	apiV1.POST("/email/unsubscribe", handlers.UnsubscribeEmail)
+
+	// Admin routes (ADMIN_USER_IDS)
+	adminGroup := apiV1.Group("/admin", auth.EchoJWTMiddleware(), auth.AdminMiddleware())
+	adminGroup.POST("/announcements", handlers.CreateAnnouncement(hub))
+	adminGroup.POST("/users/:userId/warnings", handlers.CreateModerationWarning(hub))
+	adminGroup.GET("/interest-proposals", handlers.GetInterestProposals)
+	adminGroup.POST("/interest-proposals/:proposalId/approve", handlers.ApproveInterestProposal(hub))
+	adminGroup.POST("/interest-proposals/:proposalId/reject", handlers.RejectInterestProposal(hub))
+	adminGroup.POST("/interests/:interestId/merge", handlers.MergeInterests)
 
 	// Search routes
 	searchGroup := apiV1.Group("/search")
-	searchGroup.GET("/users", handlers.SearchUsersWithQuery, auth.EchoJWTMiddleware())
-	searchGroup.POST("/users", handlers.SearchUsersAdvanced, auth.EchoJWTMiddleware())
+	searchGroup.GET("", handlers.SearchProfiles, auth.EchoJWTMiddleware(), ratelimit.Middleware(searchLimiter))
+	searchGroup.POST("", handlers.SearchProfiles, auth.EchoJWTMiddleware(), ratelimit.Middleware(searchLimiter))
+	searchGroup.GET("/users", handlers.SearchUsersWithQuery, auth.EchoJWTMiddleware(), ratelimit.Middleware(searchLimiter))
+	searchGroup.POST("/users", handlers.SearchUsersAdvanced, auth.EchoJWTMiddleware(), ratelimit.Middleware(searchLimiter))
+
+	// Saved search routes
+	savedSearchGroup := apiV1.Group("/saved-searches", auth.EchoJWTMiddleware())
+	savedSearchGroup.GET("", handlers.GetSavedSearches)
+	savedSearchGroup.POST("", handlers.CreateSavedSearch)
+	savedSearchGroup.PUT("/:savedSearchId", handlers.UpdateSavedSearch)
+	savedSearchGroup.DELETE("/:savedSearchId", handlers.DeleteSavedSearch)
+	savedSearchGroup.GET("/:savedSearchId/results", handlers.RunSavedSearch, ratelimit.Middleware(searchLimiter))
 
 	// WebSocket route with JWT middleware
 	// Note: WebSocket connections typically pass token as query parameter (?token=...)
@@ -131,14 +267,129 @@ func main() {
 		return nil
 	}, auth.EchoJWTMiddleware())
 
+	// Per-user event socket: chat list updates, matches, new chats and announcements
+	e.GET("/ws/user", func(c echo.Context) error {
+		userID, ok := c.Get("user_id").(string)
+		if !ok || userID == "" {
+			return c.String(http.StatusUnauthorized, "User ID not found in token")
+		}
+
+		handlers.UserWsHandler(hub, c.Response(), c.Request(), userID)
+		return nil
+	}, auth.EchoJWTMiddleware())
+
 	// Get port from environment variable (Render sets PORT env var)
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080" // Default port for local development
 	}
 
-	log.Printf("Server starting on port %s...", port)
-	if err := e.Start(":" + port); err != nil && err != http.ErrServerClosed {
-		log.Fatal(err)
+	// Background jobs run until shutdown
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	// Email digest of unread messages, matches and upcoming events.
+	// Enable it on one instance only, or users get one email per instance.
+	if os.Getenv("DIGEST_ENABLED") == "true" {
+		var mailer mail.Mailer
+		if smtpAddr := os.Getenv("SMTP_ADDR"); smtpAddr != "" {
+			mailer = mail.SMTPMailer{Addr: smtpAddr, Username: os.Getenv("SMTP_USERNAME"), Password: os.Getenv("SMTP_PASSWORD")}
+		} else {
+			sinkDir := os.Getenv("MAIL_SINK_DIR")
+			if sinkDir == "" {
+				sinkDir = "tmp/mail"
+			}
+			mailer = mail.FileMailer{Dir: sinkDir}
+			log.Printf("Digest: SMTP_ADDR not set, writing emails to %s", sinkDir)
+		}
+		config := digest.Config{
+			From:     os.Getenv("MAIL_FROM"),
+			BaseURL:  os.Getenv("PUBLIC_BASE_URL"),
+			AppURL:   os.Getenv("APP_URL"),
+			SendHour: 8,
+		}
+		if config.From == "" {
+			config.From = "Meetupr <no-reply@meetupr.local>"
+		}
+		if config.BaseURL == "" {
+			config.BaseURL = "http://localhost:" + port
+		}
+		if value := os.Getenv("DIGEST_SEND_HOUR"); value != "" {
+			if hour, err := strconv.Atoi(value); err == nil && hour >= 0 && hour < 24 {
+				config.SendHour = hour
+			} else {
+				log.Printf("Invalid DIGEST_SEND_HOUR %q, using %d", value, config.SendHour)
+			}
+		}
+		go digest.NewJob(digest.SupabaseStore{}, mailer, config).Start(jobsCtx, time.Hour)
+		log.Println("Digest: enabled")
+	}
+
+	// New-match alerts for saved searches. Enable it on one instance only.
+	if os.Getenv("SAVED_SEARCH_ALERTS_ENABLED") == "true" {
+		interval := 15 * time.Minute
+		if value := os.Getenv("SAVED_SEARCH_ALERT_INTERVAL"); value != "" {
+			if d, err := time.ParseDuration(value); err == nil && d >= time.Minute {
+				interval = d
+			} else {
+				log.Printf("Invalid SAVED_SEARCH_ALERT_INTERVAL %q, using %s", value, interval)
+			}
+		}
+		go savedsearch.NewJob(savedsearch.SupabaseStore{}, handlers.SavedSearchNotifier(hub)).Start(jobsCtx, interval)
+		log.Printf("Saved search alerts: enabled (every %s)", interval)
+	}
+
+	// Reminders of accepted meetups. Enable it on one instance only.
+	if os.Getenv("MEETUP_REMINDERS_ENABLED") == "true" {
+		interval := 5 * time.Minute
+		if value := os.Getenv("MEETUP_REMINDER_INTERVAL"); value != "" {
+			if d, err := time.ParseDuration(value); err == nil && d >= time.Minute {
+				interval = d
+			} else {
+				log.Printf("Invalid MEETUP_REMINDER_INTERVAL %q, using %s", value, interval)
+			}
+		}
+		go meetup.NewJob(meetup.SupabaseStore{}, handlers.MeetupReminderNotifier(hub)).Start(jobsCtx, interval)
+		log.Printf("Meetup reminders: enabled (every %s)", interval)
+	}
+
+	go func() {
+		log.Printf("Server starting on port %s...", port)
+		if err := e.Start(":" + port); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// Wait for SIGTERM (sent by Render on deploy) or Ctrl+C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	log.Println("Shutdown signal received, draining connections...")
+	stopJobs()
+
+	// Render waits 30 seconds after SIGTERM before killing the process
+	shutdownTimeout := 25 * time.Second
+	if value := os.Getenv("SHUTDOWN_TIMEOUT"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			shutdownTimeout = parsed
+		} else {
+			log.Printf("Invalid SHUTDOWN_TIMEOUT %q, using %v", value, shutdownTimeout)
+		}
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Flush pending messages and close WebSocket clients first; the Hub refuses new
+	// WebSocket connections from here on. Then stop Echo (listener and REST requests).
+	if err := hub.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Hub shutdown: %v", err)
+	}
+	// Send the push notifications still waiting to be coalesced
+	if pushDispatcher != nil {
+		pushDispatcher.Close()
+	}
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Echo shutdown: %v", err)
 	}
+	log.Println("Server stopped")
 }
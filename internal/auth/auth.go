@@ -127,3 +127,23 @@ func EchoJWTMiddleware() echo.MiddlewareFunc {
 		}
 	}
 }
+
+// AdminMiddleware only lets through users listed in ADMIN_USER_IDS (comma separated).
+// It must run after EchoJWTMiddleware.
+func AdminMiddleware() echo.MiddlewareFunc {
+	admins := make(map[string]bool)
+	for _, id := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			admins[id] = true
+		}
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			userID, _ := c.Get("user_id").(string)
+			if !admins[userID] {
+				return echo.NewHTTPError(http.StatusForbidden, "Admin privileges required")
+			}
+			return next(c)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package db
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -8,7 +10,6 @@ import (
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"meetupr-backend/internal/models"
@@ -48,10 +49,9 @@ func CreateUser(user models.User) error {
 		return err
 	}
 
-	// Create a corresponding profile
+	// Create a corresponding profile (native_language stays NULL until the user sets it)
 	profile := map[string]interface{}{
-		"user_id":         user.ID,
-		"native_language": "Unknown", // Default value
+		"user_id": user.ID,
 	}
 	var profileResults []map[string]interface{}
 	err = Supabase.DB.From("profiles").Insert(profile).Execute(&profileResults)
@@ -62,12 +62,17 @@ func CreateUser(user models.User) error {
 		return err
 	}
 
+	// メール設定の作成に失敗しても登録は続行（初回取得時に作成される）
+	if err := CreateEmailPreferences(user.ID); err != nil {
+		log.Printf("error creating email preferences for user %s: %v", user.ID, err)
+	}
+
 	return nil
 }
 
 func GetUserByID(userID string) (*models.UserProfileResponse, error) {
-	var results []json.RawMessage
-	err := Supabase.DB.From("users").Select("*, profiles(*), user_interests(*, interests(*))").Eq("id", userID).Execute(&results)
+	var results []profileRow
+	err := Supabase.DB.From("users").Select(profileColumns).Eq("id", userID).Execute(&results)
 	if err != nil {
 		return nil, err
 	}
@@ -76,11 +81,7 @@ func GetUserByID(userID string) (*models.UserProfileResponse, error) {
 		return nil, fmt.Errorf("user not found")
 	}
 
-	var user models.User
-	if err := json.Unmarshal(results[0], &user); err != nil {
-		return nil, err
-	}
-
+	user := results[0].toModel()
 	profileResponse := &models.UserProfileResponse{
 		UserID:            user.ID,
 		Email:             user.Email,
@@ -90,9 +91,17 @@ func GetUserByID(userID string) (*models.UserProfileResponse, error) {
 		NativeLanguage:    user.NativeLanguage,
 		SpokenLanguages:   user.SpokenLanguages,
 		LearningLanguages: user.LearningLanguages,
+		LanguageSkills:    user.LanguageSkills,
 		Residence:         user.Residence,
 		Comment:           user.Comment,
+		AvatarURL:         user.AvatarURL,
 		LastUpdated:       user.LastUpdatedAt,
+		IsOICVerified:     user.IsOICVerified,
+		Completeness:      user.ProfileCompleteness(),
+		Onboarding:        models.NewOnboarding(models.OnboardingRegistered),
+	}
+	if p := results[0].Profile; p != nil && p.OnboardingState != nil {
+		profileResponse.Onboarding = models.NewOnboarding(*p.OnboardingState)
 	}
 
 	// Populate interests
@@ -107,55 +116,64 @@ func GetUserByID(userID string) (*models.UserProfileResponse, error) {
 	return profileResponse, nil
 }
 
-func UpdateUserProfile(userID string, req models.UpdateUserProfileRequest) (*models.UserProfileResponse, error) {
-	// Update profiles table
-	profileUpdate := map[string]interface{}{
-		"major":              req.Major,
-		"gender":             req.Gender,
-		"native_language":    req.NativeLanguage,
-		"spoken_languages":   req.SpokenLanguages,
-		"learning_languages": req.LearningLanguages,
-		"residence":          req.Residence,
-		"comment":            req.Comment,
-		"avatar_url":         req.AvatarURL,
-		"last_updated":       time.Now(),
+// UpdateUserProfile changes the fields present in the request and returns the updated
+// profile. Values must already be validated.
+func UpdateUserProfile(userID string, req models.PatchUserProfileRequest) (*models.UserProfileResponse, error) {
+	profileUpdate := map[string]interface{}{}
+	for column, value := range map[string]*string{
+		"major":      req.Major,
+		"gender":     req.Gender,
+		"residence":  req.Residence,
+		"comment":    req.Comment,
+		"avatar_url": req.AvatarURL,
+	} {
+		if value != nil {
+			profileUpdate[column] = *value
+		}
 	}
-
-	var profileResults []map[string]interface{}
-	err := Supabase.DB.From("profiles").Update(profileUpdate).Eq("user_id", userID).Execute(&profileResults)
-	if err != nil {
-		return nil, err
+	if req.NativeLanguage != nil {
+		// 未設定の母語は NULL で保存
+		var nativeLanguage interface{}
+		if *req.NativeLanguage != "" {
+			nativeLanguage = *req.NativeLanguage
+		}
+		profileUpdate["native_language"] = nativeLanguage
 	}
-
-	// Update username in users table
-	userUpdate := map[string]interface{}{
-		"username": req.Username,
+	if req.SpokenLanguages != nil {
+		profileUpdate["spoken_languages"] = nonNilStrings(*req.SpokenLanguages)
 	}
-	var userResults []map[string]interface{}
-	err = Supabase.DB.From("users").Update(userUpdate).Eq("id", userID).Execute(&userResults)
-	if err != nil {
-		return nil, err
+	if req.LearningLanguages != nil {
+		profileUpdate["learning_languages"] = nonNilStrings(*req.LearningLanguages)
 	}
-
-	// Update user_interests table
-	// First, delete existing interests for the user
-	err = Supabase.DB.From("user_interests").Delete().Eq("user_id", userID).Execute(nil)
-	if err != nil {
-		return nil, err
+	if req.LanguageSkills != nil {
+		skills := *req.LanguageSkills
+		if skills == nil {
+			skills = []models.LanguageSkill{}
+		}
+		profileUpdate["language_skills"] = skills
 	}
 
-	// Then, insert new interests
-	var userInterests []map[string]interface{}
-	for _, interestID := range req.InterestIDs {
-		userInterests = append(userInterests, map[string]interface{}{
-			"user_id":          userID,
-			"interest_id":      interestID,
-			"preference_level": 3, // Default preference level
-		})
+	if req.Username != nil {
+		var userResults []map[string]interface{}
+		err := Supabase.DB.From("users").
+			Update(map[string]interface{}{"username": *req.Username}).
+			Eq("id", userID).
+			Execute(&userResults)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if req.Interests != nil {
+		if err := setUserInterests(userID, *req.Interests); err != nil {
+			return nil, err
+		}
 	}
 
-	if len(userInterests) > 0 {
-		err = Supabase.DB.From("user_interests").Insert(userInterests).Execute(nil)
+	// Interests are part of the profile: changing them counts as an update too
+	if len(profileUpdate) > 0 || req.Interests != nil {
+		profileUpdate["last_updated"] = time.Now()
+		var profileResults []map[string]interface{}
+		err := Supabase.DB.From("profiles").Update(profileUpdate).Eq("user_id", userID).Execute(&profileResults)
 		if err != nil {
 			return nil, err
 		}
@@ -165,28 +183,104 @@ func UpdateUserProfile(userID string, req models.UpdateUserProfileRequest) (*mod
 	return GetUserByID(userID)
 }
 
-func SearchUsers(interestID int, learningLanguage, spokenLanguage string) ([]models.User, error) {
-	query := Supabase.DB.From("users").Select("*, profiles(*), user_interests(*, interests(*))")
+// SetOnboardingState saves how far the user got in onboarding
+func SetOnboardingState(userID, state string) error {
+	var results []map[string]interface{}
+	err := Supabase.DB.From("profiles").
+		Update(map[string]interface{}{"onboarding_state": state}).
+		Eq("user_id", userID).
+		Execute(&results)
+	if err != nil {
+		return fmt.Errorf("failed to save onboarding state of user %s: %v", userID, err)
+	}
+	return nil
+}
 
-	if interestID != 0 {
-		query.Filter("user_interests.interest_id", "eq", strconv.Itoa(interestID))
+// setUserInterests replaces the user's interests, touching only the rows that change.
+// A PreferenceLevel of 0 keeps the current level, or uses the default for a new interest.
+func setUserInterests(userID string, interests []models.InterestPreference) error {
+	var rows []struct {
+		InterestID      int  `json:"interest_id"`
+		PreferenceLevel *int `json:"preference_level"`
+	}
+	err := Supabase.DB.From("user_interests").
+		Select("interest_id, preference_level").
+		Eq("user_id", userID).
+		Execute(&rows)
+	if err != nil {
+		return fmt.Errorf("failed to get interests of user %s: %v", userID, err)
+	}
+	current := make(map[int]*int, len(rows))
+	for _, row := range rows {
+		current[row.InterestID] = row.PreferenceLevel
+	}
+
+	keep := make(map[int]bool, len(interests))
+	var upserts []map[string]interface{}
+	for _, interest := range interests {
+		keep[interest.ID] = true
+		level, had := current[interest.ID]
+		switch {
+		case interest.PreferenceLevel == 0 && had:
+			continue
+		case interest.PreferenceLevel == 0:
+			interest.PreferenceLevel = models.DefaultPreferenceLevel
+		case had && level != nil && *level == interest.PreferenceLevel:
+			continue
+		}
+		upserts = append(upserts, map[string]interface{}{
+			"user_id":          userID,
+			"interest_id":      interest.ID,
+			"preference_level": interest.PreferenceLevel,
+		})
+	}
+	var removed []string
+	for id := range current {
+		if !keep[id] {
+			removed = append(removed, strconv.Itoa(id))
+		}
 	}
 
-	if learningLanguage != "" {
-		query.Filter("profiles.learning_languages", "cs", fmt.Sprintf("{%s}", learningLanguage))
+	if len(removed) > 0 {
+		var results []map[string]interface{}
+		err := Supabase.DB.From("user_interests").
+			Delete().
+			Eq("user_id", userID).
+			In("interest_id", removed).
+			Execute(&results)
+		if err != nil {
+			return fmt.Errorf("failed to remove interests of user %s: %v", userID, err)
+		}
+	}
+	if len(upserts) > 0 {
+		// (user_id, interest_id) が主キーなので、既存の行はレベルだけ更新される
+		var results []map[string]interface{}
+		if err := Supabase.DB.From("user_interests").Upsert(upserts).Execute(&results); err != nil {
+			return fmt.Errorf("failed to save interests of user %s: %v", userID, err)
+		}
 	}
+	return nil
+}
 
-	if spokenLanguage != "" {
-		query.Filter("profiles.spoken_languages", "cs", fmt.Sprintf("{%s}", spokenLanguage))
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
 	}
+	return values
+}
 
-	var users []models.User
-	err := query.Execute(&users)
+// IsUsernameTaken reports whether a user other than userID has the username
+func IsUsernameTaken(username, userID string) (bool, error) {
+	var results []map[string]interface{}
+	err := Supabase.DB.From("users").
+		Select("id").
+		Eq("username", username).
+		Neq("id", userID).
+		Execute(&results)
 	if err != nil {
-		return nil, err
+		return false, fmt.Errorf("failed to check username: %v", err)
 	}
-
-	return users, nil
+	return len(results) > 0, nil
 }
 
 func GetUserProfile(userID string) (*models.User, error) {
@@ -262,155 +356,158 @@ func GetUserProfile(userID string) (*models.User, error) {
 	return &user, nil
 }
 
-// GetInterests returns the list of available interests (master data).
+// GetInterests returns the list of available interests (master data) with their
+// localized names, category and parent.
 func GetInterests() ([]models.Interest, error) {
 	var interests []models.Interest
-	err := Supabase.DB.From("interests").Select("id, name, category").Execute(&interests)
+	err := Supabase.DB.From("interests").
+		Select("id, name, names, category, category_id, parent_id").
+		OrderBy("id", "asc").
+		Execute(&interests)
 	if err != nil {
 		return nil, err
 	}
 	return interests, nil
 }
 
-// GetUserChats returns all chat rooms that a user is participating in
-func GetUserChats(userID string) ([]models.Chat, error) {
-	log.Printf("GetUserChats: fetching chats for user %s", userID)
-
-	// Optimized: Get chat IDs directly from chats table where user is participant
-	// Since we can't use OR in supabase-go, we'll get chats where user1_id = userID, then user2_id = userID
-	var chatIDs1 []map[string]interface{}
-	err1 := Supabase.DB.From("chats").
-		Select("id").
-		Eq("user1_id", userID).
-		Execute(&chatIDs1)
-
-	var chatIDs2 []map[string]interface{}
-	err2 := Supabase.DB.From("chats").
-		Select("id").
-		Eq("user2_id", userID).
-		Execute(&chatIDs2)
-
-	// Combine chat IDs
-	userChatIDs := make(map[int64]bool)
-	if err1 == nil {
-		for _, chatIDMap := range chatIDs1 {
-			if idFloat, ok := chatIDMap["id"].(float64); ok {
-				userChatIDs[int64(idFloat)] = true
-			}
-		}
-	}
-	if err2 == nil {
-		for _, chatIDMap := range chatIDs2 {
-			if idFloat, ok := chatIDMap["id"].(float64); ok {
-				userChatIDs[int64(idFloat)] = true
-			}
-		}
+// GetInterestCategories returns the interest categories in display order
+func GetInterestCategories() ([]models.InterestCategory, error) {
+	var categories []models.InterestCategory
+	err := Supabase.DB.From("interest_categories").
+		Select("id, slug, name, names, sort_order").
+		OrderBy("sort_order", "asc").
+		Execute(&categories)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get interest categories: %v", err)
 	}
+	return categories, nil
+}
 
-	log.Printf("GetUserChats: found %d chat(s) for user %s", len(userChatIDs), userID)
-
-	if len(userChatIDs) == 0 {
-		return []models.Chat{}, nil
+// GetInterestDescendants maps each interest to its sub-interests at any depth, for
+// searches on a parent interest.
+func GetInterestDescendants() (map[int][]int, error) {
+	interests, err := GetInterests()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get interests: %v", err)
 	}
+	return models.InterestDescendants(interests), nil
+}
 
-	// Build chat list from the chat IDs we found
-	// Try to get user1_id and user2_id together first (may fail due to supabase-go issue)
-	chatMap := make(map[int64]models.Chat)
-	for chatID := range userChatIDs {
-		chat := models.Chat{
-			ID: chatID,
-		}
-
-		// Try to get both user1_id and user2_id together
-		var chatUserInfo []map[string]interface{}
-		err := Supabase.DB.From("chats").
-			Select("user1_id, user2_id").
-			Eq("id", strconv.FormatInt(chatID, 10)).
-			Execute(&chatUserInfo)
-
-		if err == nil && len(chatUserInfo) > 0 {
-			// Successfully got both fields together
-			chat.User1ID, _ = chatUserInfo[0]["user1_id"].(string)
-			chat.User2ID, _ = chatUserInfo[0]["user2_id"].(string)
-		} else {
-			// Fallback: get each field separately
-			var user1Results []map[string]interface{}
-			err1 := Supabase.DB.From("chats").
-				Select("user1_id").
-				Eq("id", strconv.FormatInt(chatID, 10)).
-				Execute(&user1Results)
-			if err1 == nil && len(user1Results) > 0 {
-				chat.User1ID, _ = user1Results[0]["user1_id"].(string)
-			}
-
-			var user2Results []map[string]interface{}
-			err2 := Supabase.DB.From("chats").
-				Select("user2_id").
-				Eq("id", strconv.FormatInt(chatID, 10)).
-				Execute(&user2Results)
-			if err2 == nil && len(user2Results) > 0 {
-				chat.User2ID, _ = user2Results[0]["user2_id"].(string)
-			}
-		}
-
-		chatMap[chat.ID] = chat
-	}
+// Archived chat filters for ListUserChats
+const (
+	ChatsUnarchived   = "exclude"
+	ChatsArchivedOnly = "only"
+	ChatsAll          = "all"
+)
 
-	log.Printf("GetUserChats: built %d chat(s) for user %s", len(chatMap), userID)
+// ChatCursor is the position after the last chat of a page. Chats are ordered by pinned,
+// then last activity (the last message, or creation for chats without messages), then ID,
+// all descending.
+type ChatCursor struct {
+	Pinned     bool      `json:"p"`
+	ActivityAt time.Time `json:"t"`
+	ID         int64     `json:"id"`
+}
 
-	// Convert map to slice
-	var chats []models.Chat
-	for _, chat := range chatMap {
-		chats = append(chats, chat)
+// CursorAfter returns the cursor that continues the chat list after chat
+func CursorAfter(chat models.Chat) ChatCursor {
+	activity := chat.CreatedAt
+	if chat.LastMessageAt != nil {
+		activity = *chat.LastMessageAt
 	}
+	return ChatCursor{Pinned: chat.Settings.Pinned, ActivityAt: activity, ID: chat.ID}
+}
 
-	// Sort chats by ID descending (most recent first) - created_at is not available
-	sort.Slice(chats, func(i, j int) bool {
-		return chats[i].ID > chats[j].ID
-	})
+// ChatListOptions selects a page of a user's chat list
+type ChatListOptions struct {
+	// Archived is ChatsUnarchived (the default), ChatsArchivedOnly or ChatsAll
+	Archived string
+	// Cursor is where the previous page ended; nil for the first page
+	Cursor *ChatCursor
+	// Limit is the maximum number of chats; 0 returns every chat
+	Limit int
+}
 
-	// Populate additional info for each chat (optimized: use GetLastChatMessage directly)
-	for i := range chats {
-		chat := &chats[i]
-		// Determine the other user ID
-		var otherUserID string
-		if chat.User1ID == userID {
-			otherUserID = chat.User2ID
-		} else {
-			otherUserID = chat.User1ID
-		}
+// chatListRow is a row returned by the get_user_chats function
+type chatListRow struct {
+	ID               int64           `json:"id"`
+	Kind             string          `json:"kind"`
+	User1ID          *string         `json:"user1_id"`
+	User2ID          *string         `json:"user2_id"`
+	Title            *string         `json:"title"`
+	EventID          *int64          `json:"event_id"`
+	MemberCount      int             `json:"member_count"`
+	AISuggestedTheme *string         `json:"ai_suggested_theme"`
+	CreatedAt        time.Time       `json:"created_at"`
+	LastMessageAt    *time.Time      `json:"last_message_at"`
+	OtherUser        *models.User    `json:"other_user"`
+	LastMessage      *models.Message `json:"last_message"`
+	UnreadCount      int             `json:"unread_count"`
+	MutedUntil       *time.Time      `json:"muted_until"`
+	Archived         bool            `json:"archived"`
+	Pinned           bool            `json:"pinned"`
+}
 
-		// Get the other user's basic info (エラーが発生しても続行)
-		if otherUserID != "" {
-			otherUser, err := GetUserProfile(otherUserID)
-			if err != nil {
-				log.Printf("error getting other user profile for user %s: %v", otherUserID, err)
-				// Create a minimal user object with just the ID
-				chat.OtherUser = &models.User{
-					ID:       otherUserID,
-					Username: otherUserID, // Fallback to ID if username unavailable
-				}
-			} else {
-				chat.OtherUser = otherUser
-			}
-		}
+func (r chatListRow) toModel() models.Chat {
+	chat := models.Chat{
+		ID:            r.ID,
+		Kind:          r.Kind,
+		User1ID:       derefString(r.User1ID),
+		User2ID:       derefString(r.User2ID),
+		Title:         derefString(r.Title),
+		EventID:       r.EventID,
+		MemberCount:   r.MemberCount,
+		CreatedAt:     r.CreatedAt,
+		LastMessageAt: r.LastMessageAt,
+		OtherUser:     r.OtherUser,
+		LastMessage:   r.LastMessage,
+		UnreadCount:   r.UnreadCount,
+		Settings:      models.ChatSettings{MutedUntil: r.MutedUntil, Archived: r.Archived, Pinned: r.Pinned},
+	}
+	if r.AISuggestedTheme != nil {
+		chat.AISuggestedTheme = *r.AISuggestedTheme
+	}
+	return chat
+}
 
-		// Get last message using optimized GetLastChatMessage function
-		lastMsg, err := GetLastChatMessage(chat.ID)
-		if err != nil {
-			log.Printf("error getting last message for chat %d: %v", chat.ID, err)
-		} else if lastMsg != nil {
-			chat.LastMessage = lastMsg
-		}
+// ListUserChats returns the user's chat list with the other user's summary, the last message,
+// the unread count and the user's settings in a single request. The get_user_chats function
+// (see docs/DATABASE.md) does the aggregation in Postgres.
+func ListUserChats(userID string, opts ChatListOptions) ([]models.Chat, error) {
+	archived := opts.Archived
+	if archived == "" {
+		archived = ChatsUnarchived
 	}
-
-	if len(chats) == 0 {
-		return []models.Chat{}, nil
+	params := map[string]interface{}{
+		"p_user_id":  userID,
+		"p_archived": archived,
+	}
+	if opts.Cursor != nil {
+		params["p_cursor_pinned"] = opts.Cursor.Pinned
+		params["p_cursor_activity"] = opts.Cursor.ActivityAt.UTC().Format(time.RFC3339Nano)
+		params["p_cursor_id"] = opts.Cursor.ID
+	}
+	if opts.Limit > 0 {
+		params["p_limit"] = opts.Limit
 	}
 
+	var rows []chatListRow
+	if err := Supabase.DB.Rpc("get_user_chats", params).Execute(&rows); err != nil {
+		return nil, fmt.Errorf("failed to get chats of user %s: %v", userID, err)
+	}
+	chats := make([]models.Chat, 0, len(rows))
+	for _, row := range rows {
+		chats = append(chats, row.toModel())
+	}
 	return chats, nil
 }
 
+// GetUserChats returns all chat rooms that a user is participating in, archived ones included,
+// pinned first and then by last activity
+func GetUserChats(userID string) ([]models.Chat, error) {
+	return ListUserChats(userID, ChatListOptions{Archived: ChatsAll})
+}
+
 // containsIgnoreCase checks if a string contains a substring (case-insensitive)
 func containsIgnoreCase(s, substr string) bool {
 	s = strings.ToLower(s)
@@ -579,7 +676,7 @@ func GetChatMessages(chatID int64) ([]models.Message, error) {
 	// Try to get all messages at once with all fields
 	var messages []models.Message
 	err = Supabase.DB.From("messages").
-		Select("id, chat_id, sender_id, content, message_type, sent_at").
+		Select("id, chat_id, sender_id, content, message_type, meetup_id, sent_at").
 		Eq("chat_id", strconv.FormatInt(chatID, 10)).
 		Execute(&messages)
 
@@ -660,742 +757,2113 @@ func GetChatMessages(chatID int64) ([]models.Message, error) {
 		return messages[i].SentAt.Before(messages[j].SentAt)
 	})
 
+	// Meetup messages show their proposal as it is now
+	if err := attachMeetups(messages); err != nil {
+		log.Printf("GetChatMessages: failed to load meetups for chat %d: %v", chatID, err)
+	}
+
 	return messages, nil
 }
 
-// SearchUserResult represents a single user in search results
-type SearchUserResult struct {
-	UserID         string         `json:"user_id"`
-	Username       string         `json:"username"`
-	Comment        string         `json:"comment"`
-	Residence      string         `json:"residence"`
-	AvatarURL      *string        `json:"avatar_url"`      // NULLの可能性があるためポインタ型
-	NativeLanguage *string        `json:"native_language"` // NULLの可能性があるためポインタ型（言語コード: "ja", "en", "ko"など）
-	Interests      []InterestItem `json:"interests"`
-}
-
-// InterestItem represents an interest/hobby item
-type InterestItem struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
-}
-
-// SearchUsersAdvanced filters users based on keyword, languages, and countries
-// Returns users (excluding current user) whose profile matches the specified criteria:
-//   - keyword: partial match in username (optional)
-//   - languages: users who have any of the specified languages in their profile
-//     (checks native_language, spoken_languages, or learning_languages)
-//   - countries: users who have any of the specified countries in their residence field
-//
-// Excludes the current user from results
-func SearchUsersAdvanced(currentUserID string, keyword string, languages []string, countries []string) ([]SearchUserResult, error) {
-	log.Printf("SearchUsersAdvanced: currentUserID=%s, keyword=%s, languages=%v, countries=%v",
-		currentUserID, keyword, languages, countries)
-
-	// まず、ユーザーIDだけを取得（これは動作する）
-	var userIDs []map[string]interface{}
-	err := Supabase.DB.From("users").
-		Select("id").
-		Neq("id", currentUserID).
-		Execute(&userIDs)
+// IsChatParticipant checks if a user is a participant in a chat room
+func IsChatParticipant(chatID int64, userID string) (bool, error) {
+	member, err := GetChatMember(chatID, userID)
 	if err != nil {
-		errStr := err.Error()
-		log.Printf("SearchUsersAdvanced: error executing basic query: %v", err)
-
-		// unexpected end of JSON input エラーの場合は空の結果を返す
-		if containsIgnoreCase(errStr, "unexpected end of json") ||
-			containsIgnoreCase(errStr, "invalid character") ||
-			containsIgnoreCase(errStr, "not found") ||
-			containsIgnoreCase(errStr, "no rows") {
-			log.Printf("SearchUsersAdvanced: query returned empty or invalid result, returning empty array")
-			return []SearchUserResult{}, nil
-		}
-
-		return nil, fmt.Errorf("failed to search users: %v", err)
+		return false, err
 	}
+	return member != nil, nil
+}
 
-	log.Printf("SearchUsersAdvanced: found %d user IDs", len(userIDs))
-
-	// フィルター条件の有無を確認
-	hasFilters := keyword != "" || len(languages) > 0 || len(countries) > 0
-	log.Printf("SearchUsersAdvanced: hasFilters=%v (keyword=%q, languages=%v, countries=%v)",
-		hasFilters, keyword, languages, countries)
+// chatColumns are the chats columns read into chatRow
+const chatColumns = "id, kind, user1_id, user2_id, title, event_id, ai_suggested_theme, created_at, last_message_at"
+
+// chatRow is a chats row as read from Supabase
+type chatRow struct {
+	ID               int64      `json:"id"`
+	Kind             string     `json:"kind"`
+	User1ID          *string    `json:"user1_id"`
+	User2ID          *string    `json:"user2_id"`
+	Title            *string    `json:"title"`
+	EventID          *int64     `json:"event_id"`
+	AISuggestedTheme *string    `json:"ai_suggested_theme"`
+	CreatedAt        time.Time  `json:"created_at"`
+	LastMessageAt    *time.Time `json:"last_message_at"`
+}
 
-	// 結果をパースしてフィルタリング（並列処理で高速化）
-	var searchResults []SearchUserResult
-	var mu sync.Mutex
-	var wg sync.WaitGroup
+func (r chatRow) toModel() models.Chat {
+	chat := models.Chat{
+		ID:               r.ID,
+		Kind:             r.Kind,
+		User1ID:          derefString(r.User1ID),
+		User2ID:          derefString(r.User2ID),
+		Title:            derefString(r.Title),
+		EventID:          r.EventID,
+		AISuggestedTheme: derefString(r.AISuggestedTheme),
+		CreatedAt:        r.CreatedAt,
+		LastMessageAt:    r.LastMessageAt,
+	}
+	if chat.Kind == "" {
+		chat.Kind = models.ChatDirect
+	}
+	return chat
+}
 
-	// 並列処理の最大数（同時実行数を制限してDBへの負荷を軽減）
-	maxWorkers := 10
-	semaphore := make(chan struct{}, maxWorkers)
+// GetChat returns a chat room without user-specific fields, or nil if it doesn't exist
+func GetChat(chatID int64) (*models.Chat, error) {
+	var rows []chatRow
+	err := Supabase.DB.From("chats").
+		Select(chatColumns).
+		Eq("id", strconv.FormatInt(chatID, 10)).
+		Execute(&rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat %d: %v", chatID, err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	chat := rows[0].toModel()
+	return &chat, nil
+}
 
-	for _, userIDMap := range userIDs {
-		wg.Add(1)
-		semaphore <- struct{}{} // セマフォを取得
+// GetChatDetail returns detailed information about a specific chat room: the other user
+// of a direct chat, or the member count of a group or event room
+func GetChatDetail(chatID int64, userID string) (*models.Chat, error) {
+	chat, err := GetChat(chatID)
+	if err != nil {
+		return nil, err
+	}
+	if chat == nil {
+		return nil, fmt.Errorf("chat %d not found", chatID)
+	}
 
-		go func(userIDMap map[string]interface{}) {
-			defer wg.Done()
-			defer func() { <-semaphore }() // セマフォを解放
+	// Verify that the user is a participant in this chat
+	participants, err := GetChatParticipants(chatID)
+	if err != nil {
+		return nil, err
+	}
+	isParticipant := false
+	for _, id := range participants {
+		isParticipant = isParticipant || id == userID
+	}
+	if !isParticipant {
+		return nil, fmt.Errorf("user %s is not a participant in chat %d", userID, chatID)
+	}
+	chat.MemberCount = len(participants)
 
-			// エラーが発生した場合はログを出力してスキップ
-			defer func() {
-				if r := recover(); r != nil {
-					log.Printf("SearchUsersAdvanced: panic in goroutine: %v", r)
+	if chat.Kind == models.ChatDirect {
+		otherUserID := chat.User1ID
+		if otherUserID == userID {
+			otherUserID = chat.User2ID
+		}
+		if otherUserID != "" {
+			otherUser, err := GetUserProfile(otherUserID)
+			if err != nil {
+				log.Printf("error getting other user profile for user %s: %v", otherUserID, err)
+				// Create a minimal user object with just the ID
+				chat.OtherUser = &models.User{
+					ID:       otherUserID,
+					Username: otherUserID, // Fallback to ID if username unavailable
 				}
-			}()
-
-			// IDを取得（string型として扱う）
-			userID := ""
-			if idStr, ok := userIDMap["id"].(string); ok {
-				userID = idStr
-			} else if idFloat, ok := userIDMap["id"].(float64); ok {
-				// float64の場合は文字列に変換を試みる（通常は発生しないが念のため）
-				userID = strconv.FormatFloat(idFloat, 'f', -1, 64)
+			} else {
+				chat.OtherUser = otherUser
 			}
+		}
+	}
 
-			if userID == "" {
-				return
-			}
+	// Get last message
+	lastMsg, err := GetLastChatMessage(chatID)
+	if err != nil {
+		log.Printf("error getting last message for chat %d: %v", chatID, err)
+	} else if lastMsg != nil {
+		chat.LastMessage = lastMsg
+	}
 
-			// usernameを個別に取得
-			var usernameResults []map[string]interface{}
-			err2 := Supabase.DB.From("users").
-				Select("username").
-				Eq("id", userID).
-				Execute(&usernameResults)
-
-			// エラーハンドリング: unexpected end of JSON input エラーは無視して続行
-			if err2 != nil {
-				errStr := err2.Error()
-				if !containsIgnoreCase(errStr, "unexpected end of json") &&
-					!containsIgnoreCase(errStr, "invalid character") {
-					log.Printf("SearchUsersAdvanced: error getting username for user %s: %v", userID, err2)
-				}
-			}
+	settings, err := GetChatSettings(chatID, userID)
+	if err != nil {
+		log.Printf("error getting settings of chat %d for user %s: %v", chatID, userID, err)
+	} else {
+		chat.Settings = settings
+	}
 
-			username := userID // フォールバック
-			if err2 == nil && len(usernameResults) > 0 {
-				if u, ok := usernameResults[0]["username"].(string); ok && u != "" {
-					username = u
-				}
-			}
+	return chat, nil
+}
 
-			// キーワードフィルタ（ユーザー名で部分一致）
-			if keyword != "" {
-				if !containsIgnoreCase(username, keyword) {
-					return
-				}
-			}
+// GetOrCreateChat finds an existing chat between two users or creates a new one
+// Returns the chat ID and whether the chat was created by this call
+func GetOrCreateChat(user1ID, user2ID string) (int64, bool, error) {
+	log.Printf("GetOrCreateChat: finding or creating chat between %s and %s", user1ID, user2ID)
 
-			// 言語または国のフィルタがある場合、プロフィール情報を取得する必要がある
-			needProfileInfo := len(languages) > 0 || len(countries) > 0
-
-			profileData := make(map[string]interface{})
-			if needProfileInfo {
-				// プロフィール情報を個別フィールドで取得（複数フィールドの同時取得が失敗するため）
-				// フィルタリングに必要なフィールドのみを先に取得
-
-				// native_language（言語フィルタに必要）
-				if len(languages) > 0 {
-					var nativeLangResults []map[string]interface{}
-					err6 := Supabase.DB.From("profiles").
-						Select("native_language").
-						Eq("user_id", userID).
-						Execute(&nativeLangResults)
-					// unexpected end of JSON input エラーは無視（プロフィールが存在しない場合）
-					if err6 != nil {
-						errStr := err6.Error()
-						if !containsIgnoreCase(errStr, "unexpected end of json") &&
-							!containsIgnoreCase(errStr, "invalid character") {
-							log.Printf("SearchUsersAdvanced: error getting native_language for user %s: %v", userID, err6)
-						}
-					} else if len(nativeLangResults) > 0 {
-						profileData["native_language"], _ = nativeLangResults[0]["native_language"].(string)
-					}
+	// Ensure user1ID < user2ID for consistent ordering (to match unique index)
+	// The unique index uses LEAST(user1_id, user2_id) and GREATEST(user1_id, user2_id)
+	// So we need to check both orders: user1-user2 and user2-user1
+	var existingChatID int64
+	found := false
 
-					// spoken_languages（言語フィルタに必要）
-					var spokenLangResults []map[string]interface{}
-					err7 := Supabase.DB.From("profiles").
-						Select("spoken_languages").
-						Eq("user_id", userID).
-						Execute(&spokenLangResults)
-					if err7 != nil {
-						errStr := err7.Error()
-						if !containsIgnoreCase(errStr, "unexpected end of json") &&
-							!containsIgnoreCase(errStr, "invalid character") {
-							log.Printf("SearchUsersAdvanced: error getting spoken_languages for user %s: %v", userID, err7)
-						}
-					} else if len(spokenLangResults) > 0 {
-						profileData["spoken_languages"] = spokenLangResults[0]["spoken_languages"]
-					}
+	// Try to find existing chat: user1_id = user1ID and user2_id = user2ID
+	var results1 []map[string]interface{}
+	err1 := Supabase.DB.From("chats").
+		Select("id").
+		Eq("user1_id", user1ID).
+		Eq("user2_id", user2ID).
+		Execute(&results1)
 
-					// learning_languages（言語フィルタに必要）
-					var learningLangResults []map[string]interface{}
-					err8 := Supabase.DB.From("profiles").
-						Select("learning_languages").
-						Eq("user_id", userID).
-						Execute(&learningLangResults)
-					if err8 != nil {
-						errStr := err8.Error()
-						if !containsIgnoreCase(errStr, "unexpected end of json") &&
-							!containsIgnoreCase(errStr, "invalid character") {
-							log.Printf("SearchUsersAdvanced: error getting learning_languages for user %s: %v", userID, err8)
-						}
-					} else if len(learningLangResults) > 0 {
-						profileData["learning_languages"] = learningLangResults[0]["learning_languages"]
-					}
-				}
+	if err1 == nil && len(results1) > 0 {
+		if idFloat, ok := results1[0]["id"].(float64); ok {
+			existingChatID = int64(idFloat)
+			found = true
+			log.Printf("GetOrCreateChat: found existing chat %d (user1=%s, user2=%s)", existingChatID, user1ID, user2ID)
+		}
+	}
 
-				// residence（国フィルタに必要、または言語フィルタのみの場合でもレスポンスに含めるため取得）
-				// フロントエンドで国旗表示のために必要
-				var residenceResults []map[string]interface{}
-				err4 := Supabase.DB.From("profiles").
-					Select("residence").
-					Eq("user_id", userID).
-					Execute(&residenceResults)
-				if err4 != nil {
-					errStr := err4.Error()
-					if !containsIgnoreCase(errStr, "unexpected end of json") &&
-						!containsIgnoreCase(errStr, "invalid character") {
-						log.Printf("SearchUsersAdvanced: error getting residence for user %s: %v", userID, err4)
-					} else {
-						// residenceが存在しない場合の警告ログ（デバッグ用）
-						log.Printf("SearchUsersAdvanced: warning - residence not found for user %s", userID)
-					}
-				} else if len(residenceResults) > 0 {
-					profileData["residence"], _ = residenceResults[0]["residence"].(string)
-				} else {
-					// residenceが存在しない場合の警告ログ（デバッグ用）
-					log.Printf("SearchUsersAdvanced: warning - residence not found for user %s", userID)
-				}
+	// Try to find existing chat: user1_id = user2ID and user2_id = user1ID
+	if !found {
+		var results2 []map[string]interface{}
+		err2 := Supabase.DB.From("chats").
+			Select("id").
+			Eq("user1_id", user2ID).
+			Eq("user2_id", user1ID).
+			Execute(&results2)
+
+		if err2 == nil && len(results2) > 0 {
+			if idFloat, ok := results2[0]["id"].(float64); ok {
+				existingChatID = int64(idFloat)
+				found = true
+				log.Printf("GetOrCreateChat: found existing chat %d (user1=%s, user2=%s)", existingChatID, user2ID, user1ID)
 			}
+		}
+	}
 
-			// 言語フィルタ
-			if len(languages) > 0 {
-				matched := false
-				nativeLang, _ := profileData["native_language"].(string)
-				spokenLangsRaw := profileData["spoken_languages"]
-				learningLangsRaw := profileData["learning_languages"]
-
-				// 配列の型変換を安全に行う
-				var spokenLangs []interface{}
-				if spokenLangsRaw != nil {
-					if arr, ok := spokenLangsRaw.([]interface{}); ok {
-						spokenLangs = arr
-					} else if str, ok := spokenLangsRaw.(string); ok {
-						// JSON文字列の場合、パースを試みる
-						var parsed []interface{}
-						if err := json.Unmarshal([]byte(str), &parsed); err == nil {
-							spokenLangs = parsed
-						}
-					}
-				}
+	// If chat exists, return it
+	if found {
+		return existingChatID, false, nil
+	}
 
-				var learningLangs []interface{}
-				if learningLangsRaw != nil {
-					if arr, ok := learningLangsRaw.([]interface{}); ok {
-						learningLangs = arr
-					} else if str, ok := learningLangsRaw.(string); ok {
-						// JSON文字列の場合、パースを試みる
-						var parsed []interface{}
-						if err := json.Unmarshal([]byte(str), &parsed); err == nil {
-							learningLangs = parsed
-						}
-					}
-				}
+	// Chat doesn't exist, create a new one
+	log.Printf("GetOrCreateChat: no existing chat found, creating new chat")
+	chatData := map[string]interface{}{
+		"user1_id": user1ID,
+		"user2_id": user2ID,
+	}
 
-				for _, lang := range languages {
-					// native_language, spoken_languages, learning_languages のいずれかに一致
-					if containsIgnoreCase(nativeLang, lang) {
-						matched = true
-						break
-					}
-					for _, spoken := range spokenLangs {
-						if spokenStr, ok := spoken.(string); ok && containsIgnoreCase(spokenStr, lang) {
-							matched = true
-							break
-						}
-					}
-					if matched {
-						break
-					}
-					for _, learning := range learningLangs {
-						if learningStr, ok := learning.(string); ok && containsIgnoreCase(learningStr, lang) {
-							matched = true
-							break
-						}
-					}
-					if matched {
-						break
-					}
+	var insertResults []map[string]interface{}
+	err := Supabase.DB.From("chats").Insert(chatData).Execute(&insertResults)
+	if err != nil {
+		errStr := err.Error()
+		// Check if it's a duplicate key error (race condition - another request created it)
+		if containsIgnoreCase(errStr, "duplicate key") || containsIgnoreCase(errStr, "unique constraint") {
+			log.Printf("GetOrCreateChat: chat was created by another request, retrying to find it")
+			// Retry finding the chat
+			var retryResults []map[string]interface{}
+			err1 := Supabase.DB.From("chats").
+				Select("id").
+				Eq("user1_id", user1ID).
+				Eq("user2_id", user2ID).
+				Execute(&retryResults)
+			if err1 == nil && len(retryResults) > 0 {
+				if idFloat, ok := retryResults[0]["id"].(float64); ok {
+					return int64(idFloat), false, nil
 				}
-				if !matched {
-					return
+			}
+			// Try reverse order
+			err2 := Supabase.DB.From("chats").
+				Select("id").
+				Eq("user1_id", user2ID).
+				Eq("user2_id", user1ID).
+				Execute(&retryResults)
+			if err2 == nil && len(retryResults) > 0 {
+				if idFloat, ok := retryResults[0]["id"].(float64); ok {
+					return int64(idFloat), false, nil
 				}
 			}
+		}
+		return 0, false, fmt.Errorf("failed to create chat: %v", err)
+	}
 
-			// 国フィルタ（residence）
-			// 注意: フロントエンドからは英語の国コード（ISO 3166-1 alpha-2）が送られてくる
-			// 例: "CN"（中国）, "US"（アメリカ）, "JP"（日本）
-			// データベースのresidenceフィールドも同じ形式で保存されていることを想定
-			if len(countries) > 0 {
-				matched := false
-				residence, _ := profileData["residence"].(string)
-				if residence == "" {
-					// residenceが取得できなかった場合は、このユーザーはマッチしない
-					return
-				}
-				for _, country := range countries {
-					// 大文字小文字を区別せずに比較（国コードは通常大文字だが、念のため）
-					if strings.EqualFold(residence, country) {
-						matched = true
-						break
-					}
-				}
-				if !matched {
-					return
-				}
+	if len(insertResults) == 0 {
+		return 0, false, fmt.Errorf("chat creation succeeded but no ID returned")
+	}
+
+	// Extract the created chat ID
+	if idFloat, ok := insertResults[0]["id"].(float64); ok {
+		newChatID := int64(idFloat)
+		log.Printf("GetOrCreateChat: created new chat %d", newChatID)
+		return newChatID, true, nil
+	}
+
+	return 0, false, fmt.Errorf("chat creation succeeded but could not extract ID from response")
+}
+
+// GetChatParticipants returns the IDs of the users in a chat room, in the order they joined
+func GetChatParticipants(chatID int64) ([]string, error) {
+	var rows []struct {
+		UserID string `json:"user_id"`
+	}
+	err := Supabase.DB.From("chat_participants").
+		Select("user_id").
+		OrderBy("joined_at", "asc").
+		Eq("chat_id", strconv.FormatInt(chatID, 10)).
+		Execute(&rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get participants of chat %d: %v", chatID, err)
+	}
+	participants := make([]string, 0, len(rows))
+	for _, row := range rows {
+		participants = append(participants, row.UserID)
+	}
+	return participants, nil
+}
+
+// chatMemberColumns selects a chat_participants row with the member's name and avatar
+const chatMemberColumns = "user_id, role, joined_at, users(username, profiles(avatar_url))"
+
+// chatMemberRow is a chat_participants row as read from Supabase
+type chatMemberRow struct {
+	UserID   string    `json:"user_id"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+	User     *struct {
+		Username string `json:"username"`
+		Profile  *struct {
+			AvatarURL *string `json:"avatar_url"`
+		} `json:"profiles"`
+	} `json:"users"`
+}
+
+func (r chatMemberRow) toModel() models.ChatMember {
+	member := models.ChatMember{UserID: r.UserID, Role: r.Role, JoinedAt: r.JoinedAt}
+	if r.User != nil {
+		member.Username = r.User.Username
+		if r.User.Profile != nil {
+			member.AvatarURL = derefString(r.User.Profile.AvatarURL)
+		}
+	}
+	return member
+}
+
+// GetChatMembers returns the members of a chat room, in the order they joined
+func GetChatMembers(chatID int64) ([]models.ChatMember, error) {
+	var rows []chatMemberRow
+	err := Supabase.DB.From("chat_participants").
+		Select(chatMemberColumns).
+		OrderBy("joined_at", "asc").
+		Eq("chat_id", strconv.FormatInt(chatID, 10)).
+		Execute(&rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members of chat %d: %v", chatID, err)
+	}
+	members := make([]models.ChatMember, 0, len(rows))
+	for _, row := range rows {
+		members = append(members, row.toModel())
+	}
+	return members, nil
+}
+
+// GetChatMember returns the user's membership of a chat room, or nil if they are not in it
+func GetChatMember(chatID int64, userID string) (*models.ChatMember, error) {
+	var rows []chatMemberRow
+	err := Supabase.DB.From("chat_participants").
+		Select(chatMemberColumns).
+		Eq("chat_id", strconv.FormatInt(chatID, 10)).
+		Eq("user_id", userID).
+		Execute(&rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get member %s of chat %d: %v", userID, chatID, err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	member := rows[0].toModel()
+	return &member, nil
+}
+
+// CreateGroupChat creates a group room owned by ownerID with memberIDs as members
+func CreateGroupChat(ownerID, title string, memberIDs []string) (*models.Chat, error) {
+	chatData := map[string]interface{}{
+		"kind":       models.ChatGroup,
+		"title":      title,
+		"created_by": ownerID,
+	}
+	var rows []chatRow
+	if err := Supabase.DB.From("chats").Insert(chatData).Execute(&rows); err != nil {
+		return nil, fmt.Errorf("failed to create group chat: %v", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("chat creation succeeded but no row returned")
+	}
+	chat := rows[0].toModel()
+
+	if _, err := AddChatMembers(chat.ID, []string{ownerID}, models.ChatRoleOwner); err != nil {
+		// 参加者のいないチャットを残さない
+		Supabase.DB.From("chats").Delete().Eq("id", strconv.FormatInt(chat.ID, 10)).Execute(nil)
+		return nil, err
+	}
+	added, err := AddChatMembers(chat.ID, memberIDs, models.ChatRoleMember)
+	if err != nil {
+		return nil, err
+	}
+	chat.MemberCount = 1 + len(added)
+	return &chat, nil
+}
+
+// GetOrCreateEventChat finds the room of an event or creates it.
+// Returns the chat ID and whether the room was created by this call
+func GetOrCreateEventChat(event models.Event) (int64, bool, error) {
+	find := func() (int64, error) {
+		var rows []chatRow
+		err := Supabase.DB.From("chats").
+			Select(chatColumns).
+			Eq("event_id", strconv.FormatInt(event.ID, 10)).
+			Execute(&rows)
+		if err != nil || len(rows) == 0 {
+			return 0, err
+		}
+		return rows[0].ID, nil
+	}
+
+	chatID, err := find()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get chat of event %d: %v", event.ID, err)
+	}
+	if chatID != 0 {
+		return chatID, false, nil
+	}
+
+	chatData := map[string]interface{}{
+		"kind":     models.ChatEvent,
+		"title":    event.Title,
+		"event_id": event.ID,
+	}
+	var rows []chatRow
+	if err := Supabase.DB.From("chats").Insert(chatData).Execute(&rows); err != nil {
+		errStr := err.Error()
+		// event_id は一意なので、同時に作成された場合は既存のルームを使う
+		if containsIgnoreCase(errStr, "duplicate key") || containsIgnoreCase(errStr, "unique constraint") {
+			if chatID, err := find(); err == nil && chatID != 0 {
+				return chatID, false, nil
 			}
+		}
+		return 0, false, fmt.Errorf("failed to create chat of event %d: %v", event.ID, err)
+	}
+	if len(rows) == 0 {
+		return 0, false, fmt.Errorf("chat creation succeeded but no row returned")
+	}
+	return rows[0].ID, true, nil
+}
 
-			// 結果を構築
-			result := SearchUserResult{
-				UserID:   userID,
-				Username: username,
+// AddChatMembers adds users to a chat room with role and returns the ones that were not
+// members yet
+func AddChatMembers(chatID int64, userIDs []string, role string) ([]string, error) {
+	var added []string
+	for _, userID := range userIDs {
+		memberData := map[string]interface{}{
+			"chat_id": chatID,
+			"user_id": userID,
+			"role":    role,
+		}
+		var results []map[string]interface{}
+		err := Supabase.DB.From("chat_participants").Insert(memberData).Execute(&results)
+		if err != nil {
+			errStr := err.Error()
+			if containsIgnoreCase(errStr, "duplicate key") || containsIgnoreCase(errStr, "unique constraint") {
+				continue
 			}
+			return added, fmt.Errorf("failed to add user %s to chat %d: %v", userID, chatID, err)
+		}
+		added = append(added, userID)
+	}
+	return added, nil
+}
 
-			// プロフィール情報を設定
-			// フィルター条件がある場合: フィルタリングに使用したプロフィール情報を設定
-			// フィルター条件がない場合: 全ユーザーを返すため、プロフィール情報も取得
-			if hasFilters {
-				// フィルター条件がある場合: フィルタリングに使用したプロフィール情報を設定
-				// residenceは言語フィルタのみの場合でもレスポンスに含める（フロントエンドで国旗表示のため）
-				if residence, ok := profileData["residence"].(string); ok && residence != "" {
-					result.Residence = residence
-				}
+// AddChatMemberUpTo adds a user to a chat room as a member unless it already has
+// maxMembers members. The count and the insert happen in one SQL function holding a lock
+// on the chat, so concurrent joins can't go over the limit. joined is false if the user
+// was already a member; full is true if the room had no space left.
+func AddChatMemberUpTo(chatID int64, userID string, maxMembers int) (joined, full bool, err error) {
+	params := map[string]interface{}{
+		"p_chat_id":     chatID,
+		"p_user_id":     userID,
+		"p_max_members": maxMembers,
+	}
+	var status string
+	if err := Supabase.DB.Rpc("add_chat_member_up_to", params).Execute(&status); err != nil {
+		return false, false, fmt.Errorf("failed to add user %s to chat %d: %v", userID, chatID, err)
+	}
+	return status == "joined", status == "full", nil
+}
 
-				// commentとavatar_urlは結果に含めるが、フィルタリングには不要なので後で取得
-				var commentResults []map[string]interface{}
-				err11 := Supabase.DB.From("profiles").
-					Select("comment").
-					Eq("user_id", userID).
-					Execute(&commentResults)
-				if err11 != nil {
-					errStr := err11.Error()
-					if !containsIgnoreCase(errStr, "unexpected end of json") &&
-						!containsIgnoreCase(errStr, "invalid character") {
-						log.Printf("SearchUsersAdvanced: error getting comment for user %s: %v", userID, err11)
-					}
-				} else if len(commentResults) > 0 {
-					result.Comment, _ = commentResults[0]["comment"].(string)
-				}
+// RemoveChatMember removes a user from a chat room. When the last owner leaves a group,
+// the member who joined first becomes the owner.
+func RemoveChatMember(chatID int64, userID string) error {
+	chatIDStr := strconv.FormatInt(chatID, 10)
+	err := Supabase.DB.From("chat_participants").
+		Delete().
+		Eq("chat_id", chatIDStr).
+		Eq("user_id", userID).
+		Execute(nil)
+	if err != nil {
+		return fmt.Errorf("failed to remove user %s from chat %d: %v", userID, chatID, err)
+	}
+	// 既読位置と設定は参加者ごとのものなので一緒に削除する
+	for _, table := range []string{"chat_reads", "chat_settings"} {
+		if err := Supabase.DB.From(table).Delete().Eq("chat_id", chatIDStr).Eq("user_id", userID).Execute(nil); err != nil {
+			log.Printf("error deleting %s of user %s in chat %d: %v", table, userID, chatID, err)
+		}
+	}
 
-				var avatarResults []map[string]interface{}
-				err12 := Supabase.DB.From("profiles").
-					Select("avatar_url").
-					Eq("user_id", userID).
-					Execute(&avatarResults)
-				if err12 != nil {
-					errStr := err12.Error()
-					if !containsIgnoreCase(errStr, "unexpected end of json") &&
-						!containsIgnoreCase(errStr, "invalid character") {
-						log.Printf("SearchUsersAdvanced: error getting avatar_url for user %s: %v", userID, err12)
-					}
-				} else if len(avatarResults) > 0 {
-					if avatarURL, ok := avatarResults[0]["avatar_url"].(string); ok && avatarURL != "" {
-						result.AvatarURL = &avatarURL
-					}
-					// avatar_urlがNULLまたは空文字列の場合は、result.AvatarURLはnilのまま（JSONではnullとして返される）
-				}
+	members, err := GetChatMembers(chatID)
+	if err != nil {
+		return err
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	for _, member := range members {
+		if member.Role == models.ChatRoleOwner {
+			return nil
+		}
+	}
+	chat, err := GetChat(chatID)
+	if err != nil || chat == nil || chat.Kind != models.ChatGroup {
+		return err
+	}
+	return SetChatMemberRole(chatID, members[0].UserID, models.ChatRoleOwner)
+}
 
-				// native_languageを取得（言語検索でフィルタリングするために必要）
-				var nativeLangResults []map[string]interface{}
-				err14 := Supabase.DB.From("profiles").
-					Select("native_language").
-					Eq("user_id", userID).
-					Execute(&nativeLangResults)
-				if err14 != nil {
-					errStr := err14.Error()
-					if !containsIgnoreCase(errStr, "unexpected end of json") &&
-						!containsIgnoreCase(errStr, "invalid character") {
-						log.Printf("SearchUsersAdvanced: error getting native_language for user %s: %v", userID, err14)
-					}
-				} else if len(nativeLangResults) > 0 {
-					if nativeLang, ok := nativeLangResults[0]["native_language"].(string); ok && nativeLang != "" {
-						// 言語コードを小文字に変換（ISO 639-1形式: "ja", "en", "ko"など）
-						nativeLangLower := strings.ToLower(strings.TrimSpace(nativeLang))
-						result.NativeLanguage = &nativeLangLower
-					}
-					// native_languageがNULLまたは空文字列の場合は、result.NativeLanguageはnilのまま（JSONではnullとして返される）
-				}
-			} else {
-				// フィルター条件がない場合: 全ユーザーを返すため、プロフィール情報も取得
-				// ただし、パフォーマンスを考慮し、必要最小限の情報のみ取得
-				var commentResults []map[string]interface{}
-				err11 := Supabase.DB.From("profiles").
-					Select("comment").
-					Eq("user_id", userID).
-					Execute(&commentResults)
-				if err11 != nil {
-					errStr := err11.Error()
-					if !containsIgnoreCase(errStr, "unexpected end of json") &&
-						!containsIgnoreCase(errStr, "invalid character") {
-						log.Printf("SearchUsersAdvanced: error getting comment for user %s: %v", userID, err11)
-					}
-				} else if len(commentResults) > 0 {
-					result.Comment, _ = commentResults[0]["comment"].(string)
-				}
+// SetChatMemberRole changes the role of a member of a chat room
+func SetChatMemberRole(chatID int64, userID, role string) error {
+	var results []map[string]interface{}
+	err := Supabase.DB.From("chat_participants").
+		Update(map[string]interface{}{"role": role}).
+		Eq("chat_id", strconv.FormatInt(chatID, 10)).
+		Eq("user_id", userID).
+		Execute(&results)
+	if err != nil {
+		return fmt.Errorf("failed to set role of user %s in chat %d: %v", userID, chatID, err)
+	}
+	return nil
+}
+
+// MarkChatRead records that the user has read the chat up to messageID
+func MarkChatRead(chatID int64, userID string, messageID int64) error {
+	readData := map[string]interface{}{
+		"chat_id":              chatID,
+		"user_id":              userID,
+		"last_read_message_id": messageID,
+		"updated_at":           time.Now().UTC().Format(time.RFC3339),
+	}
+	// (chat_id, user_id) が主キーなので Upsert で既読位置を上書きする
+	var results []map[string]interface{}
+	if err := Supabase.DB.From("chat_reads").Upsert(readData).Execute(&results); err != nil {
+		return fmt.Errorf("failed to mark chat %d as read: %v", chatID, err)
+	}
+	return nil
+}
+
+// GetUnreadCount returns the number of messages from other users that the user has not read yet
+func GetUnreadCount(chatID int64, userID string) (int, error) {
+	chatIDStr := strconv.FormatInt(chatID, 10)
+
+	// 既読位置を取得（未登録の場合は全メッセージが未読）
+	var readResults []map[string]interface{}
+	err := Supabase.DB.From("chat_reads").
+		Select("last_read_message_id").
+		Eq("chat_id", chatIDStr).
+		Eq("user_id", userID).
+		Execute(&readResults)
+	if err != nil {
+		return 0, err
+	}
+	var lastReadID int64
+	if len(readResults) > 0 {
+		if idFloat, ok := readResults[0]["last_read_message_id"].(float64); ok {
+			lastReadID = int64(idFloat)
+		}
+	}
+
+	var results []map[string]interface{}
+	err = Supabase.DB.From("messages").
+		Select("id").
+		Eq("chat_id", chatIDStr).
+		Neq("sender_id", userID).
+		Gt("id", strconv.FormatInt(lastReadID, 10)).
+		Execute(&results)
+	if err != nil {
+		return 0, err
+	}
+	return len(results), nil
+}
+
+// chatSettingsRow is a chat_settings row as read from Supabase
+type chatSettingsRow struct {
+	ChatID     int64      `json:"chat_id"`
+	MutedUntil *time.Time `json:"muted_until"`
+	Archived   bool       `json:"archived"`
+	Pinned     bool       `json:"pinned"`
+}
+
+func (r chatSettingsRow) toModel() models.ChatSettings {
+	return models.ChatSettings{MutedUntil: r.MutedUntil, Archived: r.Archived, Pinned: r.Pinned}
+}
+
+// GetChatSettings returns the user's settings for a chat (all off if never set)
+func GetChatSettings(chatID int64, userID string) (models.ChatSettings, error) {
+	var results []chatSettingsRow
+	err := Supabase.DB.From("chat_settings").
+		Select("chat_id, muted_until, archived, pinned").
+		Eq("chat_id", strconv.FormatInt(chatID, 10)).
+		Eq("user_id", userID).
+		Execute(&results)
+	if err != nil {
+		return models.ChatSettings{}, err
+	}
+	if len(results) == 0 {
+		return models.ChatSettings{}, nil
+	}
+	return results[0].toModel(), nil
+}
+
+// GetUserChatSettings returns the user's settings for every chat they have changed, keyed by chat ID
+func GetUserChatSettings(userID string) (map[int64]models.ChatSettings, error) {
+	var results []chatSettingsRow
+	err := Supabase.DB.From("chat_settings").
+		Select("chat_id, muted_until, archived, pinned").
+		Eq("user_id", userID).
+		Execute(&results)
+	if err != nil {
+		return nil, err
+	}
+	settings := make(map[int64]models.ChatSettings, len(results))
+	for _, row := range results {
+		settings[row.ChatID] = row.toModel()
+	}
+	return settings, nil
+}
+
+// chatMemberStateRow is a row returned by the get_chat_member_states function
+type chatMemberStateRow struct {
+	UserID      string     `json:"user_id"`
+	UnreadCount int        `json:"unread_count"`
+	MutedUntil  *time.Time `json:"muted_until"`
+	Archived    bool       `json:"archived"`
+	Pinned      bool       `json:"pinned"`
+}
+
+// GetChatMemberStates returns every participant of a chat with their unread count and settings
+// in a single request. The get_chat_member_states function (see docs/DATABASE.md) does the
+// counting in Postgres.
+func GetChatMemberStates(chatID int64) ([]models.ChatMemberState, error) {
+	var rows []chatMemberStateRow
+	params := map[string]interface{}{"p_chat_id": chatID}
+	if err := Supabase.DB.Rpc("get_chat_member_states", params).Execute(&rows); err != nil {
+		return nil, fmt.Errorf("failed to get member states of chat %d: %v", chatID, err)
+	}
+	states := make([]models.ChatMemberState, 0, len(rows))
+	for _, row := range rows {
+		states = append(states, models.ChatMemberState{
+			UserID:      row.UserID,
+			UnreadCount: row.UnreadCount,
+			Settings:    models.ChatSettings{MutedUntil: row.MutedUntil, Archived: row.Archived, Pinned: row.Pinned},
+		})
+	}
+	return states, nil
+}
+
+// UpdateChatSettings saves the user's settings for a chat
+func UpdateChatSettings(chatID int64, userID string, settings models.ChatSettings) (models.ChatSettings, error) {
+	var mutedUntil interface{}
+	if settings.MutedUntil != nil {
+		mutedUntil = settings.MutedUntil.UTC().Format(time.RFC3339)
+	}
+	settingsData := map[string]interface{}{
+		"chat_id":     chatID,
+		"user_id":     userID,
+		"muted_until": mutedUntil,
+		"archived":    settings.Archived,
+		"pinned":      settings.Pinned,
+		"updated_at":  time.Now().UTC().Format(time.RFC3339),
+	}
+	// (chat_id, user_id) が主キーなので Upsert で上書きする
+	var results []chatSettingsRow
+	if err := Supabase.DB.From("chat_settings").Upsert(settingsData).Execute(&results); err != nil {
+		return models.ChatSettings{}, fmt.Errorf("failed to update settings of chat %d: %v", chatID, err)
+	}
+	if len(results) == 0 {
+		return settings, nil
+	}
+	return results[0].toModel(), nil
+}
+
+// CreateMeetRequest records an anonymous "want to meet" from sender to recipient.
+// It reports whether the recipient had already sent one back (a mutual match) and
+// whether this call stored the request. Pressing the button twice is not an error;
+// the second press reports created as false.
+func CreateMeetRequest(senderID, recipientID string) (matched, created bool, err error) {
+	buttonData := map[string]interface{}{
+		"sender_id":    senderID,
+		"recipient_id": recipientID,
+	}
+	var insertResults []map[string]interface{}
+	err = Supabase.DB.From("anon_interest_buttons").Insert(buttonData).Execute(&insertResults)
+	created = err == nil
+	if err != nil {
+		errStr := err.Error()
+		if !containsIgnoreCase(errStr, "duplicate key") && !containsIgnoreCase(errStr, "unique constraint") {
+			return false, false, fmt.Errorf("failed to create meet request: %v", err)
+		}
+		log.Printf("CreateMeetRequest: %s already sent a meet request to %s", senderID, recipientID)
+	}
+
+	// 相手からも「会いたい」が届いていればマッチ
+	var reverseResults []map[string]interface{}
+	err = Supabase.DB.From("anon_interest_buttons").
+		Select("id").
+		Eq("sender_id", recipientID).
+		Eq("recipient_id", senderID).
+		Execute(&reverseResults)
+	if err != nil {
+		return false, created, fmt.Errorf("failed to check for a mutual meet request: %v", err)
+	}
+	return len(reverseResults) > 0, created, nil
+}
+
+// SavePushSubscription registers a Web Push subscription for the user.
+// The endpoint is the primary key, so re-subscribing the same browser updates its keys.
+func SavePushSubscription(userID string, sub models.PushSubscription, userAgent string) error {
+	subscriptionData := map[string]interface{}{
+		"endpoint":   sub.Endpoint,
+		"user_id":    userID,
+		"p256dh":     sub.Keys.P256dh,
+		"auth":       sub.Keys.Auth,
+		"user_agent": userAgent,
+	}
+	var results []map[string]interface{}
+	if err := Supabase.DB.From("push_subscriptions").Upsert(subscriptionData).Execute(&results); err != nil {
+		return fmt.Errorf("failed to save push subscription: %v", err)
+	}
+	return nil
+}
+
+// DeletePushSubscription removes one of the user's Web Push subscriptions
+func DeletePushSubscription(userID, endpoint string) error {
+	err := Supabase.DB.From("push_subscriptions").Delete().Eq("endpoint", endpoint).Eq("user_id", userID).Execute(nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete push subscription: %v", err)
+	}
+	return nil
+}
+
+// RemovePushSubscription removes a subscription the push service reported as expired
+func RemovePushSubscription(endpoint string) error {
+	err := Supabase.DB.From("push_subscriptions").Delete().Eq("endpoint", endpoint).Execute(nil)
+	if err != nil {
+		return fmt.Errorf("failed to remove push subscription: %v", err)
+	}
+	return nil
+}
+
+// GetPushSubscriptions returns the user's Web Push subscriptions
+func GetPushSubscriptions(userID string) ([]models.PushSubscription, error) {
+	var results []struct {
+		Endpoint string `json:"endpoint"`
+		P256dh   string `json:"p256dh"`
+		Auth     string `json:"auth"`
+	}
+	err := Supabase.DB.From("push_subscriptions").
+		Select("endpoint, p256dh, auth").
+		Eq("user_id", userID).
+		Execute(&results)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions := make([]models.PushSubscription, 0, len(results))
+	for _, r := range results {
+		var sub models.PushSubscription
+		sub.Endpoint = r.Endpoint
+		sub.Keys.P256dh = r.P256dh
+		sub.Keys.Auth = r.Auth
+		subscriptions = append(subscriptions, sub)
+	}
+	return subscriptions, nil
+}
+
+// GetNotificationSettings returns the user's notification settings (defaults if never saved)
+func GetNotificationSettings(userID string) (models.NotificationSettings, error) {
+	var results []models.NotificationSettings
+	err := Supabase.DB.From("notification_settings").
+		Select("muted, quiet_hours_start, quiet_hours_end, time_zone, updated_at").
+		Eq("user_id", userID).
+		Execute(&results)
+	if err != nil {
+		return models.NotificationSettings{}, err
+	}
+	if len(results) == 0 {
+		return models.NotificationSettings{TimeZone: "Asia/Tokyo"}, nil
+	}
+	return results[0], nil
+}
+
+// UpdateNotificationSettings saves the user's notification settings
+func UpdateNotificationSettings(userID string, settings models.NotificationSettings) (models.NotificationSettings, error) {
+	// 空文字は「静かな時間帯なし」として NULL で保存
+	var quietStart, quietEnd interface{}
+	if settings.QuietHoursStart != "" {
+		quietStart = settings.QuietHoursStart
+		quietEnd = settings.QuietHoursEnd
+	}
+	settingsData := map[string]interface{}{
+		"user_id":           userID,
+		"muted":             settings.Muted,
+		"quiet_hours_start": quietStart,
+		"quiet_hours_end":   quietEnd,
+		"time_zone":         settings.TimeZone,
+		"updated_at":        time.Now().UTC().Format(time.RFC3339),
+	}
+	var results []models.NotificationSettings
+	if err := Supabase.DB.From("notification_settings").Upsert(settingsData).Execute(&results); err != nil {
+		return models.NotificationSettings{}, fmt.Errorf("failed to update notification settings: %v", err)
+	}
+	if len(results) == 0 {
+		return settings, nil
+	}
+	return results[0], nil
+}
+
+// notificationColumns are the notifications columns read into models.Notification
+const notificationColumns = "id, type, actor_id, target_type, target_id, payload, read_at, created_at"
+
+// CreateNotification adds a notification to the user's inbox and returns it as stored
+func CreateNotification(n models.Notification) (*models.Notification, error) {
+	notificationData := map[string]interface{}{
+		"user_id": n.UserID,
+		"type":    n.Type,
+	}
+	// 空の値は NULL のままにする
+	if n.ActorID != "" {
+		notificationData["actor_id"] = n.ActorID
+	}
+	if n.TargetType != "" {
+		notificationData["target_type"] = n.TargetType
+		notificationData["target_id"] = n.TargetID
+	}
+	if len(n.Payload) > 0 {
+		notificationData["payload"] = n.Payload
+	}
+
+	var results []models.Notification
+	if err := Supabase.DB.From("notifications").Insert(notificationData).Execute(&results); err != nil {
+		return nil, fmt.Errorf("failed to create notification: %v", err)
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("notification creation succeeded but no row returned")
+	}
+	created := results[0]
+	created.UserID = n.UserID
+	return &created, nil
+}
+
+// GetNotifications returns up to limit of the user's notifications older than beforeID
+// (0 for the newest), newest first. unreadOnly skips notifications that have been read.
+func GetNotifications(userID string, beforeID int64, limit int, unreadOnly bool) ([]models.Notification, error) {
+	query := Supabase.DB.From("notifications").
+		Select(notificationColumns).
+		OrderBy("id", "desc").
+		Limit(limit).
+		Eq("user_id", userID)
+	if beforeID > 0 {
+		query = query.Lt("id", strconv.FormatInt(beforeID, 10))
+	}
+	if unreadOnly {
+		query = query.IsNull("read_at")
+	}
+
+	var notifications []models.Notification
+	if err := query.Execute(&notifications); err != nil {
+		return nil, err
+	}
+	if notifications == nil {
+		notifications = []models.Notification{}
+	}
+	return notifications, nil
+}
+
+// GetUnreadNotificationCount returns the number of unread notifications of the user
+func GetUnreadNotificationCount(userID string) (int, error) {
+	var results []map[string]interface{}
+	err := Supabase.DB.From("notifications").
+		Select("id").
+		Eq("user_id", userID).
+		IsNull("read_at").
+		Execute(&results)
+	if err != nil {
+		return 0, err
+	}
+	return len(results), nil
+}
+
+// MarkNotificationRead marks one of the user's notifications as read.
+// It reports false if the user has no such notification.
+func MarkNotificationRead(userID string, notificationID int64) (bool, error) {
+	var results []map[string]interface{}
+	err := Supabase.DB.From("notifications").
+		Update(map[string]interface{}{"read_at": time.Now().UTC().Format(time.RFC3339)}).
+		Eq("id", strconv.FormatInt(notificationID, 10)).
+		Eq("user_id", userID).
+		Execute(&results)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark notification as read: %v", err)
+	}
+	return len(results) > 0, nil
+}
+
+// MarkAllNotificationsRead marks every unread notification of the user as read
+func MarkAllNotificationsRead(userID string) error {
+	var results []map[string]interface{}
+	err := Supabase.DB.From("notifications").
+		Update(map[string]interface{}{"read_at": time.Now().UTC().Format(time.RFC3339)}).
+		Eq("user_id", userID).
+		IsNull("read_at").
+		Execute(&results)
+	if err != nil {
+		return fmt.Errorf("failed to mark notifications as read: %v", err)
+	}
+	return nil
+}
+
+// emailPreferencesRow is a row of the email_preferences table
+type emailPreferencesRow struct {
+	UserID           string     `json:"user_id"`
+	Frequency        string     `json:"frequency"`
+	UnsubscribeToken string     `json:"unsubscribe_token"`
+	LastDigestAt     *time.Time `json:"last_digest_at"`
+}
+
+func (r emailPreferencesRow) toModel() models.EmailPreferences {
+	return models.EmailPreferences{
+		UserID:           r.UserID,
+		Frequency:        r.Frequency,
+		UnsubscribeToken: r.UnsubscribeToken,
+		LastDigestAt:     r.LastDigestAt,
+	}
+}
+
+const emailPreferencesColumns = "user_id, frequency, unsubscribe_token, last_digest_at"
+
+// newUnsubscribeToken returns a random token for one-click unsubscribe links
+func newUnsubscribeToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CreateEmailPreferences creates the user's email preferences with the default frequency.
+// It does nothing if they already exist.
+func CreateEmailPreferences(userID string) error {
+	token, err := newUnsubscribeToken()
+	if err != nil {
+		return err
+	}
+	preferencesData := map[string]interface{}{
+		"user_id":           userID,
+		"frequency":         models.EmailFrequencyDaily,
+		"unsubscribe_token": token,
+	}
+	var results []map[string]interface{}
+	err = Supabase.DB.From("email_preferences").Insert(preferencesData).Execute(&results)
+	if err != nil {
+		errStr := err.Error()
+		if containsIgnoreCase(errStr, "duplicate key") || containsIgnoreCase(errStr, "unique constraint") {
+			return nil
+		}
+		return fmt.Errorf("failed to create email preferences: %v", err)
+	}
+	return nil
+}
+
+// GetEmailPreferences returns the user's email preferences, creating the defaults if needed
+func GetEmailPreferences(userID string) (models.EmailPreferences, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		var results []emailPreferencesRow
+		err := Supabase.DB.From("email_preferences").
+			Select(emailPreferencesColumns).
+			Eq("user_id", userID).
+			Execute(&results)
+		if err != nil {
+			return models.EmailPreferences{}, err
+		}
+		if len(results) > 0 {
+			return results[0].toModel(), nil
+		}
+		// 登録前のユーザーなどで行がない場合はデフォルトで作成
+		if err := CreateEmailPreferences(userID); err != nil {
+			return models.EmailPreferences{}, err
+		}
+	}
+	return models.EmailPreferences{}, fmt.Errorf("email preferences for user %s not found", userID)
+}
+
+// UpdateEmailFrequency changes how often the user receives the email digest
+func UpdateEmailFrequency(userID, frequency string) (models.EmailPreferences, error) {
+	if _, err := GetEmailPreferences(userID); err != nil {
+		return models.EmailPreferences{}, err
+	}
+	var results []emailPreferencesRow
+	err := Supabase.DB.From("email_preferences").
+		Update(map[string]interface{}{"frequency": frequency}).
+		Eq("user_id", userID).
+		Execute(&results)
+	if err != nil {
+		return models.EmailPreferences{}, fmt.Errorf("failed to update email preferences: %v", err)
+	}
+	if len(results) == 0 {
+		return models.EmailPreferences{}, fmt.Errorf("email preferences for user %s not found", userID)
+	}
+	return results[0].toModel(), nil
+}
+
+// EmailUnsubscribeTokenExists reports whether a user has the unsubscribe token
+func EmailUnsubscribeTokenExists(token string) (bool, error) {
+	var results []map[string]interface{}
+	err := Supabase.DB.From("email_preferences").
+		Select("user_id").
+		Eq("unsubscribe_token", token).
+		Execute(&results)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up unsubscribe token: %v", err)
+	}
+	return len(results) > 0, nil
+}
+
+// UnsubscribeEmail turns the digest off for the user owning token.
+// It reports false if no user has the token.
+func UnsubscribeEmail(token string) (bool, error) {
+	var results []map[string]interface{}
+	err := Supabase.DB.From("email_preferences").
+		Update(map[string]interface{}{"frequency": models.EmailFrequencyOff}).
+		Eq("unsubscribe_token", token).
+		Execute(&results)
+	if err != nil {
+		return false, fmt.Errorf("failed to unsubscribe: %v", err)
+	}
+	return len(results) > 0, nil
+}
+
+// GetDigestSubscribers returns the email preferences of every user who gets a digest
+func GetDigestSubscribers() ([]models.EmailPreferences, error) {
+	var results []emailPreferencesRow
+	err := Supabase.DB.From("email_preferences").
+		Select(emailPreferencesColumns).
+		Neq("frequency", models.EmailFrequencyOff).
+		Execute(&results)
+	if err != nil {
+		return nil, err
+	}
+	preferences := make([]models.EmailPreferences, 0, len(results))
+	for _, r := range results {
+		preferences = append(preferences, r.toModel())
+	}
+	return preferences, nil
+}
+
+// SetLastDigestAt records when the user's last digest was sent
+func SetLastDigestAt(userID string, sentAt time.Time) error {
+	var results []map[string]interface{}
+	err := Supabase.DB.From("email_preferences").
+		Update(map[string]interface{}{"last_digest_at": sentAt.UTC().Format(time.RFC3339)}).
+		Eq("user_id", userID).
+		Execute(&results)
+	if err != nil {
+		return fmt.Errorf("failed to record digest for user %s: %v", userID, err)
+	}
+	return nil
+}
+
+// GetUserContact returns the user's email address and username
+func GetUserContact(userID string) (email, username string, err error) {
+	var results []struct {
+		Email    string `json:"email"`
+		Username string `json:"username"`
+	}
+	err = Supabase.DB.From("users").
+		Select("email, username").
+		Eq("id", userID).
+		Execute(&results)
+	if err != nil {
+		return "", "", err
+	}
+	if len(results) == 0 {
+		return "", "", fmt.Errorf("user %s not found", userID)
+	}
+	return results[0].Email, results[0].Username, nil
+}
+
+// GetNotificationsSince returns the user's notifications of one type created after since
+func GetNotificationsSince(userID, notificationType string, since time.Time) ([]models.Notification, error) {
+	var notifications []models.Notification
+	err := Supabase.DB.From("notifications").
+		Select(notificationColumns).
+		OrderBy("id", "asc").
+		Eq("user_id", userID).
+		Eq("type", notificationType).
+		Gt("created_at", since.UTC().Format(time.RFC3339)).
+		Execute(&notifications)
+	if err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// GetUpcomingEvents returns events starting between from and to, soonest first
+func GetUpcomingEvents(from, to time.Time) ([]models.Event, error) {
+	var events []models.Event
+	err := Supabase.DB.From("events").
+		Select("id, title, description, event_type, start_time, end_time, chat_link_enabled").
+		OrderBy("start_time", "asc").
+		Gte("start_time", from.UTC().Format(time.RFC3339)).
+		Lt("start_time", to.UTC().Format(time.RFC3339)).
+		Execute(&events)
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// GetEvent returns an event, or nil if it doesn't exist
+func GetEvent(eventID int64) (*models.Event, error) {
+	var events []models.Event
+	err := Supabase.DB.From("events").
+		Select("id, title, description, event_type, start_time, end_time, chat_link_enabled").
+		Eq("id", strconv.FormatInt(eventID, 10)).
+		Execute(&events)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, nil
+	}
+	return &events[0], nil
+}
+
+// profileColumns selects a user with their whole profile and interests
+const profileColumns = "id, email, username, is_oic_verified, profiles(major, gender, native_language, spoken_languages, learning_languages, language_skills, residence, comment, avatar_url, last_updated, onboarding_state), user_interests(preference_level, interests(id, name))"
+
+// matchProfileColumns selects what recommendations and tandem search rank on: the
+// profile's languages and major, interests with their preference levels, and what
+// profile completeness counts
+const matchProfileColumns = "id, username, is_oic_verified, profiles(major, native_language, spoken_languages, learning_languages, language_skills, residence, comment, avatar_url, last_updated), user_interests(preference_level, interests(id, name))"
+
+// searchCandidateColumns selects everything the search engine filters and ranks on
+const searchCandidateColumns = "id, username, is_oic_verified, profiles(major, gender, native_language, spoken_languages, learning_languages, language_skills, residence, comment, avatar_url, last_updated), user_interests(preference_level, interests(id, name))"
+
+// GetSearchCandidates returns the users currentUserID can find in a search, with their
+// profile and interests, for the search engine. Users either of them blocked and users
+// hidden from search are left out, and fields the current user may not see are cleared,
+// so searches can't match on them either.
+func GetSearchCandidates(currentUserID string) ([]models.User, error) {
+	var rows []profileRow
+	err := Supabase.DB.From("users").
+		Select(searchCandidateColumns).
+		Neq("id", currentUserID).
+		Execute(&rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get search candidates: %v", err)
+	}
+	blocked, err := GetBlockedUserIDs(currentUserID)
+	if err != nil {
+		return nil, err
+	}
+	viewer, err := GetProfileViewer(currentUserID, nil)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]models.User, 0, len(rows))
+	for _, row := range rows {
+		if blocked[row.ID] || !viewer.CanFind(row.ID) {
+			continue
+		}
+		user := row.toModel()
+		viewer.Redact(&user)
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// GetUsersUpdatedSince returns the users whose profile was created or updated after since,
+// with their profile and interests, for the search engine. Unlike GetSearchCandidates
+// nothing is left out or cleared for a viewer: callers apply blocks and privacy settings.
+func GetUsersUpdatedSince(since time.Time) ([]models.User, error) {
+	var rows []profileRow
+	err := Supabase.DB.From("users").
+		Select(strings.Replace(searchCandidateColumns, "profiles(", "profiles!inner(", 1)).
+		Gt("profiles.last_updated", since.UTC().Format(time.RFC3339Nano)).
+		Execute(&rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users updated since %s: %v", since.Format(time.RFC3339), err)
+	}
+	users := make([]models.User, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, row.toModel())
+	}
+	return users, nil
+}
+
+// profileRow is a users row with its embedded profile and interests
+type profileRow struct {
+	ID            string `json:"id"`
+	Email         string `json:"email"`
+	Username      string `json:"username"`
+	IsOICVerified bool   `json:"is_oic_verified"`
+	Profile       *struct {
+		Major             *string                `json:"major"`
+		Gender            *string                `json:"gender"`
+		NativeLanguage    *string                `json:"native_language"`
+		SpokenLanguages   []string               `json:"spoken_languages"`
+		LearningLanguages []string               `json:"learning_languages"`
+		LanguageSkills    []models.LanguageSkill `json:"language_skills"`
+		Residence         *string                `json:"residence"`
+		Comment           *string                `json:"comment"`
+		AvatarURL         *string                `json:"avatar_url"`
+		LastUpdated       time.Time              `json:"last_updated"`
+		OnboardingState   *string                `json:"onboarding_state"`
+	} `json:"profiles"`
+	UserInterests []struct {
+		PreferenceLevel *int             `json:"preference_level"`
+		Interest        *models.Interest `json:"interests"`
+	} `json:"user_interests"`
+}
+
+func (r profileRow) toModel() models.User {
+	user := models.User{ID: r.ID, Email: r.Email, Username: r.Username, IsOICVerified: r.IsOICVerified}
+	if p := r.Profile; p != nil {
+		user.Major = derefString(p.Major)
+		user.Gender = derefString(p.Gender)
+		user.NativeLanguage = derefString(p.NativeLanguage)
+		user.SpokenLanguages = p.SpokenLanguages
+		user.LearningLanguages = p.LearningLanguages
+		user.LanguageSkills = p.LanguageSkills
+		user.Residence = derefString(p.Residence)
+		user.Comment = derefString(p.Comment)
+		user.AvatarURL = derefString(p.AvatarURL)
+		user.LastUpdatedAt = p.LastUpdated
+	}
+	for _, ui := range r.UserInterests {
+		if ui.Interest == nil {
+			continue
+		}
+		interest := *ui.Interest
+		if ui.PreferenceLevel != nil {
+			interest.PreferenceLevel = *ui.PreferenceLevel
+		}
+		user.Interests = append(user.Interests, interest)
+	}
+	user.Completeness = user.ProfileCompleteness().Score
+	return user
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// GetMatchProfile returns the user's languages, major and weighted interests
+func GetMatchProfile(userID string) (*models.User, error) {
+	var rows []profileRow
+	err := Supabase.DB.From("users").
+		Select(matchProfileColumns).
+		Eq("id", userID).
+		Execute(&rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("user %s not found", userID)
+	}
+	user := rows[0].toModel()
+	return &user, nil
+}
+
+// GetMatchCandidates returns the match profile of every user except userID
+func GetMatchCandidates(userID string) ([]models.User, error) {
+	var rows []profileRow
+	err := Supabase.DB.From("users").
+		Select(matchProfileColumns).
+		Neq("id", userID).
+		Execute(&rows)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]models.User, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, row.toModel())
+	}
+	return users, nil
+}
+
+// BlockUser records that blocker does not want to see or hear from blocked.
+// Blocking twice is not an error.
+func BlockUser(blockerID, blockedID string) error {
+	blockData := map[string]interface{}{
+		"blocker_id": blockerID,
+		"blocked_id": blockedID,
+	}
+	var results []map[string]interface{}
+	err := Supabase.DB.From("user_blocks").Insert(blockData).Execute(&results)
+	if err != nil {
+		errStr := err.Error()
+		if !containsIgnoreCase(errStr, "duplicate key") && !containsIgnoreCase(errStr, "unique constraint") {
+			return fmt.Errorf("failed to block user %s: %v", blockedID, err)
+		}
+	}
+	return nil
+}
+
+// UnblockUser removes a block
+func UnblockUser(blockerID, blockedID string) error {
+	var results []map[string]interface{}
+	err := Supabase.DB.From("user_blocks").
+		Delete().
+		Eq("blocker_id", blockerID).
+		Eq("blocked_id", blockedID).
+		Execute(&results)
+	if err != nil {
+		return fmt.Errorf("failed to unblock user %s: %v", blockedID, err)
+	}
+	return nil
+}
+
+// GetExistingUserIDs returns which of userIDs are registered users
+func GetExistingUserIDs(userIDs []string) (map[string]bool, error) {
+	existing := make(map[string]bool, len(userIDs))
+	if len(userIDs) == 0 {
+		return existing, nil
+	}
+	var rows []struct {
+		ID string `json:"id"`
+	}
+	if err := Supabase.DB.From("users").Select("id").In("id", userIDs).Execute(&rows); err != nil {
+		return nil, fmt.Errorf("failed to get users: %v", err)
+	}
+	for _, row := range rows {
+		existing[row.ID] = true
+	}
+	return existing, nil
+}
+
+// GetBlockedUserIDs returns the users the user blocked or was blocked by
+func GetBlockedUserIDs(userID string) (map[string]bool, error) {
+	blocked := make(map[string]bool)
+
+	// OR が使えないので、ブロックした側・された側をそれぞれ取得する
+	var byUser []map[string]interface{}
+	if err := Supabase.DB.From("user_blocks").Select("blocked_id").Eq("blocker_id", userID).Execute(&byUser); err != nil {
+		return nil, err
+	}
+	for _, row := range byUser {
+		if id, ok := row["blocked_id"].(string); ok {
+			blocked[id] = true
+		}
+	}
+
+	var ofUser []map[string]interface{}
+	if err := Supabase.DB.From("user_blocks").Select("blocker_id").Eq("blocked_id", userID).Execute(&ofUser); err != nil {
+		return nil, err
+	}
+	for _, row := range ofUser {
+		if id, ok := row["blocker_id"].(string); ok {
+			blocked[id] = true
+		}
+	}
+	return blocked, nil
+}
+
+// GetBlockedUserIDsOf returns, for each of userIDs, the users they blocked or were blocked by
+func GetBlockedUserIDsOf(userIDs []string) (map[string]map[string]bool, error) {
+	blocked := make(map[string]map[string]bool, len(userIDs))
+	for _, userID := range userIDs {
+		blocked[userID] = make(map[string]bool)
+	}
+	if len(userIDs) == 0 {
+		return blocked, nil
+	}
+
+	var rows []struct {
+		BlockerID string `json:"blocker_id"`
+		BlockedID string `json:"blocked_id"`
+	}
+	// OR が使えないので、ブロックした側・された側をそれぞれ取得する
+	for _, column := range []string{"blocker_id", "blocked_id"} {
+		if err := Supabase.DB.From("user_blocks").Select("blocker_id, blocked_id").In(column, userIDs).Execute(&rows); err != nil {
+			return nil, fmt.Errorf("failed to get blocks: %v", err)
+		}
+		for _, row := range rows {
+			if blocked[row.BlockerID] != nil {
+				blocked[row.BlockerID][row.BlockedID] = true
+			}
+			if blocked[row.BlockedID] != nil {
+				blocked[row.BlockedID][row.BlockerID] = true
+			}
+		}
+	}
+	return blocked, nil
+}
+
+// privacySettingsColumns are the privacy_settings columns read into models.PrivacySettings
+const privacySettingsColumns = "user_id, hidden_from_search, major, gender, residence, languages, interests, updated_at"
+
+// privacySettingsRow is a privacy_settings row
+type privacySettingsRow struct {
+	models.PrivacySettings
+	UserID string `json:"user_id"`
+}
+
+// GetPrivacySettings returns the user's privacy settings, or the defaults if the user
+// hasn't changed them
+func GetPrivacySettings(userID string) (models.PrivacySettings, error) {
+	settings, err := GetPrivacySettingsOf([]string{userID})
+	if err != nil {
+		return models.PrivacySettings{}, err
+	}
+	if s, ok := settings[userID]; ok {
+		return s, nil
+	}
+	return models.DefaultPrivacySettings(), nil
+}
+
+// GetPrivacySettingsOf returns the privacy settings of the users who changed them, by
+// user ID. With nil userIDs it returns every user's.
+func GetPrivacySettingsOf(userIDs []string) (map[string]models.PrivacySettings, error) {
+	var rows []privacySettingsRow
+	query := Supabase.DB.From("privacy_settings").Select(privacySettingsColumns)
+	var err error
+	if userIDs != nil {
+		err = query.In("user_id", userIDs).Execute(&rows)
+	} else {
+		err = query.Execute(&rows)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get privacy settings: %v", err)
+	}
+	settings := make(map[string]models.PrivacySettings, len(rows))
+	for _, row := range rows {
+		settings[row.UserID] = row.PrivacySettings
+	}
+	return settings, nil
+}
+
+// UpdatePrivacySettings saves the user's privacy settings
+func UpdatePrivacySettings(userID string, settings models.PrivacySettings) (models.PrivacySettings, error) {
+	settingsData := map[string]interface{}{
+		"user_id":            userID,
+		"hidden_from_search": settings.HiddenFromSearch,
+		"major":              settings.Major,
+		"gender":             settings.Gender,
+		"residence":          settings.Residence,
+		"languages":          settings.Languages,
+		"interests":          settings.Interests,
+		"updated_at":         time.Now().UTC().Format(time.RFC3339),
+	}
+	var rows []privacySettingsRow
+	if err := Supabase.DB.From("privacy_settings").Upsert(settingsData).Execute(&rows); err != nil {
+		return models.PrivacySettings{}, fmt.Errorf("failed to update privacy settings: %v", err)
+	}
+	if len(rows) == 0 {
+		return settings, nil
+	}
+	return rows[0].PrivacySettings, nil
+}
+
+// GetChatPartnerIDs returns the users the user has a chat with. Matches create a chat,
+// so this includes every match.
+func GetChatPartnerIDs(userID string) (map[string]bool, error) {
+	partners := make(map[string]bool)
+	for _, side := range [][2]string{{"user1_id", "user2_id"}, {"user2_id", "user1_id"}} {
+		var results []map[string]interface{}
+		err := Supabase.DB.From("chats").
+			Select(side[1]).
+			Eq(side[0], userID).
+			Execute(&results)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get chat partners of user %s: %v", userID, err)
+		}
+		for _, row := range results {
+			if id, ok := row[side[1]].(string); ok {
+				partners[id] = true
+			}
+		}
+	}
+	return partners, nil
+}
+
+// GetProfileViewer loads what decides which profile fields viewerID sees: whether the
+// viewer is verified, who they chat with, and the privacy settings of ownerIDs (of every
+// user if ownerIDs is nil)
+func GetProfileViewer(viewerID string, ownerIDs []string) (models.ProfileViewer, error) {
+	viewer := models.ProfileViewer{UserID: viewerID}
+	var results []map[string]interface{}
+	err := Supabase.DB.From("users").
+		Select("is_oic_verified").
+		Eq("id", viewerID).
+		Execute(&results)
+	if err != nil {
+		return viewer, fmt.Errorf("failed to get user %s: %v", viewerID, err)
+	}
+	if len(results) > 0 {
+		viewer.Verified, _ = results[0]["is_oic_verified"].(bool)
+	}
+	if viewer.Connections, err = GetChatPartnerIDs(viewerID); err != nil {
+		return viewer, err
+	}
+	if viewer.Settings, err = GetPrivacySettingsOf(ownerIDs); err != nil {
+		return viewer, err
+	}
+	return viewer, nil
+}
 
-				var residenceResults []map[string]interface{}
-				err12 := Supabase.DB.From("profiles").
-					Select("residence").
-					Eq("user_id", userID).
-					Execute(&residenceResults)
-				if err12 != nil {
-					errStr := err12.Error()
-					if !containsIgnoreCase(errStr, "unexpected end of json") &&
-						!containsIgnoreCase(errStr, "invalid character") {
-						log.Printf("SearchUsersAdvanced: error getting residence for user %s: %v", userID, err12)
-					}
-				} else if len(residenceResults) > 0 {
-					result.Residence, _ = residenceResults[0]["residence"].(string)
-				}
+// GetProfileViewers is GetProfileViewer for several viewers at once, sharing the privacy
+// settings of ownerIDs between them
+func GetProfileViewers(viewerIDs []string, ownerIDs []string) (map[string]models.ProfileViewer, error) {
+	viewers := make(map[string]models.ProfileViewer, len(viewerIDs))
+	if len(viewerIDs) == 0 {
+		return viewers, nil
+	}
+	settings := map[string]models.PrivacySettings{}
+	if ownerIDs == nil || len(ownerIDs) > 0 {
+		var err error
+		if settings, err = GetPrivacySettingsOf(ownerIDs); err != nil {
+			return nil, err
+		}
+	}
+	for _, viewerID := range viewerIDs {
+		viewers[viewerID] = models.ProfileViewer{UserID: viewerID, Connections: make(map[string]bool), Settings: settings}
+	}
 
-				var avatarResults []map[string]interface{}
-				err13 := Supabase.DB.From("profiles").
-					Select("avatar_url").
-					Eq("user_id", userID).
-					Execute(&avatarResults)
-				if err13 != nil {
-					errStr := err13.Error()
-					if !containsIgnoreCase(errStr, "unexpected end of json") &&
-						!containsIgnoreCase(errStr, "invalid character") {
-						log.Printf("SearchUsersAdvanced: error getting avatar_url for user %s: %v", userID, err13)
-					}
-				} else if len(avatarResults) > 0 {
-					if avatarURL, ok := avatarResults[0]["avatar_url"].(string); ok && avatarURL != "" {
-						result.AvatarURL = &avatarURL
-					}
-					// avatar_urlがNULLまたは空文字列の場合は、result.AvatarURLはnilのまま（JSONではnullとして返される）
-				}
+	var users []struct {
+		ID            string `json:"id"`
+		IsOICVerified bool   `json:"is_oic_verified"`
+	}
+	if err := Supabase.DB.From("users").Select("id, is_oic_verified").In("id", viewerIDs).Execute(&users); err != nil {
+		return nil, fmt.Errorf("failed to get users: %v", err)
+	}
+	for _, u := range users {
+		viewer := viewers[u.ID]
+		viewer.Verified = u.IsOICVerified
+		viewers[u.ID] = viewer
+	}
 
-				// native_languageを取得（言語検索でフィルタリングするために必要）
-				var nativeLangResults []map[string]interface{}
-				err14 := Supabase.DB.From("profiles").
-					Select("native_language").
-					Eq("user_id", userID).
-					Execute(&nativeLangResults)
-				if err14 != nil {
-					errStr := err14.Error()
-					if !containsIgnoreCase(errStr, "unexpected end of json") &&
-						!containsIgnoreCase(errStr, "invalid character") {
-						log.Printf("SearchUsersAdvanced: error getting native_language for user %s: %v", userID, err14)
-					}
-				} else if len(nativeLangResults) > 0 {
-					if nativeLang, ok := nativeLangResults[0]["native_language"].(string); ok && nativeLang != "" {
-						// 言語コードを小文字に変換（ISO 639-1形式: "ja", "en", "ko"など）
-						nativeLangLower := strings.ToLower(strings.TrimSpace(nativeLang))
-						result.NativeLanguage = &nativeLangLower
-					}
-					// native_languageがNULLまたは空文字列の場合は、result.NativeLanguageはnilのまま（JSONではnullとして返される）
-				}
+	// Chat partners, as GetChatPartnerIDs
+	var chats []struct {
+		User1ID *string `json:"user1_id"`
+		User2ID *string `json:"user2_id"`
+	}
+	for _, column := range []string{"user1_id", "user2_id"} {
+		if err := Supabase.DB.From("chats").Select("user1_id, user2_id").In(column, viewerIDs).Execute(&chats); err != nil {
+			return nil, fmt.Errorf("failed to get chat partners: %v", err)
+		}
+		for _, chat := range chats {
+			if chat.User1ID == nil || chat.User2ID == nil {
+				continue
+			}
+			if viewer, ok := viewers[*chat.User1ID]; ok {
+				viewer.Connections[*chat.User2ID] = true
 			}
+			if viewer, ok := viewers[*chat.User2ID]; ok {
+				viewer.Connections[*chat.User1ID] = true
+			}
+		}
+	}
+	return viewers, nil
+}
 
-			// 興味情報を取得（パフォーマンス最適化: フィルター条件がない場合は省略）
-			// フィルター条件がない場合、興味情報の取得は省略してパフォーマンスを優先
-			if hasFilters {
-				var userInterestIDs []map[string]interface{}
-				err9 := Supabase.DB.From("user_interests").
-					Select("interest_id").
-					Eq("user_id", userID).
-					Execute(&userInterestIDs)
-				if err9 == nil && len(userInterestIDs) > 0 {
-					// 興味IDのリストを構築
-					interestIDs := make([]int, 0, len(userInterestIDs))
-					for _, uiMap := range userInterestIDs {
-						if interestIDFloat, ok := uiMap["interest_id"].(float64); ok {
-							interestID := int(interestIDFloat)
-							if interestID > 0 {
-								interestIDs = append(interestIDs, interestID)
-							}
-						}
-					}
+// savedSearchColumns are the saved_searches columns read into models.SavedSearch
+const savedSearchColumns = "id, user_id, name, query, notify, last_checked_at, created_at, updated_at"
 
-					// 興味情報を取得（各IDごとに個別クエリ - 最適化の余地あり）
-					// ただし、パフォーマンスを考慮し、最大3件までに制限
-					maxInterests := 3
-					for i, interestID := range interestIDs {
-						if i >= maxInterests {
-							break
-						}
-						var interestInfo []map[string]interface{}
-						err10 := Supabase.DB.From("interests").
-							Select("id, name").
-							Eq("id", strconv.Itoa(interestID)).
-							Execute(&interestInfo)
-						if err10 == nil && len(interestInfo) > 0 {
-							if interestName, ok := interestInfo[0]["name"].(string); ok && interestName != "" {
-								result.Interests = append(result.Interests, InterestItem{
-									ID:   interestID,
-									Name: interestName,
-								})
-							}
-						}
-					}
-				}
-			}
+// savedSearchRow is a saved_searches row; user_id isn't part of the JSON of the model
+type savedSearchRow struct {
+	models.SavedSearch
+	OwnerID string `json:"user_id"`
+}
 
-			// スレッドセーフに結果を追加
-			mu.Lock()
-			searchResults = append(searchResults, result)
-			mu.Unlock()
-		}(userIDMap)
+func savedSearchModels(rows []savedSearchRow) []models.SavedSearch {
+	searches := make([]models.SavedSearch, len(rows))
+	for i, row := range rows {
+		searches[i] = row.SavedSearch
+		searches[i].UserID = row.OwnerID
 	}
+	return searches
+}
 
-	// すべてのgoroutineの完了を待つ
-	wg.Wait()
+// GetSavedSearches returns the user's saved searches, oldest first
+func GetSavedSearches(userID string) ([]models.SavedSearch, error) {
+	var rows []savedSearchRow
+	err := Supabase.DB.From("saved_searches").
+		Select(savedSearchColumns).
+		OrderBy("id", "asc").
+		Eq("user_id", userID).
+		Execute(&rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get saved searches: %v", err)
+	}
+	return savedSearchModels(rows), nil
+}
 
-	log.Printf("SearchUsersAdvanced: returning %d filtered results", len(searchResults))
+// GetSavedSearch returns one of the user's saved searches, or nil if the user has no
+// saved search with that ID
+func GetSavedSearch(userID string, id int64) (*models.SavedSearch, error) {
+	var rows []savedSearchRow
+	err := Supabase.DB.From("saved_searches").
+		Select(savedSearchColumns).
+		Eq("id", strconv.FormatInt(id, 10)).
+		Eq("user_id", userID).
+		Execute(&rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get saved search %d: %v", id, err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &savedSearchModels(rows)[0], nil
+}
 
-	// 結果が nil の場合は空の配列を返す
-	if searchResults == nil {
-		return []SearchUserResult{}, nil
+// GetAlertingSavedSearches returns every saved search whose owner wants new-match alerts
+func GetAlertingSavedSearches() ([]models.SavedSearch, error) {
+	var rows []savedSearchRow
+	err := Supabase.DB.From("saved_searches").
+		Select(savedSearchColumns).
+		Eq("notify", "true").
+		Execute(&rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get saved searches: %v", err)
 	}
+	return savedSearchModels(rows), nil
+}
 
-	return searchResults, nil
+// CreateSavedSearch stores a saved search and returns it as stored
+func CreateSavedSearch(s models.SavedSearch) (*models.SavedSearch, error) {
+	searchData := map[string]interface{}{
+		"user_id":         s.UserID,
+		"name":            s.Name,
+		"query":           s.Query,
+		"notify":          s.Notify,
+		"last_checked_at": time.Now().UTC().Format(time.RFC3339),
+	}
+	var rows []savedSearchRow
+	if err := Supabase.DB.From("saved_searches").Insert(searchData).Execute(&rows); err != nil {
+		return nil, fmt.Errorf("failed to create saved search: %v", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("saved search creation succeeded but no row returned")
+	}
+	return &savedSearchModels(rows)[0], nil
 }
 
-// IsChatParticipant checks if a user is a participant in a chat room
-func IsChatParticipant(chatID int64, userID string) (bool, error) {
-	log.Printf("IsChatParticipant: checking if user %s is participant in chat %d", userID, chatID)
+// UpdateSavedSearch replaces the name, query and notify flag of one of the user's saved
+// searches. It returns nil if the user has no saved search with that ID.
+func UpdateSavedSearch(s models.SavedSearch) (*models.SavedSearch, error) {
+	searchData := map[string]interface{}{
+		"name":       s.Name,
+		"query":      s.Query,
+		"notify":     s.Notify,
+		"updated_at": time.Now().UTC().Format(time.RFC3339),
+	}
+	var rows []savedSearchRow
+	err := Supabase.DB.From("saved_searches").
+		Update(searchData).
+		Eq("id", strconv.FormatInt(s.ID, 10)).
+		Eq("user_id", s.UserID).
+		Execute(&rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update saved search %d: %v", s.ID, err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &savedSearchModels(rows)[0], nil
+}
 
-	// Get user1_id and user2_id separately (Select with multiple fields fails)
-	var user1ID string
-	var user2ID string
+// DeleteSavedSearch deletes one of the user's saved searches. It reports false if the
+// user has no saved search with that ID.
+func DeleteSavedSearch(userID string, id int64) (bool, error) {
+	var results []map[string]interface{}
+	err := Supabase.DB.From("saved_searches").
+		Delete().
+		Eq("id", strconv.FormatInt(id, 10)).
+		Eq("user_id", userID).
+		Execute(&results)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete saved search %d: %v", id, err)
+	}
+	return len(results) > 0, nil
+}
 
-	// Get user1_id
-	var user1Results []map[string]interface{}
-	err := Supabase.DB.From("chats").
-		Select("user1_id").
-		Eq("id", strconv.FormatInt(chatID, 10)).
-		Execute(&user1Results)
-	if err == nil && len(user1Results) > 0 {
-		user1ID, _ = user1Results[0]["user1_id"].(string)
-	} else {
-		errStr := ""
-		if err != nil {
-			errStr = err.Error()
-		}
-		if containsIgnoreCase(errStr, "unexpected end of json") ||
-			containsIgnoreCase(errStr, "invalid character") ||
-			containsIgnoreCase(errStr, "not found") ||
-			containsIgnoreCase(errStr, "no rows") ||
-			len(user1Results) == 0 {
-			log.Printf("IsChatParticipant: chat %d not found", chatID)
-			return false, nil
-		}
+// SetSavedSearchCheckedAt records when the alert job last looked for new matches
+func SetSavedSearchCheckedAt(id int64, at time.Time) error {
+	var results []map[string]interface{}
+	err := Supabase.DB.From("saved_searches").
+		Update(map[string]interface{}{"last_checked_at": at.UTC().Format(time.RFC3339)}).
+		Eq("id", strconv.FormatInt(id, 10)).
+		Execute(&results)
+	if err != nil {
+		return fmt.Errorf("failed to update saved search %d: %v", id, err)
 	}
+	return nil
+}
 
-	// Get user2_id
-	var user2Results []map[string]interface{}
-	err = Supabase.DB.From("chats").
-		Select("user2_id").
-		Eq("id", strconv.FormatInt(chatID, 10)).
-		Execute(&user2Results)
-	if err == nil && len(user2Results) > 0 {
-		user2ID, _ = user2Results[0]["user2_id"].(string)
+// GetSavedSearchMatchIDs returns the users the owner of a saved search already knows
+// match it
+func GetSavedSearchMatchIDs(savedSearchID int64) (map[string]bool, error) {
+	var results []map[string]interface{}
+	err := Supabase.DB.From("saved_search_matches").
+		Select("user_id").
+		Eq("saved_search_id", strconv.FormatInt(savedSearchID, 10)).
+		Execute(&results)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get matches of saved search %d: %v", savedSearchID, err)
+	}
+	known := make(map[string]bool, len(results))
+	for _, row := range results {
+		if userID, ok := row["user_id"].(string); ok {
+			known[userID] = true
+		}
 	}
+	return known, nil
+}
 
-	// Check if user is either user1 or user2
-	isParticipant := user1ID == userID || user2ID == userID
-	log.Printf("IsChatParticipant: user %s is participant in chat %d: %v (user1=%s, user2=%s)", userID, chatID, isParticipant, user1ID, user2ID)
-	return isParticipant, nil
+// AddSavedSearchMatches records that the owner of a saved search knows the users match it
+func AddSavedSearchMatches(savedSearchID int64, userIDs []string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	rows := make([]map[string]interface{}, len(userIDs))
+	for i, userID := range userIDs {
+		rows[i] = map[string]interface{}{"saved_search_id": savedSearchID, "user_id": userID}
+	}
+	// (saved_search_id, user_id) が主キーなので、既に記録済みのユーザーは Upsert で無視される
+	var results []map[string]interface{}
+	if err := Supabase.DB.From("saved_search_matches").Upsert(rows).Execute(&results); err != nil {
+		return fmt.Errorf("failed to record matches of saved search %d: %v", savedSearchID, err)
+	}
+	return nil
 }
 
-// GetChatDetail returns detailed information about a specific chat room
-func GetChatDetail(chatID int64, userID string) (*models.Chat, error) {
-	log.Printf("GetChatDetail: fetching chat %d for user %s", chatID, userID)
+// interestProposalColumns are the interest_proposals columns read into models.InterestProposal
+const interestProposalColumns = "id, user_id, name, names, category_id, parent_id, note, status, interest_id, review_note, reviewed_at, created_at"
 
-	// Get chat basic info - fetch each field separately
-	chat := models.Chat{
-		ID: chatID,
+// CreateInterestProposal stores a pending interest proposal and returns it as stored
+func CreateInterestProposal(p models.InterestProposal) (*models.InterestProposal, error) {
+	names := p.Names
+	if names == nil {
+		names = models.LocalizedNames{}
 	}
+	proposalData := map[string]interface{}{
+		"user_id":     p.UserID,
+		"name":        p.Name,
+		"names":       names,
+		"category_id": p.CategoryID,
+		"parent_id":   p.ParentID,
+		"note":        p.Note,
+		"status":      models.ProposalPending,
+	}
+	var rows []models.InterestProposal
+	if err := Supabase.DB.From("interest_proposals").Insert(proposalData).Execute(&rows); err != nil {
+		return nil, fmt.Errorf("failed to create interest proposal: %v", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("interest proposal creation succeeded but no row returned")
+	}
+	return &rows[0], nil
+}
 
-	// Get user1_id
-	var user1Results []map[string]interface{}
-	err := Supabase.DB.From("chats").
-		Select("user1_id").
-		Eq("id", strconv.FormatInt(chatID, 10)).
-		Execute(&user1Results)
-	if err == nil && len(user1Results) > 0 {
-		chat.User1ID, _ = user1Results[0]["user1_id"].(string)
+// GetUserInterestProposals returns the user's interest proposals, newest first
+func GetUserInterestProposals(userID string) ([]models.InterestProposal, error) {
+	var proposals []models.InterestProposal
+	err := Supabase.DB.From("interest_proposals").
+		Select(interestProposalColumns).
+		OrderBy("id", "desc").
+		Eq("user_id", userID).
+		Execute(&proposals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get interest proposals: %v", err)
 	}
+	return proposals, nil
+}
 
-	// Get user2_id
-	var user2Results []map[string]interface{}
-	err = Supabase.DB.From("chats").
-		Select("user2_id").
-		Eq("id", strconv.FormatInt(chatID, 10)).
-		Execute(&user2Results)
-	if err == nil && len(user2Results) > 0 {
-		chat.User2ID, _ = user2Results[0]["user2_id"].(string)
+// GetInterestProposals returns the proposals with the status (every proposal if empty),
+// oldest first
+func GetInterestProposals(status string) ([]models.InterestProposal, error) {
+	var proposals []models.InterestProposal
+	query := Supabase.DB.From("interest_proposals").
+		Select(interestProposalColumns).
+		OrderBy("id", "asc")
+	var err error
+	if status != "" {
+		err = query.Eq("status", status).Execute(&proposals)
+	} else {
+		err = query.Execute(&proposals)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get interest proposals: %v", err)
 	}
+	return proposals, nil
+}
 
-	// Verify that the user is a participant in this chat
-	if chat.User1ID != userID && chat.User2ID != userID {
-		return nil, fmt.Errorf("user %s is not a participant in chat %d", userID, chatID)
+// GetInterestProposal returns a proposal, or nil if there is none with that ID
+func GetInterestProposal(id int64) (*models.InterestProposal, error) {
+	var proposals []models.InterestProposal
+	err := Supabase.DB.From("interest_proposals").
+		Select(interestProposalColumns).
+		Eq("id", strconv.FormatInt(id, 10)).
+		Execute(&proposals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get interest proposal %d: %v", id, err)
+	}
+	if len(proposals) == 0 {
+		return nil, nil
 	}
+	return &proposals[0], nil
+}
 
-	// Get ai_suggested_theme (optional)
-	var themeResults []map[string]interface{}
-	err = Supabase.DB.From("chats").
-		Select("ai_suggested_theme").
-		Eq("id", strconv.FormatInt(chatID, 10)).
-		Execute(&themeResults)
-	if err == nil && len(themeResults) > 0 {
-		if theme, ok := themeResults[0]["ai_suggested_theme"].(string); ok {
-			chat.AISuggestedTheme = theme
-		}
+// ReviewInterestProposal sets the outcome of a pending proposal. It returns nil if the
+// proposal doesn't exist or was already reviewed.
+func ReviewInterestProposal(id int64, status string, interestID *int, reviewerID, note string) (*models.InterestProposal, error) {
+	reviewData := map[string]interface{}{
+		"status":      status,
+		"interest_id": interestID,
+		"review_note": note,
+		"reviewed_by": reviewerID,
+		"reviewed_at": time.Now().UTC().Format(time.RFC3339),
+	}
+	var rows []models.InterestProposal
+	err := Supabase.DB.From("interest_proposals").
+		Update(reviewData).
+		Eq("id", strconv.FormatInt(id, 10)).
+		Eq("status", models.ProposalPending).
+		Execute(&rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to review interest proposal %d: %v", id, err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
 	}
+	return &rows[0], nil
+}
 
-	// Determine the other user ID
-	var otherUserID string
-	if chat.User1ID == userID {
-		otherUserID = chat.User2ID
-	} else {
-		otherUserID = chat.User1ID
+// CreateInterest adds an interest to the master list
+func CreateInterest(interest models.Interest) (*models.Interest, error) {
+	names := interest.Names
+	if names == nil {
+		names = models.LocalizedNames{}
+	}
+	interestData := map[string]interface{}{
+		"name":  interest.Name,
+		"names": names,
+	}
+	if interest.CategoryID != 0 {
+		interestData["category_id"] = interest.CategoryID
+	}
+	if interest.ParentID != 0 {
+		interestData["parent_id"] = interest.ParentID
+	}
+	var rows []models.Interest
+	if err := Supabase.DB.From("interests").Insert(interestData).Execute(&rows); err != nil {
+		return nil, fmt.Errorf("failed to create interest: %v", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("interest creation succeeded but no row returned")
 	}
+	return &rows[0], nil
+}
 
-	// Get the other user's profile
-	if otherUserID != "" {
-		log.Printf("GetChatDetail: fetching profile for other user %s", otherUserID)
-		otherUser, err := GetUserProfile(otherUserID)
-		if err != nil {
-			log.Printf("error getting other user profile for user %s: %v", otherUserID, err)
-			// Create a minimal user object with just the ID
-			chat.OtherUser = &models.User{
-				ID:       otherUserID,
-				Username: otherUserID, // Fallback to ID if username unavailable
-			}
-		} else {
-			log.Printf("GetChatDetail: successfully got profile for user %s, username: %s", otherUserID, otherUser.Username)
-			chat.OtherUser = otherUser
+// AddUserInterest gives the user an interest at the default preference level. Users who
+// already have it keep their level.
+func AddUserInterest(userID string, interestID int) error {
+	interestData := map[string]interface{}{
+		"user_id":          userID,
+		"interest_id":      interestID,
+		"preference_level": models.DefaultPreferenceLevel,
+	}
+	var results []map[string]interface{}
+	err := Supabase.DB.From("user_interests").Insert(interestData).Execute(&results)
+	if err != nil {
+		errStr := err.Error()
+		if !containsIgnoreCase(errStr, "duplicate key") && !containsIgnoreCase(errStr, "unique constraint") {
+			return fmt.Errorf("failed to add interest %d to user %s: %v", interestID, userID, err)
 		}
 	}
+	return nil
+}
 
-	// Get last message
-	lastMsg, err := GetLastChatMessage(chatID)
+// MergeInterests folds the interest from into into and deletes from: users, sub-interests,
+// proposals and saved searches that had from get into instead, and into gets the
+// translations it is missing. If into is below from in the hierarchy, it takes from's
+// place. The merge_interests function (see docs/DATABASE.md) does it in one transaction.
+// It returns nil if either interest doesn't exist.
+func MergeInterests(fromID, intoID int) (*models.InterestMergeResult, error) {
+	params := map[string]interface{}{
+		"p_from":          fromID,
+		"p_into":          intoID,
+		"p_default_level": models.DefaultPreferenceLevel,
+	}
+	var result *models.InterestMergeResult
+	if err := Supabase.DB.Rpc("merge_interests", params).Execute(&result); err != nil {
+		return nil, fmt.Errorf("failed to merge interest %d into %d: %v", fromID, intoID, err)
+	}
+	return result, nil
+}
+
+// GetCampusLocations returns the active campus locations meetups can be held at
+func GetCampusLocations() ([]models.CampusLocation, error) {
+	var locations []models.CampusLocation
+	err := Supabase.DB.From("campus_locations").
+		Select("id, slug, name, names, building, latitude, longitude, sort_order").
+		OrderBy("sort_order", "asc").
+		Eq("active", "true").
+		Execute(&locations)
 	if err != nil {
-		log.Printf("error getting last message for chat %d: %v", chatID, err)
-	} else if lastMsg != nil {
-		log.Printf("GetChatDetail: successfully got last message for chat %d: %s", chatID, lastMsg.Content)
-		chat.LastMessage = lastMsg
+		return nil, fmt.Errorf("failed to get campus locations: %v", err)
 	}
-
-	return &chat, nil
+	return locations, nil
 }
 
-// GetOrCreateChat finds an existing chat between two users or creates a new one
-// Returns the chat ID
-func GetOrCreateChat(user1ID, user2ID string) (int64, error) {
-	log.Printf("GetOrCreateChat: finding or creating chat between %s and %s", user1ID, user2ID)
+// GetCampusLocation returns an active campus location, or nil if there is none with the ID
+func GetCampusLocation(id int) (*models.CampusLocation, error) {
+	var locations []models.CampusLocation
+	err := Supabase.DB.From("campus_locations").
+		Select("id, slug, name, names, building, latitude, longitude, sort_order").
+		Eq("id", strconv.Itoa(id)).
+		Eq("active", "true").
+		Execute(&locations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get campus location %d: %v", id, err)
+	}
+	if len(locations) == 0 {
+		return nil, nil
+	}
+	return &locations[0], nil
+}
 
-	// Ensure user1ID < user2ID for consistent ordering (to match unique index)
-	// The unique index uses LEAST(user1_id, user2_id) and GREATEST(user1_id, user2_id)
-	// So we need to check both orders: user1-user2 and user2-user1
-	var existingChatID int64
-	found := false
+// meetupColumns selects a meetup proposal with its campus location
+const meetupColumns = "id, chat_id, proposer_id, recipient_id, candidates, location_id, event_id, note, status, accepted_start, accepted_end, previous_id, responded_at, reminders_sent, created_at, campus_locations(id, slug, name, names, building, latitude, longitude, sort_order)"
+
+// meetupRow is a meetup_proposals row as read from Supabase
+type meetupRow struct {
+	ID              int64                  `json:"id"`
+	ChatID          int64                  `json:"chat_id"`
+	ProposerID      string                 `json:"proposer_id"`
+	RecipientID     string                 `json:"recipient_id"`
+	Candidates      []models.MeetupSlot    `json:"candidates"`
+	LocationID      int                    `json:"location_id"`
+	EventID         *int64                 `json:"event_id"`
+	Note            *string                `json:"note"`
+	Status          string                 `json:"status"`
+	AcceptedStart   *time.Time             `json:"accepted_start"`
+	AcceptedEnd     *time.Time             `json:"accepted_end"`
+	PreviousID      *int64                 `json:"previous_id"`
+	RespondedAt     *time.Time             `json:"responded_at"`
+	RemindersSent   []string               `json:"reminders_sent"`
+	CreatedAt       time.Time              `json:"created_at"`
+	CampusLocations *models.CampusLocation `json:"campus_locations"`
+}
 
-	// Try to find existing chat: user1_id = user1ID and user2_id = user2ID
-	var results1 []map[string]interface{}
-	err1 := Supabase.DB.From("chats").
-		Select("id").
-		Eq("user1_id", user1ID).
-		Eq("user2_id", user2ID).
-		Execute(&results1)
+func (r meetupRow) toModel() models.MeetupProposal {
+	p := models.MeetupProposal{
+		ID:            r.ID,
+		ChatID:        r.ChatID,
+		ProposerID:    r.ProposerID,
+		RecipientID:   r.RecipientID,
+		Candidates:    r.Candidates,
+		LocationID:    r.LocationID,
+		Location:      r.CampusLocations,
+		EventID:       r.EventID,
+		Note:          derefString(r.Note),
+		Status:        r.Status,
+		PreviousID:    r.PreviousID,
+		RespondedAt:   r.RespondedAt,
+		RemindersSent: r.RemindersSent,
+		CreatedAt:     r.CreatedAt,
+	}
+	if p.Candidates == nil {
+		p.Candidates = []models.MeetupSlot{}
+	}
+	if r.AcceptedStart != nil && r.AcceptedEnd != nil {
+		p.AcceptedSlot = &models.MeetupSlot{Start: *r.AcceptedStart, End: *r.AcceptedEnd}
+	}
+	return p
+}
 
-	if err1 == nil && len(results1) > 0 {
-		if idFloat, ok := results1[0]["id"].(float64); ok {
-			existingChatID = int64(idFloat)
-			found = true
-			log.Printf("GetOrCreateChat: found existing chat %d (user1=%s, user2=%s)", existingChatID, user1ID, user2ID)
-		}
+func meetupModels(rows []meetupRow) []models.MeetupProposal {
+	proposals := make([]models.MeetupProposal, len(rows))
+	for i, row := range rows {
+		proposals[i] = row.toModel()
 	}
+	return proposals
+}
 
-	// Try to find existing chat: user1_id = user2ID and user2_id = user1ID
-	if !found {
-		var results2 []map[string]interface{}
-		err2 := Supabase.DB.From("chats").
-			Select("id").
-			Eq("user1_id", user2ID).
-			Eq("user2_id", user1ID).
-			Execute(&results2)
+// CreateMeetupProposal stores a pending meetup proposal and returns it as stored, with its location
+func CreateMeetupProposal(p models.MeetupProposal) (*models.MeetupProposal, error) {
+	proposalData := map[string]interface{}{
+		"chat_id":      p.ChatID,
+		"proposer_id":  p.ProposerID,
+		"recipient_id": p.RecipientID,
+		"candidates":   p.Candidates,
+		"location_id":  p.LocationID,
+		"event_id":     p.EventID,
+		"note":         p.Note,
+		"status":       models.MeetupPending,
+		"previous_id":  p.PreviousID,
+	}
+	var rows []meetupRow
+	if err := Supabase.DB.From("meetup_proposals").Insert(proposalData).Execute(&rows); err != nil {
+		return nil, fmt.Errorf("failed to create meetup proposal: %v", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("meetup proposal creation succeeded but no row returned")
+	}
+	// The insert doesn't embed the location
+	return GetMeetupProposal(rows[0].ID)
+}
 
-		if err2 == nil && len(results2) > 0 {
-			if idFloat, ok := results2[0]["id"].(float64); ok {
-				existingChatID = int64(idFloat)
-				found = true
-				log.Printf("GetOrCreateChat: found existing chat %d (user1=%s, user2=%s)", existingChatID, user2ID, user1ID)
-			}
-		}
+// GetMeetupProposal returns a meetup proposal with its location, or nil if it doesn't exist
+func GetMeetupProposal(id int64) (*models.MeetupProposal, error) {
+	var rows []meetupRow
+	err := Supabase.DB.From("meetup_proposals").
+		Select(meetupColumns).
+		Eq("id", strconv.FormatInt(id, 10)).
+		Execute(&rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get meetup proposal %d: %v", id, err)
 	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	p := rows[0].toModel()
+	return &p, nil
+}
 
-	// If chat exists, return it
-	if found {
-		return existingChatID, nil
+// GetMeetupProposals returns the meetup proposals with the IDs, keyed by ID
+func GetMeetupProposals(ids []int64) (map[int64]models.MeetupProposal, error) {
+	proposals := make(map[int64]models.MeetupProposal, len(ids))
+	if len(ids) == 0 {
+		return proposals, nil
+	}
+	values := make([]string, len(ids))
+	for i, id := range ids {
+		values[i] = strconv.FormatInt(id, 10)
+	}
+	var rows []meetupRow
+	err := Supabase.DB.From("meetup_proposals").
+		Select(meetupColumns).
+		In("id", values).
+		Execute(&rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get meetup proposals: %v", err)
+	}
+	for _, row := range rows {
+		proposals[row.ID] = row.toModel()
+	}
+	return proposals, nil
+}
+
+// RespondMeetupProposal moves a pending proposal to status, with the accepted slot when
+// accepting. It returns nil if the proposal was no longer pending.
+func RespondMeetupProposal(id int64, status string, accepted *models.MeetupSlot) (*models.MeetupProposal, error) {
+	responseData := map[string]interface{}{
+		"status":       status,
+		"responded_at": time.Now().UTC().Format(time.RFC3339),
+	}
+	if accepted != nil {
+		responseData["accepted_start"] = accepted.Start.UTC().Format(time.RFC3339)
+		responseData["accepted_end"] = accepted.End.UTC().Format(time.RFC3339)
+	}
+	var rows []meetupRow
+	err := Supabase.DB.From("meetup_proposals").
+		Update(responseData).
+		Eq("id", strconv.FormatInt(id, 10)).
+		Eq("status", models.MeetupPending).
+		Execute(&rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to respond to meetup proposal %d: %v", id, err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
 	}
+	return GetMeetupProposal(id)
+}
 
-	// Chat doesn't exist, create a new one
-	log.Printf("GetOrCreateChat: no existing chat found, creating new chat")
-	chatData := map[string]interface{}{
-		"user1_id": user1ID,
-		"user2_id": user2ID,
+// GetUpcomingMeetups returns the accepted meetups starting in [from, to), with their location
+func GetUpcomingMeetups(from, to time.Time) ([]models.MeetupProposal, error) {
+	var rows []meetupRow
+	err := Supabase.DB.From("meetup_proposals").
+		Select(meetupColumns).
+		OrderBy("accepted_start", "asc").
+		Eq("status", models.MeetupAccepted).
+		Gte("accepted_start", from.UTC().Format(time.RFC3339)).
+		Lt("accepted_start", to.UTC().Format(time.RFC3339)).
+		Execute(&rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get upcoming meetups: %v", err)
 	}
+	return meetupModels(rows), nil
+}
 
-	var insertResults []map[string]interface{}
-	err := Supabase.DB.From("chats").Insert(chatData).Execute(&insertResults)
+// AddMeetupReminders records reminders as sent for a meetup
+func AddMeetupReminders(meetupID int64, names []string) error {
+	p, err := GetMeetupProposal(meetupID)
 	if err != nil {
-		errStr := err.Error()
-		// Check if it's a duplicate key error (race condition - another request created it)
-		if containsIgnoreCase(errStr, "duplicate key") || containsIgnoreCase(errStr, "unique constraint") {
-			log.Printf("GetOrCreateChat: chat was created by another request, retrying to find it")
-			// Retry finding the chat
-			var retryResults []map[string]interface{}
-			err1 := Supabase.DB.From("chats").
-				Select("id").
-				Eq("user1_id", user1ID).
-				Eq("user2_id", user2ID).
-				Execute(&retryResults)
-			if err1 == nil && len(retryResults) > 0 {
-				if idFloat, ok := retryResults[0]["id"].(float64); ok {
-					return int64(idFloat), nil
-				}
-			}
-			// Try reverse order
-			err2 := Supabase.DB.From("chats").
-				Select("id").
-				Eq("user1_id", user2ID).
-				Eq("user2_id", user1ID).
-				Execute(&retryResults)
-			if err2 == nil && len(retryResults) > 0 {
-				if idFloat, ok := retryResults[0]["id"].(float64); ok {
-					return int64(idFloat), nil
-				}
+		return err
+	}
+	if p == nil {
+		return nil
+	}
+	sent := append([]string{}, p.RemindersSent...)
+	for _, name := range names {
+		found := false
+		for _, s := range sent {
+			if s == name {
+				found = true
+				break
 			}
 		}
-		return 0, fmt.Errorf("failed to create chat: %v", err)
+		if !found {
+			sent = append(sent, name)
+		}
 	}
-
-	if len(insertResults) == 0 {
-		return 0, fmt.Errorf("chat creation succeeded but no ID returned")
+	var results []map[string]interface{}
+	err = Supabase.DB.From("meetup_proposals").
+		Update(map[string]interface{}{"reminders_sent": sent}).
+		Eq("id", strconv.FormatInt(meetupID, 10)).
+		Execute(&results)
+	if err != nil {
+		return fmt.Errorf("failed to mark meetup %d reminded: %v", meetupID, err)
 	}
+	return nil
+}
 
-	// Extract the created chat ID
-	if idFloat, ok := insertResults[0]["id"].(float64); ok {
-		newChatID := int64(idFloat)
-		log.Printf("GetOrCreateChat: created new chat %d", newChatID)
-		return newChatID, nil
+// attachMeetups fills in the proposal of each meetup message
+func attachMeetups(messages []models.Message) error {
+	var ids []int64
+	for _, m := range messages {
+		if m.MeetupID != nil {
+			ids = append(ids, *m.MeetupID)
+		}
 	}
-
-	return 0, fmt.Errorf("chat creation succeeded but could not extract ID from response")
+	if len(ids) == 0 {
+		return nil
+	}
+	proposals, err := GetMeetupProposals(ids)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		if messages[i].MeetupID == nil {
+			continue
+		}
+		if p, ok := proposals[*messages[i].MeetupID]; ok {
+			messages[i].Meetup = &p
+		}
+	}
+	return nil
 }
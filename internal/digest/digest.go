@@ -0,0 +1,114 @@
+// Package digest builds and sends the periodic email digest of unread messages,
+// new matches and upcoming events.
+package digest
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"net/url"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var (
+	htmlTemplate = htmltemplate.Must(htmltemplate.New("digest.html").Funcs(htmltemplate.FuncMap(templateFuncs)).ParseFS(templateFS, "templates/digest.html"))
+	textTemplate = texttemplate.Must(texttemplate.New("digest.txt").Funcs(templateFuncs).ParseFS(templateFS, "templates/digest.txt"))
+)
+
+// Dates in the digest are shown in Japan time, where the campus is.
+var displayLocation = loadLocation("Asia/Tokyo")
+
+var templateFuncs = texttemplate.FuncMap{
+	"date": func(t time.Time) string {
+		return t.In(displayLocation).Format("2006/01/02 15:04")
+	},
+}
+
+func loadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.FixedZone("JST", 9*60*60)
+	}
+	return loc
+}
+
+// ChatSummary is a chat with unread messages.
+type ChatSummary struct {
+	ChatID int64
+	// The other user of a direct chat, or the title of a group or event room
+	OtherUsername string
+	UnreadCount   int
+	LastMessage   string
+}
+
+// MatchSummary is a mutual "want to meet" match.
+type MatchSummary struct {
+	ChatID   int64
+	Username string
+}
+
+// EventSummary is an upcoming school event.
+type EventSummary struct {
+	Title     string
+	StartTime time.Time
+}
+
+// Digest is the content of one user's digest email.
+type Digest struct {
+	Username string
+	Chats    []ChatSummary
+	Matches  []MatchSummary
+	Events   []EventSummary
+	// Link to open the app
+	AppURL string
+	// One-click unsubscribe link
+	UnsubscribeURL string
+}
+
+// Empty reports whether there is nothing worth emailing about.
+func (d Digest) Empty() bool {
+	return len(d.Chats) == 0 && len(d.Matches) == 0 && len(d.Events) == 0
+}
+
+// UnreadCount is the total number of unread messages.
+func (d Digest) UnreadCount() int {
+	total := 0
+	for _, chat := range d.Chats {
+		total += chat.UnreadCount
+	}
+	return total
+}
+
+// Subject returns the bilingual email subject.
+func (d Digest) Subject() string {
+	switch {
+	case d.UnreadCount() > 0:
+		return fmt.Sprintf("[Meetupr] 未読メッセージ %d件 / %d unread messages", d.UnreadCount(), d.UnreadCount())
+	case len(d.Matches) > 0:
+		return fmt.Sprintf("[Meetupr] 新しいマッチ %d件 / %d new matches", len(d.Matches), len(d.Matches))
+	default:
+		return "[Meetupr] 今後のイベント / Upcoming events"
+	}
+}
+
+// Render returns the HTML and plain text bodies of the email.
+func (d Digest) Render() (html, text string, err error) {
+	var htmlBuf, textBuf bytes.Buffer
+	if err := htmlTemplate.Execute(&htmlBuf, d); err != nil {
+		return "", "", err
+	}
+	if err := textTemplate.Execute(&textBuf, d); err != nil {
+		return "", "", err
+	}
+	return htmlBuf.String(), textBuf.String(), nil
+}
+
+// unsubscribeURL builds the one-click unsubscribe link for a token.
+func unsubscribeURL(baseURL, token string) string {
+	return baseURL + "/api/v1/email/unsubscribe?token=" + url.QueryEscape(token)
+}
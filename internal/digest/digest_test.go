@@ -0,0 +1,102 @@
+package digest
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"meetupr-backend/internal/mail"
+	"meetupr-backend/internal/models"
+)
+
+type fakeStore struct {
+	subscribers []models.EmailPreferences
+	chats       map[string][]ChatSummary
+	matches     map[string][]MatchSummary
+	sent        map[string]time.Time
+}
+
+func (s *fakeStore) Subscribers() ([]models.EmailPreferences, error) { return s.subscribers, nil }
+func (s *fakeStore) Contact(userID string) (string, string, error) {
+	return userID + "@example.com", userID, nil
+}
+func (s *fakeStore) UnreadChats(userID string) ([]ChatSummary, error) { return s.chats[userID], nil }
+func (s *fakeStore) MatchesSince(userID string, since time.Time) ([]MatchSummary, error) {
+	return s.matches[userID], nil
+}
+func (s *fakeStore) UpcomingEvents(from, to time.Time) ([]EventSummary, error) { return nil, nil }
+func (s *fakeStore) MarkSent(userID string, at time.Time) error {
+	s.sent[userID] = at
+	return nil
+}
+
+type recordingMailer struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+func TestJobSendsDueDigests(t *testing.T) {
+	// 09:00 in Tokyo
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	twoDaysAgo := now.Add(-48 * time.Hour)
+
+	store := &fakeStore{
+		subscribers: []models.EmailPreferences{
+			{UserID: "daily", Frequency: models.EmailFrequencyDaily, UnsubscribeToken: "tok-daily"},
+			{UserID: "weekly", Frequency: models.EmailFrequencyWeekly, LastDigestAt: &twoDaysAgo},
+			{UserID: "nothing-new", Frequency: models.EmailFrequencyDaily},
+		},
+		chats: map[string][]ChatSummary{
+			"daily":  {{ChatID: 1, OtherUsername: "yuki", UnreadCount: 2, LastMessage: "<b>また明日</b>"}},
+			"weekly": {{ChatID: 2, OtherUsername: "sam", UnreadCount: 1}},
+		},
+		matches: map[string][]MatchSummary{"daily": {{ChatID: 3, Username: "lee"}}},
+		sent:    map[string]time.Time{},
+	}
+	mailer := &recordingMailer{}
+	job := NewJob(store, mailer, Config{From: "Meetupr <no-reply@example.com>", BaseURL: "https://api.example.com", AppURL: "https://app.example.com", SendHour: 8})
+	job.now = func() time.Time { return now }
+
+	if err := job.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(mailer.messages) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(mailer.messages))
+	}
+	msg := mailer.messages[0]
+	if msg.To != "daily@example.com" || !strings.Contains(msg.Subject, "未読メッセージ 2件") || !strings.Contains(msg.Subject, "2 unread messages") {
+		t.Errorf("unexpected email: %s %q", msg.To, msg.Subject)
+	}
+	for _, want := range []string{"Unread messages", "未読メッセージ", "New matches", "lee", "https://api.example.com/api/v1/email/unsubscribe?token=tok-daily"} {
+		if !strings.Contains(msg.HTML, want) || !strings.Contains(msg.Text, want) {
+			t.Errorf("email is missing %q", want)
+		}
+	}
+	if strings.Contains(msg.HTML, "<b>また明日</b>") {
+		t.Errorf("message content was not escaped in HTML")
+	}
+	if msg.Headers["List-Unsubscribe-Post"] != "List-Unsubscribe=One-Click" {
+		t.Errorf("missing one-click unsubscribe header: %v", msg.Headers)
+	}
+	if _, ok := store.sent["daily"]; !ok || len(store.sent) != 1 {
+		t.Errorf("sent digests recorded for %v, want only daily", store.sent)
+	}
+
+	// Nothing goes out before the send hour
+	mailer.messages = nil
+	job.now = func() time.Time { return time.Date(2026, 10, 19, 21, 0, 0, 0, time.UTC) } // 06:00 JST
+	store.sent = map[string]time.Time{}
+	job.Run(context.Background())
+	if len(mailer.messages) != 0 {
+		t.Errorf("sent %d emails before the send hour", len(mailer.messages))
+	}
+}
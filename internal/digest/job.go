@@ -0,0 +1,179 @@
+package digest
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"meetupr-backend/internal/mail"
+	"meetupr-backend/internal/models"
+)
+
+// Store provides the data a digest is built from.
+type Store interface {
+	// Subscribers returns the email preferences of users whose frequency isn't off.
+	Subscribers() ([]models.EmailPreferences, error)
+	// Contact returns the user's email address and username.
+	Contact(userID string) (email, username string, err error)
+	UnreadChats(userID string) ([]ChatSummary, error)
+	MatchesSince(userID string, since time.Time) ([]MatchSummary, error)
+	UpcomingEvents(from, to time.Time) ([]EventSummary, error)
+	// MarkSent records when the user's digest was sent.
+	MarkSent(userID string, at time.Time) error
+}
+
+// Config configures a Job.
+type Config struct {
+	// Sender address, e.g. "Meetupr <no-reply@example.com>".
+	From string
+	// Public URL of this API, used for unsubscribe links.
+	BaseURL string
+	// URL of the web app, linked from the email.
+	AppURL string
+	// Hour of the day (Japan time) from which digests are sent.
+	SendHour int
+}
+
+// Job sends digests to the users that are due one.
+type Job struct {
+	store  Store
+	mailer mail.Mailer
+	config Config
+	now    func() time.Time
+}
+
+// NewJob creates a digest Job.
+func NewJob(store Store, mailer mail.Mailer, config Config) *Job {
+	return &Job{store: store, mailer: mailer, config: config, now: time.Now}
+}
+
+// Start runs the job every interval until ctx is done. Users are only mailed once per
+// period, so running often is harmless and makes up for restarts.
+func (j *Job) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := j.Run(ctx); err != nil {
+			log.Printf("digest: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run sends a digest to every subscriber that is due one and has something to read.
+func (j *Job) Run(ctx context.Context) error {
+	now := j.now()
+	if now.In(displayLocation).Hour() < j.config.SendHour {
+		return nil
+	}
+
+	subscribers, err := j.store.Subscribers()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	sent := 0
+	for _, preferences := range subscribers {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !due(preferences, now) {
+			continue
+		}
+		ok, err := j.send(ctx, preferences, now)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+	if sent > 0 {
+		log.Printf("digest: sent %d digest(s)", sent)
+	}
+	return errors.Join(errs...)
+}
+
+// due reports whether a user's next digest should go out at now.
+func due(preferences models.EmailPreferences, now time.Time) bool {
+	var period time.Duration
+	switch preferences.Frequency {
+	case models.EmailFrequencyDaily:
+		period = 24 * time.Hour
+	case models.EmailFrequencyWeekly:
+		period = 7 * 24 * time.Hour
+	default:
+		return false
+	}
+	if preferences.LastDigestAt == nil {
+		return true
+	}
+	// An hour of slack so the send time doesn't drift later every period
+	return now.Sub(*preferences.LastDigestAt) >= period-time.Hour
+}
+
+// send builds and mails one user's digest. It reports false if there was nothing to send.
+func (j *Job) send(ctx context.Context, preferences models.EmailPreferences, now time.Time) (bool, error) {
+	email, username, err := j.store.Contact(preferences.UserID)
+	if err != nil {
+		return false, err
+	}
+	if email == "" {
+		return false, nil
+	}
+
+	lookahead := 2 * 24 * time.Hour
+	since := now.Add(-24 * time.Hour)
+	if preferences.Frequency == models.EmailFrequencyWeekly {
+		lookahead = 7 * 24 * time.Hour
+		since = now.Add(-7 * 24 * time.Hour)
+	}
+	if preferences.LastDigestAt != nil && preferences.LastDigestAt.After(since) {
+		since = *preferences.LastDigestAt
+	}
+
+	d := Digest{
+		Username:       username,
+		AppURL:         j.config.AppURL,
+		UnsubscribeURL: unsubscribeURL(j.config.BaseURL, preferences.UnsubscribeToken),
+	}
+	if d.Chats, err = j.store.UnreadChats(preferences.UserID); err != nil {
+		return false, err
+	}
+	if d.Matches, err = j.store.MatchesSince(preferences.UserID, since); err != nil {
+		return false, err
+	}
+	if d.Events, err = j.store.UpcomingEvents(now, now.Add(lookahead)); err != nil {
+		return false, err
+	}
+	if d.Empty() {
+		return false, nil
+	}
+
+	html, text, err := d.Render()
+	if err != nil {
+		return false, err
+	}
+	err = j.mailer.Send(ctx, mail.Message{
+		From:    j.config.From,
+		To:      email,
+		Subject: d.Subject(),
+		HTML:    html,
+		Text:    text,
+		Headers: map[string]string{
+			// RFC 8058 one-click unsubscribe
+			"List-Unsubscribe":      "<" + d.UnsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, j.store.MarkSent(preferences.UserID, now)
+}
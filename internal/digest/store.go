@@ -0,0 +1,81 @@
+package digest
+
+import (
+	"strconv"
+	"time"
+
+	"meetupr-backend/internal/db"
+	"meetupr-backend/internal/models"
+)
+
+// SupabaseStore is the Store backed by the Supabase tables.
+type SupabaseStore struct{}
+
+func (SupabaseStore) Subscribers() ([]models.EmailPreferences, error) {
+	return db.GetDigestSubscribers()
+}
+
+func (SupabaseStore) Contact(userID string) (string, string, error) {
+	return db.GetUserContact(userID)
+}
+
+func (SupabaseStore) UnreadChats(userID string) ([]ChatSummary, error) {
+	chats, err := db.GetUserChats(userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var summaries []ChatSummary
+	for _, chat := range chats {
+		// Muted chats are left out of the digest like they are left out of pushes
+		if chat.UnreadCount == 0 || chat.Settings.Muted(now) {
+			continue
+		}
+		summary := ChatSummary{ChatID: chat.ID, UnreadCount: chat.UnreadCount}
+		if chat.OtherUser != nil {
+			summary.OtherUsername = chat.OtherUser.Username
+		} else {
+			summary.OtherUsername = chat.Title
+		}
+		if chat.LastMessage != nil {
+			summary.LastMessage = chat.LastMessage.Content
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+func (SupabaseStore) MatchesSince(userID string, since time.Time) ([]MatchSummary, error) {
+	notifications, err := db.GetNotificationsSince(userID, models.NotificationMatch, since)
+	if err != nil {
+		return nil, err
+	}
+	var matches []MatchSummary
+	for _, n := range notifications {
+		match := MatchSummary{Username: n.ActorID}
+		if chatID, err := strconv.ParseInt(n.TargetID, 10, 64); err == nil {
+			match.ChatID = chatID
+		}
+		if _, username, err := db.GetUserContact(n.ActorID); err == nil && username != "" {
+			match.Username = username
+		}
+		matches = append(matches, match)
+	}
+	return matches, nil
+}
+
+func (SupabaseStore) UpcomingEvents(from, to time.Time) ([]EventSummary, error) {
+	events, err := db.GetUpcomingEvents(from, to)
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]EventSummary, 0, len(events))
+	for _, event := range events {
+		summaries = append(summaries, EventSummary{Title: event.Title, StartTime: event.StartTime})
+	}
+	return summaries, nil
+}
+
+func (SupabaseStore) MarkSent(userID string, at time.Time) error {
+	return db.SetLastDigestAt(userID, at)
+}
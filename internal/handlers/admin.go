@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AnnouncementRequest is the body of POST /api/v1/admin/announcements.
+type AnnouncementRequest struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// CreateAnnouncement godoc
+// @Summary Send an announcement to all users
+// @Description Broadcast an announcement event to every connected /ws/user socket. Admin only.
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Param   announcement body AnnouncementRequest true "Announcement"
+// @Success 202 {object} Announcement
+// @Router /api/v1/admin/announcements [post]
+func CreateAnnouncement(hub *Hub) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req AnnouncementRequest
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+		}
+		if strings.TrimSpace(req.Title) == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "title is required")
+		}
+
+		announcement := Announcement{
+			Title:     req.Title,
+			Body:      req.Body,
+			CreatedAt: time.Now().UTC(),
+		}
+		if err := hub.Announce(c.Request().Context(), announcement); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to send announcement: "+err.Error())
+		}
+		return c.JSON(http.StatusAccepted, announcement)
+	}
+}
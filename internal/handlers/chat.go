@@ -1,21 +1,36 @@
 package handlers
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 
 	"meetupr-backend/internal/db"
+	"meetupr-backend/internal/models"
 
 	"github.com/labstack/echo/v4"
 )
 
+const (
+	defaultChatPageSize = 50
+	maxChatPageSize     = 100
+	// Response header carrying the cursor of the next page of a list
+	headerNextCursor = "X-Next-Cursor"
+)
+
 // GetChats godoc
 // @Summary Get list of chat rooms
-// @Description Get a list of chat rooms that the current user is participating in
+// @Description Get a page of the chat rooms that the current user is participating in, with the other user's summary, last message, unread count and the user's settings. Pinned chats come first, then the most recently active. Archived chats are left out unless archived=true (only archived chats) or archived=all. When there are more chats, the X-Next-Cursor header holds the cursor for the next page.
 // @Tags chats
 // @Produce  json
+// @Param   archived query string false "true for archived chats only, all for every chat"
+// @Param   cursor query string false "X-Next-Cursor from the previous page"
+// @Param   limit query int false "Page size (default 50, max 100)"
 // @Success 200 {array} models.Chat
+// @Header  200 {string} X-Next-Cursor "Cursor for the next page"
 // @Router /api/v1/chats [get]
 func GetChats(c echo.Context) error {
 	userID, ok := c.Get("user_id").(string)
@@ -23,14 +38,68 @@ func GetChats(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
 	}
 
-	chats, err := db.GetUserChats(userID)
+	opts := db.ChatListOptions{Limit: defaultChatPageSize}
+	switch c.QueryParam("archived") {
+	case "", "false":
+		opts.Archived = db.ChatsUnarchived
+	case "true":
+		opts.Archived = db.ChatsArchivedOnly
+	case "all":
+		opts.Archived = db.ChatsAll
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "archived must be true, false or all")
+	}
+	if cursor := c.QueryParam("cursor"); cursor != "" {
+		decoded, err := decodeChatCursor(cursor)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid cursor")
+		}
+		opts.Cursor = decoded
+	}
+	if limitStr := c.QueryParam("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid limit")
+		}
+		opts.Limit = min(parsed, maxChatPageSize)
+	}
+	limit := opts.Limit
+	// Fetch one extra chat to know whether there is a next page
+	opts.Limit++
+
+	chats, err := db.ListUserChats(userID, opts)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get chats: "+err.Error())
 	}
+	if len(chats) > limit {
+		chats = chats[:limit]
+		c.Response().Header().Set(headerNextCursor, encodeChatCursor(db.CursorAfter(chats[limit-1])))
+	}
+	if err := redactOtherUsers(userID, chats); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get privacy settings: "+err.Error())
+	}
 
 	return c.JSON(http.StatusOK, chats)
 }
 
+// encodeChatCursor makes a chat list cursor opaque to clients.
+func encodeChatCursor(cursor db.ChatCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeChatCursor(value string) (*db.ChatCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var cursor db.ChatCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
 // GetChatMessages godoc
 // @Summary Get messages from a chat room
 // @Description Get message history from a specific chat room
@@ -98,39 +167,185 @@ func GetChatDetail(c echo.Context) error {
 		}
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get chat details: "+err.Error())
 	}
+	if err := redactOtherUsers(userID, []models.Chat{*chat}); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get privacy settings: "+err.Error())
+	}
 
 	return c.JSON(http.StatusOK, chat)
 }
 
+// redactOtherUsers clears the fields of the other users of chats that they don't share
+// with userID. OtherUser is a pointer, so copies of the chats are redacted too.
+func redactOtherUsers(userID string, chats []models.Chat) error {
+	var ownerIDs []string
+	for _, chat := range chats {
+		if chat.OtherUser != nil {
+			ownerIDs = append(ownerIDs, chat.OtherUser.ID)
+		}
+	}
+	if len(ownerIDs) == 0 {
+		return nil
+	}
+	viewer, err := db.GetProfileViewer(userID, ownerIDs)
+	if err != nil {
+		return err
+	}
+	for _, chat := range chats {
+		if chat.OtherUser != nil {
+			viewer.Redact(chat.OtherUser)
+		}
+	}
+	return nil
+}
+
 // GetOrCreateChatWithUser godoc
 // @Summary Get or create a chat with another user
-// @Description Get an existing chat ID or create a new chat between the current user and another user
+// @Description Get an existing chat ID or create a new chat between the current user and another user. The other user is notified with a chat_created event when the chat is new.
 // @Tags chats
 // @Produce  json
 // @Param   otherUserId path string true "Other User ID"
 // @Success 200 {object} map[string]interface{} "Returns chat_id"
 // @Router /api/v1/chats/with/{otherUserId} [get]
-func GetOrCreateChatWithUser(c echo.Context) error {
-	userID, ok := c.Get("user_id").(string)
-	if !ok || userID == "" {
-		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
-	}
+func GetOrCreateChatWithUser(hub *Hub) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := c.Get("user_id").(string)
+		if !ok || userID == "" {
+			return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+		}
 
-	otherUserID := c.Param("otherUserId")
-	if otherUserID == "" {
-		return echo.NewHTTPError(http.StatusBadRequest, "Other user ID is required")
-	}
+		otherUserID := c.Param("otherUserId")
+		if otherUserID == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "Other user ID is required")
+		}
+
+		if otherUserID == userID {
+			return echo.NewHTTPError(http.StatusBadRequest, "Cannot create a chat with yourself")
+		}
 
-	if otherUserID == userID {
-		return echo.NewHTTPError(http.StatusBadRequest, "Cannot create a chat with yourself")
+		chatID, created, err := db.GetOrCreateChat(userID, otherUserID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get or create chat: "+err.Error())
+		}
+		if created {
+			hub.SendEvent(otherUserID, EventChatCreated, chatID, ChatCreated{OtherUserID: userID})
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"chat_id": chatID,
+		})
 	}
+}
 
-	chatID, err := db.GetOrCreateChat(userID, otherUserID)
-	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get or create chat: "+err.Error())
+// MarkChatRead godoc
+// @Summary Mark a chat as read
+// @Description Record that the current user has read the chat up to a message (the latest message if message_id is omitted). The user's other devices get a chat_updated event with the new unread count.
+// @Tags chats
+// @Accept  json
+// @Produce  json
+// @Param   chatId path int true "Chat ID"
+// @Param   read body models.MarkChatReadRequest false "Last read message"
+// @Success 200 {object} map[string]interface{} "Returns unread_count"
+// @Router /api/v1/chats/{chatId}/read [post]
+func MarkChatRead(hub *Hub) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := c.Get("user_id").(string)
+		if !ok || userID == "" {
+			return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+		}
+
+		chatID, err := strconv.ParseInt(c.Param("chatId"), 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid chat ID")
+		}
+
+		var req models.MarkChatReadRequest
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+		}
+
+		isParticipant, err := db.IsChatParticipant(chatID, userID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to verify chat access: "+err.Error())
+		}
+		if !isParticipant {
+			return echo.NewHTTPError(http.StatusForbidden, "You are not a participant in this chat")
+		}
+
+		messageID := req.MessageID
+		if messageID == 0 {
+			lastMsg, err := db.GetLastChatMessage(chatID)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get last message: "+err.Error())
+			}
+			if lastMsg != nil {
+				messageID = lastMsg.ID
+			}
+		}
+
+		if err := db.MarkChatRead(chatID, userID, messageID); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		unreadCount, err := db.GetUnreadCount(chatID, userID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get unread count: "+err.Error())
+		}
+		// Clear the badge on the user's other devices
+		hub.SendEvent(userID, EventChatUpdated, chatID, ChatUpdate{UnreadCount: unreadCount})
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"chat_id":      chatID,
+			"unread_count": unreadCount,
+		})
 	}
+}
+
+// UpdateChatSettings godoc
+// @Summary Update the current user's settings for a chat
+// @Description Mute (muted_until; null to unmute), archive or pin a chat. Settings are per participant; the other user is not affected. The user's other devices get a chat_updated event with the new settings.
+// @Tags chats
+// @Accept  json
+// @Produce  json
+// @Param   chatId path int true "Chat ID"
+// @Param   settings body models.ChatSettings true "Chat settings"
+// @Success 200 {object} models.ChatSettings
+// @Router /api/v1/chats/{chatId}/settings [put]
+func UpdateChatSettings(hub *Hub) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := c.Get("user_id").(string)
+		if !ok || userID == "" {
+			return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+		}
+
+		chatID, err := strconv.ParseInt(c.Param("chatId"), 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid chat ID")
+		}
+
+		var req models.ChatSettings
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+		}
 
-	return c.JSON(http.StatusOK, map[string]interface{}{
-		"chat_id": chatID,
-	})
+		isParticipant, err := db.IsChatParticipant(chatID, userID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to verify chat access: "+err.Error())
+		}
+		if !isParticipant {
+			return echo.NewHTTPError(http.StatusForbidden, "You are not a participant in this chat")
+		}
+
+		settings, err := db.UpdateChatSettings(chatID, userID, req)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		unreadCount, err := db.GetUnreadCount(chatID, userID)
+		if err != nil {
+			log.Printf("error getting unread count for chat %d: %v", chatID, err)
+		}
+		hub.SendEvent(userID, EventChatUpdated, chatID, ChatUpdate{UnreadCount: unreadCount, Settings: &settings})
+
+		return c.JSON(http.StatusOK, settings)
+	}
 }
@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"meetupr-backend/internal/db"
+	"meetupr-backend/internal/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Maximum number of members of a group room, the owner included
+	maxGroupMembers = 50
+	// Maximum number of members of an event room; every message is fanned out to all of them
+	maxEventRoomMembers = 500
+	maxChatTitleRunes   = 50
+)
+
+// CreateGroupChat godoc
+// @Summary Create a group chat
+// @Description Start a group room (a study group, for example) with other users. The creator becomes its owner and the members get a chat_created event. Up to 50 members including the owner; users you blocked or who blocked you can't be added.
+// @Tags chats
+// @Accept  json
+// @Produce  json
+// @Param   group body models.CreateGroupChatRequest true "Title (up to 50 characters) and members"
+// @Success 201 {object} models.Chat
+// @Router /api/v1/chats/groups [post]
+func CreateGroupChat(hub *Hub) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := c.Get("user_id").(string)
+		if !ok || userID == "" {
+			return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+		}
+
+		var req models.CreateGroupChatRequest
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+		}
+		req.Title = strings.TrimSpace(req.Title)
+		if req.Title == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "title is required")
+		}
+		if utf8.RuneCountInString(req.Title) > maxChatTitleRunes {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("title must be at most %d characters", maxChatTitleRunes))
+		}
+		memberIDs, err := validateInvitees(userID, req.MemberIDs, nil)
+		if err != nil {
+			return err
+		}
+		if 1+len(memberIDs) > maxGroupMembers {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("a group can have up to %d members", maxGroupMembers))
+		}
+
+		chat, err := db.CreateGroupChat(userID, req.Title, memberIDs)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		hub.SendEventToUsers(memberIDs, EventChatCreated, chat.ID, ChatCreated{OtherUserID: userID, Kind: chat.Kind, Title: chat.Title})
+		return c.JSON(http.StatusCreated, chat)
+	}
+}
+
+// GetChatMembers godoc
+// @Summary Get the members of a chat
+// @Description Get the members of a chat room with their role, in the order they joined.
+// @Tags chats
+// @Produce  json
+// @Param   chatId path int true "Chat ID"
+// @Success 200 {array} models.ChatMember
+// @Router /api/v1/chats/{chatId}/members [get]
+func GetChatMembers(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
+	chatID, err := strconv.ParseInt(c.Param("chatId"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid chat ID")
+	}
+
+	members, err := db.GetChatMembers(chatID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	isMember := false
+	for _, member := range members {
+		isMember = isMember || member.UserID == userID
+	}
+	if !isMember {
+		return echo.NewHTTPError(http.StatusForbidden, "You are not a participant in this chat")
+	}
+	return c.JSON(http.StatusOK, members)
+}
+
+// InviteChatMembers godoc
+// @Summary Add members to a group chat
+// @Description Add users to a group room. Only its owner can. New members get a chat_created event and the others a chat_members event. Users who are already members are skipped.
+// @Tags chats
+// @Accept  json
+// @Produce  json
+// @Param   chatId path int true "Chat ID"
+// @Param   invite body models.InviteChatMembersRequest true "Users to add"
+// @Success 200 {array} models.ChatMember
+// @Router /api/v1/chats/{chatId}/members [post]
+func InviteChatMembers(hub *Hub) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, chat, member, err := chatMembership(c)
+		if err != nil {
+			return err
+		}
+		if chat.Kind != models.ChatGroup {
+			return echo.NewHTTPError(http.StatusBadRequest, "Members can only be added to group chats")
+		}
+		if member.Role != models.ChatRoleOwner {
+			return echo.NewHTTPError(http.StatusForbidden, "Only the owner can add members")
+		}
+
+		var req models.InviteChatMembersRequest
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+		}
+		current, err := db.GetChatParticipants(chat.ID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		inviteeIDs, err := validateInvitees(userID, req.UserIDs, current)
+		if err != nil {
+			return err
+		}
+		if len(current)+len(inviteeIDs) > maxGroupMembers {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("a group can have up to %d members", maxGroupMembers))
+		}
+
+		added, err := db.AddChatMembers(chat.ID, inviteeIDs, models.ChatRoleMember)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		members, err := db.GetChatMembers(chat.ID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if len(added) > 0 {
+			membersChanged(hub, chat.ID, current, ChatMembersUpdate{Joined: added, MemberCount: len(members)})
+			hub.SendEventToUsers(added, EventChatCreated, chat.ID, ChatCreated{OtherUserID: userID, Kind: chat.Kind, Title: chat.Title})
+		}
+		return c.JSON(http.StatusOK, members)
+	}
+}
+
+// RemoveChatMember godoc
+// @Summary Remove a member from a group chat
+// @Description Remove a member from a group room. Only its owner can; to leave a chat use POST /api/v1/chats/{chatId}/leave. The removed user's connections to the room are closed and every member, the removed user included, gets a chat_members event.
+// @Tags chats
+// @Produce  json
+// @Param   chatId path int true "Chat ID"
+// @Param   userId path string true "User to remove"
+// @Success 204
+// @Router /api/v1/chats/{chatId}/members/{userId} [delete]
+func RemoveChatMember(hub *Hub) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, chat, member, err := chatMembership(c)
+		if err != nil {
+			return err
+		}
+		if chat.Kind != models.ChatGroup {
+			return echo.NewHTTPError(http.StatusBadRequest, "Members can only be removed from group chats")
+		}
+		if member.Role != models.ChatRoleOwner {
+			return echo.NewHTTPError(http.StatusForbidden, "Only the owner can remove members")
+		}
+		targetID := c.Param("userId")
+		if targetID == userID {
+			return echo.NewHTTPError(http.StatusBadRequest, "Use POST /api/v1/chats/{chatId}/leave to leave the chat")
+		}
+		target, err := db.GetChatMember(chat.ID, targetID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if target == nil {
+			return echo.NewHTTPError(http.StatusNotFound, "User is not a member of this chat")
+		}
+
+		if err := leaveChat(hub, chat.ID, targetID); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// LeaveChat godoc
+// @Summary Leave a group or event chat
+// @Description Leave a group or event room. Direct chats can't be left. When the owner of a group leaves, the member who joined first becomes the owner. The user's connections to the room are closed and the members get a chat_members event.
+// @Tags chats
+// @Produce  json
+// @Param   chatId path int true "Chat ID"
+// @Success 204
+// @Router /api/v1/chats/{chatId}/leave [post]
+func LeaveChat(hub *Hub) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, chat, _, err := chatMembership(c)
+		if err != nil {
+			return err
+		}
+		if chat.Kind == models.ChatDirect {
+			return echo.NewHTTPError(http.StatusBadRequest, "Direct chats can't be left")
+		}
+		if err := leaveChat(hub, chat.ID, userID); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// JoinEventChat godoc
+// @Summary Join the chat room of an event
+// @Description Join the chat room of an event with chat_link_enabled, creating the room on first join. Joining again is harmless. The other members get a chat_members event. A room holds up to 500 members.
+// @Tags events
+// @Produce  json
+// @Param   eventId path int true "Event ID"
+// @Success 200 {object} map[string]interface{} "Returns chat_id"
+// @Router /api/v1/events/{eventId}/chat [post]
+func JoinEventChat(hub *Hub) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := c.Get("user_id").(string)
+		if !ok || userID == "" {
+			return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+		}
+		eventID, err := strconv.ParseInt(c.Param("eventId"), 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid event ID")
+		}
+
+		event, err := db.GetEvent(eventID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get event: "+err.Error())
+		}
+		if event == nil {
+			return echo.NewHTTPError(http.StatusNotFound, "Event not found")
+		}
+		if !event.ChatLinkEnabled {
+			return echo.NewHTTPError(http.StatusForbidden, "This event has no chat room")
+		}
+
+		chatID, _, err := db.GetOrCreateEventChat(*event)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		// 上限の確認と参加は DB で1回で行うので、同時に参加しても上限を超えない
+		joined, full, err := db.AddChatMemberUpTo(chatID, userID, maxEventRoomMembers)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if full {
+			return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("the event room is full (%d members)", maxEventRoomMembers))
+		}
+		if joined {
+			members, err := db.GetChatParticipants(chatID)
+			if err != nil {
+				log.Printf("error getting participants of chat %d: %v", chatID, err)
+			}
+			membersChanged(hub, chatID, members, ChatMembersUpdate{Joined: []string{userID}, MemberCount: len(members)})
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"chat_id": chatID,
+		})
+	}
+}
+
+// chatMembership returns the current user, the chat of the chatId path parameter and the
+// user's membership of it.
+func chatMembership(c echo.Context) (string, *models.Chat, *models.ChatMember, error) {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return "", nil, nil, echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
+	chatID, err := strconv.ParseInt(c.Param("chatId"), 10, 64)
+	if err != nil {
+		return "", nil, nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid chat ID")
+	}
+
+	chat, err := db.GetChat(chatID)
+	if err != nil {
+		return "", nil, nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if chat == nil {
+		return "", nil, nil, echo.NewHTTPError(http.StatusNotFound, "Chat not found")
+	}
+	member, err := db.GetChatMember(chatID, userID)
+	if err != nil {
+		return "", nil, nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to verify chat access: "+err.Error())
+	}
+	if member == nil {
+		return "", nil, nil, echo.NewHTTPError(http.StatusForbidden, "You are not a participant in this chat")
+	}
+	return userID, chat, member, nil
+}
+
+// validateInvitees checks the users userID wants to add to a group and returns them
+// without duplicates, userID and the users in current.
+func validateInvitees(userID string, userIDs, current []string) ([]string, error) {
+	skip := map[string]bool{userID: true}
+	for _, id := range current {
+		skip[id] = true
+	}
+	var invitees []string
+	for _, id := range userIDs {
+		if id = strings.TrimSpace(id); id != "" && !skip[id] {
+			skip[id] = true
+			invitees = append(invitees, id)
+		}
+	}
+
+	existing, err := db.GetExistingUserIDs(invitees)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	blocked, err := db.GetBlockedUserIDs(userID)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to get blocked users: "+err.Error())
+	}
+	for _, id := range invitees {
+		if !existing[id] {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "User not found: "+id)
+		}
+		if blocked[id] {
+			return nil, echo.NewHTTPError(http.StatusForbidden, "Cannot add this user: "+id)
+		}
+	}
+	return invitees, nil
+}
+
+// leaveChat removes userID from a chat and tells the remaining members and userID.
+func leaveChat(hub *Hub, chatID int64, userID string) error {
+	if err := db.RemoveChatMember(chatID, userID); err != nil {
+		return err
+	}
+	remaining, err := db.GetChatParticipants(chatID)
+	if err != nil {
+		log.Printf("error getting participants of chat %d: %v", chatID, err)
+	}
+	if err := hub.ChatMembersChanged(context.Background(), chatID, userID); err != nil {
+		log.Printf("error publishing members change of chat %d: %v", chatID, err)
+	}
+	update := ChatMembersUpdate{Left: []string{userID}, MemberCount: len(remaining)}
+	hub.SendEventToUsers(append(remaining, userID), EventChatMembers, chatID, update)
+	return nil
+}
+
+// membersChanged sends update to members after users joined a chat.
+func membersChanged(hub *Hub, chatID int64, members []string, update ChatMembersUpdate) {
+	hub.SendEventToUsers(members, EventChatMembers, chatID, update)
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"net/http"
+
+	"meetupr-backend/internal/db"
+	"meetupr-backend/internal/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetEmailPreferences godoc
+// @Summary Get email digest preferences
+// @Description Get how often the current user receives the email digest (off, daily or weekly)
+// @Tags email
+// @Produce  json
+// @Success 200 {object} models.EmailPreferences
+// @Router /api/v1/users/me/email-preferences [get]
+func GetEmailPreferences(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
+
+	preferences, err := db.GetEmailPreferences(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get email preferences: "+err.Error())
+	}
+	return c.JSON(http.StatusOK, preferences)
+}
+
+// UpdateEmailPreferences godoc
+// @Summary Update email digest preferences
+// @Description Set how often the current user receives the email digest
+// @Tags email
+// @Accept  json
+// @Produce  json
+// @Param   preferences body models.UpdateEmailPreferencesRequest true "off, daily or weekly"
+// @Success 200 {object} models.EmailPreferences
+// @Router /api/v1/users/me/email-preferences [put]
+func UpdateEmailPreferences(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
+
+	var req models.UpdateEmailPreferencesRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	switch req.Frequency {
+	case models.EmailFrequencyOff, models.EmailFrequencyDaily, models.EmailFrequencyWeekly:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "frequency must be off, daily or weekly")
+	}
+
+	preferences, err := db.UpdateEmailFrequency(userID, req.Frequency)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, preferences)
+}
+
+// The form posts back to the page's own URL, token included.
+const confirmUnsubscribePage = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Meetupr</title></head>
+<body style="font-family: sans-serif; text-align: center; padding: 40px;">
+<p>Meetupr からのメールの配信を停止しますか？</p>
+<p>Stop receiving Meetupr emails?</p>
+<form method="post">
+<button type="submit">配信を停止する / Unsubscribe</button>
+</form>
+</body></html>`
+
+const unsubscribedPage = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Meetupr</title></head>
+<body style="font-family: sans-serif; text-align: center; padding: 40px;">
+<p>メールの配信を停止しました。</p>
+<p>You have been unsubscribed from Meetupr emails.</p>
+</body></html>`
+
+// ConfirmEmailUnsubscribe godoc
+// @Summary Confirm unsubscribing from the email digest
+// @Description Unsubscribe link from the digest email. Shows a page whose button unsubscribes (POST), so link scanners that open the link don't unsubscribe the user. No login needed: the token identifies the user.
+// @Tags email
+// @Produce  html
+// @Param   token query string true "Unsubscribe token from the email"
+// @Success 200 {string} string "Confirmation page"
+// @Router /api/v1/email/unsubscribe [get]
+func ConfirmEmailUnsubscribe(c echo.Context) error {
+	token := c.QueryParam("token")
+	if token == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "token is required")
+	}
+
+	found, err := db.EmailUnsubscribeTokenExists(token)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to check unsubscribe link")
+	}
+	if !found {
+		return echo.NewHTTPError(http.StatusNotFound, "Invalid unsubscribe link")
+	}
+	return c.HTML(http.StatusOK, confirmUnsubscribePage)
+}
+
+// UnsubscribeEmail godoc
+// @Summary Unsubscribe from the email digest
+// @Description Turn the email digest off. Posted by the confirmation page and by mail clients' one-click unsubscribe (RFC 8058 List-Unsubscribe-Post). No login needed: the token identifies the user.
+// @Tags email
+// @Produce  html
+// @Param   token query string true "Unsubscribe token from the email"
+// @Success 200 {string} string "Confirmation page"
+// @Router /api/v1/email/unsubscribe [post]
+func UnsubscribeEmail(c echo.Context) error {
+	token := c.QueryParam("token")
+	if token == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "token is required")
+	}
+
+	found, err := db.UnsubscribeEmail(token)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to unsubscribe")
+	}
+	if !found {
+		return echo.NewHTTPError(http.StatusNotFound, "Invalid unsubscribe link")
+	}
+	return c.HTML(http.StatusOK, unsubscribedPage)
+}
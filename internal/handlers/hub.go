@@ -0,0 +1,487 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"meetupr-backend/internal/models"
+	"meetupr-backend/internal/notify"
+	"meetupr-backend/internal/pubsub"
+	"meetupr-backend/internal/ratelimit"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Default number of room shards, each with its own event loop.
+	defaultHubShards = 16
+	// Default number of message persistence workers.
+	defaultPersistWorkers = 8
+	// Messages a persistence worker may have waiting before senders are pushed back.
+	persistQueueSize = 1024
+	// Number of workers sending chat_updated events and pushes for saved messages.
+	notifyWorkers = 4
+	// Saved messages a notifier may have waiting before their notifications are dropped.
+	notifyQueueSize = 1024
+	// Minimum time clients are asked to wait before reconnecting after a restart.
+	reconnectDelay = 2 * time.Second
+	// Time given to the broker to hand back the last published messages during shutdown.
+	deliveryGrace = 500 * time.Millisecond
+)
+
+var (
+	errHubDraining = errors.New("hub is shutting down")
+	errQueueFull   = errors.New("persistence queue is full")
+)
+
+// roomMessage is a payload received from the broker for a chat room.
+type roomMessage struct {
+	chatID  int64
+	payload []byte
+}
+
+// Hub routes chat messages between clients.
+//
+// Rooms are spread over shards (chatID % shards), each with its own goroutine, so a
+// busy room only competes with rooms in the same shard. Persistence happens on a pool of
+// workers (chatID % workers) which keeps messages of one chat in order. A saved message
+// is published to the broker and delivered to local clients when it comes back from it,
+// so several Hubs sharing a broker see each other's messages. Participants are then
+// notified (chat list events, pushes) by separate notifier workers, so the lookups this
+// takes never delay saving the next message.
+type Hub struct {
+	shards  []*hubShard
+	workers []chan *Message
+	// Saved messages whose participants are still to be notified, by chatID % notifiers
+	notifiers []chan *models.Message
+
+	// Limits how many messages per second a user can send.
+	messageLimiter *ratelimit.Limiter
+
+	broker pubsub.Broker
+	store  MessageStore
+	// Connections indexed by user, for events that target all of a user's devices.
+	sessions *sessionRegistry
+	// Push notifications for users who aren't connected; nil disables them.
+	push *notify.Dispatcher
+
+	// mu guards draining against submit so worker queues are never written after close.
+	mu       sync.RWMutex
+	draining bool
+	// Closed when the shards should close their clients and stop.
+	done        chan struct{}
+	persisting  sync.WaitGroup
+	notifying   sync.WaitGroup
+	connections sync.WaitGroup
+}
+
+// hubShard owns the rooms whose chatID maps to it. Its maps are only touched by run.
+type hubShard struct {
+	hub        *Hub
+	register   chan *Client
+	unregister chan *Client
+	// Payloads delivered by the broker, waiting to be sent to local clients.
+	inbound chan roomMessage
+	// Users removed from rooms, whose connections to those rooms must be closed.
+	evictions chan membersChange
+
+	clients map[*Client]bool
+	// Maps chatID to a set of clients in that room.
+	rooms map[int64]map[*Client]bool
+	// Broker subscriptions for rooms that have local clients, keyed by chatID.
+	subscriptions map[int64]func()
+}
+
+// NewHub creates a Hub backed by an in-process broker.
+func NewHub() *Hub {
+	return NewHubWithBroker(pubsub.NewMemoryBroker())
+}
+
+// NewHubWithBroker creates a Hub that publishes and receives chat messages through broker.
+// HUB_SHARDS and HUB_PERSIST_WORKERS override the number of shards and persistence workers.
+func NewHubWithBroker(broker pubsub.Broker) *Hub {
+	return newHub(broker, envInt("HUB_SHARDS", defaultHubShards), envInt("HUB_PERSIST_WORKERS", defaultPersistWorkers))
+}
+
+func newHub(broker pubsub.Broker, shardCount, workerCount int) *Hub {
+	h := &Hub{
+		messageLimiter: ratelimit.New(ratelimit.FromEnv("RATE_LIMIT_MESSAGES", ratelimit.Messages)),
+		broker:         broker,
+		store:          supabaseStore{},
+		done:           make(chan struct{}),
+	}
+	h.sessions = newSessionRegistry(h, envInt("MAX_CONNECTIONS_PER_USER", defaultMaxConnectionsPerUser))
+	for i := 0; i < shardCount; i++ {
+		h.shards = append(h.shards, &hubShard{
+			hub:           h,
+			register:      make(chan *Client),
+			unregister:    make(chan *Client),
+			inbound:       make(chan roomMessage, 256),
+			evictions:     make(chan membersChange, 16),
+			clients:       make(map[*Client]bool),
+			rooms:         make(map[int64]map[*Client]bool),
+			subscriptions: make(map[int64]func()),
+		})
+	}
+	for i := 0; i < workerCount; i++ {
+		h.workers = append(h.workers, make(chan *Message, persistQueueSize))
+	}
+	for i := 0; i < notifyWorkers; i++ {
+		h.notifiers = append(h.notifiers, make(chan *models.Message, notifyQueueSize))
+	}
+	return h
+}
+
+// SetPush enables push notifications for offline users. It must be called before Run.
+func (h *Hub) SetPush(d *notify.Dispatcher) {
+	h.push = d
+}
+
+// Run starts the shard loops and persistence workers and blocks until Shutdown.
+func (h *Hub) Run() {
+	// Announcements go to every /ws/user connection on this instance
+	unsubscribe, err := h.broker.Subscribe(pubsub.AnnouncementTopic, h.sessions.deliverAll)
+	if err != nil {
+		log.Printf("error subscribing to announcements: %v", err)
+	} else {
+		defer unsubscribe()
+	}
+	// Membership changes evict removed members
+	unsubscribeMembers, err := h.broker.Subscribe(pubsub.ChatMembersTopic, h.applyMembersChange)
+	if err != nil {
+		log.Printf("error subscribing to chat member changes: %v", err)
+	} else {
+		defer unsubscribeMembers()
+	}
+	for _, queue := range h.workers {
+		h.persisting.Add(1)
+		go h.persist(queue)
+	}
+	for _, queue := range h.notifiers {
+		h.notifying.Add(1)
+		go h.notifyQueued(queue)
+	}
+	for _, shard := range h.shards[1:] {
+		go shard.run()
+	}
+	h.shards[0].run()
+}
+
+// shardFor returns the shard that owns the chat room.
+func (h *Hub) shardFor(chatID int64) *hubShard {
+	return h.shards[uint64(chatID)%uint64(len(h.shards))]
+}
+
+// Accepting reports whether the hub takes new connections and messages.
+func (h *Hub) Accepting() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return !h.draining
+}
+
+// submit queues a message for persistence. It waits up to writeWait for room in the
+// chat's worker queue.
+func (h *Hub) submit(msg *Message) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.draining {
+		return errHubDraining
+	}
+
+	queue := h.workers[uint64(msg.ChatID)%uint64(len(h.workers))]
+	select {
+	case queue <- msg:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(writeWait)
+	defer timer.Stop()
+	select {
+	case queue <- msg:
+		return nil
+	case <-timer.C:
+		return errQueueFull
+	}
+}
+
+// Shutdown stops accepting connections and messages, waits for queued messages to be
+// saved and delivered, then closes every client with a "server restarting" close frame.
+// It returns early with an error if ctx expires.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	if h.draining {
+		h.mu.Unlock()
+		return nil
+	}
+	h.draining = true
+	for _, queue := range h.workers {
+		close(queue)
+	}
+	h.mu.Unlock()
+	log.Printf("Hub: draining, waiting for pending messages to be saved")
+
+	if err := waitGroupWithContext(ctx, &h.persisting); err != nil {
+		close(h.done)
+		return fmt.Errorf("pending messages were not saved before the deadline: %v", err)
+	}
+	// Every message is saved, so nothing is queued for the notifiers anymore
+	for _, queue := range h.notifiers {
+		close(queue)
+	}
+	if err := waitGroupWithContext(ctx, &h.notifying); err != nil {
+		close(h.done)
+		return fmt.Errorf("participants were not notified before the deadline: %v", err)
+	}
+
+	// Saved messages come back through the broker; give them a moment to arrive
+	select {
+	case <-time.After(deliveryGrace):
+	case <-ctx.Done():
+	}
+
+	close(h.done)
+	log.Printf("Hub: closing client connections")
+	if err := waitGroupWithContext(ctx, &h.connections); err != nil {
+		return fmt.Errorf("client connections were not closed before the deadline: %v", err)
+	}
+	log.Printf("Hub: shutdown complete")
+	return nil
+}
+
+// waitGroupWithContext waits for wg or until ctx is done.
+func waitGroupWithContext(ctx context.Context, wg *sync.WaitGroup) error {
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// restartCloseFrame is the close frame sent to clients when the server restarts. The
+// reason carries a jittered reconnect hint so clients don't all reconnect at once.
+func restartCloseFrame() []byte {
+	reconnectAfter := reconnectDelay + time.Duration(rand.Int63n(int64(3*time.Second)))
+	reason := fmt.Sprintf(`{"reason":"server restarting","reconnect_after_ms":%d}`, reconnectAfter.Milliseconds())
+	return websocket.FormatCloseMessage(websocket.CloseServiceRestart, reason)
+}
+
+// removedCloseFrame is the close frame sent to a client whose user left or was removed
+// from the chat.
+var removedCloseFrame = websocket.FormatCloseMessage(websocket.ClosePolicyViolation, `{"reason":"removed from chat"}`)
+
+// persist saves queued messages in order and publishes them to the chat's topic.
+func (h *Hub) persist(queue chan *Message) {
+	defer h.persisting.Done()
+	for msg := range queue {
+		saved, err := h.store.SaveMessage(msg)
+		if err != nil {
+			var rejected *rejectedMessage
+			if errors.As(err, &rejected) {
+				if msg.sender != nil {
+					msg.sender.sendError(rejected.code, rejected.message, 0)
+				}
+				continue
+			}
+			log.Printf("error saving message to db: %v", err)
+			continue
+		}
+		log.Printf("Message saved to DB: chat_id=%d, sender_id=%s, content=%s", msg.ChatID, msg.SenderID, msg.Content)
+
+		payload, err := json.Marshal(saved)
+		if err != nil {
+			log.Printf("error marshalling message: %v", err)
+			continue
+		}
+
+		// Every instance subscribed to the room (including this one) delivers it
+		if err := h.broker.Publish(context.Background(), pubsub.ChatTopic(msg.ChatID), payload); err != nil {
+			log.Printf("error publishing message for chat %d: %v", msg.ChatID, err)
+		}
+		// ...and participants' chat lists hear about it as a user event
+		h.queueNotification(saved)
+	}
+}
+
+// queueNotification hands a saved message to its chat's notifier. When the notifier is
+// behind, the notifications are dropped rather than holding up persistence: the message
+// itself is saved and delivered, only chat lists and pushes miss it.
+func (h *Hub) queueNotification(saved *models.Message) {
+	select {
+	case h.notifiers[uint64(saved.ChatID)%uint64(len(h.notifiers))] <- saved:
+	default:
+		log.Printf("notification queue is full, not notifying participants of message %d in chat %d", saved.ID, saved.ChatID)
+	}
+}
+
+// notifyQueued notifies the participants of queued messages, in order for each chat.
+func (h *Hub) notifyQueued(queue chan *models.Message) {
+	defer h.notifying.Done()
+	for saved := range queue {
+		h.notifyParticipants(saved)
+	}
+}
+
+// join registers client with the shard. It reports false if the hub is shutting down.
+func (s *hubShard) join(client *Client) bool {
+	select {
+	case s.register <- client:
+		return true
+	case <-s.hub.done:
+		return false
+	}
+}
+
+// leave unregisters client from the shard.
+func (s *hubShard) leave(client *Client) {
+	select {
+	case s.unregister <- client:
+	case <-s.hub.done:
+	}
+}
+
+func (s *hubShard) run() {
+	for {
+		select {
+		case <-s.hub.done:
+			s.closeAll()
+			return
+		case client := <-s.register:
+			s.clients[client] = true
+			// /ws/user clients are only tracked so shutdown can close them
+			if client.isUserChannel() {
+				continue
+			}
+			if s.rooms[client.chatID] == nil {
+				s.rooms[client.chatID] = make(map[*Client]bool)
+				s.subscribe(client.chatID)
+			}
+			s.rooms[client.chatID][client] = true
+		case client := <-s.unregister:
+			if _, ok := s.clients[client]; ok {
+				delete(s.clients, client)
+				client.closeSend()
+				s.removeFromRoom(client)
+			}
+		case in := <-s.inbound:
+			s.deliver(in.chatID, in.payload)
+		case change := <-s.evictions:
+			s.evict(change.ChatID, change.Removed)
+		}
+	}
+}
+
+// closeAll delivers whatever the broker already handed over, then closes every client
+// with the restart close frame and drops the room subscriptions.
+func (s *hubShard) closeAll() {
+	for {
+		select {
+		case in := <-s.inbound:
+			s.deliver(in.chatID, in.payload)
+			continue
+		default:
+		}
+		break
+	}
+
+	for client := range s.clients {
+		client.closeSendWith(restartCloseFrame())
+	}
+	for chatID, unsubscribe := range s.subscriptions {
+		go unsubscribe()
+		delete(s.subscriptions, chatID)
+	}
+	s.clients = make(map[*Client]bool)
+	s.rooms = make(map[int64]map[*Client]bool)
+}
+
+// subscribe starts receiving the room's messages from the broker.
+func (s *hubShard) subscribe(chatID int64) {
+	unsubscribe, err := s.hub.broker.Subscribe(pubsub.ChatTopic(chatID), func(payload []byte) {
+		s.inbound <- roomMessage{chatID: chatID, payload: payload}
+	})
+	if err != nil {
+		log.Printf("error subscribing to chat %d: %v", chatID, err)
+		return
+	}
+	s.subscriptions[chatID] = unsubscribe
+}
+
+// removeFromRoom drops client from its room, unsubscribing when the room becomes empty.
+func (s *hubShard) removeFromRoom(client *Client) {
+	roomClients := s.rooms[client.chatID]
+	if roomClients == nil {
+		return
+	}
+	delete(roomClients, client)
+	if len(roomClients) == 0 {
+		delete(s.rooms, client.chatID)
+		if unsubscribe, ok := s.subscriptions[client.chatID]; ok {
+			// The broker may be blocked handing us a payload for this room; unsubscribe
+			// off the loop so it can't wait on s.inbound while we wait on it.
+			go unsubscribe()
+			delete(s.subscriptions, client.chatID)
+		}
+	}
+}
+
+// evict closes the room connections of users who are no longer members of the chat.
+func (s *hubShard) evict(chatID int64, userIDs []string) {
+	removed := make(map[string]bool, len(userIDs))
+	for _, userID := range userIDs {
+		removed[userID] = true
+	}
+	for client := range s.rooms[chatID] {
+		if removed[client.userID] {
+			client.closeSendWith(removedCloseFrame)
+			delete(s.clients, client)
+			s.removeFromRoom(client)
+		}
+	}
+}
+
+// deliver sends a payload to every local client in the room, dropping clients that
+// can't keep up.
+func (s *hubShard) deliver(chatID int64, payload []byte) {
+	roomClients, ok := s.rooms[chatID]
+	if !ok {
+		log.Printf("No clients found in chat room %d", chatID)
+		return
+	}
+	for client := range roomClients {
+		if !client.trySend(payload) {
+			log.Printf("Client send channel full, removing client: user_id=%s", client.userID)
+			client.closeSend()
+			delete(s.clients, client)
+			s.removeFromRoom(client)
+		}
+	}
+}
+
+// envInt reads a positive integer from the environment, falling back to def.
+func envInt(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("invalid %s=%q, using default %d", key, value, def)
+		return def
+	}
+	return n
+}
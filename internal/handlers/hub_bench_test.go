@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"meetupr-backend/internal/models"
+	"meetupr-backend/internal/pubsub"
+)
+
+// slowStore simulates the latency of a Supabase insert.
+type slowStore struct {
+	delay time.Duration
+	next  atomic.Int64
+}
+
+func (s *slowStore) SaveMessage(m *Message) (*models.Message, error) {
+	time.Sleep(s.delay)
+	return &models.Message{
+		ID:          s.next.Add(1),
+		ChatID:      m.ChatID,
+		SenderID:    m.SenderID,
+		Content:     m.Content,
+		MessageType: "text",
+		SentAt:      time.Now(),
+	}, nil
+}
+
+func (s *slowStore) ChatMessages(chatID int64) ([]models.Message, error) {
+	return nil, nil
+}
+
+func (s *slowStore) ChatMemberStates(chatID int64) ([]models.ChatMemberState, error) {
+	return nil, nil
+}
+
+// benchmarkHub connects rooms*clientsPerRoom simulated clients (no sockets, just drained
+// send channels) and measures how fast b.N messages spread over all rooms are delivered.
+func benchmarkHub(b *testing.B, shards, workers, rooms, clientsPerRoom int, saveDelay time.Duration) {
+	output := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(output)
+
+	hub := newHub(pubsub.NewMemoryBroker(), shards, workers)
+	hub.store = &slowStore{delay: saveDelay}
+	go hub.Run()
+
+	var delivered atomic.Int64
+	var drained sync.WaitGroup
+	for room := 0; room < rooms; room++ {
+		for i := 0; i < clientsPerRoom; i++ {
+			client := &Client{
+				hub:    hub,
+				send:   make(chan []byte, 256),
+				chatID: int64(room + 1),
+				userID: fmt.Sprintf("user-%d-%d", room, i),
+			}
+			hub.shardFor(client.chatID).register <- client
+			drained.Add(1)
+			go func() {
+				defer drained.Done()
+				for range client.send {
+					delivered.Add(1)
+				}
+			}()
+		}
+	}
+	// Let the broker subscriptions settle
+	time.Sleep(50 * time.Millisecond)
+
+	want := int64(b.N) * int64(clientsPerRoom)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hub.submit(&Message{
+			Content:  "benchmark",
+			ChatID:   int64(i%rooms + 1),
+			SenderID: "sender",
+		})
+	}
+	deadline := time.Now().Add(30 * time.Second)
+	for delivered.Load() < want {
+		if time.Now().After(deadline) {
+			b.Fatalf("only %d of %d deliveries completed", delivered.Load(), want)
+		}
+		time.Sleep(100 * time.Microsecond)
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(want)/b.Elapsed().Seconds(), "deliveries/s")
+}
+
+func BenchmarkHubBroadcast(b *testing.B) {
+	for _, tc := range []struct {
+		name            string
+		shards, workers int
+		rooms, perRoom  int
+		saveDelay       time.Duration
+	}{
+		{"2000clients/1shard/1worker", 1, 1, 1000, 2, 0},
+		{"2000clients/16shards/8workers", 16, 8, 1000, 2, 0},
+		{"5000clients/16shards/8workers", 16, 8, 2500, 2, 0},
+		{"2000clients/16shards/8workers/slowdb", 16, 8, 1000, 2, time.Millisecond},
+		{"2000clients/16shards/32workers/slowdb", 16, 32, 1000, 2, time.Millisecond},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			benchmarkHub(b, tc.shards, tc.workers, tc.rooms, tc.perRoom, tc.saveDelay)
+		})
+	}
+}
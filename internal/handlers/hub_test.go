@@ -0,0 +1,614 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"meetupr-backend/internal/models"
+	"meetupr-backend/internal/notify"
+	"meetupr-backend/internal/pubsub"
+
+	"github.com/gorilla/websocket"
+)
+
+// memoryStore is a MessageStore that keeps messages in memory.
+type memoryStore struct {
+	mu           sync.Mutex
+	messages     []models.Message
+	participants map[int64][]string
+	// Chat settings keyed by chat ID, then user ID
+	settings map[int64]map[string]models.ChatSettings
+}
+
+func (s *memoryStore) SaveMessage(m *Message) (*models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	saved := models.Message{
+		ID:          int64(len(s.messages) + 1),
+		ChatID:      m.ChatID,
+		SenderID:    m.SenderID,
+		Content:     m.Content,
+		MessageType: "text",
+		SentAt:      time.Now(),
+	}
+	s.messages = append(s.messages, saved)
+	return &saved, nil
+}
+
+func (s *memoryStore) ChatMessages(chatID int64) ([]models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var history []models.Message
+	for _, m := range s.messages {
+		if m.ChatID == chatID {
+			history = append(history, m)
+		}
+	}
+	return history, nil
+}
+
+// ChatMemberStates counts every message from other users as unread; memoryStore has no
+// read markers.
+func (s *memoryStore) ChatMemberStates(chatID int64) ([]models.ChatMemberState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var states []models.ChatMemberState
+	for _, userID := range s.participants[chatID] {
+		state := models.ChatMemberState{UserID: userID, Settings: s.settings[chatID][userID]}
+		for _, m := range s.messages {
+			if m.ChatID == chatID && m.SenderID != userID {
+				state.UnreadCount++
+			}
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+func newTestHub(broker pubsub.Broker, store MessageStore) *Hub {
+	hub := NewHubWithBroker(broker)
+	hub.store = store
+	go hub.Run()
+	return hub
+}
+
+// newTestUserClient connects userID to the hub's /ws/user channel.
+func newTestUserClient(t *testing.T, hub *Hub, userID string) (*websocket.Conn, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		UserWsHandler(hub, w, r, userID)
+	}))
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	return ws, func() {
+		ws.Close()
+		server.Close()
+	}
+}
+
+func readUserEvent(t *testing.T, ws *websocket.Conn) UserEvent {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var event UserEvent
+	if err := ws.ReadJSON(&event); err != nil {
+		t.Fatalf("ReadJSON failed: %v", err)
+	}
+	return event
+}
+
+func readChatMessage(t *testing.T, ws *websocket.Conn) models.Message {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, p, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatalf("ReadMessage failed: %v", err)
+	}
+	var msg models.Message
+	if err := json.Unmarshal(p, &msg); err != nil {
+		t.Fatalf("Failed to unmarshal message: %v", err)
+	}
+	return msg
+}
+
+func TestHubsShareBroker(t *testing.T) {
+	broker := pubsub.NewMemoryBroker()
+	defer broker.Close()
+	store := &memoryStore{}
+
+	// Three "instances" sharing one backplane
+	hubs := []*Hub{
+		newTestHub(broker, store),
+		newTestHub(broker, store),
+		newTestHub(broker, store),
+	}
+
+	chatID := int64(42)
+	var conns []*websocket.Conn
+	for i, hub := range hubs {
+		ws, cleanup := newTestClient(t, hub, chatID, []string{"user1", "user2", "user3"}[i])
+		defer cleanup()
+		conns = append(conns, ws)
+	}
+
+	// A client in another room must not see the message
+	other, cleanupOther := newTestClient(t, hubs[1], chatID+1, "user4")
+	defer cleanupOther()
+
+	// Give the hubs a moment to register the clients
+	time.Sleep(100 * time.Millisecond)
+
+	if err := conns[0].WriteJSON(map[string]string{"content": "hello across instances"}); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+
+	for i, ws := range conns {
+		msg := readChatMessage(t, ws)
+		if msg.Content != "hello across instances" {
+			t.Errorf("client %d received wrong content: got %q", i, msg.Content)
+		}
+		if msg.SenderID != "user1" || msg.ChatID != chatID || msg.ID == 0 {
+			t.Errorf("client %d received unexpected message: %+v", i, msg)
+		}
+	}
+
+	other.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, _, err := other.ReadMessage(); err == nil {
+		t.Errorf("client in another chat should not have received the message")
+	}
+}
+
+func TestHubPreservesChatOrder(t *testing.T) {
+	broker := pubsub.NewMemoryBroker()
+	defer broker.Close()
+	hub := newHub(broker, 4, 4)
+	hub.store = &slowStore{delay: time.Millisecond}
+	go hub.Run()
+
+	sender, cleanupSender := newTestClient(t, hub, 7, "user1")
+	defer cleanupSender()
+	receiver, cleanupReceiver := newTestClient(t, hub, 7, "user2")
+	defer cleanupReceiver()
+	time.Sleep(100 * time.Millisecond)
+
+	const count = 8
+	for i := 0; i < count; i++ {
+		if err := sender.WriteJSON(map[string]string{"content": strconv.Itoa(i)}); err != nil {
+			t.Fatalf("WriteJSON failed: %v", err)
+		}
+	}
+	for i := 0; i < count; i++ {
+		if msg := readChatMessage(t, receiver); msg.Content != strconv.Itoa(i) {
+			t.Fatalf("message %d out of order: got %q", i, msg.Content)
+		}
+	}
+}
+
+// stalledMembersStore is a memoryStore whose member lookups hang until release is closed.
+type stalledMembersStore struct {
+	*memoryStore
+	release chan struct{}
+}
+
+func (s *stalledMembersStore) ChatMemberStates(chatID int64) ([]models.ChatMemberState, error) {
+	<-s.release
+	return s.memoryStore.ChatMemberStates(chatID)
+}
+
+func TestHubNotifiesParticipantsOffThePersistWorker(t *testing.T) {
+	broker := pubsub.NewMemoryBroker()
+	defer broker.Close()
+	store := &stalledMembersStore{
+		memoryStore: &memoryStore{participants: map[int64][]string{3: {"user1", "user2"}}},
+		release:     make(chan struct{}),
+	}
+	// One worker of each kind, so a blocked notifier would block the chat
+	hub := newHub(broker, 1, 1)
+	hub.store = store
+	go hub.Run()
+
+	sender, cleanupSender := newTestClient(t, hub, 3, "user1")
+	defer cleanupSender()
+	peer, cleanupPeer := newTestUserClient(t, hub, "user2")
+	defer cleanupPeer()
+	time.Sleep(100 * time.Millisecond)
+
+	// Messages keep being saved and delivered while participants can't be looked up
+	for _, content := range []string{"first", "second"} {
+		if err := sender.WriteJSON(map[string]string{"content": content}); err != nil {
+			t.Fatalf("WriteJSON failed: %v", err)
+		}
+		if msg := readChatMessage(t, sender); msg.Content != content {
+			t.Fatalf("got %q, want %q", msg.Content, content)
+		}
+	}
+
+	close(store.release)
+	for _, content := range []string{"first", "second"} {
+		event := readUserEvent(t, peer)
+		var update ChatUpdate
+		json.Unmarshal(event.Payload, &update)
+		if event.Type != EventChatUpdated || update.LastMessage == nil || update.LastMessage.Content != content {
+			t.Errorf("got %+v, want chat_updated for %q", event, content)
+		}
+	}
+}
+
+func TestHubShutdownFlushesAndCloses(t *testing.T) {
+	broker := pubsub.NewMemoryBroker()
+	defer broker.Close()
+	hub := newHub(broker, 2, 2)
+	hub.store = &slowStore{delay: 20 * time.Millisecond}
+	go hub.Run()
+
+	ws, cleanup := newTestClient(t, hub, 9, "user1")
+	defer cleanup()
+	time.Sleep(100 * time.Millisecond)
+
+	if err := ws.WriteJSON(map[string]string{"content": "last words"}); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	// Let readPump hand the message to the persistence queue
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- hub.Shutdown(ctx) }()
+
+	// The in-flight message is still delivered before the close frame
+	if msg := readChatMessage(t, ws); msg.Content != "last words" {
+		t.Errorf("got %q, want the pending message", msg.Content)
+	}
+
+	_, _, err := ws.ReadMessage()
+	closeErr, ok := err.(*websocket.CloseError)
+	if !ok {
+		t.Fatalf("expected a close frame, got %v", err)
+	}
+	if closeErr.Code != websocket.CloseServiceRestart || !strings.Contains(closeErr.Text, "server restarting") {
+		t.Errorf("unexpected close frame: %d %q", closeErr.Code, closeErr.Text)
+	}
+
+	if err := <-shutdownErr; err != nil {
+		t.Errorf("Shutdown returned error: %v", err)
+	}
+	if hub.Accepting() {
+		t.Errorf("hub should not accept connections after Shutdown")
+	}
+}
+
+func TestUserEventsReachOtherDevices(t *testing.T) {
+	broker := pubsub.NewMemoryBroker()
+	defer broker.Close()
+	store := &memoryStore{participants: map[int64][]string{5: {"user1", "user2"}}}
+	// The user's phone and laptop are connected to different instances
+	hub1 := newTestHub(broker, store)
+	hub2 := newTestHub(broker, store)
+
+	laptop, cleanupLaptop := newTestClient(t, hub1, 5, "user1")
+	defer cleanupLaptop()
+	phone, cleanupPhone := newTestUserClient(t, hub2, "user1")
+	defer cleanupPhone()
+	peer, cleanupPeer := newTestUserClient(t, hub2, "user2")
+	defer cleanupPeer()
+	// A chat room socket in another chat only carries that room's messages
+	elsewhere, cleanupElsewhere := newTestClient(t, hub2, 6, "user2")
+	defer cleanupElsewhere()
+	time.Sleep(100 * time.Millisecond)
+
+	if err := laptop.WriteJSON(map[string]string{"content": "sent from laptop"}); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+
+	// The laptop is in the room and gets the plain message
+	if msg := readChatMessage(t, laptop); msg.Content != "sent from laptop" {
+		t.Errorf("laptop got %q", msg.Content)
+	}
+
+	// Both users' event channels get a chat_updated event with their own unread count
+	for name, tc := range map[string]struct {
+		ws     *websocket.Conn
+		unread int
+	}{"phone": {phone, 0}, "peer": {peer, 1}} {
+		event := readUserEvent(t, tc.ws)
+		var update ChatUpdate
+		json.Unmarshal(event.Payload, &update)
+		if event.Type != EventChatUpdated || event.ChatID != 5 || update.LastMessage == nil || update.LastMessage.Content != "sent from laptop" {
+			t.Errorf("%s got unexpected event: %+v", name, event)
+		}
+		if update.UnreadCount != tc.unread {
+			t.Errorf("%s got unread_count %d, want %d", name, update.UnreadCount, tc.unread)
+		}
+	}
+
+	elsewhere.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, _, err := elsewhere.ReadMessage(); err == nil {
+		t.Errorf("chat room socket should not receive user events")
+	}
+}
+
+func TestHubAppliesMemberChanges(t *testing.T) {
+	broker := pubsub.NewMemoryBroker()
+	defer broker.Close()
+	store := &memoryStore{participants: map[int64][]string{9: {"owner", "leaver"}}}
+	// The change is published on one instance and applied on the other too
+	hub1 := newTestHub(broker, store)
+	hub2 := newTestHub(broker, store)
+
+	owner, cleanupOwner := newTestClient(t, hub1, 9, "owner")
+	defer cleanupOwner()
+	leaver, cleanupLeaver := newTestClient(t, hub2, 9, "leaver")
+	defer cleanupLeaver()
+	newcomer, cleanupNewcomer := newTestUserClient(t, hub1, "newcomer")
+	defer cleanupNewcomer()
+	time.Sleep(100 * time.Millisecond)
+
+	// Both members get messages before the change
+	if err := owner.WriteJSON(map[string]string{"content": "before"}); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	readChatMessage(t, owner)
+	readChatMessage(t, leaver)
+
+	store.mu.Lock()
+	store.participants[9] = []string{"owner", "newcomer"}
+	store.mu.Unlock()
+	if err := hub1.ChatMembersChanged(context.Background(), 9, "leaver"); err != nil {
+		t.Fatalf("ChatMembersChanged failed: %v", err)
+	}
+
+	// The removed member's room connection is closed
+	leaver.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := leaver.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatalf("leaver got %v, want a policy violation close", err)
+	}
+
+	// The new member hears about the next message
+	if err := owner.WriteJSON(map[string]string{"content": "after"}); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	event := readUserEvent(t, newcomer)
+	var update ChatUpdate
+	json.Unmarshal(event.Payload, &update)
+	if event.Type != EventChatUpdated || event.ChatID != 9 || update.LastMessage == nil || update.LastMessage.Content != "after" {
+		t.Errorf("newcomer got unexpected event: %+v", event)
+	}
+}
+
+// countingBroker counts the publish calls made through it.
+type countingBroker struct {
+	pubsub.Broker
+	mu        sync.Mutex
+	publishes int
+	batches   int
+}
+
+func (b *countingBroker) Publish(ctx context.Context, topic string, payload []byte) error {
+	b.mu.Lock()
+	b.publishes++
+	b.mu.Unlock()
+	return b.Broker.Publish(ctx, topic, payload)
+}
+
+func (b *countingBroker) PublishBatch(ctx context.Context, messages []pubsub.Message) error {
+	b.mu.Lock()
+	b.batches++
+	b.mu.Unlock()
+	return b.Broker.PublishBatch(ctx, messages)
+}
+
+func TestMemberEventsArePublishedInOneBatch(t *testing.T) {
+	memory := pubsub.NewMemoryBroker()
+	defer memory.Close()
+	broker := &countingBroker{Broker: memory}
+	hub := newTestHub(broker, &memoryStore{})
+
+	var clients []*websocket.Conn
+	members := []string{"user1", "user2", "user3"}
+	for _, userID := range members {
+		ws, cleanup := newTestUserClient(t, hub, userID)
+		defer cleanup()
+		clients = append(clients, ws)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	membersChanged(hub, 4, members, ChatMembersUpdate{Joined: []string{"user3"}, MemberCount: 3})
+	for i, ws := range clients {
+		event := readUserEvent(t, ws)
+		var update ChatMembersUpdate
+		json.Unmarshal(event.Payload, &update)
+		if event.Type != EventChatMembers || event.ChatID != 4 || update.MemberCount != 3 {
+			t.Errorf("%s got unexpected event: %+v", members[i], event)
+		}
+	}
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	if broker.batches != 1 || broker.publishes != 0 {
+		t.Errorf("got %d batches and %d single publishes, want one batch", broker.batches, broker.publishes)
+	}
+}
+
+func TestAnnouncementReachesAllInstances(t *testing.T) {
+	broker := pubsub.NewMemoryBroker()
+	defer broker.Close()
+	hub1 := newTestHub(broker, &memoryStore{})
+	hub2 := newTestHub(broker, &memoryStore{})
+
+	ws1, cleanup1 := newTestUserClient(t, hub1, "user1")
+	defer cleanup1()
+	ws2, cleanup2 := newTestUserClient(t, hub2, "user2")
+	defer cleanup2()
+	time.Sleep(100 * time.Millisecond)
+
+	if err := hub1.Announce(context.Background(), Announcement{Title: "Campus festival", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("Announce failed: %v", err)
+	}
+	for i, ws := range []*websocket.Conn{ws1, ws2} {
+		event := readUserEvent(t, ws)
+		var announcement Announcement
+		json.Unmarshal(event.Payload, &announcement)
+		if event.Type != EventAnnouncement || announcement.Title != "Campus festival" {
+			t.Errorf("client %d got unexpected event: %+v", i, event)
+		}
+	}
+}
+
+func TestOfflineParticipantGetsPush(t *testing.T) {
+	broker := pubsub.NewMemoryBroker()
+	defer broker.Close()
+	store := &memoryStore{participants: map[int64][]string{8: {"user1", "user2", "user3"}}}
+	hub := NewHubWithBroker(broker)
+	hub.store = store
+	recorder := &notify.Recorder{}
+	hub.SetPush(notify.NewDispatcher(recorder, nil, 50*time.Millisecond))
+	go hub.Run()
+
+	sender, cleanupSender := newTestClient(t, hub, 8, "user1")
+	defer cleanupSender()
+	// user3 is online (on the chat list), user2 is offline
+	_, cleanupOnline := newTestUserClient(t, hub, "user3")
+	defer cleanupOnline()
+	time.Sleep(100 * time.Millisecond)
+
+	for _, content := range []string{"are you free today?", "lunch maybe?"} {
+		if err := sender.WriteJSON(map[string]string{"content": content}); err != nil {
+			t.Fatalf("WriteJSON failed: %v", err)
+		}
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	sent := recorder.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("got %d pushes, want 1 coalesced push: %+v", len(sent), sent)
+	}
+	if n := sent[0]; n.UserID != "user2" || n.ChatID != 8 || n.Count != 2 || n.Body != "lunch maybe?" {
+		t.Errorf("unexpected push: %+v", n)
+	}
+}
+
+func TestMutedChatSkipsPush(t *testing.T) {
+	broker := pubsub.NewMemoryBroker()
+	defer broker.Close()
+	mutedUntil := time.Now().Add(time.Hour)
+	store := &memoryStore{
+		participants: map[int64][]string{9: {"user1", "user2", "user3"}},
+		settings:     map[int64]map[string]models.ChatSettings{9: {"user2": {MutedUntil: &mutedUntil}}},
+	}
+	hub := NewHubWithBroker(broker)
+	hub.store = store
+	recorder := &notify.Recorder{}
+	hub.SetPush(notify.NewDispatcher(recorder, nil, 50*time.Millisecond))
+	go hub.Run()
+
+	sender, cleanupSender := newTestClient(t, hub, 9, "user1")
+	defer cleanupSender()
+	time.Sleep(100 * time.Millisecond)
+
+	if err := sender.WriteJSON(map[string]string{"content": "hello"}); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	sent := recorder.Sent()
+	if len(sent) != 1 || sent[0].UserID != "user3" {
+		t.Fatalf("want a single push to user3, got %+v", sent)
+	}
+}
+
+func TestConnectionLimitPerUser(t *testing.T) {
+	broker := pubsub.NewMemoryBroker()
+	defer broker.Close()
+	hub := newTestHub(broker, &memoryStore{})
+	hub.sessions.maxPerUser = 2
+
+	for i := 0; i < 2; i++ {
+		_, cleanup := newTestClient(t, hub, 1, "user1")
+		defer cleanup()
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WsHandler(hub, w, r, 1, "user1")
+	}))
+	defer server.Close()
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err == nil {
+		t.Fatalf("third connection should have been rejected")
+	}
+	if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected 429, got %v", resp)
+	}
+}
+
+// rejectingStore is a memoryStore that rejects every meetup action, as saveMessage does
+// for one that breaks a rule checked against the database.
+type rejectingStore struct {
+	memoryStore
+}
+
+func (s *rejectingStore) SaveMessage(m *Message) (*models.Message, error) {
+	if isMeetupFrame(m.Type) {
+		return nil, rejectMessage("meetup_closed", "This meetup proposal was already answered")
+	}
+	return s.memoryStore.SaveMessage(m)
+}
+
+func TestMeetupFrameRejectionReachesSender(t *testing.T) {
+	broker := pubsub.NewMemoryBroker()
+	defer broker.Close()
+	hub := newTestHub(broker, &rejectingStore{})
+
+	sender, cleanupSender := newTestClient(t, hub, 9, "user1")
+	defer cleanupSender()
+	receiver, cleanupReceiver := newTestClient(t, hub, 9, "user2")
+	defer cleanupReceiver()
+	time.Sleep(100 * time.Millisecond)
+
+	readError := func() ErrorFrame {
+		t.Helper()
+		sender.SetReadDeadline(time.Now().Add(2 * time.Second))
+		var frame ErrorFrame
+		if err := sender.ReadJSON(&frame); err != nil {
+			t.Fatalf("ReadJSON failed: %v", err)
+		}
+		return frame
+	}
+
+	// Caught by readPump: a proposal needs candidate times
+	if err := sender.WriteJSON(map[string]interface{}{
+		"type":   FrameMeetupPropose,
+		"meetup": map[string]interface{}{"location_id": 1},
+	}); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	if frame := readError(); frame.Type != "error" || frame.Code != "invalid_meetup" {
+		t.Errorf("got %+v, want an invalid_meetup error", frame)
+	}
+
+	// Rejected by the store
+	if err := sender.WriteJSON(map[string]interface{}{
+		"type":   FrameMeetupAccept,
+		"meetup": map[string]interface{}{"proposal_id": 3},
+	}); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	if frame := readError(); frame.Code != "meetup_closed" {
+		t.Errorf("got %+v, want a meetup_closed error", frame)
+	}
+
+	// Text messages still go through, and the receiver saw nothing before them
+	if err := sender.WriteJSON(map[string]string{"content": "see you there"}); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	if msg := readChatMessage(t, receiver); msg.Content != "see you there" {
+		t.Errorf("receiver got %+v, want the text message", msg)
+	}
+}
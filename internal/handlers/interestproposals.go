@@ -0,0 +1,454 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"meetupr-backend/internal/db"
+	"meetupr-backend/internal/languages"
+	"meetupr-backend/internal/models"
+	"meetupr-backend/internal/namematch"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	maxInterestNameRunes     = 50
+	maxProposalNoteRunes     = 500
+	maxPendingProposals      = 10
+	defaultProposalListState = models.ProposalPending
+)
+
+// InterestProposalRequest is the body of POST /api/v1/interests/proposals and, with
+// every field optional, of the admin approve endpoint.
+type InterestProposalRequest struct {
+	Name string `json:"name"`
+	// Names in other languages by language code, e.g. {"en": "Board games"}
+	Names      models.LocalizedNames `json:"names"`
+	CategoryID *int                  `json:"category_id"`
+	ParentID   *int                  `json:"parent_id"`
+	Note       string                `json:"note"`
+}
+
+// RejectInterestProposalRequest is the body of the admin reject endpoint.
+type RejectInterestProposalRequest struct {
+	Reason string `json:"reason"`
+	// An existing interest the proposal duplicates; the proposer gets it instead
+	DuplicateOf int `json:"duplicate_of"`
+}
+
+// MergeInterestsRequest is the body of POST /api/v1/admin/interests/{interestId}/merge.
+type MergeInterestsRequest struct {
+	Into int `json:"into"`
+}
+
+// DuplicateInterestError is the body of a 409 for a proposal of an existing interest.
+type DuplicateInterestError struct {
+	Message  string          `json:"message"`
+	Interest namematch.Match `json:"interest"`
+}
+
+// InterestProposalPayload is the payload of an interest_proposal notification.
+type InterestProposalPayload struct {
+	ProposalID int64  `json:"proposal_id"`
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	InterestID *int   `json:"interest_id,omitempty"`
+	ReviewNote string `json:"review_note,omitempty"`
+}
+
+// CreateInterestProposal godoc
+// @Summary Propose a new interest
+// @Description Ask for an interest that isn't in the master list. An admin reviews it; when approved it is added to the list and to your interests. The name is checked against existing interests in every language, ignoring case, width, kana/romaji spelling, long vowels, spaces and punctuation: an exact match is refused with 409 and the existing interest, close matches are returned in duplicates. Up to 10 proposals can be pending at once.
+// @Tags interests
+// @Accept  json
+// @Produce  json
+// @Param   proposal body InterestProposalRequest true "Name (up to 50 characters), names in other languages, category, parent interest and a note (up to 500 characters)"
+// @Success 201 {object} models.InterestProposal
+// @Failure 409 {object} DuplicateInterestError
+// @Router /api/v1/interests/proposals [post]
+func CreateInterestProposal(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
+
+	var req InterestProposalRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "name is required")
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	if utf8.RuneCountInString(req.Note) > maxProposalNoteRunes {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("note must be at most %d characters", maxProposalNoteRunes))
+	}
+	interests, err := validateInterestDefinition(&req)
+	if err != nil {
+		return err
+	}
+
+	duplicates := findDuplicateInterests(req.Name, req.Names, interests)
+	if len(duplicates) > 0 && duplicates[0].Similarity == 1 {
+		return echo.NewHTTPError(http.StatusConflict, DuplicateInterestError{
+			Message:  "This interest already exists: " + duplicates[0].Name,
+			Interest: duplicates[0],
+		})
+	}
+
+	proposals, err := db.GetUserInterestProposals(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	pending := 0
+	key := namematch.Key(req.Name)
+	for _, p := range proposals {
+		if p.Status != models.ProposalPending {
+			continue
+		}
+		pending++
+		if namematch.Key(p.Name) == key {
+			return echo.NewHTTPError(http.StatusConflict, "You already proposed this interest")
+		}
+	}
+	if pending >= maxPendingProposals {
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("You can have up to %d pending proposals", maxPendingProposals))
+	}
+
+	created, err := db.CreateInterestProposal(models.InterestProposal{
+		UserID:     userID,
+		Name:       req.Name,
+		Names:      req.Names,
+		CategoryID: req.CategoryID,
+		ParentID:   req.ParentID,
+		Note:       req.Note,
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	created.Duplicates = duplicates
+	return c.JSON(http.StatusCreated, created)
+}
+
+// GetMyInterestProposals godoc
+// @Summary Get your interest proposals
+// @Description Get the interests you proposed and how they were reviewed, newest first.
+// @Tags interests
+// @Produce  json
+// @Success 200 {array} models.InterestProposal
+// @Router /api/v1/interests/proposals [get]
+func GetMyInterestProposals(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
+
+	proposals, err := db.GetUserInterestProposals(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, proposals)
+}
+
+// GetInterestProposals godoc
+// @Summary List interest proposals
+// @Description List interest proposals for review, oldest first, each with the existing interests it likely duplicates. Admin only.
+// @Tags admin
+// @Produce  json
+// @Param   status query string false "pending (default), approved, duplicate, rejected or all"
+// @Success 200 {array} models.InterestProposal
+// @Router /api/v1/admin/interest-proposals [get]
+func GetInterestProposals(c echo.Context) error {
+	status := c.QueryParam("status")
+	switch status {
+	case "":
+		status = defaultProposalListState
+	case "all":
+		status = ""
+	case models.ProposalPending, models.ProposalApproved, models.ProposalDuplicate, models.ProposalRejected:
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "status must be one of pending, approved, duplicate, rejected, all")
+	}
+
+	proposals, err := db.GetInterestProposals(status)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	interests, err := db.GetInterests()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get interests: "+err.Error())
+	}
+	for i, p := range proposals {
+		if p.Status == models.ProposalPending {
+			proposals[i].Duplicates = findDuplicateInterests(p.Name, p.Names, interests)
+		}
+	}
+	return c.JSON(http.StatusOK, proposals)
+}
+
+// ApproveInterestProposal godoc
+// @Summary Approve an interest proposal
+// @Description Add a proposed interest to the master list and to the proposer's interests, and tell the proposer. Fields in the body replace the proposed ones. Admin only.
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Param   proposalId path int true "Proposal ID"
+// @Param   interest body InterestProposalRequest false "Corrections to the proposal; note is the review note"
+// @Success 200 {object} models.InterestProposal
+// @Router /api/v1/admin/interest-proposals/{proposalId}/approve [post]
+func ApproveInterestProposal(hub *Hub) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		adminID, _ := c.Get("user_id").(string)
+		proposal, err := pendingProposal(c)
+		if err != nil {
+			return err
+		}
+
+		var req InterestProposalRequest
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+		}
+		if req.Name = strings.TrimSpace(req.Name); req.Name == "" {
+			req.Name = proposal.Name
+		}
+		if req.Names == nil {
+			req.Names = proposal.Names
+		}
+		if req.CategoryID == nil {
+			req.CategoryID = proposal.CategoryID
+		}
+		if req.ParentID == nil {
+			req.ParentID = proposal.ParentID
+		}
+		interests, err := validateInterestDefinition(&req)
+		if err != nil {
+			return err
+		}
+		if duplicates := findDuplicateInterests(req.Name, req.Names, interests); len(duplicates) > 0 && duplicates[0].Similarity == 1 {
+			return echo.NewHTTPError(http.StatusConflict, DuplicateInterestError{
+				Message:  "This interest already exists: " + duplicates[0].Name,
+				Interest: duplicates[0],
+			})
+		}
+
+		interest := models.Interest{Name: req.Name, Names: req.Names}
+		if req.CategoryID != nil {
+			interest.CategoryID = *req.CategoryID
+		}
+		if req.ParentID != nil {
+			interest.ParentID = *req.ParentID
+		}
+		created, err := db.CreateInterest(interest)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return finishProposalReview(c, hub, proposal, models.ProposalApproved, &created.ID, adminID, strings.TrimSpace(req.Note))
+	}
+}
+
+// RejectInterestProposal godoc
+// @Summary Reject an interest proposal
+// @Description Turn down a proposed interest and tell the proposer why. With duplicate_of, the proposal is marked as a duplicate of that existing interest, which is added to the proposer's interests instead. Admin only.
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Param   proposalId path int true "Proposal ID"
+// @Param   rejection body RejectInterestProposalRequest true "Reason and the duplicated interest"
+// @Success 200 {object} models.InterestProposal
+// @Router /api/v1/admin/interest-proposals/{proposalId}/reject [post]
+func RejectInterestProposal(hub *Hub) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		adminID, _ := c.Get("user_id").(string)
+		proposal, err := pendingProposal(c)
+		if err != nil {
+			return err
+		}
+
+		var req RejectInterestProposalRequest
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+		}
+		status := models.ProposalRejected
+		var interestID *int
+		if req.DuplicateOf != 0 {
+			interests, err := db.GetInterests()
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get interests: "+err.Error())
+			}
+			if !hasInterest(interests, req.DuplicateOf) {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown interest %d", req.DuplicateOf))
+			}
+			status, interestID = models.ProposalDuplicate, &req.DuplicateOf
+		}
+		return finishProposalReview(c, hub, proposal, status, interestID, adminID, strings.TrimSpace(req.Reason))
+	}
+}
+
+// MergeInterests godoc
+// @Summary Merge duplicate interests
+// @Description Fold an interest into another and delete it. Users who had it get the other one (users who had both keep the higher preference level), its sub-interests move under the other one (which first takes its place if it was below it), saved searches for it search for the other one, and the other one gets the translations it is missing, all in one transaction. Admin only.
+// @Tags admin
+// @Accept  json
+// @Produce  json
+// @Param   interestId path int true "ID of the interest to merge away"
+// @Param   merge body MergeInterestsRequest true "ID of the interest to keep"
+// @Success 200 {object} models.InterestMergeResult
+// @Router /api/v1/admin/interests/{interestId}/merge [post]
+func MergeInterests(c echo.Context) error {
+	fromID, err := strconv.Atoi(c.Param("interestId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid interest ID")
+	}
+	var req MergeInterestsRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.Into == 0 || req.Into == fromID {
+		return echo.NewHTTPError(http.StatusBadRequest, "into must be another interest")
+	}
+
+	result, err := db.MergeInterests(fromID, req.Into)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if result == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Interest not found")
+	}
+	log.Printf("interests: merged %d into %d (%d users, %d saved searches)", fromID, req.Into, result.MovedUsers, result.SavedSearches)
+	return c.JSON(http.StatusOK, result)
+}
+
+// validateInterestDefinition checks the name, translations, category and parent of an
+// interest to be added, and returns the current master list.
+func validateInterestDefinition(req *InterestProposalRequest) ([]models.Interest, error) {
+	if utf8.RuneCountInString(req.Name) > maxInterestNameRunes {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("name must be at most %d characters", maxInterestNameRunes))
+	}
+	names := make(models.LocalizedNames, len(req.Names))
+	for locale, name := range req.Names {
+		if code, ok := languages.Normalize(locale); !ok || code != locale {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "names must be keyed by ISO 639-1 language codes: "+locale)
+		}
+		name = strings.TrimSpace(name)
+		if utf8.RuneCountInString(name) > maxInterestNameRunes {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("names.%s must be at most %d characters", locale, maxInterestNameRunes))
+		}
+		if name != "" {
+			names[locale] = name
+		}
+	}
+	req.Names = names
+
+	interests, err := db.GetInterests()
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to get interests: "+err.Error())
+	}
+	if req.ParentID != nil && !hasInterest(interests, *req.ParentID) {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown parent interest %d", *req.ParentID))
+	}
+	if req.CategoryID != nil {
+		categories, err := db.GetInterestCategories()
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		known := false
+		for _, category := range categories {
+			known = known || category.ID == *req.CategoryID
+		}
+		if !known {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown category %d", *req.CategoryID))
+		}
+	}
+	return interests, nil
+}
+
+// findDuplicateInterests returns the interests a proposed name or one of its translations
+// likely duplicates, comparing against every name of every interest.
+func findDuplicateInterests(name string, names models.LocalizedNames, interests []models.Interest) []namematch.Match {
+	proposed := []string{name}
+	for _, n := range names {
+		proposed = append(proposed, n)
+	}
+	candidates := make([]namematch.Candidate, len(interests))
+	for i, interest := range interests {
+		candidates[i] = namematch.Candidate{ID: interest.ID, Names: []string{interest.Name}}
+		for _, n := range interest.Names {
+			candidates[i].Names = append(candidates[i].Names, n)
+		}
+	}
+	return namematch.Find(proposed, candidates, namematch.DefaultThreshold)
+}
+
+func hasInterest(interests []models.Interest, id int) bool {
+	for _, interest := range interests {
+		if interest.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// pendingProposal returns the proposal of the proposalId path parameter if it still
+// awaits review.
+func pendingProposal(c echo.Context) (*models.InterestProposal, error) {
+	id, err := strconv.ParseInt(c.Param("proposalId"), 10, 64)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid proposal ID")
+	}
+	proposal, err := db.GetInterestProposal(id)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if proposal == nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "Proposal not found")
+	}
+	if proposal.Status != models.ProposalPending {
+		return nil, echo.NewHTTPError(http.StatusConflict, "Proposal was already reviewed")
+	}
+	return proposal, nil
+}
+
+// finishProposalReview records the outcome of a proposal, gives the proposer the
+// resulting interest and tells them.
+func finishProposalReview(c echo.Context, hub *Hub, proposal *models.InterestProposal, status string, interestID *int, adminID, note string) error {
+	reviewed, err := db.ReviewInterestProposal(proposal.ID, status, interestID, adminID, note)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if reviewed == nil {
+		return echo.NewHTTPError(http.StatusConflict, "Proposal was already reviewed")
+	}
+
+	if interestID != nil {
+		if err := db.AddUserInterest(reviewed.UserID, *interestID); err != nil {
+			log.Printf("error adding interest %d to proposer %s: %v", *interestID, reviewed.UserID, err)
+		}
+	}
+	payload, err := json.Marshal(InterestProposalPayload{
+		ProposalID: reviewed.ID,
+		Name:       reviewed.Name,
+		Status:     reviewed.Status,
+		InterestID: reviewed.InterestID,
+		ReviewNote: reviewed.ReviewNote,
+	})
+	if err == nil {
+		err = createNotification(hub, models.Notification{
+			UserID:     reviewed.UserID,
+			Type:       models.NotificationInterestProposal,
+			TargetType: "interest_proposal",
+			TargetID:   strconv.FormatInt(reviewed.ID, 10),
+			Payload:    payload,
+		})
+	}
+	if err != nil {
+		log.Printf("error notifying proposer %s of proposal %d: %v", reviewed.UserID, reviewed.ID, err)
+	}
+	return c.JSON(http.StatusOK, reviewed)
+}
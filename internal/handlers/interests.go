@@ -4,21 +4,80 @@ import (
 	"net/http"
 
 	"meetupr-backend/internal/db"
+	"meetupr-backend/internal/models"
 
 	"github.com/labstack/echo/v4"
 )
 
 // GetInterests godoc
 // @Summary Get interests master data
-// @Description Retrieve the list of available interests/categories
+// @Description Retrieve the list of available interests. name and category are in the first language of Accept-Language (or lang) that has a translation, falling back to the default name. parent_id is the broader interest an interest belongs to (Music for J-Pop); searching for a parent also finds users who chose one of its sub-interests.
 // @Tags interests
 // @Produce  json
-// @Success 200 {array} map[string]interface{}
+// @Param   lang query string false "Language code (ja, en, zh, ko, ...), preferred over Accept-Language"
+// @Success 200 {array} models.Interest
 // @Router /api/v1/interests [get]
 func GetInterests(c echo.Context) error {
-	interests, err := db.GetInterests()
+	interests, categories, err := localizedInterests(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get interests: "+err.Error())
+		return err
+	}
+	byID := make(map[int]string, len(categories))
+	for _, category := range categories {
+		byID[category.ID] = category.Name
+	}
+	for i := range interests {
+		if name, ok := byID[interests[i].CategoryID]; ok {
+			interests[i].Category = name
+		}
 	}
 	return c.JSON(http.StatusOK, interests)
 }
+
+// GetInterestCategories godoc
+// @Summary Get interest categories
+// @Description Retrieve the interest categories in display order, each with its interests as a tree: top-level interests with their sub-interests in children. Interests without a category are listed last under "other". Names are localized like GET /api/v1/interests.
+// @Tags interests
+// @Produce  json
+// @Param   lang query string false "Language code (ja, en, zh, ko, ...), preferred over Accept-Language"
+// @Success 200 {array} models.InterestCategory
+// @Router /api/v1/interests/categories [get]
+func GetInterestCategories(c echo.Context) error {
+	interests, categories, err := localizedInterests(c)
+	if err != nil {
+		return err
+	}
+	tree := models.BuildInterestTree(categories, interests)
+	locales := requestLocales(c)
+	for i := range tree {
+		if tree[i].ID == 0 {
+			tree[i].Name = tree[i].Names.Pick(locales, tree[i].Name)
+			tree[i].Names = nil
+		}
+	}
+	return c.JSON(http.StatusOK, tree)
+}
+
+// localizedInterests returns the interests and categories with their names in the
+// client's language. The other translations are left out of the response.
+func localizedInterests(c echo.Context) ([]models.Interest, []models.InterestCategory, error) {
+	interests, err := db.GetInterests()
+	if err != nil {
+		return nil, nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to get interests: "+err.Error())
+	}
+	categories, err := db.GetInterestCategories()
+	if err != nil {
+		return nil, nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to get interest categories: "+err.Error())
+	}
+
+	locales := requestLocales(c)
+	for i := range interests {
+		interests[i].Name = interests[i].Names.Pick(locales, interests[i].Name)
+		interests[i].Names = nil
+	}
+	for i := range categories {
+		categories[i].Name = categories[i].Names.Pick(locales, categories[i].Name)
+		categories[i].Names = nil
+	}
+	return interests, categories, nil
+}
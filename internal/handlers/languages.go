@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"meetupr-backend/internal/languages"
+
+	"github.com/labstack/echo/v4"
+)
+
+// LanguageItem is a language from the master list with its name in the requested locale.
+type LanguageItem struct {
+	Code       string `json:"code"`
+	Name       string `json:"name"`
+	NativeName string `json:"native_name"`
+}
+
+// requestLocale returns "ja" or "en" for localized responses: the lang query parameter
+// if given, otherwise the first supported language in Accept-Language. Defaults to "ja".
+func requestLocale(c echo.Context) string {
+	for _, locale := range requestLocales(c) {
+		if locale == "ja" || locale == "en" {
+			return locale
+		}
+	}
+	return "ja"
+}
+
+// requestLocales returns the language codes the client prefers, best first: the lang
+// query parameter if given, then the languages of Accept-Language by quality. Region
+// subtags are dropped ("zh-TW" is "zh").
+func requestLocales(c echo.Context) []string {
+	var locales []string
+	seen := make(map[string]bool)
+	add := func(tag string) {
+		code := strings.ToLower(strings.TrimSpace(strings.SplitN(tag, "-", 2)[0]))
+		if code != "" && code != "*" && !seen[code] {
+			seen[code] = true
+			locales = append(locales, code)
+		}
+	}
+	if lang := c.QueryParam("lang"); lang != "" {
+		add(lang)
+	}
+
+	type weighted struct {
+		tag     string
+		quality float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(c.Request().Header.Get("Accept-Language"), ",") {
+		fields := strings.Split(part, ";")
+		quality := 1.0
+		for _, param := range fields[1:] {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if q, err := strconv.ParseFloat(value, 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		if quality > 0 {
+			tags = append(tags, weighted{fields[0], quality})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].quality > tags[j].quality })
+	for _, t := range tags {
+		add(t.tag)
+	}
+	return locales
+}
+
+// GetLanguages godoc
+// @Summary Get the list of languages
+// @Description Get the languages that can be used in profiles, identified by ISO 639-1 codes, with names in the language of Accept-Language (ja or en; override with lang)
+// @Tags languages
+// @Produce  json
+// @Param   lang query string false "ja or en"
+// @Success 200 {array} LanguageItem
+// @Router /api/v1/languages [get]
+func GetLanguages(c echo.Context) error {
+	locale := requestLocale(c)
+	all := languages.All()
+	items := make([]LanguageItem, 0, len(all))
+	for _, l := range all {
+		items = append(items, LanguageItem{Code: l.Code, Name: l.Name(locale), NativeName: l.NativeName})
+	}
+	return c.JSON(http.StatusOK, items)
+}
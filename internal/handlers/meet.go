@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+
+	"meetupr-backend/internal/models"
+	"meetupr-backend/internal/notify"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CreateMeetRequest godoc
+// @Summary Send an anonymous "want to meet"
+// @Description Tell another user you want to meet them. The recipient is not told who pressed the button; only when both users have pressed it is a chat created and both are notified with a match event. Pressing it again after a match returns the match without notifying anyone again.
+// @Tags meet-requests
+// @Accept  json
+// @Produce  json
+// @Param   request body models.MeetRequest true "Recipient"
+// @Success 201 {object} models.MeetRequestResponse "Request sent"
+// @Success 200 {object} models.MeetRequestResponse "Mutual match"
+// @Router /api/v1/meet-requests [post]
+func CreateMeetRequest(hub *Hub) echo.HandlerFunc {
+	return createMeetRequest(hub, supabaseMeetRequestStore{})
+}
+
+func createMeetRequest(hub *Hub, store MeetRequestStore) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := c.Get("user_id").(string)
+		if !ok || userID == "" {
+			return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+		}
+
+		var req models.MeetRequest
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+		}
+		if req.RecipientID == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "recipient_id is required")
+		}
+		if req.RecipientID == userID {
+			return echo.NewHTTPError(http.StatusBadRequest, "Cannot send a meet request to yourself")
+		}
+
+		matched, created, err := store.CreateMeetRequest(userID, req.RecipientID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if !matched {
+			return c.JSON(http.StatusCreated, models.MeetRequestResponse{Matched: false})
+		}
+
+		// 相互マッチ: チャットを作成して両者に通知
+		chatID, err := store.GetOrCreateChat(userID, req.RecipientID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create chat for match: "+err.Error())
+		}
+		// 既にマッチ済みの再押下では通知しない
+		if !created {
+			return c.JSON(http.StatusOK, models.MeetRequestResponse{Matched: true, ChatID: chatID})
+		}
+		hub.SendEvent(userID, EventMatch, chatID, Match{UserID: req.RecipientID, ChatID: chatID})
+		hub.SendEvent(req.RecipientID, EventMatch, chatID, Match{UserID: userID, ChatID: chatID})
+		// Both inboxes keep the match for users who weren't online
+		for _, n := range []models.Notification{
+			{UserID: userID, Type: models.NotificationMatch, ActorID: req.RecipientID},
+			{UserID: req.RecipientID, Type: models.NotificationMatch, ActorID: userID},
+		} {
+			n.TargetType = "chat"
+			n.TargetID = strconv.FormatInt(chatID, 10)
+			if err := createNotification(hub, n); err != nil {
+				log.Printf("error creating match notification for user %s: %v", n.UserID, err)
+			}
+		}
+		go hub.PushIfOffline(context.Background(), notify.Notification{
+			UserID: req.RecipientID,
+			Type:   notify.TypeMatch,
+			Title:  "It's a match!",
+			Body:   "Someone you wanted to meet wants to meet you too",
+			ChatID: chatID,
+			Tag:    "match-" + strconv.FormatInt(chatID, 10),
+		})
+
+		return c.JSON(http.StatusOK, models.MeetRequestResponse{Matched: true, ChatID: chatID})
+	}
+}
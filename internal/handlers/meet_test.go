@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"meetupr-backend/internal/models"
+	"meetupr-backend/internal/pubsub"
+
+	"github.com/labstack/echo/v4"
+)
+
+// matchedMeetStore answers every request as a repeated press on an existing match.
+type matchedMeetStore struct{ chatID int64 }
+
+func (s matchedMeetStore) CreateMeetRequest(senderID, recipientID string) (bool, bool, error) {
+	return true, false, nil
+}
+
+func (s matchedMeetStore) GetOrCreateChat(user1ID, user2ID string) (int64, error) {
+	return s.chatID, nil
+}
+
+func TestMeetRequestRepeatedAfterMatchNotifiesNobody(t *testing.T) {
+	broker := pubsub.NewMemoryBroker()
+	defer broker.Close()
+	hub := newTestHub(broker, &memoryStore{})
+
+	var events atomic.Int32
+	for _, userID := range []string{"user1", "user2"} {
+		unsubscribe, err := broker.Subscribe(pubsub.UserTopic(userID), func([]byte) { events.Add(1) })
+		if err != nil {
+			t.Fatalf("Subscribe failed: %v", err)
+		}
+		defer unsubscribe()
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/meet-requests", strings.NewReader(`{"recipient_id":"user2"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.Set("user_id", "user1")
+	if err := createMeetRequest(hub, matchedMeetStore{chatID: 7})(c); err != nil {
+		t.Fatalf("handler failed: %v", err)
+	}
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var resp models.MeetRequestResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !resp.Matched || resp.ChatID != 7 {
+		t.Errorf("response = %+v, want the existing match", resp)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := events.Load(); n != 0 {
+		t.Errorf("%d events sent for a repeated press", n)
+	}
+}
@@ -0,0 +1,426 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"meetupr-backend/internal/db"
+	"meetupr-backend/internal/meetup"
+	"meetupr-backend/internal/models"
+	"meetupr-backend/internal/notify"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Chat room frame types for meetups; a frame without a type is a text message
+const (
+	FrameMeetupPropose = "meetup_propose"
+	FrameMeetupAccept  = "meetup_accept"
+	FrameMeetupDecline = "meetup_decline"
+	FrameMeetupCounter = "meetup_counter"
+)
+
+// rejectedMessage is returned by SaveMessage for a message that breaks a rule checked
+// against the database; the sender gets an ErrorFrame with its code instead.
+type rejectedMessage struct {
+	code    string
+	message string
+}
+
+func (e *rejectedMessage) Error() string {
+	return e.code + ": " + e.message
+}
+
+func rejectMessage(code, message string) error {
+	return &rejectedMessage{code: code, message: message}
+}
+
+// isMeetupFrame reports whether a chat room frame type is a meetup action.
+func isMeetupFrame(frameType string) bool {
+	switch frameType {
+	case FrameMeetupPropose, FrameMeetupAccept, FrameMeetupDecline, FrameMeetupCounter:
+		return true
+	}
+	return false
+}
+
+// checkMeetupFrame checks what can be checked about a meetup action without the database,
+// so readPump can reject it right away.
+func checkMeetupFrame(msg *Message, now time.Time) error {
+	action := msg.Meetup
+	if action == nil {
+		return errors.New("meetup is required")
+	}
+	if msg.Type != FrameMeetupPropose && action.ProposalID <= 0 {
+		return errors.New("proposal_id is required")
+	}
+	switch msg.Type {
+	case FrameMeetupPropose:
+		if action.LocationID <= 0 {
+			return errors.New("location_id is required")
+		}
+		fallthrough
+	case FrameMeetupCounter:
+		if err := meetup.ValidateSlots(action.Candidates, now); err != nil {
+			return err
+		}
+		return meetup.ValidateNote(action.Note)
+	case FrameMeetupAccept:
+		if action.Slot < 0 {
+			return errors.New("slot must not be negative")
+		}
+	}
+	return nil
+}
+
+// saveMeetupMessage carries out a meetup action and saves the meetup message that
+// announces it in the chat.
+func saveMeetupMessage(m *Message) (*models.Message, error) {
+	var (
+		proposal *models.MeetupProposal
+		content  string
+		err      error
+	)
+	if m.Type == FrameMeetupPropose {
+		proposal, err = proposeMeetup(m)
+		content = "Proposed a meetup"
+	} else {
+		proposal, content, err = respondToMeetup(m)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	saved, err := insertMessage(m.ChatID, m.SenderID, content, models.MessageTypeMeetup, &proposal.ID)
+	if err != nil {
+		return nil, err
+	}
+	saved.Meetup = proposal
+	return saved, nil
+}
+
+// proposeMeetup stores a new proposal to the other user of a direct chat.
+func proposeMeetup(m *Message) (*models.MeetupProposal, error) {
+	chat, err := db.GetChat(m.ChatID)
+	if err != nil {
+		return nil, err
+	}
+	if chat == nil || chat.Kind != models.ChatDirect {
+		return nil, rejectMessage("meetup_unavailable", "Meetups can only be proposed in direct chats")
+	}
+	recipientID := chat.User1ID
+	if recipientID == m.SenderID {
+		recipientID = chat.User2ID
+	}
+	if err := checkMeetupPlace(m.Meetup.LocationID, m.Meetup.EventID); err != nil {
+		return nil, err
+	}
+	return db.CreateMeetupProposal(models.MeetupProposal{
+		ChatID:      m.ChatID,
+		ProposerID:  m.SenderID,
+		RecipientID: recipientID,
+		Candidates:  m.Meetup.Candidates,
+		LocationID:  m.Meetup.LocationID,
+		EventID:     m.Meetup.EventID,
+		Note:        m.Meetup.Note,
+	})
+}
+
+// respondToMeetup accepts, declines or counters a pending proposal made to the sender.
+// It returns the proposal to show in the chat and the message text.
+func respondToMeetup(m *Message) (*models.MeetupProposal, string, error) {
+	action := m.Meetup
+	p, err := db.GetMeetupProposal(action.ProposalID)
+	if err != nil {
+		return nil, "", err
+	}
+	if p == nil || p.ChatID != m.ChatID {
+		return nil, "", rejectMessage("meetup_not_found", "Meetup proposal not found")
+	}
+	if p.RecipientID != m.SenderID {
+		return nil, "", rejectMessage("forbidden", "Only the recipient can respond to a meetup proposal")
+	}
+	closed := rejectMessage("meetup_closed", "This meetup proposal was already answered")
+	if p.Status != models.MeetupPending {
+		return nil, "", closed
+	}
+
+	switch m.Type {
+	case FrameMeetupAccept:
+		if action.Slot >= len(p.Candidates) {
+			return nil, "", rejectMessage("invalid_meetup", "slot is not one of the candidate times")
+		}
+		slot := p.Candidates[action.Slot]
+		if !slot.Start.After(time.Now()) {
+			return nil, "", rejectMessage("invalid_meetup", "That time has already passed")
+		}
+		accepted, err := db.RespondMeetupProposal(p.ID, models.MeetupAccepted, &slot)
+		if err != nil {
+			return nil, "", err
+		}
+		if accepted == nil {
+			return nil, "", closed
+		}
+		return accepted, "Accepted the meetup", nil
+
+	case FrameMeetupDecline:
+		declined, err := db.RespondMeetupProposal(p.ID, models.MeetupDeclined, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		if declined == nil {
+			return nil, "", closed
+		}
+		return declined, "Declined the meetup", nil
+
+	default: // FrameMeetupCounter
+		locationID, eventID := p.LocationID, p.EventID
+		if action.LocationID > 0 {
+			locationID = action.LocationID
+		}
+		if action.EventID != nil {
+			eventID = action.EventID
+		}
+		if err := checkMeetupPlace(locationID, eventID); err != nil {
+			return nil, "", err
+		}
+		countered, err := db.RespondMeetupProposal(p.ID, models.MeetupCountered, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		if countered == nil {
+			return nil, "", closed
+		}
+		counter, err := db.CreateMeetupProposal(models.MeetupProposal{
+			ChatID:      p.ChatID,
+			ProposerID:  m.SenderID,
+			RecipientID: p.ProposerID,
+			Candidates:  action.Candidates,
+			LocationID:  locationID,
+			EventID:     eventID,
+			Note:        action.Note,
+			PreviousID:  &p.ID,
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		return counter, "Suggested other times for the meetup", nil
+	}
+}
+
+// checkMeetupPlace checks that the campus location and the linked event, if any, exist.
+func checkMeetupPlace(locationID int, eventID *int64) error {
+	location, err := db.GetCampusLocation(locationID)
+	if err != nil {
+		return err
+	}
+	if location == nil {
+		return rejectMessage("invalid_meetup", "Unknown campus location")
+	}
+	if eventID != nil {
+		event, err := db.GetEvent(*eventID)
+		if err != nil {
+			return err
+		}
+		if event == nil {
+			return rejectMessage("invalid_meetup", "Event not found")
+		}
+	}
+	return nil
+}
+
+// GetCampusLocations godoc
+// @Summary Get campus locations
+// @Description Get the places on campus where meetups can be held, with names in the client's language.
+// @Tags meetups
+// @Produce  json
+// @Param   lang query string false "Language code (ja, en, zh, ko, ...), preferred over Accept-Language"
+// @Success 200 {array} models.CampusLocation
+// @Router /api/v1/campus-locations [get]
+func GetCampusLocations(c echo.Context) error {
+	locations, err := db.GetCampusLocations()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get campus locations: "+err.Error())
+	}
+	locales := requestLocales(c)
+	for i := range locations {
+		localizeLocation(&locations[i], locales)
+	}
+	return c.JSON(http.StatusOK, locations)
+}
+
+// GetMeetup godoc
+// @Summary Get a meetup proposal
+// @Description Get a meetup proposal you made or received, with its campus location.
+// @Tags meetups
+// @Produce  json
+// @Param   meetupId path int true "Meetup proposal ID"
+// @Success 200 {object} models.MeetupProposal
+// @Router /api/v1/meetups/{meetupId} [get]
+func GetMeetup(c echo.Context) error {
+	_, p, err := meetupForParticipant(c)
+	if err != nil {
+		return err
+	}
+	if p.Location != nil {
+		localizeLocation(p.Location, requestLocales(c))
+	}
+	return c.JSON(http.StatusOK, p)
+}
+
+// GetMeetupCalendar godoc
+// @Summary Download an accepted meetup as iCalendar
+// @Description Download an accepted meetup as an .ics file to add to a calendar app. The event has a one-hour alarm and keeps its UID across downloads.
+// @Tags meetups
+// @Produce  text/calendar
+// @Param   meetupId path int true "Meetup proposal ID"
+// @Success 200 {string} string "iCalendar file"
+// @Router /api/v1/meetups/{meetupId}/calendar.ics [get]
+func GetMeetupCalendar(c echo.Context) error {
+	userID, p, err := meetupForParticipant(c)
+	if err != nil {
+		return err
+	}
+	if p.Status != models.MeetupAccepted || p.AcceptedSlot == nil {
+		return echo.NewHTTPError(http.StatusConflict, "Meetup has not been accepted")
+	}
+
+	_, otherName, err := db.GetUserContact(p.OtherParticipant(userID))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	summary := "Meetup with " + otherName
+	if requestLocale(c) == "ja" {
+		summary = otherName + "さんとのミートアップ"
+	}
+	event := meetup.CalendarEvent{
+		UID:         fmt.Sprintf("meetup-%d@meetupr", p.ID),
+		Start:       p.AcceptedSlot.Start,
+		End:         p.AcceptedSlot.End,
+		Summary:     summary,
+		Description: p.Note,
+		Stamp:       time.Now(),
+		Alarm:       time.Hour,
+	}
+	if p.Location != nil {
+		event.Location = p.Location.Names.Pick(requestLocales(c), p.Location.Name)
+		if p.Location.Building != "" {
+			event.Location += ", " + p.Location.Building
+		}
+	}
+	if p.EventID != nil {
+		if linked, err := db.GetEvent(*p.EventID); err == nil && linked != nil {
+			if event.Description != "" {
+				event.Description += "\n"
+			}
+			event.Description += linked.Title
+		}
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="meetup-%d.ics"`, p.ID))
+	return c.Blob(http.StatusOK, "text/calendar; charset=utf-8", meetup.ICS(event))
+}
+
+// meetupForParticipant loads the meetup proposal in the path, if the user made or received it.
+func meetupForParticipant(c echo.Context) (string, *models.MeetupProposal, error) {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return "", nil, echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
+	meetupID, err := strconv.ParseInt(c.Param("meetupId"), 10, 64)
+	if err != nil {
+		return "", nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid meetup ID")
+	}
+	p, err := db.GetMeetupProposal(meetupID)
+	if err != nil {
+		return "", nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	// Other users can't tell whether the proposal exists
+	if p == nil || (p.ProposerID != userID && p.RecipientID != userID) {
+		return "", nil, echo.NewHTTPError(http.StatusNotFound, "Meetup not found")
+	}
+	return userID, p, nil
+}
+
+// localizeLocation sets the location's name in the client's language and drops the other translations.
+func localizeLocation(location *models.CampusLocation, locales []string) {
+	location.Name = location.Names.Pick(locales, location.Name)
+	location.Names = nil
+}
+
+// meetupReminderPayload is the payload of a meetup_reminder notification
+type meetupReminderPayload struct {
+	MeetupID int64             `json:"meetup_id"`
+	ChatID   int64             `json:"chat_id"`
+	Reminder string            `json:"reminder"`
+	Slot     models.MeetupSlot `json:"slot"`
+	Location string            `json:"location,omitempty"`
+}
+
+// MeetupReminderNotifier reminds a participant of an accepted meetup with an inbox
+// notification, pushed if they are offline.
+func MeetupReminderNotifier(hub *Hub) func(ctx context.Context, userID string, m models.MeetupProposal, r meetup.Reminder) error {
+	return func(ctx context.Context, userID string, m models.MeetupProposal, r meetup.Reminder) error {
+		location := ""
+		if m.Location != nil {
+			location = m.Location.Name
+		}
+		payload, err := json.Marshal(meetupReminderPayload{
+			MeetupID: m.ID,
+			ChatID:   m.ChatID,
+			Reminder: r.Name,
+			Slot:     *m.AcceptedSlot,
+			Location: location,
+		})
+		if err != nil {
+			return err
+		}
+		n := models.Notification{
+			UserID:     userID,
+			Type:       models.NotificationMeetupReminder,
+			ActorID:    m.OtherParticipant(userID),
+			TargetType: "meetup",
+			TargetID:   strconv.FormatInt(m.ID, 10),
+			Payload:    payload,
+		}
+		if err := createNotification(hub, n); err != nil {
+			return err
+		}
+
+		body := "Your meetup starts within " + reminderLead(r)
+		if location != "" {
+			body = fmt.Sprintf("Your meetup at %s starts within %s", location, reminderLead(r))
+		}
+		hub.PushIfOffline(ctx, notify.Notification{
+			UserID: userID,
+			Type:   notify.TypeMeetup,
+			Title:  "Meetup reminder",
+			Body:   body,
+			ChatID: m.ChatID,
+			Tag:    "meetup-" + n.TargetID,
+		})
+		return nil
+	}
+}
+
+// reminderLead describes how long before the meetup a reminder is sent.
+func reminderLead(r meetup.Reminder) string {
+	if r.Before%(24*time.Hour) == 0 {
+		if days := int(r.Before / (24 * time.Hour)); days > 1 {
+			return strconv.Itoa(days) + " days"
+		}
+		return "a day"
+	}
+	if r.Before%time.Hour == 0 {
+		if hours := int(r.Before / time.Hour); hours > 1 {
+			return strconv.Itoa(hours) + " hours"
+		}
+		return "an hour"
+	}
+	return r.Before.String()
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"meetupr-backend/internal/db"
+	"meetupr-backend/internal/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultNotificationPageSize = 20
+	maxNotificationPageSize     = 100
+)
+
+// NotificationCount is the payload of a notification_count event.
+type NotificationCount struct {
+	UnreadCount int `json:"unread_count"`
+}
+
+// createNotification stores a notification in the user's inbox and delivers it live to
+// the user's /ws/user connections.
+func createNotification(hub *Hub, n models.Notification) error {
+	created, err := db.CreateNotification(n)
+	if err != nil {
+		return err
+	}
+	hub.SendEvent(n.UserID, EventNotification, 0, created)
+	return nil
+}
+
+// sendNotificationCount tells the user's devices the current unread notification count.
+func sendNotificationCount(hub *Hub, store NotificationStore, userID string) (int, error) {
+	unreadCount, err := store.UnreadCount(userID)
+	if err != nil {
+		return 0, err
+	}
+	hub.SendEvent(userID, EventNotificationCount, 0, NotificationCount{UnreadCount: unreadCount})
+	return unreadCount, nil
+}
+
+// GetNotifications godoc
+// @Summary Get notifications
+// @Description Get the current user's in-app notifications, newest first. Pass next_cursor from the previous page as cursor to get older notifications.
+// @Tags notifications
+// @Produce  json
+// @Param   cursor query string false "Cursor from the previous page"
+// @Param   limit query int false "Page size (default 20, max 100)"
+// @Param   unread query bool false "Only unread notifications"
+// @Success 200 {object} models.NotificationPage
+// @Router /api/v1/notifications [get]
+func GetNotifications(c echo.Context) error {
+	return getNotifications(c, supabaseNotificationStore{})
+}
+
+func getNotifications(c echo.Context, store NotificationStore) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
+
+	var beforeID int64
+	if cursor := c.QueryParam("cursor"); cursor != "" {
+		id, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil || id <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid cursor")
+		}
+		beforeID = id
+	}
+	limit := defaultNotificationPageSize
+	if limitStr := c.QueryParam("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid limit")
+		}
+		limit = min(parsed, maxNotificationPageSize)
+	}
+	unreadOnly := c.QueryParam("unread") == "true"
+
+	// Fetch one extra row to know whether there is a next page
+	notifications, err := store.Notifications(userID, beforeID, limit+1, unreadOnly)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get notifications: "+err.Error())
+	}
+	page := models.NotificationPage{Notifications: notifications}
+	if len(notifications) > limit {
+		page.Notifications = notifications[:limit]
+		page.NextCursor = strconv.FormatInt(page.Notifications[limit-1].ID, 10)
+	}
+
+	page.UnreadCount, err = store.UnreadCount(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get unread count: "+err.Error())
+	}
+	return c.JSON(http.StatusOK, page)
+}
+
+// GetUnreadNotificationCount godoc
+// @Summary Get the unread notification count
+// @Description Get the number of unread notifications for the badge
+// @Tags notifications
+// @Produce  json
+// @Success 200 {object} NotificationCount
+// @Router /api/v1/notifications/unread-count [get]
+func GetUnreadNotificationCount(c echo.Context) error {
+	return getUnreadNotificationCount(c, supabaseNotificationStore{})
+}
+
+func getUnreadNotificationCount(c echo.Context, store NotificationStore) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
+
+	unreadCount, err := store.UnreadCount(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get unread count: "+err.Error())
+	}
+	return c.JSON(http.StatusOK, NotificationCount{UnreadCount: unreadCount})
+}
+
+// MarkNotificationRead godoc
+// @Summary Mark a notification as read
+// @Description Mark one notification as read. The user's devices get a notification_count event.
+// @Tags notifications
+// @Produce  json
+// @Param   notificationId path int true "Notification ID"
+// @Success 200 {object} NotificationCount
+// @Router /api/v1/notifications/{notificationId}/read [post]
+func MarkNotificationRead(hub *Hub) echo.HandlerFunc {
+	return markNotificationRead(hub, supabaseNotificationStore{})
+}
+
+func markNotificationRead(hub *Hub, store NotificationStore) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := c.Get("user_id").(string)
+		if !ok || userID == "" {
+			return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+		}
+
+		notificationID, err := strconv.ParseInt(c.Param("notificationId"), 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid notification ID")
+		}
+
+		found, err := store.MarkRead(userID, notificationID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if !found {
+			return echo.NewHTTPError(http.StatusNotFound, "Notification not found")
+		}
+
+		unreadCount, err := sendNotificationCount(hub, store, userID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get unread count: "+err.Error())
+		}
+		return c.JSON(http.StatusOK, NotificationCount{UnreadCount: unreadCount})
+	}
+}
+
+// MarkAllNotificationsRead godoc
+// @Summary Mark all notifications as read
+// @Description Mark every notification of the current user as read. The user's devices get a notification_count event.
+// @Tags notifications
+// @Produce  json
+// @Success 200 {object} NotificationCount
+// @Router /api/v1/notifications/read-all [post]
+func MarkAllNotificationsRead(hub *Hub) echo.HandlerFunc {
+	return markAllNotificationsRead(hub, supabaseNotificationStore{})
+}
+
+func markAllNotificationsRead(hub *Hub, store NotificationStore) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := c.Get("user_id").(string)
+		if !ok || userID == "" {
+			return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+		}
+
+		if err := store.MarkAllRead(userID); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		unreadCount, err := sendNotificationCount(hub, store, userID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get unread count: "+err.Error())
+		}
+		return c.JSON(http.StatusOK, NotificationCount{UnreadCount: unreadCount})
+	}
+}
+
+// ModerationWarningRequest is the body of POST /api/v1/admin/users/{userId}/warnings.
+type ModerationWarningRequest struct {
+	Message string `json:"message"`
+}
+
+// CreateModerationWarning godoc
+// @Summary Warn a user
+// @Description Put a moderation warning in a user's notification inbox. Admin only.
+// @Tags admin
+// @Accept  json
+// @Param   userId path string true "User ID"
+// @Param   warning body ModerationWarningRequest true "Warning"
+// @Success 201
+// @Router /api/v1/admin/users/{userId}/warnings [post]
+func CreateModerationWarning(hub *Hub) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req ModerationWarningRequest
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+		}
+		if req.Message == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "message is required")
+		}
+
+		payload, err := json.Marshal(req)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		err = createNotification(hub, models.Notification{
+			UserID:  c.Param("userId"),
+			Type:    models.NotificationModerationWarning,
+			Payload: payload,
+		})
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		return c.NoContent(http.StatusCreated)
+	}
+}
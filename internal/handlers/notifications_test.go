@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"meetupr-backend/internal/models"
+	"meetupr-backend/internal/pubsub"
+
+	"github.com/labstack/echo/v4"
+)
+
+// memoryNotificationStore is a NotificationStore that keeps inboxes in memory.
+type memoryNotificationStore struct {
+	mu            sync.Mutex
+	notifications []models.Notification
+}
+
+func (s *memoryNotificationStore) Notifications(userID string, beforeID int64, limit int, unreadOnly bool) ([]models.Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	page := []models.Notification{}
+	for i := len(s.notifications) - 1; i >= 0 && len(page) < limit; i-- {
+		n := s.notifications[i]
+		if n.UserID != userID || (beforeID > 0 && n.ID >= beforeID) || (unreadOnly && n.ReadAt != nil) {
+			continue
+		}
+		page = append(page, n)
+	}
+	return page, nil
+}
+
+func (s *memoryNotificationStore) UnreadCount(userID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, n := range s.notifications {
+		if n.UserID == userID && n.ReadAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *memoryNotificationStore) MarkRead(userID string, notificationID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, n := range s.notifications {
+		if n.ID == notificationID && n.UserID == userID {
+			now := time.Now()
+			s.notifications[i].ReadAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *memoryNotificationStore) MarkAllRead(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for i, n := range s.notifications {
+		if n.UserID == userID && n.ReadAt == nil {
+			s.notifications[i].ReadAt = &now
+		}
+	}
+	return nil
+}
+
+// newNotificationStore gives user1 notifications 1-5 and user2 notification 6.
+func newNotificationStore() *memoryNotificationStore {
+	store := &memoryNotificationStore{}
+	for id := int64(1); id <= 6; id++ {
+		userID := "user1"
+		if id == 6 {
+			userID = "user2"
+		}
+		store.notifications = append(store.notifications, models.Notification{ID: id, UserID: userID, Type: models.NotificationMatch})
+	}
+	return store
+}
+
+// callNotificationHandler runs handler as user1 and decodes its JSON response into out.
+func callNotificationHandler(t *testing.T, handler echo.HandlerFunc, target string, params map[string]string, out interface{}) *echo.HTTPError {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.Set("user_id", "user1")
+	for name, value := range params {
+		c.SetParamNames(name)
+		c.SetParamValues(value)
+	}
+	if err := handler(c); err != nil {
+		httpErr, ok := err.(*echo.HTTPError)
+		if !ok {
+			t.Fatalf("handler failed: %v", err)
+		}
+		return httpErr
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	return nil
+}
+
+func notificationIDs(page models.NotificationPage) []int64 {
+	ids := []int64{}
+	for _, n := range page.Notifications {
+		ids = append(ids, n.ID)
+	}
+	return ids
+}
+
+func TestNotificationsPageWithCursor(t *testing.T) {
+	store := newNotificationStore()
+	handler := func(c echo.Context) error { return getNotifications(c, store) }
+
+	var pages [][]int64
+	var page models.NotificationPage
+	cursor := ""
+	for {
+		page = models.NotificationPage{}
+		if err := callNotificationHandler(t, handler, "/api/v1/notifications?limit=2&cursor="+cursor, nil, &page); err != nil {
+			t.Fatalf("page %d: %v", len(pages), err)
+		}
+		pages = append(pages, notificationIDs(page))
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	// Newest first; the last page has no cursor, and other users' notifications never show
+	if want := [][]int64{{5, 4}, {3, 2}, {1}}; !reflect.DeepEqual(pages, want) {
+		t.Errorf("pages = %v, want %v", pages, want)
+	}
+	if page.UnreadCount != 5 {
+		t.Errorf("unread_count = %d, want 5", page.UnreadCount)
+	}
+
+	// A page that fills exactly to the end has no next cursor either
+	page = models.NotificationPage{}
+	callNotificationHandler(t, handler, "/api/v1/notifications?limit=5", nil, &page)
+	if len(page.Notifications) != 5 || page.NextCursor != "" {
+		t.Errorf("limit=5: got %v with cursor %q", notificationIDs(page), page.NextCursor)
+	}
+
+	for _, target := range []string{"/api/v1/notifications?cursor=abc", "/api/v1/notifications?cursor=-1", "/api/v1/notifications?limit=0"} {
+		if err := callNotificationHandler(t, handler, target, nil, &page); err == nil || err.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %v, want 400", target, err)
+		}
+	}
+}
+
+func TestNotificationReadStateAndUnreadCount(t *testing.T) {
+	broker := pubsub.NewMemoryBroker()
+	defer broker.Close()
+	hub := newTestHub(broker, &memoryStore{})
+	store := newNotificationStore()
+
+	ws, cleanup := newTestUserClient(t, hub, "user1")
+	defer cleanup()
+	time.Sleep(100 * time.Millisecond)
+
+	expectCount := func(got NotificationCount, want int) {
+		t.Helper()
+		if got.UnreadCount != want {
+			t.Errorf("unread_count = %d, want %d", got.UnreadCount, want)
+		}
+		// Every device hears about the new count
+		event := readUserEvent(t, ws)
+		var count NotificationCount
+		json.Unmarshal(event.Payload, &count)
+		if event.Type != EventNotificationCount || count.UnreadCount != want {
+			t.Errorf("got event %+v, want a notification_count of %d", event, want)
+		}
+	}
+
+	var count NotificationCount
+	markRead := markNotificationRead(hub, store)
+	if err := callNotificationHandler(t, markRead, "/", map[string]string{"notificationId": "4"}, &count); err != nil {
+		t.Fatal(err)
+	}
+	expectCount(count, 4)
+	// Marking it again changes nothing
+	if err := callNotificationHandler(t, markRead, "/", map[string]string{"notificationId": "4"}, &count); err != nil {
+		t.Fatal(err)
+	}
+	expectCount(count, 4)
+	// Another user's notification is not found
+	if err := callNotificationHandler(t, markRead, "/", map[string]string{"notificationId": "6"}, &count); err == nil || err.Code != http.StatusNotFound {
+		t.Errorf("marking another user's notification: got %v, want 404", err)
+	}
+
+	var page models.NotificationPage
+	unreadOnly := func(c echo.Context) error { return getNotifications(c, store) }
+	callNotificationHandler(t, unreadOnly, "/api/v1/notifications?unread=true", nil, &page)
+	if ids := notificationIDs(page); !reflect.DeepEqual(ids, []int64{5, 3, 2, 1}) {
+		t.Errorf("unread notifications = %v, want [5 3 2 1]", ids)
+	}
+
+	if err := callNotificationHandler(t, markAllNotificationsRead(hub, store), "/", nil, &count); err != nil {
+		t.Fatal(err)
+	}
+	expectCount(count, 0)
+	unreadCount := func(c echo.Context) error { return getUnreadNotificationCount(c, store) }
+	callNotificationHandler(t, unreadCount, "/", nil, &count)
+	if count.UnreadCount != 0 {
+		t.Errorf("unread-count = %d after reading all", count.UnreadCount)
+	}
+	// Only user1's inbox was read
+	if n, _ := store.UnreadCount("user2"); n != 1 {
+		t.Errorf("user2 unread = %d, want 1", n)
+	}
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+
+	"meetupr-backend/internal/db"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetPrivacySettings godoc
+// @Summary Get privacy settings
+// @Description Get who can see the current user's major, gender, residence, languages and interests, and whether the user is hidden from search.
+// @Tags users
+// @Produce  json
+// @Success 200 {object} models.PrivacySettings
+// @Router /api/v1/users/me/privacy [get]
+func GetPrivacySettings(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
+
+	settings, err := db.GetPrivacySettings(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get privacy settings: "+err.Error())
+	}
+	return c.JSON(http.StatusOK, settings)
+}
+
+// UpdatePrivacySettings godoc
+// @Summary Update privacy settings
+// @Description Set who can see each profile field: everyone, verified (OIC-verified students), connections (users you matched or chat with) or nobody. hidden_from_search leaves you out of search results (including tandem search and saved search alerts); people you chat with still see your profile. Omitted fields are left unchanged.
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param   settings body models.PrivacySettings true "Privacy settings"
+// @Success 200 {object} models.PrivacySettings
+// @Router /api/v1/users/me/privacy [put]
+func UpdatePrivacySettings(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
+
+	settings, err := db.GetPrivacySettings(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get privacy settings: "+err.Error())
+	}
+	if err := c.Bind(&settings); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := settings.Validate(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	updated, err := db.UpdatePrivacySettings(userID, settings)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, updated)
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"net/http"
+
+	"meetupr-backend/internal/db"
+	"meetupr-backend/internal/models"
+	"meetupr-backend/internal/notify"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetVapidPublicKey godoc
+// @Summary Get the VAPID public key
+// @Description Get the application server key to pass to PushManager.subscribe(). Returns 404 when push notifications are not configured.
+// @Tags push
+// @Produce  json
+// @Success 200 {object} map[string]string "Returns public_key"
+// @Router /api/v1/push/vapid-public-key [get]
+func GetVapidPublicKey(publicKey string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if publicKey == "" {
+			return echo.NewHTTPError(http.StatusNotFound, "Push notifications are not configured")
+		}
+		return c.JSON(http.StatusOK, map[string]string{"public_key": publicKey})
+	}
+}
+
+// SubscribePush godoc
+// @Summary Register a Web Push subscription
+// @Description Register the browser's PushSubscription (as returned by toJSON()) for the current user
+// @Tags push
+// @Accept  json
+// @Param   subscription body models.PushSubscription true "Push subscription"
+// @Success 201
+// @Router /api/v1/push/subscriptions [post]
+func SubscribePush(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
+
+	var sub models.PushSubscription
+	if err := c.Bind(&sub); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if sub.Endpoint == "" || sub.Keys.P256dh == "" || sub.Keys.Auth == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "endpoint, keys.p256dh and keys.auth are required")
+	}
+
+	if err := db.SavePushSubscription(userID, sub, c.Request().UserAgent()); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.NoContent(http.StatusCreated)
+}
+
+// UnsubscribePush godoc
+// @Summary Remove a Web Push subscription
+// @Description Remove one of the current user's push subscriptions, e.g. on logout
+// @Tags push
+// @Accept  json
+// @Param   subscription body models.PushSubscription true "Subscription (only endpoint is used)"
+// @Success 204
+// @Router /api/v1/push/subscriptions [delete]
+func UnsubscribePush(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
+
+	var sub models.PushSubscription
+	if err := c.Bind(&sub); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if sub.Endpoint == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "endpoint is required")
+	}
+
+	if err := db.DeletePushSubscription(userID, sub.Endpoint); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetNotificationSettings godoc
+// @Summary Get notification settings
+// @Description Get the current user's push notification settings (mute and quiet hours)
+// @Tags push
+// @Produce  json
+// @Success 200 {object} models.NotificationSettings
+// @Router /api/v1/users/me/notification-settings [get]
+func GetNotificationSettings(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
+
+	settings, err := db.GetNotificationSettings(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get notification settings: "+err.Error())
+	}
+	return c.JSON(http.StatusOK, settings)
+}
+
+// UpdateNotificationSettings godoc
+// @Summary Update notification settings
+// @Description Mute push notifications or set quiet hours ("HH:MM" in time_zone, may span midnight)
+// @Tags push
+// @Accept  json
+// @Produce  json
+// @Param   settings body models.NotificationSettings true "Notification settings"
+// @Success 200 {object} models.NotificationSettings
+// @Router /api/v1/users/me/notification-settings [put]
+func UpdateNotificationSettings(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
+
+	var settings models.NotificationSettings
+	if err := c.Bind(&settings); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if settings.TimeZone == "" {
+		settings.TimeZone = notify.DefaultTimeZone
+	}
+	if err := notify.ValidateSettings(settings); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	updated, err := db.UpdateNotificationSettings(userID, settings)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, updated)
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"meetupr-backend/internal/db"
+	"meetupr-backend/internal/languages"
+	"meetupr-backend/internal/models"
+	"meetupr-backend/internal/recommend"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultRecommendationCount = 20
+	maxRecommendationCount     = 50
+)
+
+// GetRecommendations godoc
+// @Summary Get recommended users
+// @Description Rank other users as conversation partners for the current user ("おすすめ"). Complementary languages (their native language is one you are learning and the other way round), shared interests weighted by preference level, a shared major, recent activity and a complete profile raise the score; the weight of each factor is configurable on the server. Users you already chat with, blocked users and users hidden from search are left out. Each result explains why it was recommended.
+// @Tags users
+// @Produce  json
+// @Param   limit query int false "Number of results (default 20, max 50)"
+// @Param   language query string false "Only users who speak this language (ISO 639-1 code)"
+// @Param   min_level query string false "...at this level or above (A1-C2, native; default A1)"
+// @Param   min_completeness query int false "Only users whose profile completeness is at least this (0-100)"
+// @Success 200 {array} recommend.Recommendation
+// @Router /api/v1/recommendations [get]
+func GetRecommendations(weights recommend.Weights) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, ok := c.Get("user_id").(string)
+		if !ok || userID == "" {
+			return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+		}
+
+		limit := defaultRecommendationCount
+		if limitStr := c.QueryParam("limit"); limitStr != "" {
+			parsed, err := strconv.Atoi(limitStr)
+			if err != nil || parsed <= 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, "Invalid limit")
+			}
+			limit = min(parsed, maxRecommendationCount)
+		}
+
+		var language string
+		minLevel := c.QueryParam("min_level")
+		if value := c.QueryParam("language"); value != "" {
+			code, ok := languages.Normalize(value)
+			if !ok {
+				return echo.NewHTTPError(http.StatusBadRequest, "Unknown language: "+value)
+			}
+			language = code
+			if minLevel == "" {
+				minLevel = models.LevelA1
+			}
+		} else if minLevel != "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "min_level requires language")
+		}
+		if minLevel != "" && !models.ValidLevel(minLevel) {
+			return echo.NewHTTPError(http.StatusBadRequest, "min_level must be one of A1, A2, B1, B2, C1, C2, native")
+		}
+		var minCompleteness int
+		if value := c.QueryParam("min_completeness"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 || parsed > 100 {
+				return echo.NewHTTPError(http.StatusBadRequest, "min_completeness must be between 0 and 100")
+			}
+			minCompleteness = parsed
+		}
+
+		me, err := db.GetMatchProfile(userID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get your profile: "+err.Error())
+		}
+		candidates, err := db.GetMatchCandidates(userID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get candidates: "+err.Error())
+		}
+
+		blocked, err := db.GetBlockedUserIDs(userID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get blocked users: "+err.Error())
+		}
+		viewer, err := db.GetProfileViewer(userID, nil)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get privacy settings: "+err.Error())
+		}
+
+		filtered := recommendationCandidates(candidates, blocked, viewer, language, minLevel, minCompleteness)
+		return c.JSON(http.StatusOK, recommend.Rank(*me, filtered, weights, time.Now(), limit))
+	}
+}
+
+// recommendationCandidates leaves out the candidates the viewer blocked, already chats
+// with or can't find, and redacts the rest so they are filtered and ranked only on what
+// they share with the viewer, completeness included.
+func recommendationCandidates(candidates []models.User, blocked map[string]bool, viewer models.ProfileViewer, language, minLevel string, minCompleteness int) []models.User {
+	filtered := make([]models.User, 0, len(candidates))
+	for _, candidate := range candidates {
+		// Users they already chat with are left out; recommendations are a search too
+		if blocked[candidate.ID] || viewer.Connections[candidate.ID] || !viewer.CanFind(candidate.ID) {
+			continue
+		}
+		viewer.Redact(&candidate)
+		if candidate.Completeness < minCompleteness {
+			continue
+		}
+		if language == "" || candidate.SpeaksAtLeast(language, minLevel) {
+			filtered = append(filtered, candidate)
+		}
+	}
+	return filtered
+}
+
+// SearchTandemPartners godoc
+// @Summary Find language exchange partners
+// @Description Find tandem partners for "I teach X, I learn Y": users who speak Y at C1 or above (or natively) and are learning X below your level in it. Results are ranked by fit: how well the partner speaks Y, and how close their level in X is to yours in Y. Languages and levels default to your profile (your native language and first learning language). Levels are A1–C2 or native.
+// @Tags users
+// @Produce  json
+// @Param   teach query string false "Language you teach (default: your native language)"
+// @Param   teach_level query string false "Your level in it (default: from your profile)"
+// @Param   learn query string false "Language you learn (default: your first learning language)"
+// @Param   learn_level query string false "Your current level in it (default: from your profile, else A1)"
+// @Param   limit query int false "Number of results (default 20, max 50)"
+// @Success 200 {array} recommend.TandemMatch
+// @Router /api/v1/tandem [get]
+func SearchTandemPartners(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
+
+	limit := defaultRecommendationCount
+	if limitStr := c.QueryParam("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid limit")
+		}
+		limit = min(parsed, maxRecommendationCount)
+	}
+
+	me, err := db.GetMatchProfile(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get your profile: "+err.Error())
+	}
+
+	q := recommend.TandemQuery{
+		Teach:      strings.TrimSpace(c.QueryParam("teach")),
+		TeachLevel: c.QueryParam("teach_level"),
+		Learn:      strings.TrimSpace(c.QueryParam("learn")),
+		LearnLevel: c.QueryParam("learn_level"),
+	}
+	if q.Teach == "" {
+		q.Teach = me.NativeLanguage
+	}
+	if q.Learn == "" && len(me.LearningLanguages) > 0 {
+		q.Learn = me.LearningLanguages[0]
+	}
+	if q.Teach == "" || q.Learn == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "teach and learn are required when your profile has no native or learning language")
+	}
+	for _, lang := range []*string{&q.Teach, &q.Learn} {
+		code, ok := languages.Normalize(*lang)
+		if !ok {
+			return echo.NewHTTPError(http.StatusBadRequest, "Unknown language: "+*lang)
+		}
+		*lang = code
+	}
+	if strings.EqualFold(q.Teach, q.Learn) {
+		return echo.NewHTTPError(http.StatusBadRequest, "teach and learn must be different languages")
+	}
+	if q.TeachLevel == "" {
+		q.TeachLevel = me.LanguageLevel(q.Teach)
+	}
+	if q.LearnLevel == "" {
+		q.LearnLevel = me.LanguageLevel(q.Learn)
+		if q.LearnLevel == "" {
+			q.LearnLevel = models.LevelA1
+		}
+	}
+	if !models.ValidLevel(q.TeachLevel) || !models.ValidLevel(q.LearnLevel) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Levels must be one of A1, A2, B1, B2, C1, C2, native")
+	}
+	if models.LevelRank(q.TeachLevel) < models.LevelRank(models.TeachingLevel) {
+		return echo.NewHTTPError(http.StatusBadRequest, "teach_level must be C1 or above to teach a language")
+	}
+
+	candidates, err := db.GetMatchCandidates(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get candidates: "+err.Error())
+	}
+	blocked, err := db.GetBlockedUserIDs(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get blocked users: "+err.Error())
+	}
+	viewer, err := db.GetProfileViewer(userID, nil)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get privacy settings: "+err.Error())
+	}
+	filtered := make([]models.User, 0, len(candidates))
+	for _, candidate := range candidates {
+		// Tandem is a search: hidden users are left out and hidden languages don't match
+		if blocked[candidate.ID] || !viewer.CanFind(candidate.ID) {
+			continue
+		}
+		viewer.Redact(&candidate)
+		filtered = append(filtered, candidate)
+	}
+
+	matches := recommend.Tandem(q, filtered, limit)
+	if matches == nil {
+		matches = []recommend.TandemMatch{}
+	}
+	return c.JSON(http.StatusOK, matches)
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"testing"
+
+	"meetupr-backend/internal/models"
+)
+
+func TestRecommendationCandidatesRespectPrivacy(t *testing.T) {
+	full := func(id string) models.User {
+		u := models.User{
+			ID: id, AvatarURL: "a.png", NativeLanguage: "ja", LearningLanguages: []string{"en"},
+			Interests: []models.Interest{{ID: 1, Name: "guitar"}}, Comment: "hi", Major: "IT", Residence: "JP",
+		}
+		u.Completeness = u.ProfileCompleteness().Score
+		return u
+	}
+	candidates := []models.User{full("visible"), full("hidden"), full("private"), full("blocked"), full("partner")}
+	viewer := models.ProfileViewer{
+		UserID:      "me",
+		Connections: map[string]bool{"partner": true},
+		Settings: map[string]models.PrivacySettings{
+			"hidden": {HiddenFromSearch: true},
+			// Complete, but only chat partners see most of it
+			"private": {
+				Major:     models.VisibilityConnections,
+				Gender:    models.VisibilityConnections,
+				Residence: models.VisibilityConnections,
+				Languages: models.VisibilityConnections,
+				Interests: models.VisibilityConnections,
+			},
+		},
+	}
+	blocked := map[string]bool{"blocked": true}
+
+	got := recommendationCandidates(candidates, blocked, viewer, "", "", 0)
+	if len(got) != 2 || got[0].ID != "visible" || got[1].ID != "private" {
+		t.Fatalf("unexpected candidates: %+v", got)
+	}
+	if got[1].NativeLanguage != "" || got[1].Completeness >= got[0].Completeness {
+		t.Errorf("private candidate ranked on hidden fields: %+v", got[1])
+	}
+
+	// Hidden fields don't count towards min_completeness
+	got = recommendationCandidates(candidates, blocked, viewer, "", "", 80)
+	if len(got) != 1 || got[0].ID != "visible" {
+		t.Errorf("min_completeness: unexpected candidates %+v", got)
+	}
+}
@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"meetupr-backend/internal/db"
+	"meetupr-backend/internal/models"
+	"meetupr-backend/internal/notify"
+	"meetupr-backend/internal/search"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	maxSavedSearches        = 20
+	maxSavedSearchNameRunes = 50
+)
+
+// SavedSearchRequest is the body of POST and PUT /api/v1/saved-searches. On PUT,
+// omitted fields are left unchanged.
+type SavedSearchRequest struct {
+	Name  *string       `json:"name"`
+	Query *search.Query `json:"query"`
+	// Notify the owner when new users match (default true)
+	Notify *bool `json:"notify"`
+}
+
+// GetSavedSearches godoc
+// @Summary Get saved searches
+// @Description Get the current user's saved searches, oldest first.
+// @Tags search
+// @Produce  json
+// @Success 200 {array} models.SavedSearch
+// @Router /api/v1/saved-searches [get]
+func GetSavedSearches(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
+
+	searches, err := db.GetSavedSearches(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get saved searches: "+err.Error())
+	}
+	return c.JSON(http.StatusOK, searches)
+}
+
+// CreateSavedSearch godoc
+// @Summary Save a search
+// @Description Save a search request (the body of POST /api/v1/search; cursor and limit are dropped) under a name. With notify (the default), the user gets a saved_search_match notification when users who don't match yet join or update their profile to match. Users matching at creation aren't reported. A user can have up to 20 saved searches.
+// @Tags search
+// @Accept  json
+// @Produce  json
+// @Param   search body SavedSearchRequest true "Name, query and notify"
+// @Success 201 {object} models.SavedSearch
+// @Router /api/v1/saved-searches [post]
+func CreateSavedSearch(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
+
+	var req SavedSearchRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.Name == nil || req.Query == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "name and query are required")
+	}
+	s := models.SavedSearch{UserID: userID, Notify: true}
+	if req.Notify != nil {
+		s.Notify = *req.Notify
+	}
+	q, err := applySavedSearchRequest(&s, req)
+	if err != nil {
+		return err
+	}
+
+	existing, err := db.GetSavedSearches(userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get saved searches: "+err.Error())
+	}
+	if len(existing) >= maxSavedSearches {
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("You can save up to %d searches", maxSavedSearches))
+	}
+
+	created, err := db.CreateSavedSearch(s)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to save search: "+err.Error())
+	}
+	seedSavedSearchMatches(userID, created.ID, *q)
+	return c.JSON(http.StatusCreated, created)
+}
+
+// UpdateSavedSearch godoc
+// @Summary Update a saved search
+// @Description Rename a saved search, replace its query or turn its alerts on or off. Users matching a replaced query at the time of the update aren't reported.
+// @Tags search
+// @Accept  json
+// @Produce  json
+// @Param   savedSearchId path int true "Saved search ID"
+// @Param   search body SavedSearchRequest true "Fields to change"
+// @Success 200 {object} models.SavedSearch
+// @Router /api/v1/saved-searches/{savedSearchId} [put]
+func UpdateSavedSearch(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
+	id, err := strconv.ParseInt(c.Param("savedSearchId"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid saved search ID")
+	}
+
+	var req SavedSearchRequest
+	if err := c.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	s, err := db.GetSavedSearch(userID, id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get saved search: "+err.Error())
+	}
+	if s == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Saved search not found")
+	}
+	if req.Notify != nil {
+		s.Notify = *req.Notify
+	}
+	q, err := applySavedSearchRequest(s, req)
+	if err != nil {
+		return err
+	}
+
+	updated, err := db.UpdateSavedSearch(*s)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update saved search: "+err.Error())
+	}
+	if updated == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Saved search not found")
+	}
+	if q != nil {
+		seedSavedSearchMatches(userID, id, *q)
+	}
+	return c.JSON(http.StatusOK, updated)
+}
+
+// DeleteSavedSearch godoc
+// @Summary Delete a saved search
+// @Description Delete a saved search and stop its alerts.
+// @Tags search
+// @Param   savedSearchId path int true "Saved search ID"
+// @Success 204
+// @Router /api/v1/saved-searches/{savedSearchId} [delete]
+func DeleteSavedSearch(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
+	id, err := strconv.ParseInt(c.Param("savedSearchId"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid saved search ID")
+	}
+
+	deleted, err := db.DeleteSavedSearch(userID, id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete saved search: "+err.Error())
+	}
+	if !deleted {
+		return echo.NewHTTPError(http.StatusNotFound, "Saved search not found")
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RunSavedSearch godoc
+// @Summary Run a saved search
+// @Description Run a saved search, with the same results as POST /api/v1/search.
+// @Tags search
+// @Produce  json
+// @Param   savedSearchId path int true "Saved search ID"
+// @Param   cursor query string false "next_cursor of the previous page"
+// @Param   limit query int false "Page size (default 20, max 50)"
+// @Success 200 {object} search.Page
+// @Router /api/v1/saved-searches/{savedSearchId}/results [get]
+func RunSavedSearch(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
+	id, err := strconv.ParseInt(c.Param("savedSearchId"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid saved search ID")
+	}
+
+	s, err := db.GetSavedSearch(userID, id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get saved search: "+err.Error())
+	}
+	if s == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Saved search not found")
+	}
+	var q search.Query
+	if err := json.Unmarshal(s.Query, &q); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to read saved search: "+err.Error())
+	}
+	q.Cursor = c.QueryParam("cursor")
+	if limitStr := c.QueryParam("limit"); limitStr != "" {
+		if q.Limit, err = strconv.Atoi(limitStr); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid limit")
+		}
+	}
+	page, err := runSearch(userID, q)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, page)
+}
+
+// applySavedSearchRequest validates the name and query of req and sets them on s. It
+// returns the normalized query if req has one.
+func applySavedSearchRequest(s *models.SavedSearch, req SavedSearchRequest) (*search.Query, error) {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "name must not be empty")
+		}
+		if utf8.RuneCountInString(name) > maxSavedSearchNameRunes {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("name must be at most %d characters", maxSavedSearchNameRunes))
+		}
+		s.Name = name
+	}
+	if req.Query == nil {
+		return nil, nil
+	}
+
+	q := *req.Query
+	q.Cursor = ""
+	q.Limit = 0
+	if err := q.Normalize(); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	// Stored without the page size so the job and the results endpoint choose their own
+	q.Limit = 0
+	raw, err := json.Marshal(q)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to save query: "+err.Error())
+	}
+	s.Query = raw
+	return &q, nil
+}
+
+// seedSavedSearchMatches records the users matching a new or changed saved search, so
+// its alerts only report users who start matching later.
+func seedSavedSearchMatches(userID string, savedSearchID int64, q search.Query) {
+	q.Limit = 0
+	page, err := searchCandidates(userID, q)
+	if err != nil {
+		log.Printf("error seeding matches of saved search %d: %v", savedSearchID, err)
+		return
+	}
+	userIDs := make([]string, len(page.Results))
+	for i, r := range page.Results {
+		userIDs[i] = r.ID
+	}
+	if err := db.AddSavedSearchMatches(savedSearchID, userIDs); err != nil {
+		log.Printf("error seeding matches of saved search %d: %v", savedSearchID, err)
+	}
+}
+
+// SavedSearchNotifier returns the savedsearch.NotifyFunc that puts alerts in the owner's
+// inbox and pushes them to the owner's devices when offline.
+func SavedSearchNotifier(hub *Hub) func(ctx context.Context, ownerID string, alert models.SavedSearchAlert) error {
+	return func(ctx context.Context, ownerID string, alert models.SavedSearchAlert) error {
+		payload, err := json.Marshal(alert)
+		if err != nil {
+			return err
+		}
+		n := models.Notification{
+			UserID:     ownerID,
+			Type:       models.NotificationSavedSearchMatch,
+			TargetType: "saved_search",
+			TargetID:   strconv.FormatInt(alert.SavedSearchID, 10),
+			Payload:    payload,
+		}
+		if alert.Count == 1 {
+			n.ActorID = alert.UserIDs[0]
+		}
+		if err := createNotification(hub, n); err != nil {
+			return err
+		}
+
+		body := "1 new person matches your search"
+		if alert.Count > 1 {
+			body = fmt.Sprintf("%d new people match your search", alert.Count)
+		}
+		hub.PushIfOffline(ctx, notify.Notification{
+			UserID: ownerID,
+			Type:   notify.TypeSavedSearch,
+			Title:  alert.Name,
+			Body:   body,
+			Tag:    "saved-search-" + n.TargetID,
+		})
+		return nil
+	}
+}
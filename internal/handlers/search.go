@@ -4,26 +4,35 @@ import (
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"meetupr-backend/internal/db"
+	"meetupr-backend/internal/models"
+	"meetupr-backend/internal/search"
 
 	"github.com/labstack/echo/v4"
 )
 
 // SearchRequest represents the search request body
 type SearchRequest struct {
-	Keyword   string   `json:"keyword"`   // キーワード検索（ユーザー名など）
+	Keyword   string   `json:"keyword"`   // キーワード検索（ユーザー名、自己紹介、専攻、趣味）
 	Languages []string `json:"languages"` // 言語フィルタ（日本語、英語など）
 	Countries []string `json:"countries"` // 国フィルタ（residence）
+	MinLevel  string   `json:"min_level"` // 言語レベルの下限（A1〜C2, native）。指定時は languages をこのレベル以上で話すユーザーのみ
 }
 
 // SearchUserResult represents a single user in search results
 type SearchUserResult struct {
-	UserID    string         `json:"user_id"`
-	Username  string         `json:"username"`
-	Comment   string         `json:"comment"`
-	Residence string         `json:"residence"`
-	Interests []InterestItem `json:"interests"`
+	UserID         string         `json:"user_id"`
+	Username       string         `json:"username"`
+	Comment        string         `json:"comment"`
+	Residence      string         `json:"residence"`
+	AvatarURL      *string        `json:"avatar_url"`      // NULLの可能性があるためポインタ型
+	NativeLanguage *string        `json:"native_language"` // NULLの可能性があるためポインタ型（言語コード: "ja", "en", "ko"など）
+	Interests      []InterestItem `json:"interests"`
+	// Only for keyword searches: relevance and where the keyword matched
+	Score      float64            `json:"score,omitempty"`
+	Highlights []search.Highlight `json:"highlights,omitempty"`
 }
 
 // InterestItem represents an interest/hobby item
@@ -32,9 +41,62 @@ type InterestItem struct {
 	Name string `json:"name"`
 }
 
+// SearchProfiles godoc
+// @Summary Search for users
+// @Description Search other users with any combination of filters: keyword (username, comment, major and interest names; results are ordered by relevance with the matched text in highlights), interests (any or all), majors, genders, residences, languages by role (native, spoken, learning, or any) with an optional minimum level, verified users only and recently active users. Without a keyword, the most recently active users come first. Blocked users and users hidden from search are left out, and profile fields a user doesn't share with you are empty and never match a filter. Results are paged: pass next_cursor as cursor for the next page; total counts every match. Facets count matching users per native language, residence, interest and major, each computed with every filter except its own. GET takes the same fields as query parameters (repeat a parameter for lists, e.g. interest_ids=1&interest_ids=2).
+// @Tags search
+// @Accept  json
+// @Produce  json
+// @Param   query body search.Query true "Search query"
+// @Success 200 {object} search.Page
+// @Router /api/v1/search [post]
+func SearchProfiles(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
+
+	var q search.Query
+	if err := c.Bind(&q); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid search query")
+	}
+	page, err := runSearch(userID, q)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, page)
+}
+
+// runSearch normalizes q and runs it over every user the current user may see.
+func runSearch(userID string, q search.Query) (search.Page, error) {
+	if err := q.Normalize(); err != nil {
+		return search.Page{}, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return searchCandidates(userID, q)
+}
+
+// searchCandidates runs an already normalized query over the users the current user can
+// find, as far as their privacy settings let the current user see them. Interests also
+// match their sub-interests.
+func searchCandidates(userID string, q search.Query) (search.Page, error) {
+	candidates, err := db.GetSearchCandidates(userID)
+	if err != nil {
+		log.Printf("search: error getting candidates for user %s: %v", userID, err)
+		return search.Page{}, echo.NewHTTPError(http.StatusInternalServerError, "Failed to search users: "+err.Error())
+	}
+	if len(q.InterestIDs) > 0 {
+		descendants, err := db.GetInterestDescendants()
+		if err != nil {
+			return search.Page{}, echo.NewHTTPError(http.StatusInternalServerError, "Failed to search users: "+err.Error())
+		}
+		q.IncludeSubInterests(descendants)
+	}
+	return search.Run(q, candidates, time.Now()), nil
+}
+
 // SearchUsersAdvanced godoc
 // @Summary Advanced search for users
-// @Description Search for users with keyword, language, and country filters
+// @Description Search for users with keyword, language, and country filters. Kept for compatibility: it returns every match without paging; use /api/v1/search instead.
 // @Tags search
 // @Accept  json
 // @Produce  json
@@ -53,38 +115,22 @@ func SearchUsersAdvanced(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
 	}
 
-	// 検索パラメータの正規化（空白トリム）
-	req.Keyword = strings.TrimSpace(req.Keyword)
-	for i := range req.Languages {
-		req.Languages[i] = strings.TrimSpace(req.Languages[i])
-	}
-	for i := range req.Countries {
-		req.Countries[i] = strings.TrimSpace(req.Countries[i])
-	}
-
-	// DB検索実行
-	results, err := db.SearchUsersAdvanced(currentUserID, req.Keyword, req.Languages, req.Countries)
+	results, err := legacySearch(currentUserID, req)
 	if err != nil {
-		log.Printf("SearchUsersAdvanced handler error: %v", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to search users: "+err.Error())
-	}
-
-	// 結果が nil の場合は空の配列を返す
-	if results == nil {
-		results = []db.SearchUserResult{}
+		return err
 	}
-
 	return c.JSON(http.StatusOK, results)
 }
 
 // SearchUsersWithQuery godoc
 // @Summary Search for users with query parameters
-// @Description Search for users using GET request with query parameters
+// @Description Search for users using GET request with query parameters. Kept for compatibility: it returns every match without paging; use /api/v1/search instead.
 // @Tags search
 // @Produce  json
-// @Param   keyword query string false "Keyword to search in username"
+// @Param   keyword query string false "Keyword to search in username, comment, major and interests"
 // @Param   language query string false "Language filter (comma-separated)"
 // @Param   country query string false "Country/residence filter (comma-separated)"
+// @Param   min_level query string false "Only users who speak one of the languages at this level or above (A1-C2, native)"
 // @Success 200 {array} SearchUserResult
 // @Router /api/v1/search/users [get]
 func SearchUsersWithQuery(c echo.Context) error {
@@ -94,35 +140,89 @@ func SearchUsersWithQuery(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
 	}
 
-	// クエリパラメータから検索条件を取得
-	keyword := strings.TrimSpace(c.QueryParam("keyword"))
+	results, err := legacySearch(currentUserID, SearchRequest{
+		Keyword:   c.QueryParam("keyword"),
+		Languages: splitList(c.QueryParam("language")),
+		Countries: splitList(c.QueryParam("country")),
+		MinLevel:  c.QueryParam("min_level"),
+	})
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, results)
+}
 
-	// カンマ区切りの言語と国を配列に変換
-	var languages []string
-	languageParam := c.QueryParam("language")
-	if languageParam != "" {
-		for _, lang := range strings.Split(languageParam, ",") {
-			if trimmed := strings.TrimSpace(lang); trimmed != "" {
-				languages = append(languages, trimmed)
-			}
-		}
+// legacySearch runs a /search/users request on the search engine, returning every
+// match in the old result format. Unknown languages are kept, as the old endpoint did.
+func legacySearch(userID string, req SearchRequest) ([]SearchUserResult, error) {
+	q := search.Query{
+		Keyword:    req.Keyword,
+		Languages:  req.Languages,
+		Residences: req.Countries,
+		MinLevel:   req.MinLevel,
+	}
+	q.KeepUnknownLanguages()
+	if err := q.Normalize(); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	q.Limit = 0
+	page, err := searchCandidates(userID, q)
+	if err != nil {
+		return nil, err
 	}
 
-	var countries []string
-	countryParam := c.QueryParam("country")
-	if countryParam != "" {
-		for _, country := range strings.Split(countryParam, ",") {
-			if trimmed := strings.TrimSpace(country); trimmed != "" {
-				countries = append(countries, trimmed)
-			}
+	results := make([]SearchUserResult, 0, len(page.Results))
+	for _, r := range page.Results {
+		result := SearchUserResult{
+			UserID:     r.ID,
+			Username:   r.Username,
+			Comment:    r.Comment,
+			Residence:  r.Residence,
+			Interests:  []InterestItem{},
+			Score:      r.Score,
+			Highlights: r.Highlights,
+		}
+		if r.AvatarURL != "" {
+			result.AvatarURL = &r.AvatarURL
+		}
+		if r.NativeLanguage != "" {
+			nativeLanguage := strings.ToLower(r.NativeLanguage)
+			result.NativeLanguage = &nativeLanguage
 		}
+		for _, interest := range r.Interests {
+			result.Interests = append(result.Interests, InterestItem{ID: interest.ID, Name: interest.Name})
+		}
+		results = append(results, result)
 	}
+	return results, nil
+}
 
-	// DB検索実行
-	results, err := db.SearchUsersAdvanced(currentUserID, keyword, languages, countries)
+// legacyUserSearch runs a GET /users request on the search engine, returning every
+// match as a user. Unknown languages are kept, as the old endpoint did.
+func legacyUserSearch(userID string, q search.Query) ([]models.User, error) {
+	q.KeepUnknownLanguages()
+	if err := q.Normalize(); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	q.Limit = 0
+	page, err := searchCandidates(userID, q)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to search users: "+err.Error())
+		return nil, err
 	}
+	users := make([]models.User, len(page.Results))
+	for i, r := range page.Results {
+		users[i] = r.User
+	}
+	return users, nil
+}
 
-	return c.JSON(http.StatusOK, results)
+// splitList splits a comma-separated query parameter, dropping empty values.
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if trimmed := strings.TrimSpace(v); trimmed != "" {
+			values = append(values, trimmed)
+		}
+	}
+	return values
 }
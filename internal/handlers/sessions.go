@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"meetupr-backend/internal/models"
+	"meetupr-backend/internal/notify"
+	"meetupr-backend/internal/pubsub"
+)
+
+const (
+	// Default number of simultaneous WebSocket connections per user on one instance.
+	defaultMaxConnectionsPerUser = 5
+)
+
+// UserEvent is pushed to every device of a user, wherever it is connected.
+type UserEvent struct {
+	Type    string          `json:"type"`
+	ChatID  int64           `json:"chat_id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// User event types.
+const (
+	// A chat's last message or unread count changed. Payload is a ChatUpdate.
+	EventChatUpdated = "chat_updated"
+	// Another user started a chat with the user or added them to a group. Payload is a ChatCreated.
+	EventChatCreated = "chat_created"
+	// Members joined or left a group or event room. Payload is a ChatMembersUpdate.
+	EventChatMembers = "chat_members"
+	// Two users pressed "want to meet" on each other. Payload is a Match.
+	EventMatch = "match"
+	// An admin announcement sent to everyone. Payload is an Announcement.
+	EventAnnouncement = "announcement"
+	// A new entry in the notification inbox. Payload is a models.Notification.
+	EventNotification = "notification"
+	// The unread notification count changed (notifications were read). Payload is a NotificationCount.
+	EventNotificationCount = "notification_count"
+)
+
+// ChatUpdate is the payload of a chat_updated event.
+type ChatUpdate struct {
+	LastMessage *models.Message      `json:"last_message,omitempty"`
+	UnreadCount int                  `json:"unread_count"`
+	Settings    *models.ChatSettings `json:"settings,omitempty"`
+}
+
+// ChatCreated is the payload of a chat_created event.
+type ChatCreated struct {
+	// The user who started the chat or added the user to it
+	OtherUserID string `json:"other_user_id"`
+	Kind        string `json:"kind,omitempty"`
+	Title       string `json:"title,omitempty"`
+}
+
+// ChatMembersUpdate is the payload of a chat_members event.
+type ChatMembersUpdate struct {
+	Joined      []string `json:"joined,omitempty"`
+	Left        []string `json:"left,omitempty"`
+	MemberCount int      `json:"member_count"`
+}
+
+// membersChange is published on pubsub.ChatMembersTopic when the members of a chat change.
+type membersChange struct {
+	ChatID  int64    `json:"chat_id"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// Match is the payload of a match event.
+type Match struct {
+	UserID string `json:"user_id"`
+	ChatID int64  `json:"chat_id"`
+}
+
+// Announcement is the payload of an announcement event.
+type Announcement struct {
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// userSessions is the set of a user's connections on this instance.
+type userSessions struct {
+	clients     map[*Client]bool
+	unsubscribe func()
+}
+
+// sessionRegistry indexes connections by user so events can reach all of a user's
+// devices. Each user with local connections is subscribed to pubsub.UserTopic, so an
+// event published on any instance reaches the user's devices on every instance.
+// Chat room connections count towards the per-user limit, but only /ws/user
+// connections receive events.
+type sessionRegistry struct {
+	hub        *Hub
+	maxPerUser int
+	mu         sync.Mutex
+	users      map[string]*userSessions
+}
+
+func newSessionRegistry(hub *Hub, maxPerUser int) *sessionRegistry {
+	return &sessionRegistry{
+		hub:        hub,
+		maxPerUser: maxPerUser,
+		users:      make(map[string]*userSessions),
+	}
+}
+
+// add registers client under its user. It reports false if the user already has the
+// maximum number of connections.
+func (r *sessionRegistry) add(client *Client) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sessions := r.users[client.userID]
+	if sessions == nil {
+		sessions = &userSessions{clients: make(map[*Client]bool)}
+		unsubscribe, err := r.hub.broker.Subscribe(pubsub.UserTopic(client.userID), func(payload []byte) {
+			r.deliver(client.userID, payload)
+		})
+		if err != nil {
+			log.Printf("error subscribing to user %s: %v", client.userID, err)
+		} else {
+			sessions.unsubscribe = unsubscribe
+		}
+		r.users[client.userID] = sessions
+	}
+	if len(sessions.clients) >= r.maxPerUser {
+		return false
+	}
+	sessions.clients[client] = true
+	return true
+}
+
+// remove unregisters client, unsubscribing from the user topic with the last connection.
+func (r *sessionRegistry) remove(client *Client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sessions := r.users[client.userID]
+	if sessions == nil {
+		return
+	}
+	delete(sessions.clients, client)
+	if len(sessions.clients) == 0 {
+		if sessions.unsubscribe != nil {
+			go sessions.unsubscribe()
+		}
+		delete(r.users, client.userID)
+	}
+}
+
+// deliver sends a UserEvent payload to the user's local /ws/user connections.
+func (r *sessionRegistry) deliver(userID string, payload []byte) {
+	r.mu.Lock()
+	var targets []*Client
+	if sessions := r.users[userID]; sessions != nil {
+		for client := range sessions.clients {
+			if client.isUserChannel() {
+				targets = append(targets, client)
+			}
+		}
+	}
+	r.mu.Unlock()
+
+	for _, client := range targets {
+		if !client.trySend(payload) {
+			log.Printf("sessionRegistry: send channel unavailable for user %s, dropping event", userID)
+		}
+	}
+}
+
+// online reports whether the user has any connection on this instance.
+func (r *sessionRegistry) online(userID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.users[userID] != nil
+}
+
+// deliverAll sends a payload to every local /ws/user connection.
+func (r *sessionRegistry) deliverAll(payload []byte) {
+	r.mu.Lock()
+	var targets []*Client
+	for _, sessions := range r.users {
+		for client := range sessions.clients {
+			if client.isUserChannel() {
+				targets = append(targets, client)
+			}
+		}
+	}
+	r.mu.Unlock()
+
+	for _, client := range targets {
+		if !client.trySend(payload) {
+			log.Printf("sessionRegistry: send channel unavailable for user %s, dropping broadcast", client.userID)
+		}
+	}
+}
+
+// ChatMembersChanged tells every instance that users were removed from a chat, so their
+// chat room connections are closed wherever they are.
+func (h *Hub) ChatMembersChanged(ctx context.Context, chatID int64, removed ...string) error {
+	payload, err := json.Marshal(membersChange{ChatID: chatID, Removed: removed})
+	if err != nil {
+		return err
+	}
+	return h.broker.Publish(ctx, pubsub.ChatMembersTopic, payload)
+}
+
+// applyMembersChange handles a membersChange published by any instance.
+func (h *Hub) applyMembersChange(payload []byte) {
+	var change membersChange
+	if err := json.Unmarshal(payload, &change); err != nil {
+		log.Printf("error unmarshalling members change: %v", err)
+		return
+	}
+	if len(change.Removed) == 0 {
+		return
+	}
+	select {
+	case h.shardFor(change.ChatID).evictions <- change:
+	case <-h.done:
+	}
+}
+
+// SendToUser publishes an event to all of a user's devices on every instance.
+func (h *Hub) SendToUser(ctx context.Context, userID string, event UserEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return h.broker.Publish(ctx, pubsub.UserTopic(userID), payload)
+}
+
+// SendEvent builds a UserEvent with payload and sends it to the user, logging failures.
+// It is meant for handlers where the event is a side effect of the request.
+func (h *Hub) SendEvent(userID, eventType string, chatID int64, payload interface{}) {
+	event, err := userEvent(eventType, chatID, payload)
+	if err != nil {
+		log.Printf("error marshalling %s event: %v", eventType, err)
+		return
+	}
+	if err := h.broker.Publish(context.Background(), pubsub.UserTopic(userID), event); err != nil {
+		log.Printf("error sending %s event to user %s: %v", eventType, userID, err)
+	}
+}
+
+// SendEventToUsers sends the same event to several users in one broker batch, logging
+// failures, like SendEvent.
+func (h *Hub) SendEventToUsers(userIDs []string, eventType string, chatID int64, payload interface{}) {
+	if len(userIDs) == 0 {
+		return
+	}
+	event, err := userEvent(eventType, chatID, payload)
+	if err != nil {
+		log.Printf("error marshalling %s event: %v", eventType, err)
+		return
+	}
+	events := make([]pubsub.Message, len(userIDs))
+	for i, userID := range userIDs {
+		events[i] = pubsub.Message{Topic: pubsub.UserTopic(userID), Payload: event}
+	}
+	if err := h.broker.PublishBatch(context.Background(), events); err != nil {
+		log.Printf("error sending %s events for chat %d: %v", eventType, chatID, err)
+	}
+}
+
+// Announce publishes an announcement to every /ws/user connection on every instance.
+func (h *Hub) Announce(ctx context.Context, announcement Announcement) error {
+	payload, err := json.Marshal(announcement)
+	if err != nil {
+		return err
+	}
+	event, err := json.Marshal(UserEvent{Type: EventAnnouncement, Payload: payload})
+	if err != nil {
+		return err
+	}
+	return h.broker.Publish(ctx, pubsub.AnnouncementTopic, event)
+}
+
+// notifyParticipants sends a chat_updated event for a saved message to every participant,
+// with that participant's unread count, so their chat lists stay current. Participants
+// without a connection get a push notification instead, unless they muted the chat.
+// It runs on a notifier worker, so the lookups don't hold up persistence.
+func (h *Hub) notifyParticipants(message *models.Message) {
+	members, err := h.store.ChatMemberStates(message.ChatID)
+	if err != nil {
+		log.Printf("error getting participants of chat %d: %v", message.ChatID, err)
+		return
+	}
+	// Large groups and event rooms have many members: publish their events in one batch
+	events := make([]pubsub.Message, 0, len(members))
+	now := time.Now()
+	for _, member := range members {
+		event, err := userEvent(EventChatUpdated, message.ChatID, ChatUpdate{LastMessage: message, UnreadCount: member.UnreadCount})
+		if err != nil {
+			log.Printf("error marshalling %s event: %v", EventChatUpdated, err)
+			return
+		}
+		events = append(events, pubsub.Message{Topic: pubsub.UserTopic(member.UserID), Payload: event})
+
+		if member.UserID == message.SenderID || h.push == nil || h.sessions.online(member.UserID) || member.Settings.Muted(now) {
+			continue
+		}
+		h.push.Message(notify.Notification{
+			UserID: member.UserID,
+			Type:   notify.TypeChatMessage,
+			Title:  "New message",
+			Body:   preview(message.Content),
+			ChatID: message.ChatID,
+		})
+	}
+	if err := h.broker.PublishBatch(context.Background(), events); err != nil {
+		log.Printf("error sending %s events for chat %d: %v", EventChatUpdated, message.ChatID, err)
+	}
+}
+
+// userEvent encodes a UserEvent with payload for publishing.
+func userEvent(eventType string, chatID int64, payload interface{}) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(UserEvent{Type: eventType, ChatID: chatID, Payload: data})
+}
+
+// PushIfOffline sends a push notification right away if the user has no connection on
+// this instance. With several instances a user connected elsewhere may still get the
+// push; the service worker skips it when the app has a focused window.
+func (h *Hub) PushIfOffline(ctx context.Context, n notify.Notification) {
+	if h.push == nil || h.sessions.online(n.UserID) {
+		return
+	}
+	h.push.Send(ctx, n)
+}
+
+// preview shortens message content for a notification body.
+func preview(content string) string {
+	const maxRunes = 100
+	runes := []rune(content)
+	if len(runes) <= maxRunes {
+		return content
+	}
+	return string(runes[:maxRunes]) + "…"
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"meetupr-backend/internal/db"
+	"meetupr-backend/internal/models"
+)
+
+// MessageStore persists chat messages for the Hub.
+type MessageStore interface {
+	// SaveMessage stores a message and returns it as it should be delivered to clients.
+	SaveMessage(m *Message) (*models.Message, error)
+	// ChatMessages returns the history of a chat room, oldest first.
+	ChatMessages(chatID int64) ([]models.Message, error)
+	// ChatMemberStates returns every participant of a chat room with how many messages from
+	// others they have not read and their mute, archive and pin settings, in one query.
+	ChatMemberStates(chatID int64) ([]models.ChatMemberState, error)
+}
+
+// supabaseStore is the MessageStore backed by the Supabase messages table.
+type supabaseStore struct{}
+
+func (supabaseStore) SaveMessage(m *Message) (*models.Message, error) {
+	return saveMessage(m)
+}
+
+func (supabaseStore) ChatMessages(chatID int64) ([]models.Message, error) {
+	return db.GetChatMessages(chatID)
+}
+
+func (supabaseStore) ChatMemberStates(chatID int64) ([]models.ChatMemberState, error) {
+	return db.GetChatMemberStates(chatID)
+}
+
+// MeetRequestStore persists anonymous "want to meet" requests.
+type MeetRequestStore interface {
+	// CreateMeetRequest stores a request and reports whether it completes a mutual match
+	// and whether it was new, not a repeated press.
+	CreateMeetRequest(senderID, recipientID string) (matched, created bool, err error)
+	// GetOrCreateChat returns the chat between two users, creating it if needed.
+	GetOrCreateChat(user1ID, user2ID string) (int64, error)
+}
+
+// supabaseMeetRequestStore is the MeetRequestStore backed by the anon_interest_buttons table.
+type supabaseMeetRequestStore struct{}
+
+func (supabaseMeetRequestStore) CreateMeetRequest(senderID, recipientID string) (bool, bool, error) {
+	return db.CreateMeetRequest(senderID, recipientID)
+}
+
+func (supabaseMeetRequestStore) GetOrCreateChat(user1ID, user2ID string) (int64, error) {
+	chatID, _, err := db.GetOrCreateChat(user1ID, user2ID)
+	return chatID, err
+}
+
+// ProfileStore looks up what profile changes are validated against.
+type ProfileStore interface {
+	// Username returns the user's current username.
+	Username(userID string) (string, error)
+	// IsUsernameTaken reports whether a user other than userID has the username.
+	IsUsernameTaken(username, userID string) (bool, error)
+	// Interests returns the interest master data.
+	Interests() ([]models.Interest, error)
+}
+
+// supabaseProfileStore is the ProfileStore backed by the users and interests tables.
+type supabaseProfileStore struct{}
+
+func (supabaseProfileStore) Username(userID string) (string, error) {
+	_, username, err := db.GetUserContact(userID)
+	return username, err
+}
+
+func (supabaseProfileStore) IsUsernameTaken(username, userID string) (bool, error) {
+	return db.IsUsernameTaken(username, userID)
+}
+
+func (supabaseProfileStore) Interests() ([]models.Interest, error) {
+	return db.GetInterests()
+}
+
+// NotificationStore reads and updates users' notification inboxes.
+type NotificationStore interface {
+	// Notifications returns up to limit of the user's notifications older than beforeID
+	// (0 for the newest), newest first, optionally only unread ones.
+	Notifications(userID string, beforeID int64, limit int, unreadOnly bool) ([]models.Notification, error)
+	// UnreadCount returns the number of unread notifications of the user.
+	UnreadCount(userID string) (int, error)
+	// MarkRead marks one notification as read; false if the user has no such notification.
+	MarkRead(userID string, notificationID int64) (bool, error)
+	// MarkAllRead marks every notification of the user as read.
+	MarkAllRead(userID string) error
+}
+
+// supabaseNotificationStore is the NotificationStore backed by the notifications table.
+type supabaseNotificationStore struct{}
+
+func (supabaseNotificationStore) Notifications(userID string, beforeID int64, limit int, unreadOnly bool) ([]models.Notification, error) {
+	return db.GetNotifications(userID, beforeID, limit, unreadOnly)
+}
+
+func (supabaseNotificationStore) UnreadCount(userID string) (int, error) {
+	return db.GetUnreadNotificationCount(userID)
+}
+
+func (supabaseNotificationStore) MarkRead(userID string, notificationID int64) (bool, error) {
+	return db.MarkNotificationRead(userID, notificationID)
+}
+
+func (supabaseNotificationStore) MarkAllRead(userID string) error {
+	return db.MarkAllNotificationsRead(userID)
+}
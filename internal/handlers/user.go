@@ -1,23 +1,31 @@
 package handlers
 
 import (
+	"fmt"
+	"log"
 	"net/http"
+	"regexp"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/labstack/echo/v4"
 	"meetupr-backend/internal/db"
+	"meetupr-backend/internal/languages"
 	"meetupr-backend/internal/models"
+	"meetupr-backend/internal/search"
 	"strconv"
 )
 
 // RegisterUser godoc
 // @Summary Register a new user
-// @Description Register a new user after Auth0 authentication
+// @Description Register a new user after Auth0 authentication. Username: 2-30 letters, digits, "_", "." or "-".
 // @Tags users
 // @Accept  json
 // @Produce  json
 // @Param   user body models.RegisterUserRequest true "User registration info"
 // @Success 201 {object} models.User
+// @Failure 400 {object} models.ValidationError
 // @Failure 409 {object} echo.HTTPError
 // @Router /api/v1/users/register [post]
 func RegisterUser(c echo.Context) error {
@@ -36,10 +44,18 @@ func RegisterUser(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusUnauthorized, "User email not found in token")
 	}
 
+	username := strings.TrimSpace(req.Username)
+	if message := checkUsername(username); message != "" {
+		return echo.NewHTTPError(http.StatusBadRequest, models.ValidationError{
+			Message: "Invalid user",
+			Errors:  []models.FieldError{{Field: "username", Message: message}},
+		})
+	}
+
 	user := models.User{
 		ID:            userID,
 		Email:         userEmail,
-		Username:      req.Username,
+		Username:      username,
 		IsOICVerified: false,
 		CreatedAt:     time.Now(),
 	}
@@ -59,7 +75,7 @@ func RegisterUser(c echo.Context) error {
 
 // GetMyProfile godoc
 // @Summary Get current user's profile
-// @Description Get the detailed profile of the currently logged-in user
+// @Description Get the detailed profile of the currently logged-in user, with its completeness score (0-100) and the items still missing, and the onboarding checklist: registered, profile_basics (native and learning language set), interests (at least one interest), verified (OIC-verified). Onboarding only moves forward, one step after another.
 // @Tags users
 // @Produce  json
 // @Success 200 {object} models.UserProfileResponse
@@ -78,18 +94,20 @@ func GetMyProfile(c echo.Context) error {
 		}
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get user profile: "+err.Error())
 	}
+	advanceOnboarding(profile)
 
 	return c.JSON(http.StatusOK, profile)
 }
 
 // UpdateMyProfile godoc
 // @Summary Update current user's profile
-// @Description Update the profile of the currently logged-in user
+// @Description Replace the profile of the currently logged-in user. Omitted fields are cleared, except language_skills, which are kept. Interests listed in interest_ids keep their preference level; new ones get 3. Use PATCH to change only some fields. Invalid fields are listed one by one in errors.
 // @Tags users
 // @Accept  json
 // @Produce  json
 // @Param   profile body models.UpdateUserProfileRequest true "User profile update info"
 // @Success 200 {object} models.UserProfileResponse
+// @Failure 400 {object} models.ValidationError
 // @Router /api/v1/users/me [put]
 func UpdateMyProfile(c echo.Context) error {
 	userID, ok := c.Get("user_id").(string)
@@ -101,18 +119,89 @@ func UpdateMyProfile(c echo.Context) error {
 	if err := c.Bind(&req); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
 	}
+	patch := models.PatchUserProfileRequest{
+		Username:          &req.Username,
+		Major:             &req.Major,
+		Gender:            &req.Gender,
+		NativeLanguage:    &req.NativeLanguage,
+		SpokenLanguages:   &req.SpokenLanguages,
+		LearningLanguages: &req.LearningLanguages,
+		Residence:         &req.Residence,
+		Comment:           &req.Comment,
+		AvatarURL:         &req.AvatarURL,
+		InterestIDs:       &req.InterestIDs,
+	}
+	if req.LanguageSkills != nil {
+		patch.LanguageSkills = &req.LanguageSkills
+	}
+	return updateProfile(c, userID, patch)
+}
+
+// PatchMyProfile godoc
+// @Summary Update some fields of current user's profile
+// @Description Change only the fields present in the request; an empty string clears a text field and an empty list clears a list. interests replaces the interests with their preference levels (1-5; omit a level to keep the current one, or 3 for a new interest); interest_ids does the same keeping levels. Username: 2-30 letters, digits, "_", "." or "-", not taken by another user; the current username is always accepted. Comment: up to 500 characters. Languages are ISO 639-1 codes or names. Invalid fields are listed one by one in errors.
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param   profile body models.PatchUserProfileRequest true "Fields to change"
+// @Success 200 {object} models.UserProfileResponse
+// @Failure 400 {object} models.ValidationError
+// @Router /api/v1/users/me [patch]
+func PatchMyProfile(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
+
+	var patch models.PatchUserProfileRequest
+	if err := c.Bind(&patch); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	return updateProfile(c, userID, patch)
+}
+
+// updateProfile validates a profile change and saves it.
+func updateProfile(c echo.Context, userID string, patch models.PatchUserProfileRequest) error {
+	fieldErrors, err := validateProfilePatch(supabaseProfileStore{}, userID, &patch)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to validate profile: "+err.Error())
+	}
+	if len(fieldErrors) > 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, models.ValidationError{Message: "Invalid profile", Errors: fieldErrors})
+	}
 
-	updatedProfile, err := db.UpdateUserProfile(userID, req)
+	updatedProfile, err := db.UpdateUserProfile(userID, patch)
 	if err != nil {
+		// Taken by someone else between the check and the update
+		if strings.Contains(err.Error(), "users_username_key") {
+			return echo.NewHTTPError(http.StatusBadRequest, models.ValidationError{
+				Message: "Invalid profile",
+				Errors:  []models.FieldError{{Field: "username", Message: "is already taken"}},
+			})
+		}
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update user profile: "+err.Error())
 	}
-
+	advanceOnboarding(updatedProfile)
 	return c.JSON(http.StatusOK, updatedProfile)
 }
 
+// advanceOnboarding moves the user's onboarding forward to what their profile now
+// completes, and saves the new state. If saving fails the response still shows it; the
+// next request tries again.
+func advanceOnboarding(profile *models.UserProfileResponse) {
+	state := models.AdvanceOnboarding(profile.Onboarding.State, profile.Completeness)
+	if state == profile.Onboarding.State {
+		return
+	}
+	if err := db.SetOnboardingState(profile.UserID, state); err != nil {
+		log.Printf("error advancing onboarding of user %s: %v", profile.UserID, err)
+	}
+	profile.Onboarding = models.NewOnboarding(state)
+}
+
 // SearchUsers godoc
 // @Summary Search for users
-// @Description Search for other users based on criteria
+// @Description Search for other users based on criteria. Kept for compatibility: it returns every match without paging; use /api/v1/search instead.
 // @Tags users
 // @Produce  json
 // @Param   interest_id query int false "Interest ID"
@@ -121,36 +210,46 @@ func UpdateMyProfile(c echo.Context) error {
 // @Success 200 {array} models.User
 // @Router /api/v1/users [get]
 func SearchUsers(c echo.Context) error {
-	interestIDStr := c.QueryParam("interest_id")
-	learningLanguage := c.QueryParam("learning_language")
-	spokenLanguage := c.QueryParam("spoken_language")
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
 
-	var interestID int
-	if interestIDStr != "" {
-		parsedID, err := strconv.Atoi(interestIDStr)
+	var q search.Query
+	if interestIDStr := c.QueryParam("interest_id"); interestIDStr != "" {
+		interestID, err := strconv.Atoi(interestIDStr)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, "Invalid interest_id")
 		}
-		interestID = parsedID
+		q.InterestIDs = []int{interestID}
+	}
+	if learningLanguage := c.QueryParam("learning_language"); learningLanguage != "" {
+		q.LearningLanguages = []string{learningLanguage}
+	}
+	if spokenLanguage := c.QueryParam("spoken_language"); spokenLanguage != "" {
+		q.SpokenLanguages = []string{spokenLanguage}
 	}
 
-	users, err := db.SearchUsers(interestID, learningLanguage, spokenLanguage)
+	users, err := legacyUserSearch(userID, q)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to search users: "+err.Error())
+		return err
 	}
-
 	return c.JSON(http.StatusOK, users)
 }
 
 // GetUserProfile godoc
 // @Summary Get a user's public profile
-// @Description Get the public profile of a specific user
+// @Description Get the public profile of a specific user. Major, gender, residence, languages and interests are left out when the user doesn't share them with you (see /api/v1/users/me/privacy).
 // @Tags users
 // @Produce  json
 // @Param   userId path string true "User ID"
 // @Success 200 {object} models.User
 // @Router /api/v1/users/{userId} [get]
 func GetUserProfile(c echo.Context) error {
+	viewerID, ok := c.Get("user_id").(string)
+	if !ok || viewerID == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
 	userID := c.Param("userId")
 
 	user, err := db.GetUserProfile(userID)
@@ -162,5 +261,191 @@ func GetUserProfile(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get user profile: "+err.Error())
 	}
 
+	viewer, err := db.GetProfileViewer(viewerID, []string{userID})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get privacy settings: "+err.Error())
+	}
+	viewer.Redact(user)
 	return c.JSON(http.StatusOK, user)
 }
+
+// BlockUser godoc
+// @Summary Block a user
+// @Description Block a user. Blocked users (in either direction) no longer appear in each other's recommendations.
+// @Tags users
+// @Param   userId path string true "User ID"
+// @Success 204 "No Content"
+// @Router /api/v1/users/{userId}/block [post]
+func BlockUser(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
+	blockedID := c.Param("userId")
+	if blockedID == userID {
+		return echo.NewHTTPError(http.StatusBadRequest, "Cannot block yourself")
+	}
+
+	if err := db.BlockUser(userID, blockedID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// UnblockUser godoc
+// @Summary Unblock a user
+// @Description Remove a block on a user
+// @Tags users
+// @Param   userId path string true "User ID"
+// @Success 204 "No Content"
+// @Router /api/v1/users/{userId}/block [delete]
+func UnblockUser(c echo.Context) error {
+	userID, ok := c.Get("user_id").(string)
+	if !ok || userID == "" {
+		return echo.NewHTTPError(http.StatusUnauthorized, "User ID not found in token")
+	}
+
+	if err := db.UnblockUser(userID, c.Param("userId")); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+const (
+	minUsernameRunes = 2
+	maxUsernameRunes = 30
+	maxCommentRunes  = 500
+)
+
+var usernamePattern = regexp.MustCompile(`^[\p{L}\p{N}_.\-]+$`)
+
+// checkUsername returns what's wrong with the format of a new username, or "" if nothing is.
+func checkUsername(username string) string {
+	if n := utf8.RuneCountInString(username); n < minUsernameRunes || n > maxUsernameRunes {
+		return fmt.Sprintf("must be %d to %d characters", minUsernameRunes, maxUsernameRunes)
+	}
+	if !usernamePattern.MatchString(username) {
+		return "may only contain letters, digits, \"_\", \".\" and \"-\""
+	}
+	return ""
+}
+
+// validateProfilePatch checks every field present in a profile change and returns what's
+// wrong with each. Languages are turned into their ISO 639-1 code (names such as "日本語"
+// or "English" are accepted), and interest_ids into interests. A username is only checked
+// when it changes, so users who registered before the format rules can keep theirs. The
+// error is for lookups that failed.
+func validateProfilePatch(store ProfileStore, userID string, p *models.PatchUserProfileRequest) ([]models.FieldError, error) {
+	var errs []models.FieldError
+	fail := func(field, format string, args ...interface{}) {
+		errs = append(errs, models.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if p.Username != nil {
+		username := strings.TrimSpace(*p.Username)
+		p.Username = &username
+		current, err := store.Username(userID)
+		if err != nil {
+			return nil, err
+		}
+		if username != current {
+			if message := checkUsername(username); message != "" {
+				fail("username", "%s", message)
+			} else {
+				taken, err := store.IsUsernameTaken(username, userID)
+				if err != nil {
+					return nil, err
+				}
+				if taken {
+					fail("username", "is already taken")
+				}
+			}
+		}
+	}
+	if p.Comment != nil && utf8.RuneCountInString(*p.Comment) > maxCommentRunes {
+		fail("comment", "must be at most %d characters", maxCommentRunes)
+	}
+
+	if p.NativeLanguage != nil && *p.NativeLanguage != "" {
+		if code, ok := languages.Normalize(*p.NativeLanguage); ok {
+			*p.NativeLanguage = code
+		} else {
+			fail("native_language", "unknown language %q", *p.NativeLanguage)
+		}
+	}
+	for _, list := range []struct {
+		field  string
+		values *[]string
+	}{
+		{"spoken_languages", p.SpokenLanguages},
+		{"learning_languages", p.LearningLanguages},
+	} {
+		if list.values == nil {
+			continue
+		}
+		for i, value := range *list.values {
+			if code, ok := languages.Normalize(value); ok {
+				(*list.values)[i] = code
+			} else {
+				fail(fmt.Sprintf("%s[%d]", list.field, i), "unknown language %q", value)
+			}
+		}
+	}
+	if p.LanguageSkills != nil {
+		seen := make(map[string]bool, len(*p.LanguageSkills))
+		for i, skill := range *p.LanguageSkills {
+			field := fmt.Sprintf("language_skills[%d]", i)
+			code, ok := languages.Normalize(skill.Language)
+			switch {
+			case !ok:
+				fail(field, "unknown language %q", skill.Language)
+			case !models.ValidLevel(skill.Level):
+				fail(field, "invalid level %q for %s (use A1, A2, B1, B2, C1, C2 or native)", skill.Level, code)
+			case seen[code]:
+				fail(field, "%s is listed more than once", code)
+			default:
+				seen[code] = true
+				(*p.LanguageSkills)[i].Language = code
+			}
+		}
+	}
+
+	if p.Interests != nil && p.InterestIDs != nil {
+		fail("interests", "send either interests or interest_ids")
+		return errs, nil
+	}
+	interestsField := "interests"
+	if p.InterestIDs != nil {
+		interestsField = "interest_ids"
+		interests := make([]models.InterestPreference, len(*p.InterestIDs))
+		for i, id := range *p.InterestIDs {
+			interests[i] = models.InterestPreference{ID: id}
+		}
+		p.Interests, p.InterestIDs = &interests, nil
+	}
+	if p.Interests != nil && len(*p.Interests) > 0 {
+		master, err := store.Interests()
+		if err != nil {
+			return nil, err
+		}
+		known := make(map[int]bool, len(master))
+		for _, interest := range master {
+			known[interest.ID] = true
+		}
+		seen := make(map[int]bool, len(*p.Interests))
+		for i, interest := range *p.Interests {
+			field := fmt.Sprintf("%s[%d]", interestsField, i)
+			switch {
+			case !known[interest.ID]:
+				fail(field, "unknown interest %d", interest.ID)
+			case seen[interest.ID]:
+				fail(field, "interest %d is listed more than once", interest.ID)
+			case interest.PreferenceLevel != 0 &&
+				(interest.PreferenceLevel < models.MinPreferenceLevel || interest.PreferenceLevel > models.MaxPreferenceLevel):
+				fail(field, "preference_level must be %d to %d", models.MinPreferenceLevel, models.MaxPreferenceLevel)
+			}
+			seen[interest.ID] = true
+		}
+	}
+	return errs, nil
+}
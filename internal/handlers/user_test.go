@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"meetupr-backend/internal/models"
+)
+
+// fakeProfileStore is a ProfileStore where every user is called "old name" and "taken"
+// belongs to someone else.
+type fakeProfileStore struct{}
+
+func (fakeProfileStore) Username(userID string) (string, error) {
+	return "old name", nil
+}
+
+func (fakeProfileStore) IsUsernameTaken(username, userID string) (bool, error) {
+	return username == "taken", nil
+}
+
+func (fakeProfileStore) Interests() ([]models.Interest, error) {
+	return []models.Interest{{ID: 1, Name: "guitar"}, {ID: 2, Name: "anime"}}, nil
+}
+
+func TestValidateProfilePatch(t *testing.T) {
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		name  string
+		patch models.PatchUserProfileRequest
+		want  []models.FieldError
+	}{
+		{
+			name:  "unchanged username is kept even if it breaks the format rules",
+			patch: models.PatchUserProfileRequest{Username: str(" old name ")},
+		},
+		{
+			name:  "new username must match the format",
+			patch: models.PatchUserProfileRequest{Username: str("new name")},
+			want:  []models.FieldError{{Field: "username", Message: `may only contain letters, digits, "_", "." and "-"`}},
+		},
+		{
+			name:  "new username must be free",
+			patch: models.PatchUserProfileRequest{Username: str("taken")},
+			want:  []models.FieldError{{Field: "username", Message: "is already taken"}},
+		},
+		{
+			name: "interests and interest_ids are exclusive",
+			patch: models.PatchUserProfileRequest{
+				Interests:   &[]models.InterestPreference{{ID: 1}},
+				InterestIDs: &[]int{2},
+			},
+			want: []models.FieldError{{Field: "interests", Message: "send either interests or interest_ids"}},
+		},
+		{
+			name: "preference levels must be in range",
+			patch: models.PatchUserProfileRequest{
+				Interests: &[]models.InterestPreference{{ID: 1, PreferenceLevel: 5}, {ID: 2, PreferenceLevel: 6}},
+			},
+			want: []models.FieldError{{Field: "interests[1]", Message: "preference_level must be 1 to 5"}},
+		},
+		{
+			name: "interests must exist and be listed once",
+			patch: models.PatchUserProfileRequest{
+				InterestIDs: &[]int{1, 3, 1},
+			},
+			want: []models.FieldError{
+				{Field: "interest_ids[1]", Message: "unknown interest 3"},
+				{Field: "interest_ids[2]", Message: "interest 1 is listed more than once"},
+			},
+		},
+		{
+			name: "the same language under two names is a duplicate skill",
+			patch: models.PatchUserProfileRequest{
+				LanguageSkills: &[]models.LanguageSkill{{Language: "ja", Level: "native"}, {Language: "Japanese", Level: "B2"}},
+			},
+			want: []models.FieldError{{Field: "language_skills[1]", Message: "ja is listed more than once"}},
+		},
+		{
+			name: "skill levels must be known",
+			patch: models.PatchUserProfileRequest{
+				LanguageSkills: &[]models.LanguageSkill{{Language: "en", Level: "fluent"}},
+			},
+			want: []models.FieldError{{Field: "language_skills[0]", Message: `invalid level "fluent" for en (use A1, A2, B1, B2, C1, C2 or native)`}},
+		},
+		{
+			name: "unknown languages are reported per entry",
+			patch: models.PatchUserProfileRequest{
+				NativeLanguage:    str("Elvish"),
+				LearningLanguages: &[]string{"English", "Klingon"},
+			},
+			want: []models.FieldError{
+				{Field: "native_language", Message: `unknown language "Elvish"`},
+				{Field: "learning_languages[1]", Message: `unknown language "Klingon"`},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateProfilePatch(fakeProfileStore{}, "me", &tt.patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateProfilePatchNormalizesLanguages(t *testing.T) {
+	patch := models.PatchUserProfileRequest{
+		NativeLanguage:  func(s string) *string { return &s }("日本語"),
+		SpokenLanguages: &[]string{"English", "ko"},
+	}
+	if errs, err := validateProfilePatch(fakeProfileStore{}, "me", &patch); err != nil || errs != nil {
+		t.Fatalf("unexpected errors %v, %v", errs, err)
+	}
+	if *patch.NativeLanguage != "ja" || !reflect.DeepEqual(*patch.SpokenLanguages, []string{"en", "ko"}) {
+		t.Errorf("languages not normalized: %s, %v", *patch.NativeLanguage, *patch.SpokenLanguages)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"meetupr-backend/internal/db"
@@ -16,7 +18,7 @@ const (
 	writeWait      = 10 * time.Second
 	pongWait       = 60 * time.Second
 	pingPeriod     = (pongWait * 9) / 10
-	maxMessageSize = 512
+	maxMessageSize = 2048 // fits a meetup proposal with every candidate time and a note
 )
 
 var upgrader = websocket.Upgrader{
@@ -29,9 +31,30 @@ var upgrader = websocket.Upgrader{
 
 // Message defines the structure for messages sent over WebSocket.
 type Message struct {
-	Content  string `json:"content"`
-	ChatID   int64  `json:"chat_id"`
-	SenderID string `json:"sender_id"`
+	// Frame type: empty for a text message, or one of the meetup frame types
+	Type     string               `json:"type,omitempty"`
+	Content  string               `json:"content"`
+	ChatID   int64                `json:"chat_id"`
+	SenderID string               `json:"sender_id"`
+	Meetup   *models.MeetupAction `json:"meetup,omitempty"`
+
+	// Connection the message came from, told when the message is rejected
+	sender *Client
+}
+
+// clientFrame is a frame a client sends to a chat room.
+type clientFrame struct {
+	Type    string               `json:"type"`
+	Content string               `json:"content"`
+	Meetup  *models.MeetupAction `json:"meetup"`
+}
+
+// ErrorFrame is sent to a client when one of its messages is rejected.
+type ErrorFrame struct {
+	Type         string `json:"type"` // always "error"
+	Code         string `json:"code"`
+	Message      string `json:"message"`
+	RetryAfterMs int64  `json:"retry_after_ms,omitempty"`
 }
 
 // Client is a middleman between the websocket connection and the hub.
@@ -41,11 +64,54 @@ type Client struct {
 	send   chan []byte
 	chatID int64
 	userID string
+
+	// Guards send against writes after the hub has closed it.
+	mu     sync.Mutex
+	closed bool
+	// Close frame written after the queued messages when send is closed (empty = plain close).
+	closeFrame []byte
+}
+
+// isUserChannel reports whether the client is a /ws/user connection rather than a chat room.
+func (c *Client) isUserChannel() bool {
+	return c.chatID == 0
+}
+
+// trySend queues payload without blocking. It reports false if the queue is full or closed.
+func (c *Client) trySend(payload []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	select {
+	case c.send <- payload:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeSend closes the send channel once, which makes writePump close the connection.
+func (c *Client) closeSend() {
+	c.closeSendWith(nil)
+}
+
+// closeSendWith is closeSend with a close frame (see websocket.FormatCloseMessage) that
+// writePump sends once the already queued messages are flushed.
+func (c *Client) closeSendWith(closeFrame []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		c.closeFrame = closeFrame
+		close(c.send)
+	}
 }
 
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		c.hub.shardFor(c.chatID).leave(c)
 		c.conn.Close()
 	}()
 	c.conn.SetReadLimit(maxMessageSize)
@@ -62,28 +128,74 @@ func (c *Client) readPump() {
 			break
 		}
 
+		// The user channel is server-to-client only
+		if c.isUserChannel() {
+			continue
+		}
+
 		// Unmarshal the raw message to extract content
-		var msgData map[string]string
-		if err := json.Unmarshal(rawMessage, &msgData); err != nil {
+		var frame clientFrame
+		if err := json.Unmarshal(rawMessage, &frame); err != nil {
 			log.Printf("error unmarshalling raw message: %v", err)
 			continue
 		}
+		if frame.Type == models.MessageTypeText {
+			frame.Type = ""
+		}
+		if frame.Type != "" && !isMeetupFrame(frame.Type) {
+			c.sendError("unknown_type", "Unknown message type: "+frame.Type, 0)
+			continue
+		}
+
+		// Per-user throttle (shared across all of the user's connections)
+		if res := c.hub.messageLimiter.Allow(c.userID); !res.Allowed {
+			log.Printf("readPump: throttled message from user %s in chat %d", c.userID, c.chatID)
+			c.sendError("rate_limited", "Too many messages, slow down", res.RetryAfter)
+			continue
+		}
 
 		// Create a message struct and populate it
-		msg := Message{
-			Content:  msgData["content"],
+		msg := &Message{
+			Type:     frame.Type,
+			Content:  frame.Content,
 			ChatID:   c.chatID,
 			SenderID: c.userID,
+			Meetup:   frame.Meetup,
+			sender:   c,
+		}
+		if isMeetupFrame(msg.Type) {
+			if err := checkMeetupFrame(msg, time.Now()); err != nil {
+				c.sendError("invalid_meetup", err.Error(), 0)
+				continue
+			}
 		}
 
-		// Marshal the struct to JSON to be sent to the hub
-		jsonMessage, err := json.Marshal(msg)
-		if err != nil {
-			log.Printf("error marshalling message: %v", err)
-			continue
+		// Hand the message to the persistence workers; a full queue only backs up this client
+		switch err := c.hub.submit(msg); err {
+		case nil:
+		case errHubDraining:
+			c.sendError("server_restarting", "Server is restarting, message was not sent", reconnectDelay)
+		default:
+			log.Printf("readPump: persistence queue full, rejecting message from user %s in chat %d", c.userID, c.chatID)
+			c.sendError("server_busy", "Server is busy, please retry", time.Second)
 		}
+	}
+}
 
-		c.hub.broadcast <- jsonMessage
+// sendError queues an ErrorFrame for the client without blocking.
+func (c *Client) sendError(code, message string, retryAfter time.Duration) {
+	frame, err := json.Marshal(ErrorFrame{
+		Type:         "error",
+		Code:         code,
+		Message:      message,
+		RetryAfterMs: retryAfter.Milliseconds(),
+	})
+	if err != nil {
+		log.Printf("error marshalling error frame: %v", err)
+		return
+	}
+	if !c.trySend(frame) {
+		log.Printf("sendError: send channel unavailable for user %s, dropping error frame", c.userID)
 	}
 }
 
@@ -92,6 +204,8 @@ func (c *Client) writePump() {
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
+		c.hub.sessions.remove(c)
+		c.hub.connections.Done()
 		log.Printf("writePump: connection closed for chat %d, user %s", c.chatID, c.userID)
 	}()
 
@@ -102,7 +216,13 @@ func (c *Client) writePump() {
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
 				log.Printf("writePump: send channel closed for chat %d, user %s", c.chatID, c.userID)
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				c.mu.Lock()
+				closeFrame := c.closeFrame
+				c.mu.Unlock()
+				if closeFrame == nil {
+					closeFrame = []byte{}
+				}
+				c.conn.WriteMessage(websocket.CloseMessage, closeFrame)
 				return
 			}
 
@@ -130,112 +250,18 @@ func (c *Client) writePump() {
 	}
 }
 
-// Hub maintains the set of active clients and broadcasts messages to the clients.
-type Hub struct {
-	clients    map[*Client]bool
-	broadcast  chan []byte
-	register   chan *Client
-	unregister chan *Client
-	// Maps chatID to a set of clients in that room.
-	rooms map[int64]map[*Client]bool
-}
-
-func NewHub() *Hub {
-	return &Hub{
-		broadcast:  make(chan []byte),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		clients:    make(map[*Client]bool),
-		rooms:      make(map[int64]map[*Client]bool),
-	}
-}
-
-func (h *Hub) Run() {
-	for {
-		select {
-		case client := <-h.register:
-			h.clients[client] = true
-			if h.rooms[client.chatID] == nil {
-				h.rooms[client.chatID] = make(map[*Client]bool)
-			}
-			h.rooms[client.chatID][client] = true
-		case client := <-h.unregister:
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-				if roomClients := h.rooms[client.chatID]; roomClients != nil {
-					delete(roomClients, client)
-					if len(roomClients) == 0 {
-						delete(h.rooms, client.chatID)
-					}
-				}
-			}
-		case jsonMessage := <-h.broadcast:
-			var msg Message
-			if err := json.Unmarshal(jsonMessage, &msg); err != nil {
-				log.Printf("error unmarshalling broadcast message: %v", err)
-				continue
-			}
-
-			// Save message to the database
-			if err := saveMessage(&msg); err != nil {
-				log.Printf("error saving message to db: %v", err)
-				continue
-			}
-			log.Printf("Message saved to DB: chat_id=%d, sender_id=%s, content=%s", msg.ChatID, msg.SenderID, msg.Content)
-
-			// Convert handlers.Message to models.Message format for frontend
-			fullMsg := models.Message{
-				ChatID:      msg.ChatID,
-				SenderID:    msg.SenderID,
-				Content:     msg.Content,
-				MessageType: "text",
-				SentAt:      time.Now(),
-			}
-			messageToBroadcast, err := json.Marshal(fullMsg)
-			if err != nil {
-				log.Printf("error marshalling message: %v", err)
-				continue
-			}
-
-			if roomClients, ok := h.rooms[msg.ChatID]; ok {
-				log.Printf("Broadcasting message to %d client(s) in chat %d", len(roomClients), msg.ChatID)
-				for client := range roomClients {
-					select {
-					case client.send <- messageToBroadcast:
-						log.Printf("Message sent to client: chat_id=%d, user_id=%s", client.chatID, client.userID)
-					default:
-						log.Printf("Client send channel full, removing client: user_id=%s", client.userID)
-						close(client.send)
-						delete(h.clients, client)
-						delete(roomClients, client)
-					}
-				}
-			} else {
-				log.Printf("No clients found in chat room %d", msg.ChatID)
-			}
-		}
-	}
-}
-
 // WsHandler handles websocket requests from the peer.
 func WsHandler(hub *Hub, w http.ResponseWriter, r *http.Request, chatID int64, userID string) {
 	log.Printf("WsHandler: WebSocket connection attempt for chat %d, user %s", chatID, userID)
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Printf("WsHandler: failed to upgrade connection: %v", err)
-		return
-	}
-	log.Printf("WsHandler: WebSocket connection established for chat %d, user %s", chatID, userID)
-
 	client := &Client{
 		hub:    hub,
-		conn:   conn,
 		send:   make(chan []byte, 256),
 		chatID: chatID,
 		userID: userID,
 	}
-	client.hub.register <- client
+	if !connect(hub, w, r, client) {
+		return
+	}
 	log.Printf("WsHandler: client registered for chat %d", chatID)
 
 	// Load and send message history
@@ -245,23 +271,110 @@ func WsHandler(hub *Hub, w http.ResponseWriter, r *http.Request, chatID int64, u
 	go client.readPump()
 }
 
-func saveMessage(m *Message) error {
+// UserWsHandler handles the per-user event socket (/ws/user), which streams UserEvents
+// such as chat list updates, matches and announcements to one of the user's devices.
+func UserWsHandler(hub *Hub, w http.ResponseWriter, r *http.Request, userID string) {
+	log.Printf("UserWsHandler: WebSocket connection attempt for user %s", userID)
+	client := &Client{
+		hub:    hub,
+		send:   make(chan []byte, 256),
+		userID: userID,
+	}
+	if !connect(hub, w, r, client) {
+		return
+	}
+	log.Printf("UserWsHandler: client registered for user %s", userID)
+
+	go client.writePump()
+	go client.readPump()
+}
+
+// connect upgrades the request and registers client with the hub. On failure it has
+// already written the response and returns false.
+func connect(hub *Hub, w http.ResponseWriter, r *http.Request, client *Client) bool {
+	if !hub.Accepting() {
+		w.Header().Set("Retry-After", strconv.Itoa(int(reconnectDelay.Seconds())))
+		http.Error(w, "Server is restarting", http.StatusServiceUnavailable)
+		return false
+	}
+
+	// Reserve a connection slot for the user before upgrading
+	if !hub.sessions.add(client) {
+		log.Printf("connect: user %s reached the connection limit", client.userID)
+		http.Error(w, "Too many connections for this user", http.StatusTooManyRequests)
+		return false
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("connect: failed to upgrade connection: %v", err)
+		hub.sessions.remove(client)
+		return false
+	}
+	log.Printf("connect: WebSocket connection established for chat %d, user %s", client.chatID, client.userID)
+	client.conn = conn
+
+	hub.connections.Add(1)
+	if !hub.shardFor(client.chatID).join(client) {
+		// The hub started shutting down while we were upgrading
+		hub.sessions.remove(client)
+		hub.connections.Done()
+		conn.WriteMessage(websocket.CloseMessage, restartCloseFrame())
+		conn.Close()
+		return false
+	}
+	return true
+}
+
+func saveMessage(m *Message) (*models.Message, error) {
+	if isMeetupFrame(m.Type) {
+		return saveMeetupMessage(m)
+	}
+	return insertMessage(m.ChatID, m.SenderID, m.Content, models.MessageTypeText, nil)
+}
+
+// insertMessage stores a chat message, with the meetup proposal it announces if any.
+func insertMessage(chatID int64, senderID, content, messageType string, meetupID *int64) (*models.Message, error) {
 	// Supabase API経由でメッセージを挿入
 	messageData := map[string]interface{}{
-		"chat_id":      m.ChatID,
-		"sender_id":    m.SenderID,
-		"content":      m.Content,
-		"message_type": "text", // Assuming message_type is always "text" for now
+		"chat_id":      chatID,
+		"sender_id":    senderID,
+		"content":      content,
+		"message_type": messageType,
+	}
+	if meetupID != nil {
+		messageData["meetup_id"] = *meetupID
 	}
 
 	var results []map[string]interface{}
-	err := db.Supabase.DB.From("messages").Insert(messageData).Execute(&results)
-	return err
+	if err := db.Supabase.DB.From("messages").Insert(messageData).Execute(&results); err != nil {
+		return nil, err
+	}
+
+	saved := &models.Message{
+		ChatID:      chatID,
+		SenderID:    senderID,
+		Content:     content,
+		MessageType: messageType,
+		SentAt:      time.Now(),
+		MeetupID:    meetupID,
+	}
+	// The insert returns the stored row; use its ID and timestamp when available
+	if len(results) > 0 {
+		if idFloat, ok := results[0]["id"].(float64); ok {
+			saved.ID = int64(idFloat)
+		}
+		if sentAtStr, ok := results[0]["sent_at"].(string); ok {
+			if parsedTime, err := time.Parse(time.RFC3339, sentAtStr); err == nil {
+				saved.SentAt = parsedTime
+			}
+		}
+	}
+	return saved, nil
 }
 
 func loadMessageHistory(c *Client) {
-	// Use db.GetChatMessages to get message history
-	messages, err := db.GetChatMessages(c.chatID)
+	messages, err := c.hub.store.ChatMessages(c.chatID)
 	if err != nil {
 		log.Printf("error loading message history from Supabase: %v", err)
 		return
@@ -283,14 +396,10 @@ func loadMessageHistory(c *Client) {
 			log.Printf("loadMessageHistory: error marshalling history message: %v", err)
 			continue
 		}
-		select {
-		case c.send <- jsonMessage:
+		if c.trySend(jsonMessage) {
 			sentCount++
 			log.Printf("loadMessageHistory: Sent history message %d/%d: id=%d, content=%s", sentCount, len(messages), dbMsg.ID, dbMsg.Content)
-		case <-time.After(5 * time.Second):
-			log.Printf("loadMessageHistory: timeout sending message %d, client send channel may be blocked", dbMsg.ID)
-			break
-		default:
+		} else {
 			log.Printf("loadMessageHistory: client send channel full, skipping history message %d", dbMsg.ID)
 		}
 	}
@@ -0,0 +1,122 @@
+// Package languages is the master list of languages users can put on their profile,
+// identified by ISO 639-1 codes.
+package languages
+
+import (
+	"sort"
+	"strings"
+)
+
+// Language is one entry of the master list.
+type Language struct {
+	Code       string `json:"code"`
+	NameEn     string `json:"name_en"`
+	NameJa     string `json:"name_ja"`
+	NativeName string `json:"native_name"`
+}
+
+// Name returns the language's name in locale ("ja" or anything else for English).
+func (l Language) Name(locale string) string {
+	if locale == "ja" {
+		return l.NameJa
+	}
+	return l.NameEn
+}
+
+var all = []Language{
+	{"ar", "Arabic", "アラビア語", "العربية"},
+	{"bn", "Bengali", "ベンガル語", "বাংলা"},
+	{"de", "German", "ドイツ語", "Deutsch"},
+	{"en", "English", "英語", "English"},
+	{"es", "Spanish", "スペイン語", "Español"},
+	{"fa", "Persian", "ペルシア語", "فارسی"},
+	{"fi", "Finnish", "フィンランド語", "Suomi"},
+	{"fr", "French", "フランス語", "Français"},
+	{"hi", "Hindi", "ヒンディー語", "हिन्दी"},
+	{"id", "Indonesian", "インドネシア語", "Bahasa Indonesia"},
+	{"it", "Italian", "イタリア語", "Italiano"},
+	{"ja", "Japanese", "日本語", "日本語"},
+	{"km", "Khmer", "クメール語", "ខ្មែរ"},
+	{"ko", "Korean", "韓国語", "한국어"},
+	{"mn", "Mongolian", "モンゴル語", "Монгол"},
+	{"ms", "Malay", "マレー語", "Bahasa Melayu"},
+	{"my", "Burmese", "ミャンマー語", "မြန်မာဘာသာ"},
+	{"ne", "Nepali", "ネパール語", "नेपाली"},
+	{"nl", "Dutch", "オランダ語", "Nederlands"},
+	{"pl", "Polish", "ポーランド語", "Polski"},
+	{"pt", "Portuguese", "ポルトガル語", "Português"},
+	{"ru", "Russian", "ロシア語", "Русский"},
+	{"si", "Sinhala", "シンハラ語", "සිංහල"},
+	{"sv", "Swedish", "スウェーデン語", "Svenska"},
+	{"th", "Thai", "タイ語", "ไทย"},
+	{"tl", "Tagalog", "タガログ語", "Tagalog"},
+	{"tr", "Turkish", "トルコ語", "Türkçe"},
+	{"uk", "Ukrainian", "ウクライナ語", "Українська"},
+	{"ur", "Urdu", "ウルドゥー語", "اردو"},
+	{"uz", "Uzbek", "ウズベク語", "Oʻzbek"},
+	{"vi", "Vietnamese", "ベトナム語", "Tiếng Việt"},
+	{"zh", "Chinese", "中国語", "中文"},
+}
+
+// Other names found in free-text profile data, mapped to their codes.
+var aliases = map[string]string{
+	"mandarin":        "zh",
+	"cantonese":       "zh",
+	"普通話":             "zh",
+	"普通话":             "zh",
+	"汉语":              "zh",
+	"filipino":        "tl",
+	"フィリピン語":          "tl",
+	"farsi":           "fa",
+	"ビルマ語":            "my",
+	"myanmar":         "my",
+	"bahasa":          "id",
+	"nihongo":         "ja",
+	"にほんご":            "ja",
+	"korean language": "ko",
+	"한국말":             "ko",
+}
+
+var byKey = func() map[string]string {
+	m := make(map[string]string, len(all)*4+len(aliases))
+	for _, l := range all {
+		for _, key := range []string{l.Code, l.NameEn, l.NameJa, l.NativeName} {
+			m[strings.ToLower(key)] = l.Code
+		}
+	}
+	for alias, code := range aliases {
+		m[alias] = code
+	}
+	return m
+}()
+
+// All returns the master list sorted by code.
+func All() []Language {
+	list := make([]Language, len(all))
+	copy(list, all)
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+	return list
+}
+
+// Lookup returns the language with an ISO 639-1 code.
+func Lookup(code string) (Language, bool) {
+	for _, l := range all {
+		if l.Code == code {
+			return l, true
+		}
+	}
+	return Language{}, false
+}
+
+// Valid reports whether code is a language in the master list.
+func Valid(code string) bool {
+	_, ok := Lookup(code)
+	return ok
+}
+
+// Normalize maps a code or a language name in English, Japanese or the language itself
+// (as older profiles stored them) to its ISO 639-1 code. Matching ignores case.
+func Normalize(value string) (string, bool) {
+	code, ok := byKey[strings.ToLower(strings.TrimSpace(value))]
+	return code, ok
+}
@@ -0,0 +1,25 @@
+package languages
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	for input, want := range map[string]string{
+		"ja":        "ja",
+		"EN":        "en",
+		"英語":        "en",
+		" Korean ":  "ko",
+		"한국어":       "ko",
+		"Mandarin":  "zh",
+		"Français":  "fr",
+		"português": "pt",
+	} {
+		if got, ok := Normalize(input); !ok || got != want {
+			t.Errorf("Normalize(%q) = %q, %v; want %q", input, got, ok, want)
+		}
+	}
+	for _, input := range []string{"Unknown", "", "klingon"} {
+		if code, ok := Normalize(input); ok {
+			t.Errorf("Normalize(%q) = %q, want no match", input, code)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package mail
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+)
+
+// SMTPMailer sends messages through an SMTP server with PLAIN auth.
+type SMTPMailer struct {
+	// host:port of the server
+	Addr     string
+	Username string
+	Password string
+}
+
+// Send delivers m via SMTP. The context is not used by net/smtp.
+func (s SMTPMailer) Send(ctx context.Context, m Message) error {
+	data, err := m.Bytes()
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	return smtp.SendMail(s.Addr, auth, m.From, []string{m.To}, data)
+}
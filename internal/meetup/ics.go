@@ -0,0 +1,112 @@
+package meetup
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// CalendarEvent is a meetup as an iCalendar event.
+type CalendarEvent struct {
+	// UID identifies the event across downloads, so calendars update instead of duplicating it
+	UID         string
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Location    string
+	Description string
+	URL         string
+	// When the file was created
+	Stamp time.Time
+	// Fire an alarm this long before Start; no alarm when 0
+	Alarm time.Duration
+}
+
+const icsTime = "20060102T150405Z"
+
+// ICS renders the event as an RFC 5545 calendar with a single VEVENT.
+func ICS(e CalendarEvent) []byte {
+	var b bytes.Buffer
+	line := func(name, value string) {
+		writeFolded(&b, name+":"+value)
+	}
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//Meetupr//Meetups//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	line("BEGIN", "VEVENT")
+	line("UID", escapeText(e.UID))
+	line("DTSTAMP", e.Stamp.UTC().Format(icsTime))
+	line("DTSTART", e.Start.UTC().Format(icsTime))
+	line("DTEND", e.End.UTC().Format(icsTime))
+	line("SUMMARY", escapeText(e.Summary))
+	if e.Location != "" {
+		line("LOCATION", escapeText(e.Location))
+	}
+	if e.Description != "" {
+		line("DESCRIPTION", escapeText(e.Description))
+	}
+	if e.URL != "" {
+		line("URL", e.URL)
+	}
+	line("STATUS", "CONFIRMED")
+	if e.Alarm > 0 {
+		line("BEGIN", "VALARM")
+		line("ACTION", "DISPLAY")
+		line("DESCRIPTION", escapeText(e.Summary))
+		line("TRIGGER", "-"+icsDuration(e.Alarm))
+		line("END", "VALARM")
+	}
+	line("END", "VEVENT")
+	line("END", "VCALENDAR")
+	return b.Bytes()
+}
+
+// icsDuration formats d, to the minute, as an RFC 5545 dur-value such as PT1H30M.
+func icsDuration(d time.Duration) string {
+	minutes := int(d / time.Minute)
+	if minutes == 0 {
+		return "PT0M"
+	}
+	if minutes%(24*60) == 0 {
+		return "P" + strconv.Itoa(minutes/(24*60)) + "D"
+	}
+	out := "PT"
+	if h := minutes / 60; h > 0 {
+		out += strconv.Itoa(h) + "H"
+	}
+	if m := minutes % 60; m > 0 {
+		out += strconv.Itoa(m) + "M"
+	}
+	return out
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// escapeText escapes a TEXT property value.
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+// writeFolded writes a content line, folding it after 75 octets without splitting a
+// UTF-8 sequence, and ends it with CRLF.
+func writeFolded(b *bytes.Buffer, s string) {
+	const limit = 75
+	width := limit
+	for len(s) > width {
+		cut := width
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		// The leading space counts towards the next line
+		width = limit - 1
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,130 @@
+package meetup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"meetupr-backend/internal/models"
+)
+
+// Reminder is a notice sent a fixed time before a meetup starts.
+type Reminder struct {
+	Name   string
+	Before time.Duration
+}
+
+// Reminders are sent to both participants of an accepted meetup, shortest lead first.
+var Reminders = []Reminder{
+	{Name: "hour", Before: time.Hour},
+	{Name: "day", Before: 24 * time.Hour},
+}
+
+// Store provides the accepted meetups to remind participants of.
+type Store interface {
+	// UpcomingMeetups returns the accepted meetups starting between from and to, with their location.
+	UpcomingMeetups(from, to time.Time) ([]models.MeetupProposal, error)
+	// MarkReminded records reminders as sent for a meetup.
+	MarkReminded(meetupID int64, names []string) error
+}
+
+// NotifyFunc reminds one participant of a meetup.
+type NotifyFunc func(ctx context.Context, userID string, meetup models.MeetupProposal, reminder Reminder) error
+
+// Job sends meetup reminders.
+type Job struct {
+	store  Store
+	notify NotifyFunc
+	now    func() time.Time
+}
+
+// NewJob creates a meetup reminder Job.
+func NewJob(store Store, notify NotifyFunc) *Job {
+	return &Job{store: store, notify: notify, now: time.Now}
+}
+
+// Start runs the job every interval until ctx is done.
+func (j *Job) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := j.Run(ctx); err != nil {
+			log.Printf("meetup: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run sends the reminders that are due once.
+func (j *Job) Run(ctx context.Context) error {
+	now := j.now()
+	longest := Reminders[len(Reminders)-1].Before
+	meetups, err := j.store.UpcomingMeetups(now, now.Add(longest))
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	sent := 0
+	for _, m := range meetups {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if m.AcceptedSlot == nil {
+			continue
+		}
+		r, covered, ok := dueReminder(m, now)
+		if !ok {
+			continue
+		}
+		// Mark first so a failing push isn't retried every run
+		if err := j.store.MarkReminded(m.ID, covered); err != nil {
+			errs = append(errs, fmt.Errorf("meetup %d: %w", m.ID, err))
+			continue
+		}
+		for _, userID := range []string{m.ProposerID, m.RecipientID} {
+			if err := j.notify(ctx, userID, m, r); err != nil {
+				errs = append(errs, fmt.Errorf("meetup %d: %w", m.ID, err))
+			}
+		}
+		sent++
+	}
+	if sent > 0 {
+		log.Printf("meetup: sent %d reminder(s)", sent)
+	}
+	return errors.Join(errs...)
+}
+
+// dueReminder returns the reminder to send for m at now, and the names of the reminders
+// it covers: when several are due at once, e.g. for a meetup accepted 30 minutes before it
+// starts, only the one with the shortest lead is sent and the longer ones are skipped.
+func dueReminder(m models.MeetupProposal, now time.Time) (Reminder, []string, bool) {
+	until := m.AcceptedSlot.Start.Sub(now)
+	if until <= 0 {
+		return Reminder{}, nil, false
+	}
+	sent := make(map[string]bool, len(m.RemindersSent))
+	for _, name := range m.RemindersSent {
+		sent[name] = true
+	}
+	for i, r := range Reminders {
+		if until > r.Before {
+			continue
+		}
+		if sent[r.Name] {
+			return Reminder{}, nil, false
+		}
+		var covered []string
+		for _, longer := range Reminders[i:] {
+			covered = append(covered, longer.Name)
+		}
+		return r, covered, true
+	}
+	return Reminder{}, nil, false
+}
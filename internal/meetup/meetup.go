@@ -0,0 +1,61 @@
+// Package meetup validates meetup proposals, exports accepted meetups as iCalendar
+// files and reminds participants of upcoming meetups.
+package meetup
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"meetupr-backend/internal/models"
+)
+
+const (
+	// MaxCandidates is how many times a proposal may offer.
+	MaxCandidates = 5
+	// MaxDuration is the longest a meetup may last.
+	MaxDuration = 8 * time.Hour
+	// MaxLead is how far ahead a meetup may be proposed.
+	MaxLead = 90 * 24 * time.Hour
+	// MaxNoteLength is the longest note, in characters.
+	MaxNoteLength = 200
+)
+
+// ValidateSlots checks the candidate times of a proposal made at now.
+func ValidateSlots(slots []models.MeetupSlot, now time.Time) error {
+	if len(slots) == 0 {
+		return errors.New("at least one candidate time is required")
+	}
+	if len(slots) > MaxCandidates {
+		return fmt.Errorf("at most %d candidate times are allowed", MaxCandidates)
+	}
+	for i, s := range slots {
+		switch {
+		case s.Start.IsZero() || s.End.IsZero():
+			return fmt.Errorf("candidate %d needs a start and an end", i)
+		case !s.Start.After(now):
+			return fmt.Errorf("candidate %d is in the past", i)
+		case !s.End.After(s.Start):
+			return fmt.Errorf("candidate %d ends before it starts", i)
+		case s.End.Sub(s.Start) > MaxDuration:
+			return fmt.Errorf("candidate %d is longer than %s", i, MaxDuration)
+		case s.Start.Sub(now) > MaxLead:
+			return fmt.Errorf("candidate %d is more than %d days ahead", i, int(MaxLead.Hours()/24))
+		}
+		for _, prev := range slots[:i] {
+			if prev.Start.Equal(s.Start) && prev.End.Equal(s.End) {
+				return fmt.Errorf("candidate %d is listed twice", i)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateNote checks the note of a proposal or a decline.
+func ValidateNote(note string) error {
+	if utf8.RuneCountInString(note) > MaxNoteLength {
+		return fmt.Errorf("note must be at most %d characters", MaxNoteLength)
+	}
+	return nil
+}
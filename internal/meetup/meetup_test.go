@@ -0,0 +1,159 @@
+package meetup
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"meetupr-backend/internal/models"
+)
+
+func TestValidateSlots(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	slot := func(startIn, length time.Duration) models.MeetupSlot {
+		return models.MeetupSlot{Start: now.Add(startIn), End: now.Add(startIn + length)}
+	}
+	tests := []struct {
+		name  string
+		slots []models.MeetupSlot
+		ok    bool
+	}{
+		{"valid", []models.MeetupSlot{slot(time.Hour, time.Hour), slot(25*time.Hour, 30*time.Minute)}, true},
+		{"none", nil, false},
+		{"too many", []models.MeetupSlot{slot(1*time.Hour, time.Hour), slot(2*time.Hour, time.Hour), slot(3*time.Hour, time.Hour), slot(4*time.Hour, time.Hour), slot(5*time.Hour, time.Hour), slot(6*time.Hour, time.Hour)}, false},
+		{"past", []models.MeetupSlot{slot(-time.Hour, 2*time.Hour)}, false},
+		{"ends before start", []models.MeetupSlot{slot(time.Hour, -time.Minute)}, false},
+		{"too long", []models.MeetupSlot{slot(time.Hour, 9*time.Hour)}, false},
+		{"too far ahead", []models.MeetupSlot{slot(91*24*time.Hour, time.Hour)}, false},
+		{"duplicate", []models.MeetupSlot{slot(time.Hour, time.Hour), slot(time.Hour, time.Hour)}, false},
+	}
+	for _, tt := range tests {
+		if err := ValidateSlots(tt.slots, now); (err == nil) != tt.ok {
+			t.Errorf("%s: ValidateSlots() error = %v, want ok=%v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestICS(t *testing.T) {
+	start := time.Date(2026, 10, 20, 18, 30, 0, 0, time.FixedZone("JST", 9*60*60))
+	ics := string(ICS(CalendarEvent{
+		UID:         "meetup-7@meetupr",
+		Start:       start,
+		End:         start.Add(90 * time.Minute),
+		Summary:     "Meetup with yuki",
+		Location:    "Library, 2F; lounge",
+		Description: "Bring the notes\n" + strings.Repeat("日本語", 20),
+		Stamp:       time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC),
+		Alarm:       time.Hour,
+	}))
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"UID:meetup-7@meetupr\r\n",
+		"DTSTART:20261020T093000Z\r\n",
+		"DTEND:20261020T110000Z\r\n",
+		`LOCATION:Library\, 2F\; lounge` + "\r\n",
+		"TRIGGER:-PT1H\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("calendar is missing %q:\n%s", want, ics)
+		}
+	}
+	if !strings.Contains(ics, `DESCRIPTION:Bring the notes\n`) {
+		t.Errorf("newline in description not escaped:\n%s", ics)
+	}
+
+	// Lines are folded after 75 octets without splitting a character
+	unfolded := strings.ReplaceAll(ics, "\r\n ", "")
+	if !strings.Contains(unfolded, strings.Repeat("日本語", 20)) {
+		t.Errorf("folding changed the description:\n%s", ics)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line longer than 75 octets: %q", line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("line splits a character: %q", line)
+		}
+	}
+}
+
+type fakeStore struct {
+	meetups  []models.MeetupProposal
+	reminded map[int64][]string
+}
+
+func (s *fakeStore) UpcomingMeetups(from, to time.Time) ([]models.MeetupProposal, error) {
+	var upcoming []models.MeetupProposal
+	for _, m := range s.meetups {
+		if !m.AcceptedSlot.Start.Before(from) && m.AcceptedSlot.Start.Before(to) {
+			m.RemindersSent = s.reminded[m.ID]
+			upcoming = append(upcoming, m)
+		}
+	}
+	return upcoming, nil
+}
+
+func (s *fakeStore) MarkReminded(id int64, names []string) error {
+	s.reminded[id] = append(s.reminded[id], names...)
+	return nil
+}
+
+func TestJobSendsEachReminderOnce(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	accepted := func(id int64, startIn time.Duration) models.MeetupProposal {
+		start := now.Add(startIn)
+		return models.MeetupProposal{
+			ID: id, ProposerID: "a", RecipientID: "b", Status: models.MeetupAccepted,
+			AcceptedSlot: &models.MeetupSlot{Start: start, End: start.Add(time.Hour)},
+		}
+	}
+	store := &fakeStore{
+		meetups: []models.MeetupProposal{
+			accepted(1, 20*time.Hour),
+			// Accepted shortly before it starts: only the hour reminder goes out
+			accepted(2, 30*time.Minute),
+			accepted(3, 3*24*time.Hour),
+		},
+		reminded: map[int64][]string{},
+	}
+	sent := map[int64][]string{}
+	job := NewJob(store, func(ctx context.Context, userID string, m models.MeetupProposal, r Reminder) error {
+		sent[m.ID] = append(sent[m.ID], userID+":"+r.Name)
+		return nil
+	})
+	job.now = func() time.Time { return now }
+
+	if err := job.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(sent[1], ","); got != "a:day,b:day" {
+		t.Errorf("meetup 1 reminders = %s, want a:day,b:day", got)
+	}
+	if got := strings.Join(sent[2], ","); got != "a:hour,b:hour" {
+		t.Errorf("meetup 2 reminders = %s, want a:hour,b:hour", got)
+	}
+	if len(sent[3]) != 0 {
+		t.Errorf("meetup 3 reminded too early: %v", sent[3])
+	}
+
+	// Nothing new is due on the next run
+	if err := job.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent[1]) != 2 || len(sent[2]) != 2 {
+		t.Errorf("reminders repeated: %v", sent)
+	}
+
+	// An hour before meetup 1 its second reminder goes out
+	job.now = func() time.Time { return now.Add(19*time.Hour + 30*time.Minute) }
+	if err := job.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(sent[1], ","); got != "a:day,b:day,a:hour,b:hour" {
+		t.Errorf("meetup 1 reminders = %s", got)
+	}
+}
@@ -0,0 +1,19 @@
+package meetup
+
+import (
+	"time"
+
+	"meetupr-backend/internal/db"
+	"meetupr-backend/internal/models"
+)
+
+// SupabaseStore is the Store backed by the Supabase tables.
+type SupabaseStore struct{}
+
+func (SupabaseStore) UpcomingMeetups(from, to time.Time) ([]models.MeetupProposal, error) {
+	return db.GetUpcomingMeetups(from, to)
+}
+
+func (SupabaseStore) MarkReminded(meetupID int64, names []string) error {
+	return db.AddMeetupReminders(meetupID, names)
+}
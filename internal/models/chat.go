@@ -2,16 +2,87 @@ package models
 
 import "time"
 
-// Chat represents a chat room between two users
+// Chat kinds
+const (
+	// A one-to-one chat between User1ID and User2ID
+	ChatDirect = "direct"
+	// A study group or other room of several users, started by a user
+	ChatGroup = "group"
+	// The room of an event with chat_link_enabled, open to everyone
+	ChatEvent = "event"
+)
+
+// Roles of a chat member
+const (
+	// Can invite and remove members
+	ChatRoleOwner  = "owner"
+	ChatRoleMember = "member"
+)
+
+// Chat represents a chat room: a direct chat between two users, or a group or event room
 type Chat struct {
-	ID               int64     `json:"id"`
-	User1ID          string    `json:"user1_id"`
-	User2ID          string    `json:"user2_id"`
+	ID   int64  `json:"id"`
+	Kind string `json:"kind"`
+	// The two users of a direct chat; empty for group and event rooms
+	User1ID string `json:"user1_id"`
+	User2ID string `json:"user2_id"`
+	// Name of a group or event room
+	Title string `json:"title,omitempty"`
+	// Event of an event room
+	EventID          *int64    `json:"event_id,omitempty"`
+	MemberCount      int       `json:"member_count,omitempty"`
 	AISuggestedTheme string    `json:"ai_suggested_theme,omitempty"`
 	CreatedAt        time.Time `json:"created_at"`
+	// Time of the last message, kept up to date by a trigger on messages
+	LastMessageAt *time.Time `json:"last_message_at,omitempty"`
 	// Additional fields for response
-	OtherUser   *User    `json:"other_user,omitempty"`
-	LastMessage *Message `json:"last_message,omitempty"`
+	OtherUser   *User        `json:"other_user,omitempty"`
+	LastMessage *Message     `json:"last_message,omitempty"`
+	UnreadCount int          `json:"unread_count"`
+	Settings    ChatSettings `json:"settings"`
+}
+
+// ChatMember is a participant of a chat room
+type ChatMember struct {
+	UserID    string    `json:"user_id"`
+	Username  string    `json:"username"`
+	AvatarURL string    `json:"avatar_url,omitempty"`
+	Role      string    `json:"role"`
+	JoinedAt  time.Time `json:"joined_at"`
+}
+
+// CreateGroupChatRequest is the body of POST /api/v1/chats/groups
+type CreateGroupChatRequest struct {
+	Title string `json:"title"`
+	// Users to add besides the creator, who becomes the owner
+	MemberIDs []string `json:"member_ids"`
+}
+
+// InviteChatMembersRequest is the body of POST /api/v1/chats/{chatId}/members
+type InviteChatMembersRequest struct {
+	UserIDs []string `json:"user_ids"`
+}
+
+// ChatSettings is one participant's view of a chat: mute, archive and pin.
+// Each participant has their own settings.
+type ChatSettings struct {
+	// Push notifications for the chat are suppressed until this time; nil means not muted
+	MutedUntil *time.Time `json:"muted_until"`
+	Archived   bool       `json:"archived"`
+	Pinned     bool       `json:"pinned"`
+}
+
+// Muted reports whether the chat is muted at t
+func (s ChatSettings) Muted(t time.Time) bool {
+	return s.MutedUntil != nil && t.Before(*s.MutedUntil)
+}
+
+// ChatMemberState is a participant's unread count and settings for a chat, which is what
+// notifying them of a new message needs
+type ChatMemberState struct {
+	UserID      string       `json:"user_id"`
+	UnreadCount int          `json:"unread_count"`
+	Settings    ChatSettings `json:"settings"`
 }
 
 // Message represents a message in a chat
@@ -23,4 +94,24 @@ type Message struct {
 	TranslatedContent string    `json:"translated_content,omitempty"`
 	MessageType       string    `json:"message_type"`
 	SentAt            time.Time `json:"sent_at"`
+	// Proposal of a meetup message
+	MeetupID *int64          `json:"meetup_id,omitempty"`
+	Meetup   *MeetupProposal `json:"meetup,omitempty"`
+}
+
+// MarkChatReadRequest is the body of POST /api/v1/chats/{chatId}/read
+type MarkChatReadRequest struct {
+	// ID of the last message the user has read; 0 means the latest message
+	MessageID int64 `json:"message_id"`
+}
+
+// MeetRequest is the body of POST /api/v1/meet-requests
+type MeetRequest struct {
+	RecipientID string `json:"recipient_id"`
+}
+
+// MeetRequestResponse tells the sender whether their "want to meet" was mutual
+type MeetRequestResponse struct {
+	Matched bool  `json:"match"`
+	ChatID  int64 `json:"chat_id,omitempty"`
 }
@@ -0,0 +1,133 @@
+package models
+
+// Items of a complete profile, as listed in ProfileCompleteness.Missing
+const (
+	ProfileItemAvatar            = "avatar_url"
+	ProfileItemNativeLanguage    = "native_language"
+	ProfileItemLearningLanguages = "learning_languages"
+	ProfileItemInterests         = "interests"
+	ProfileItemComment           = "comment"
+	ProfileItemMajor             = "major"
+	ProfileItemResidence         = "residence"
+	ProfileItemVerified          = "verified"
+)
+
+// Profiles scoring below this are incomplete: search lists them after complete ones.
+const MinCompleteScore = 50
+
+// profileItems are the items of a profile with how much each counts, out of 100.
+var profileItems = []struct {
+	item   string
+	weight int
+	has    func(u User) bool
+}{
+	{ProfileItemAvatar, 15, func(u User) bool { return u.AvatarURL != "" }},
+	{ProfileItemNativeLanguage, 15, func(u User) bool { return u.NativeLanguage != "" }},
+	{ProfileItemLearningLanguages, 15, func(u User) bool { return len(u.LearningLanguages) > 0 }},
+	{ProfileItemInterests, 15, func(u User) bool { return len(u.Interests) > 0 }},
+	{ProfileItemComment, 15, func(u User) bool { return u.Comment != "" }},
+	{ProfileItemMajor, 10, func(u User) bool { return u.Major != "" }},
+	{ProfileItemResidence, 5, func(u User) bool { return u.Residence != "" }},
+	{ProfileItemVerified, 10, func(u User) bool { return u.IsOICVerified }},
+}
+
+// ProfileCompleteness is how much of a profile is filled in
+type ProfileCompleteness struct {
+	// 0–100
+	Score int `json:"score"`
+	// Items still to fill in, most important first
+	Missing []string `json:"missing"`
+}
+
+// ProfileCompleteness scores the profile. Private fields count as missing once hidden
+// for another user (see ProfileViewer.Redact).
+func (u User) ProfileCompleteness() ProfileCompleteness {
+	c := ProfileCompleteness{Missing: []string{}}
+	for _, item := range profileItems {
+		if item.has(u) {
+			c.Score += item.weight
+		} else {
+			c.Missing = append(c.Missing, item.item)
+		}
+	}
+	return c
+}
+
+func (c ProfileCompleteness) has(item string) bool {
+	for _, missing := range c.Missing {
+		if missing == item {
+			return false
+		}
+	}
+	return true
+}
+
+// Onboarding states, in order. Each state means its step is done.
+const (
+	OnboardingRegistered = "registered"
+	// Native language and a language to learn are set
+	OnboardingProfileBasics = "profile_basics"
+	// At least one interest is set
+	OnboardingInterests = "interests"
+	// Verified as an OIC student
+	OnboardingVerified = "verified"
+)
+
+var onboardingSteps = []struct {
+	state string
+	done  func(c ProfileCompleteness) bool
+}{
+	{OnboardingRegistered, func(ProfileCompleteness) bool { return true }},
+	{OnboardingProfileBasics, func(c ProfileCompleteness) bool {
+		return c.has(ProfileItemNativeLanguage) && c.has(ProfileItemLearningLanguages)
+	}},
+	{OnboardingInterests, func(c ProfileCompleteness) bool { return c.has(ProfileItemInterests) }},
+	{OnboardingVerified, func(c ProfileCompleteness) bool { return c.has(ProfileItemVerified) }},
+}
+
+// Onboarding is where a user is in the onboarding checklist
+type Onboarding struct {
+	State string `json:"state"`
+	// The next step to do; empty once verified
+	NextStep string           `json:"next_step,omitempty"`
+	Steps    []OnboardingStep `json:"steps"`
+}
+
+// OnboardingStep is an item of the onboarding checklist
+type OnboardingStep struct {
+	Step string `json:"step"`
+	Done bool   `json:"done"`
+}
+
+func onboardingIndex(state string) int {
+	for i, step := range onboardingSteps {
+		if step.state == state {
+			return i
+		}
+	}
+	return 0
+}
+
+// AdvanceOnboarding moves state forward through every following step the profile
+// completes, in order. States never go back: a user who removes their interests later
+// stays past that step.
+func AdvanceOnboarding(state string, c ProfileCompleteness) string {
+	i := onboardingIndex(state)
+	for i+1 < len(onboardingSteps) && onboardingSteps[i+1].done(c) {
+		i++
+	}
+	return onboardingSteps[i].state
+}
+
+// NewOnboarding returns the checklist of a user in state.
+func NewOnboarding(state string) Onboarding {
+	current := onboardingIndex(state)
+	o := Onboarding{State: onboardingSteps[current].state}
+	for i, step := range onboardingSteps {
+		o.Steps = append(o.Steps, OnboardingStep{Step: step.state, Done: i <= current})
+	}
+	if current+1 < len(onboardingSteps) {
+		o.NextStep = onboardingSteps[current+1].state
+	}
+	return o
+}
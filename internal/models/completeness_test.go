@@ -0,0 +1,40 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProfileCompletenessAndOnboarding(t *testing.T) {
+	u := User{NativeLanguage: "ja", LearningLanguages: []string{"en"}, Comment: "よろしく"}
+	c := u.ProfileCompleteness()
+	wantMissing := []string{ProfileItemAvatar, ProfileItemInterests, ProfileItemMajor, ProfileItemResidence, ProfileItemVerified}
+	if c.Score != 45 || !reflect.DeepEqual(c.Missing, wantMissing) {
+		t.Fatalf("got %+v", c)
+	}
+
+	if got := AdvanceOnboarding(OnboardingRegistered, c); got != OnboardingProfileBasics {
+		t.Errorf("basics done: got %s", got)
+	}
+	// Verified but without interests: the interests step comes first
+	u.IsOICVerified = true
+	if got := AdvanceOnboarding(OnboardingRegistered, u.ProfileCompleteness()); got != OnboardingProfileBasics {
+		t.Errorf("verified without interests: got %s", got)
+	}
+	u.Interests = []Interest{{ID: 1}}
+	if got := AdvanceOnboarding(OnboardingRegistered, u.ProfileCompleteness()); got != OnboardingVerified {
+		t.Errorf("all done: got %s", got)
+	}
+	// Never goes back
+	if got := AdvanceOnboarding(OnboardingInterests, User{}.ProfileCompleteness()); got != OnboardingInterests {
+		t.Errorf("emptied profile: got %s", got)
+	}
+
+	o := NewOnboarding(OnboardingProfileBasics)
+	if o.NextStep != OnboardingInterests || len(o.Steps) != 4 || !o.Steps[1].Done || o.Steps[2].Done {
+		t.Errorf("unexpected checklist %+v", o)
+	}
+	if o := NewOnboarding(OnboardingVerified); o.NextStep != "" {
+		t.Errorf("verified still has a next step: %+v", o)
+	}
+}
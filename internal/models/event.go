@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Event is a school event or mission
+type Event struct {
+	ID              int64      `json:"id"`
+	Title           string     `json:"title"`
+	Description     string     `json:"description,omitempty"`
+	EventType       string     `json:"event_type"`
+	StartTime       time.Time  `json:"start_time"`
+	EndTime         *time.Time `json:"end_time,omitempty"`
+	ChatLinkEnabled bool       `json:"chat_link_enabled"`
+}
@@ -0,0 +1,168 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"meetupr-backend/internal/namematch"
+)
+
+// LocalizedNames maps language codes (ja, en, zh, ko, ...) to display names.
+type LocalizedNames map[string]string
+
+// Pick returns the name in the first of locales that has one, or fallback.
+func (n LocalizedNames) Pick(locales []string, fallback string) string {
+	for _, locale := range locales {
+		if name := n[locale]; name != "" {
+			return name
+		}
+	}
+	return fallback
+}
+
+// InterestCategory groups interests, e.g. Music or Sports
+type InterestCategory struct {
+	ID        int            `json:"id"`
+	Slug      string         `json:"slug"`
+	Name      string         `json:"name"`
+	Names     LocalizedNames `json:"names,omitempty"`
+	SortOrder int            `json:"sort_order"`
+	// Top-level interests of the category, with their sub-interests
+	Interests []InterestNode `json:"interests,omitempty"`
+}
+
+// InterestNode is an interest with the interests under it
+type InterestNode struct {
+	ID       int            `json:"id"`
+	Name     string         `json:"name"`
+	Children []InterestNode `json:"children,omitempty"`
+}
+
+// UncategorizedInterests is the category BuildInterestTree puts interests without one in.
+var UncategorizedInterests = InterestCategory{
+	Slug:  "other",
+	Name:  "その他",
+	Names: LocalizedNames{"ja": "その他", "en": "Other", "zh": "其他", "ko": "기타"},
+}
+
+// BuildInterestTree nests interests under their parents and files the top-level ones
+// under their category, in category sort order. Sub-interests are listed under their
+// parent whatever their own category is. Interests without a known category go into
+// UncategorizedInterests at the end.
+func BuildInterestTree(categories []InterestCategory, interests []Interest) []InterestCategory {
+	known := make(map[int]bool, len(interests))
+	for _, interest := range interests {
+		known[interest.ID] = true
+	}
+	children := make(map[int][]Interest)
+	for _, interest := range interests {
+		if interest.ParentID != 0 && known[interest.ParentID] {
+			children[interest.ParentID] = append(children[interest.ParentID], interest)
+		}
+	}
+	var node func(interest Interest, seen map[int]bool) InterestNode
+	node = func(interest Interest, seen map[int]bool) InterestNode {
+		n := InterestNode{ID: interest.ID, Name: interest.Name}
+		seen[interest.ID] = true
+		for _, child := range children[interest.ID] {
+			// A parent loop in the data would recurse forever
+			if !seen[child.ID] {
+				n.Children = append(n.Children, node(child, seen))
+			}
+		}
+		return n
+	}
+
+	tree := make([]InterestCategory, len(categories))
+	copy(tree, categories)
+	sort.SliceStable(tree, func(i, j int) bool { return tree[i].SortOrder < tree[j].SortOrder })
+	index := make(map[int]int, len(tree))
+	for i, category := range tree {
+		tree[i].Interests = nil
+		index[category.ID] = i
+	}
+	var other []InterestNode
+	for _, interest := range interests {
+		if interest.ParentID != 0 && known[interest.ParentID] {
+			continue
+		}
+		n := node(interest, map[int]bool{})
+		if i, ok := index[interest.CategoryID]; ok && interest.CategoryID != 0 {
+			tree[i].Interests = append(tree[i].Interests, n)
+		} else {
+			other = append(other, n)
+		}
+	}
+	if len(other) > 0 {
+		uncategorized := UncategorizedInterests
+		uncategorized.Interests = other
+		tree = append(tree, uncategorized)
+	}
+	return tree
+}
+
+// InterestDescendants maps each interest that has sub-interests to all of them, at any
+// depth.
+func InterestDescendants(interests []Interest) map[int][]int {
+	children := make(map[int][]int)
+	for _, interest := range interests {
+		if interest.ParentID != 0 {
+			children[interest.ParentID] = append(children[interest.ParentID], interest.ID)
+		}
+	}
+	descendants := make(map[int][]int, len(children))
+	for parent := range children {
+		seen := map[int]bool{parent: true}
+		queue := append([]int(nil), children[parent]...)
+		for len(queue) > 0 {
+			id := queue[0]
+			queue = queue[1:]
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			descendants[parent] = append(descendants[parent], id)
+			queue = append(queue, children[id]...)
+		}
+	}
+	return descendants
+}
+
+// Interest proposal statuses
+const (
+	ProposalPending  = "pending"
+	ProposalApproved = "approved"
+	// An existing interest was the same; the proposer got that one instead
+	ProposalDuplicate = "duplicate"
+	ProposalRejected  = "rejected"
+)
+
+// InterestProposal is a new interest a user asked to add to the master list
+type InterestProposal struct {
+	ID         int64          `json:"id"`
+	UserID     string         `json:"user_id"`
+	Name       string         `json:"name"`
+	Names      LocalizedNames `json:"names,omitempty"`
+	CategoryID *int           `json:"category_id,omitempty"`
+	ParentID   *int           `json:"parent_id,omitempty"`
+	// Why the user wants it
+	Note   string `json:"note,omitempty"`
+	Status string `json:"status"`
+	// The interest created on approval, or the existing one for a duplicate
+	InterestID *int       `json:"interest_id,omitempty"`
+	ReviewNote string     `json:"review_note,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	// Existing interests the proposal likely duplicates, most similar first
+	Duplicates []namematch.Match `json:"duplicates,omitempty"`
+}
+
+// InterestMergeResult is what merging one interest into another changed
+type InterestMergeResult struct {
+	From int `json:"from"`
+	Into int `json:"into"`
+	// Users whose interest moved to Into (users who had both keep the higher level)
+	MovedUsers int `json:"moved_users"`
+	// Saved searches whose interest_ids were rewritten
+	SavedSearches int `json:"saved_searches"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestBuildInterestTree(t *testing.T) {
+	categories := []InterestCategory{
+		{ID: 2, Slug: "sports", Name: "スポーツ", SortOrder: 2},
+		{ID: 1, Slug: "music", Name: "音楽", SortOrder: 1},
+	}
+	interests := []Interest{
+		{ID: 10, Name: "音楽", CategoryID: 1},
+		{ID: 11, Name: "J-POP", CategoryID: 1, ParentID: 10},
+		{ID: 12, Name: "アイドル", ParentID: 11},
+		{ID: 20, Name: "サッカー", CategoryID: 2},
+		{ID: 30, Name: "料理"},
+	}
+
+	tree := BuildInterestTree(categories, interests)
+	if len(tree) != 3 || tree[0].Slug != "music" || tree[1].Slug != "sports" || tree[2].Slug != UncategorizedInterests.Slug {
+		t.Fatalf("unexpected categories: %+v", tree)
+	}
+	music := tree[0].Interests
+	if len(music) != 1 || len(music[0].Children) != 1 || music[0].Children[0].Children[0].ID != 12 {
+		t.Errorf("unexpected music tree: %+v", music)
+	}
+	if len(tree[2].Interests) != 1 || tree[2].Interests[0].ID != 30 {
+		t.Errorf("unexpected uncategorized interests: %+v", tree[2].Interests)
+	}
+
+	descendants := InterestDescendants(interests)
+	got := descendants[10]
+	sort.Ints(got)
+	if !reflect.DeepEqual(got, []int{11, 12}) || len(descendants[20]) != 0 {
+		t.Errorf("unexpected descendants: %v", descendants)
+	}
+
+	names := LocalizedNames{"en": "Music", "ko": "음악"}
+	if got := names.Pick([]string{"zh", "ko", "en"}, "音楽"); got != "음악" {
+		t.Errorf("Pick = %q", got)
+	}
+	if got := names.Pick([]string{"fr"}, "音楽"); got != "音楽" {
+		t.Errorf("Pick without a match = %q", got)
+	}
+}
@@ -0,0 +1,77 @@
+package models
+
+import "strings"
+
+// Language proficiency levels: the CEFR scale, plus native.
+const (
+	LevelA1     = "A1"
+	LevelA2     = "A2"
+	LevelB1     = "B1"
+	LevelB2     = "B2"
+	LevelC1     = "C1"
+	LevelC2     = "C2"
+	LevelNative = "native"
+)
+
+// TeachingLevel is the lowest level at which someone can be the "teacher" of a language
+// in a language exchange.
+const TeachingLevel = LevelC1
+
+var levelRanks = map[string]int{
+	LevelA1:     1,
+	LevelA2:     2,
+	LevelB1:     3,
+	LevelB2:     4,
+	LevelC1:     5,
+	LevelC2:     6,
+	LevelNative: 7,
+}
+
+// LevelRank orders levels from 1 (A1) to 7 (native). Unknown levels rank 0.
+func LevelRank(level string) int {
+	return levelRanks[level]
+}
+
+// MaxLevelRank is the rank of LevelNative.
+const MaxLevelRank = 7
+
+// ValidLevel reports whether level is one of the proficiency levels.
+func ValidLevel(level string) bool {
+	return LevelRank(level) > 0
+}
+
+// LanguageSkill is how well a user speaks one language, identified by its ISO 639-1 code.
+type LanguageSkill struct {
+	Language string `json:"language"`
+	Level    string `json:"level"`
+}
+
+// LanguageLevel returns the user's level in a language: the level from their language
+// skills, native for their native language, or "" if unknown.
+func (u User) LanguageLevel(language string) string {
+	for _, skill := range u.LanguageSkills {
+		if strings.EqualFold(skill.Language, language) {
+			return skill.Level
+		}
+	}
+	if u.NativeLanguage != "" && strings.EqualFold(u.NativeLanguage, language) {
+		return LevelNative
+	}
+	return ""
+}
+
+// SpeaksAtLeast reports whether the user's level in language is level or above.
+func (u User) SpeaksAtLeast(language, level string) bool {
+	rank := LevelRank(u.LanguageLevel(language))
+	return rank > 0 && rank >= LevelRank(level)
+}
+
+// IsLearning reports whether language is one of the user's learning languages.
+func (u User) IsLearning(language string) bool {
+	for _, l := range u.LearningLanguages {
+		if strings.EqualFold(l, language) {
+			return true
+		}
+	}
+	return false
+}
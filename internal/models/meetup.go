@@ -0,0 +1,84 @@
+package models
+
+import "time"
+
+// Message types
+const (
+	MessageTypeText = "text"
+	// A meetup proposal, or a response to one; Message.Meetup holds the proposal
+	MessageTypeMeetup = "meetup"
+)
+
+// Meetup proposal statuses
+const (
+	MeetupPending  = "pending"
+	MeetupAccepted = "accepted"
+	MeetupDeclined = "declined"
+	// The recipient answered with other times; see the proposal with this one as PreviousID
+	MeetupCountered = "countered"
+)
+
+// CampusLocation is a place on campus where users can meet
+type CampusLocation struct {
+	ID   int    `json:"id"`
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+	// Names in other languages, like Interest.Names
+	Names     LocalizedNames `json:"names,omitempty"`
+	Building  string         `json:"building,omitempty"`
+	Latitude  *float64       `json:"latitude,omitempty"`
+	Longitude *float64       `json:"longitude,omitempty"`
+	SortOrder int            `json:"sort_order"`
+}
+
+// MeetupSlot is a candidate time for a meetup
+type MeetupSlot struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// MeetupProposal is a proposal to meet in person, made in a direct chat
+type MeetupProposal struct {
+	ID          int64        `json:"id"`
+	ChatID      int64        `json:"chat_id"`
+	ProposerID  string       `json:"proposer_id"`
+	RecipientID string       `json:"recipient_id"`
+	Candidates  []MeetupSlot `json:"candidates"`
+	LocationID  int          `json:"location_id"`
+	// Filled in when the proposal is returned to clients
+	Location *CampusLocation `json:"location,omitempty"`
+	// Event the meetup is for, if any
+	EventID *int64 `json:"event_id,omitempty"`
+	Note    string `json:"note,omitempty"`
+	Status  string `json:"status"`
+	// The candidate the recipient accepted
+	AcceptedSlot *MeetupSlot `json:"accepted_slot,omitempty"`
+	// The proposal this one counters
+	PreviousID  *int64     `json:"previous_id,omitempty"`
+	RespondedAt *time.Time `json:"responded_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	// Reminders already sent, by name
+	RemindersSent []string `json:"-"`
+}
+
+// OtherParticipant returns the participant of the meetup who isn't userID
+func (p MeetupProposal) OtherParticipant(userID string) string {
+	if p.ProposerID == userID {
+		return p.RecipientID
+	}
+	return p.ProposerID
+}
+
+// MeetupAction is the meetup part of a meetup_* WebSocket frame
+type MeetupAction struct {
+	// Proposal to accept, decline or counter
+	ProposalID int64 `json:"proposal_id,omitempty"`
+	// Candidate times of a new or counter proposal
+	Candidates []MeetupSlot `json:"candidates,omitempty"`
+	// Campus location of a new proposal; a counter keeps the original one when 0
+	LocationID int    `json:"location_id,omitempty"`
+	EventID    *int64 `json:"event_id,omitempty"`
+	Note       string `json:"note,omitempty"`
+	// Index of the accepted candidate
+	Slot int `json:"slot,omitempty"`
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// PushSubscription is a browser's Web Push subscription (PushSubscription.toJSON())
+type PushSubscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// NotificationSettings controls when push notifications are sent to a user
+type NotificationSettings struct {
+	// Muted turns off all push notifications
+	Muted bool `json:"muted"`
+	// Quiet hours in "HH:MM" local time; no pushes between start and end (may span midnight)
+	QuietHoursStart string    `json:"quiet_hours_start,omitempty"`
+	QuietHoursEnd   string    `json:"quiet_hours_end,omitempty"`
+	TimeZone        string    `json:"time_zone"`
+	UpdatedAt       time.Time `json:"updated_at,omitempty"`
+}
+
+// Notification types shown in the in-app inbox
+const (
+	NotificationMatch             = "match"
+	NotificationModerationWarning = "moderation_warning"
+	NotificationSavedSearchMatch  = "saved_search_match"
+	// An interest the user proposed was reviewed
+	NotificationInterestProposal = "interest_proposal"
+	// An accepted meetup is coming up
+	NotificationMeetupReminder = "meetup_reminder"
+)
+
+// Notification is an entry in a user's in-app notification inbox
+type Notification struct {
+	ID     int64  `json:"id"`
+	UserID string `json:"-"`
+	Type   string `json:"type"`
+	// User who caused the notification, if any
+	ActorID string `json:"actor_id,omitempty"`
+	// What the notification is about, e.g. target_type "chat" and target_id "123"
+	TargetType string          `json:"target_type,omitempty"`
+	TargetID   string          `json:"target_id,omitempty"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+	ReadAt     *time.Time      `json:"read_at"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// NotificationPage is one page of GET /api/v1/notifications
+type NotificationPage struct {
+	Notifications []Notification `json:"notifications"`
+	// Pass as ?cursor= to get the next (older) page; empty on the last page
+	NextCursor  string `json:"next_cursor,omitempty"`
+	UnreadCount int    `json:"unread_count"`
+}
+
+// Email digest frequencies
+const (
+	EmailFrequencyOff    = "off"
+	EmailFrequencyDaily  = "daily"
+	EmailFrequencyWeekly = "weekly"
+)
+
+// EmailPreferences controls the unread messages / matches email digest
+type EmailPreferences struct {
+	UserID    string `json:"-"`
+	Frequency string `json:"frequency"`
+	// Secret for the one-click unsubscribe link; never sent to the client
+	UnsubscribeToken string     `json:"-"`
+	LastDigestAt     *time.Time `json:"last_digest_at,omitempty"`
+}
+
+// UpdateEmailPreferencesRequest is the body of PUT /api/v1/users/me/email-preferences
+type UpdateEmailPreferencesRequest struct {
+	Frequency string `json:"frequency"`
+}
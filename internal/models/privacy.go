@@ -0,0 +1,130 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Who can see a profile field
+const (
+	VisibilityEveryone = "everyone"
+	// Only OIC-verified students
+	VisibilityVerified = "verified"
+	// Only users the owner matched or chats with
+	VisibilityConnections = "connections"
+	VisibilityNobody      = "nobody"
+)
+
+// PrivacySettings controls what other users see of a user's profile. Username, avatar
+// and comment are always visible; email is never shown to other users.
+type PrivacySettings struct {
+	// Leave the user out of search results
+	HiddenFromSearch bool `json:"hidden_from_search"`
+	// Visibility of each field: everyone, verified, connections or nobody
+	Major     string `json:"major"`
+	Gender    string `json:"gender"`
+	Residence string `json:"residence"`
+	// Native, spoken and learning languages with their levels
+	Languages string    `json:"languages"`
+	Interests string    `json:"interests"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+// DefaultPrivacySettings are the settings of users who haven't changed them: everything
+// visible to everyone.
+func DefaultPrivacySettings() PrivacySettings {
+	return PrivacySettings{
+		Major:     VisibilityEveryone,
+		Gender:    VisibilityEveryone,
+		Residence: VisibilityEveryone,
+		Languages: VisibilityEveryone,
+		Interests: VisibilityEveryone,
+	}
+}
+
+// Validate checks that every field has a known visibility.
+func (s PrivacySettings) Validate() error {
+	for field, visibility := range map[string]string{
+		"major":     s.Major,
+		"gender":    s.Gender,
+		"residence": s.Residence,
+		"languages": s.Languages,
+		"interests": s.Interests,
+	} {
+		switch visibility {
+		case VisibilityEveryone, VisibilityVerified, VisibilityConnections, VisibilityNobody:
+		default:
+			return fmt.Errorf("%s must be one of everyone, verified, connections, nobody", field)
+		}
+	}
+	return nil
+}
+
+// ProfileViewer is a user looking at other users' profiles, with what decides which
+// fields they see.
+type ProfileViewer struct {
+	UserID string
+	// Whether the viewer is an OIC-verified student
+	Verified bool
+	// Users the viewer matched or chats with
+	Connections map[string]bool
+	// Privacy settings of the users being viewed; missing users have the defaults
+	Settings map[string]PrivacySettings
+}
+
+// SettingsOf returns the privacy settings of a user being viewed.
+func (v ProfileViewer) SettingsOf(userID string) PrivacySettings {
+	if s, ok := v.Settings[userID]; ok {
+		return s
+	}
+	return DefaultPrivacySettings()
+}
+
+// CanFind reports whether the user may appear in the viewer's search results.
+func (v ProfileViewer) CanFind(userID string) bool {
+	return userID == v.UserID || !v.SettingsOf(userID).HiddenFromSearch
+}
+
+// canSee reports whether the viewer may see a field of the user with this visibility.
+func (v ProfileViewer) canSee(userID, visibility string) bool {
+	switch visibility {
+	case VisibilityEveryone:
+		return true
+	case VisibilityVerified:
+		return v.Verified || v.Connections[userID]
+	case VisibilityConnections:
+		return v.Connections[userID]
+	default:
+		return false
+	}
+}
+
+// Redact clears the fields of u that the viewer may not see and scores its completeness
+// on what is left, so filtering and ranking on it don't reveal hidden fields. Users see
+// all of their own profile.
+func (v ProfileViewer) Redact(u *User) {
+	if u.ID == v.UserID {
+		return
+	}
+	u.Email = ""
+	s := v.SettingsOf(u.ID)
+	if !v.canSee(u.ID, s.Major) {
+		u.Major = ""
+	}
+	if !v.canSee(u.ID, s.Gender) {
+		u.Gender = ""
+	}
+	if !v.canSee(u.ID, s.Residence) {
+		u.Residence = ""
+	}
+	if !v.canSee(u.ID, s.Languages) {
+		u.NativeLanguage = ""
+		u.SpokenLanguages = nil
+		u.LearningLanguages = nil
+		u.LanguageSkills = nil
+	}
+	if !v.canSee(u.ID, s.Interests) {
+		u.Interests = nil
+	}
+	u.Completeness = u.ProfileCompleteness().Score
+}
@@ -0,0 +1,54 @@
+package models
+
+import "testing"
+
+func TestProfileViewerRedact(t *testing.T) {
+	profile := User{
+		ID: "owner", Email: "owner@example.com", Major: "情報工学", Gender: "女性", Residence: "KR",
+		NativeLanguage: "ko", SpokenLanguages: []string{"ja"}, Interests: []Interest{{ID: 1, Name: "K-POP"}},
+	}
+	settings := map[string]PrivacySettings{"owner": {
+		Major:     VisibilityEveryone,
+		Gender:    VisibilityNobody,
+		Residence: VisibilityVerified,
+		Languages: VisibilityConnections,
+		Interests: VisibilityVerified,
+	}}
+
+	tests := []struct {
+		name   string
+		viewer ProfileViewer
+		want   func(u User) bool
+	}{
+		{"stranger", ProfileViewer{UserID: "v", Settings: settings}, func(u User) bool {
+			return u.Major != "" && u.Gender == "" && u.Residence == "" && u.NativeLanguage == "" && u.Interests == nil
+		}},
+		{"verified", ProfileViewer{UserID: "v", Verified: true, Settings: settings}, func(u User) bool {
+			return u.Gender == "" && u.Residence == "KR" && u.NativeLanguage == "" && len(u.Interests) == 1
+		}},
+		{"chat partner", ProfileViewer{UserID: "v", Connections: map[string]bool{"owner": true}, Settings: settings}, func(u User) bool {
+			return u.Gender == "" && u.Residence == "KR" && u.NativeLanguage == "ko" && len(u.SpokenLanguages) == 1
+		}},
+		{"owner", ProfileViewer{UserID: "owner", Settings: settings}, func(u User) bool {
+			return u.Gender == "女性" && u.Email != ""
+		}},
+	}
+	for _, tt := range tests {
+		u := profile
+		tt.viewer.Redact(&u)
+		if !tt.want(u) {
+			t.Errorf("%s sees %+v", tt.name, u)
+		}
+		if tt.viewer.UserID != "owner" && u.Email != "" {
+			t.Errorf("%s sees the email", tt.name)
+		}
+	}
+
+	if !(ProfileViewer{UserID: "v"}).CanFind("owner") {
+		t.Error("users without settings should be findable")
+	}
+	hidden := ProfileViewer{UserID: "v", Settings: map[string]PrivacySettings{"owner": {HiddenFromSearch: true}}}
+	if hidden.CanFind("owner") {
+		t.Error("hidden user found")
+	}
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SavedSearch is a user search kept under a name, optionally checked in the background
+// for users who newly match it
+type SavedSearch struct {
+	ID     int64  `json:"id"`
+	UserID string `json:"-"`
+	Name   string `json:"name"`
+	// The search request (search.Query) without cursor and limit
+	Query json.RawMessage `json:"query"`
+	// Notify the owner when new users match
+	Notify bool `json:"notify"`
+	// When the alert job last looked for new matches
+	LastCheckedAt *time.Time `json:"last_checked_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// SavedSearchAlert is the payload of a saved_search_match notification
+type SavedSearchAlert struct {
+	SavedSearchID int64  `json:"saved_search_id"`
+	Name          string `json:"name"`
+	// Number of users who newly match
+	Count int `json:"count"`
+	// The most relevant of them, at most 10
+	UserIDs []string `json:"user_ids"`
+}
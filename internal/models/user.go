@@ -3,21 +3,26 @@ package models
 import "time"
 
 type User struct {
-	ID                string     `json:"id"`
-	Email             string     `json:"email"`
-	Username          string     `json:"username"`
-	IsOICVerified     bool       `json:"is_oic_verified"`
-	CreatedAt         time.Time  `json:"created_at"`
-	Major             string     `json:"major,omitempty"`
-	Gender            string     `json:"gender,omitempty"`
-	NativeLanguage    string     `json:"native_language,omitempty"`
-	SpokenLanguages   []string   `json:"spoken_languages,omitempty"`
-	LearningLanguages []string   `json:"learning_languages,omitempty"`
-	Residence         string     `json:"residence,omitempty"`
-	Comment           string     `json:"comment,omitempty"`
-	AvatarURL         string     `json:"avatar_url,omitempty"`
-	Interests         []Interest `json:"interests,omitempty"`
-	LastUpdatedAt     time.Time  `json:"last_updated,omitempty"`
+	ID string `json:"id"`
+	// Only in the user's own view
+	Email             string          `json:"email,omitempty"`
+	Username          string          `json:"username"`
+	IsOICVerified     bool            `json:"is_oic_verified"`
+	CreatedAt         time.Time       `json:"created_at"`
+	Major             string          `json:"major,omitempty"`
+	Gender            string          `json:"gender,omitempty"`
+	NativeLanguage    string          `json:"native_language,omitempty"`
+	SpokenLanguages   []string        `json:"spoken_languages,omitempty"`
+	LearningLanguages []string        `json:"learning_languages,omitempty"`
+	LanguageSkills    []LanguageSkill `json:"language_skills,omitempty"`
+	Residence         string          `json:"residence,omitempty"`
+	Comment           string          `json:"comment,omitempty"`
+	AvatarURL         string          `json:"avatar_url,omitempty"`
+	Interests         []Interest      `json:"interests,omitempty"`
+	LastUpdatedAt     time.Time       `json:"last_updated,omitempty"`
+	// ProfileCompleteness score; search and recommendations rank on it. Redact scores it
+	// again on the fields the viewer can see
+	Completeness int `json:"-"`
 }
 
 type Interest struct {
@@ -25,22 +30,32 @@ type Interest struct {
 	Name            string `json:"name"`
 	PreferenceLevel int    `json:"preference_level,omitempty"`
 	Category        string `json:"category,omitempty"`
+	CategoryID      int    `json:"category_id,omitempty"`
+	// The broader interest this one belongs to, e.g. Music for J-Pop
+	ParentID int `json:"parent_id,omitempty"`
+	// Display names by language code; Name is used for languages without one
+	Names LocalizedNames `json:"names,omitempty"`
 }
 
 type UserProfileResponse struct {
-	UserID            string     `json:"user_id"`
-	Email             string     `json:"email"`
-	Username          string     `json:"username"`
-	Major             string     `json:"major"`
-	Gender            string     `json:"gender"`
-	NativeLanguage    string     `json:"native_language"`
-	SpokenLanguages   []string   `json:"spoken_languages"`
-	LearningLanguages []string   `json:"learning_languages"`
-	Residence         string     `json:"residence"`
-	Comment           string     `json:"comment"`
-	AvatarURL         string     `json:"avatar_url"`
-	Interests         []Interest `json:"interests"`
-	LastUpdated       time.Time  `json:"last_updated"`
+	UserID            string          `json:"user_id"`
+	Email             string          `json:"email"`
+	Username          string          `json:"username"`
+	Major             string          `json:"major"`
+	Gender            string          `json:"gender"`
+	NativeLanguage    string          `json:"native_language"`
+	SpokenLanguages   []string        `json:"spoken_languages"`
+	LearningLanguages []string        `json:"learning_languages"`
+	LanguageSkills    []LanguageSkill `json:"language_skills"`
+	Residence         string          `json:"residence"`
+	Comment           string          `json:"comment"`
+	AvatarURL         string          `json:"avatar_url"`
+	Interests         []Interest      `json:"interests"`
+	LastUpdated       time.Time       `json:"last_updated"`
+	IsOICVerified     bool            `json:"is_oic_verified"`
+	// How much of the profile is filled in, with what is missing
+	Completeness ProfileCompleteness `json:"completeness"`
+	Onboarding   Onboarding          `json:"onboarding"`
 }
 
 type RegisterUserRequest struct {
@@ -54,8 +69,56 @@ type UpdateUserProfileRequest struct {
 	NativeLanguage    string   `json:"native_language"`
 	SpokenLanguages   []string `json:"spoken_languages"`
 	LearningLanguages []string `json:"learning_languages"`
-	Residence         string   `json:"residence"`
-	Comment           string   `json:"comment"`
-	AvatarURL         string   `json:"avatar_url"`
-	InterestIDs       []int    `json:"interest_ids"`
+	// Omit to keep the current language skills
+	LanguageSkills []LanguageSkill `json:"language_skills"`
+	Residence      string          `json:"residence"`
+	Comment        string          `json:"comment"`
+	AvatarURL      string          `json:"avatar_url"`
+	InterestIDs    []int           `json:"interest_ids"`
+}
+
+// Interest preference levels (user_interests.preference_level)
+const (
+	MinPreferenceLevel     = 1
+	MaxPreferenceLevel     = 5
+	DefaultPreferenceLevel = 3
+)
+
+// InterestPreference is an interest with how much the user likes it
+type InterestPreference struct {
+	ID int `json:"id"`
+	// 1–5; omit to keep the current level (3 for a new interest)
+	PreferenceLevel int `json:"preference_level,omitempty"`
+}
+
+// PatchUserProfileRequest is the body of PATCH /api/v1/users/me. Only the fields in the
+// request are changed: an empty string clears a text field and an empty list clears a
+// list.
+type PatchUserProfileRequest struct {
+	Username          *string          `json:"username"`
+	Major             *string          `json:"major"`
+	Gender            *string          `json:"gender"`
+	NativeLanguage    *string          `json:"native_language"`
+	SpokenLanguages   *[]string        `json:"spoken_languages"`
+	LearningLanguages *[]string        `json:"learning_languages"`
+	LanguageSkills    *[]LanguageSkill `json:"language_skills"`
+	Residence         *string          `json:"residence"`
+	Comment           *string          `json:"comment"`
+	AvatarURL         *string          `json:"avatar_url"`
+	// The user's interests with their levels; replaces the current ones
+	Interests *[]InterestPreference `json:"interests"`
+	// Like interests, keeping the levels of interests the user already has
+	InterestIDs *[]int `json:"interest_ids"`
+}
+
+// FieldError is what's wrong with one field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is the body of a 400 response to a request with invalid fields
+type ValidationError struct {
+	Message string       `json:"message"`
+	Errors  []FieldError `json:"errors"`
 }
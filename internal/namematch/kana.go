@@ -0,0 +1,90 @@
+package namematch
+
+import "strings"
+
+// Hepburn romaji of each hiragana. Katakana are converted to hiragana first.
+var kanaRomaji = map[rune]string{
+	'あ': "a", 'い': "i", 'う': "u", 'え': "e", 'お': "o",
+	'か': "ka", 'き': "ki", 'く': "ku", 'け': "ke", 'こ': "ko",
+	'さ': "sa", 'し': "shi", 'す': "su", 'せ': "se", 'そ': "so",
+	'た': "ta", 'ち': "chi", 'つ': "tsu", 'て': "te", 'と': "to",
+	'な': "na", 'に': "ni", 'ぬ': "nu", 'ね': "ne", 'の': "no",
+	'は': "ha", 'ひ': "hi", 'ふ': "fu", 'へ': "he", 'ほ': "ho",
+	'ま': "ma", 'み': "mi", 'む': "mu", 'め': "me", 'も': "mo",
+	'や': "ya", 'ゆ': "yu", 'よ': "yo",
+	'ら': "ra", 'り': "ri", 'る': "ru", 'れ': "re", 'ろ': "ro",
+	'わ': "wa", 'ゐ': "i", 'ゑ': "e", 'を': "o", 'ん': "n",
+	'が': "ga", 'ぎ': "gi", 'ぐ': "gu", 'げ': "ge", 'ご': "go",
+	'ざ': "za", 'じ': "ji", 'ず': "zu", 'ぜ': "ze", 'ぞ': "zo",
+	'だ': "da", 'ぢ': "ji", 'づ': "zu", 'で': "de", 'ど': "do",
+	'ば': "ba", 'び': "bi", 'ぶ': "bu", 'べ': "be", 'ぼ': "bo",
+	'ぱ': "pa", 'ぴ': "pi", 'ぷ': "pu", 'ぺ': "pe", 'ぽ': "po",
+	'ゔ': "vu",
+	'ぁ': "a", 'ぃ': "i", 'ぅ': "u", 'ぇ': "e", 'ぉ': "o",
+	'ゃ': "ya", 'ゅ': "yu", 'ょ': "yo", 'ゎ': "wa",
+}
+
+// Small kana that change the vowel of the kana before them (ファ is "fa", ティ "ti")
+var smallVowels = map[rune]string{'ぁ': "a", 'ぃ': "i", 'ぅ': "u", 'ぇ': "e", 'ぉ': "o"}
+
+// Small ya, yu and yo, which make a contracted sound with the i-row kana before them
+var smallY = map[rune]string{'ゃ': "a", 'ゅ': "u", 'ょ': "o"}
+
+func toHiragana(r rune) rune {
+	if r >= 'ァ' && r <= 'ヶ' {
+		return r - 0x60
+	}
+	return r
+}
+
+// romanizeKana replaces the kana in s with Hepburn romaji. Other characters are kept.
+// The long vowel mark is dropped: long and short vowels compare equal anyway.
+func romanizeKana(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	// Romaji of the last kana, still to be written: the next small kana may change it
+	pending := ""
+	geminate := false
+	flush := func() {
+		if geminate && pending != "" {
+			b.WriteByte(pending[0])
+		}
+		b.WriteString(pending)
+		pending, geminate = "", false
+	}
+
+	for _, r := range runes {
+		h := toHiragana(r)
+		if vowel, ok := smallY[h]; ok && strings.HasSuffix(pending, "i") && len(pending) > 1 {
+			base := strings.TrimSuffix(pending, "i")
+			if base == "sh" || base == "ch" || base == "j" {
+				pending = base + vowel
+			} else {
+				pending = base + "y" + vowel
+			}
+			continue
+		}
+		if vowel, ok := smallVowels[h]; ok && len(pending) > 1 {
+			pending = pending[:len(pending)-1] + vowel
+			continue
+		}
+		if h == 'っ' {
+			flush()
+			geminate = true
+			continue
+		}
+		if h == 'ー' {
+			continue
+		}
+		if romaji, ok := kanaRomaji[h]; ok {
+			g := geminate
+			flush()
+			pending, geminate = romaji, g
+			continue
+		}
+		flush()
+		b.WriteRune(r)
+	}
+	flush()
+	return b.String()
+}
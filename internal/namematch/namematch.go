@@ -0,0 +1,160 @@
+// Package namematch finds interest names that are the same despite how they are
+// written: case, full- and half-width characters, hiragana, katakana and romaji (Hepburn
+// or Kunrei spellings, long vowels with or without macrons), spacing and punctuation.
+// Names in different languages only match through an interest's localized names.
+package namematch
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// DefaultThreshold is the similarity from which two names are reported as likely the same.
+const DefaultThreshold = 0.8
+
+// Keys shorter than this only match exactly: a single typo in a short name is usually a
+// different word.
+const minFuzzyRunes = 4
+
+// Key returns the form names are compared in. Names with the same key are the same.
+func Key(name string) string {
+	s := strings.ToLower(norm.NFKC.String(name))
+	s = romanizeKana(s)
+
+	var b strings.Builder
+	for _, r := range s {
+		if folded, ok := macrons[r]; ok {
+			r = folded
+		}
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			b.WriteRune(r)
+		}
+	}
+	s = b.String()
+	s = spellings.Replace(s)
+	return collapseRepeats(s)
+}
+
+// Similarity rates how alike two names are, from 0 to 1 (same key).
+func Similarity(a, b string) float64 {
+	return keySimilarity(Key(a), Key(b))
+}
+
+func keySimilarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if len(ra) < minFuzzyRunes || len(rb) < minFuzzyRunes {
+		return 0
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// Candidate is an existing interest with every name it is known by.
+type Candidate struct {
+	ID    int
+	Names []string
+}
+
+// Match is an existing interest that a name likely duplicates.
+type Match struct {
+	InterestID int `json:"interest_id"`
+	// The name of the interest that matched
+	Name       string  `json:"name"`
+	Similarity float64 `json:"similarity"`
+}
+
+// Find returns the candidates one of names matches with at least threshold
+// similarity, most similar first. Each candidate is reported once, with its closest name.
+func Find(names []string, candidates []Candidate, threshold float64) []Match {
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		if key := Key(name); key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	var matches []Match
+	for _, c := range candidates {
+		best := Match{InterestID: c.ID}
+		for _, name := range c.Names {
+			candidateKey := Key(name)
+			if candidateKey == "" {
+				continue
+			}
+			for _, key := range keys {
+				if sim := keySimilarity(key, candidateKey); sim > best.Similarity {
+					best.Name, best.Similarity = name, sim
+				}
+			}
+		}
+		if best.Similarity >= threshold {
+			matches = append(matches, best)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Similarity > matches[j].Similarity })
+	return matches
+}
+
+var macrons = map[rune]rune{
+	'ā': 'a', 'ī': 'i', 'ū': 'u', 'ē': 'e', 'ō': 'o',
+	'â': 'a', 'î': 'i', 'û': 'u', 'ê': 'e', 'ô': 'o',
+}
+
+// spellings rewrites romaji to one spelling: Hepburn to Kunrei, "m" before b and p
+// to "n", and "ou" to "o". English words are rewritten too, which is harmless as long
+// as both sides of a comparison are.
+var spellings = strings.NewReplacer(
+	"tch", "ty",
+	"cch", "ty",
+	"tsu", "tu",
+	"shi", "si",
+	"chi", "ti",
+	"sh", "sy",
+	"ch", "ty",
+	"fu", "hu",
+	"ji", "zi",
+	"j", "zy",
+	"mb", "nb",
+	"mp", "np",
+	"ou", "o",
+)
+
+// collapseRepeats turns runs of the same rune into one, so long vowels ("aa") and
+// double consonants ("kk") compare equal to the short ones.
+func collapseRepeats(s string) string {
+	var b strings.Builder
+	var last rune = -1
+	for _, r := range s {
+		if r != last {
+			b.WriteRune(r)
+		}
+		last = r
+	}
+	return b.String()
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
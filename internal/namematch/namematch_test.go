@@ -0,0 +1,51 @@
+package namematch
+
+import "testing"
+
+func TestKeyMatchesKanaAndRomajiSpellings(t *testing.T) {
+	same := [][]string{
+		{"ギター", "ぎたー", "gitā", "GITAA", "ｷﾞﾀｰ"},
+		{"抹茶", "抹茶"},
+		{"まっちゃ", "Matcha", "maccha"},
+		{"将棋", "将棋 "},
+		{"しょうぎ", "shogi", "syougi", "Shōgi"},
+		{"ジャズ", "jazu", "zyazu"},
+		{"しんぶん", "shimbun", "Shin-bun"},
+		{"K-POP", "kpop", "Ｋ－ＰＯＰ"},
+	}
+	for _, names := range same {
+		want := Key(names[0])
+		for _, name := range names[1:] {
+			if got := Key(name); got != want {
+				t.Errorf("Key(%q) = %q, want %q like %q", name, got, want, names[0])
+			}
+		}
+	}
+	if Key("ギター") == Key("ピアノ") {
+		t.Error("different names got the same key")
+	}
+}
+
+func TestFind(t *testing.T) {
+	candidates := []Candidate{
+		{ID: 1, Names: []string{"音楽", "Music", "음악"}},
+		{ID: 2, Names: []string{"ボードゲーム", "Board games"}},
+		{ID: 3, Names: []string{"ゲーム", "Games"}},
+	}
+
+	matches := Find([]string{"boardgame"}, candidates, DefaultThreshold)
+	if len(matches) != 1 || matches[0].InterestID != 2 || matches[0].Name != "Board games" {
+		t.Errorf("boardgame: got %+v", matches)
+	}
+	// Across languages through the localized names
+	matches = Find([]string{"음악"}, candidates, DefaultThreshold)
+	if len(matches) != 1 || matches[0].InterestID != 1 || matches[0].Similarity != 1 {
+		t.Errorf("음악: got %+v", matches)
+	}
+	if matches := Find([]string{"ぼーどげーむ"}, candidates, DefaultThreshold); len(matches) != 1 || matches[0].InterestID != 2 {
+		t.Errorf("ぼーどげーむ: got %+v", matches)
+	}
+	if matches := Find([]string{"Gardening"}, candidates, DefaultThreshold); len(matches) != 0 {
+		t.Errorf("Gardening: got %+v", matches)
+	}
+}
@@ -0,0 +1,158 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"meetupr-backend/internal/models"
+)
+
+// DefaultCoalesceWindow is how long chat message pushes are held so that a burst of
+// messages in one chat becomes a single notification.
+const DefaultCoalesceWindow = 15 * time.Second
+
+// SettingsFunc looks up a user's notification settings.
+type SettingsFunc func(userID string) (models.NotificationSettings, error)
+
+// Dispatcher applies users' mute and quiet hours settings and coalesces chat message
+// pushes per chat before handing them to a Notifier.
+type Dispatcher struct {
+	notifier Notifier
+	settings SettingsFunc
+	window   time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	closed  bool
+	pending map[pendingKey]*pendingPush
+	// Tracks pushes being sent so Close can wait for them.
+	sending sync.WaitGroup
+}
+
+type pendingKey struct {
+	userID string
+	chatID int64
+}
+
+type pendingPush struct {
+	latest Notification
+	count  int
+	timer  *time.Timer
+}
+
+// NewDispatcher creates a Dispatcher. settings may be nil, in which case every push is allowed.
+func NewDispatcher(notifier Notifier, settings SettingsFunc, window time.Duration) *Dispatcher {
+	return &Dispatcher{
+		notifier: notifier,
+		settings: settings,
+		window:   window,
+		now:      time.Now,
+		pending:  make(map[pendingKey]*pendingPush),
+	}
+}
+
+// Send delivers n right away, unless the user's settings forbid it.
+func (d *Dispatcher) Send(ctx context.Context, n Notification) {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.sending.Add(1)
+	d.mu.Unlock()
+	defer d.sending.Done()
+
+	d.deliver(ctx, n)
+}
+
+// Message queues a chat message push. Messages for the same user and chat arriving
+// within the coalesce window are sent as one notification carrying the latest message
+// and the number of messages.
+func (d *Dispatcher) Message(n Notification) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return
+	}
+
+	key := pendingKey{userID: n.UserID, chatID: n.ChatID}
+	if p, ok := d.pending[key]; ok {
+		p.latest = n
+		p.count++
+		return
+	}
+	p := &pendingPush{latest: n, count: 1}
+	d.pending[key] = p
+	d.sending.Add(1)
+	p.timer = time.AfterFunc(d.window, func() {
+		defer d.sending.Done()
+		if push, ok := d.take(key, p); ok {
+			d.deliver(context.Background(), push)
+		}
+	})
+}
+
+// Close sends every pending push immediately and waits for in-flight pushes.
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	d.closed = true
+	var flush []Notification
+	for key, p := range d.pending {
+		if p.timer.Stop() {
+			// The timer won't run, so its sending.Add is ours to release
+			d.sending.Done()
+			flush = append(flush, coalesced(p))
+		}
+		delete(d.pending, key)
+	}
+	d.mu.Unlock()
+
+	for _, n := range flush {
+		d.deliver(context.Background(), n)
+	}
+	d.sending.Wait()
+}
+
+// take removes p from the pending set if it is still there.
+func (d *Dispatcher) take(key pendingKey, p *pendingPush) (Notification, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.pending[key] != p {
+		return Notification{}, false
+	}
+	delete(d.pending, key)
+	return coalesced(p), true
+}
+
+// coalesced turns a pending push into the notification that is sent.
+func coalesced(p *pendingPush) Notification {
+	n := p.latest
+	n.Count = p.count
+	if n.Tag == "" {
+		n.Tag = "chat-" + strconv.FormatInt(n.ChatID, 10)
+	}
+	if p.count > 1 {
+		n.Title = fmt.Sprintf("%s (%d)", n.Title, p.count)
+	}
+	return n
+}
+
+// deliver checks the user's settings and hands n to the notifier.
+func (d *Dispatcher) deliver(ctx context.Context, n Notification) {
+	if d.settings != nil {
+		settings, err := d.settings(n.UserID)
+		if err != nil {
+			log.Printf("notify: error getting notification settings for user %s: %v", n.UserID, err)
+		} else if !Allowed(settings, d.now()) {
+			log.Printf("notify: %s push for user %s suppressed by settings", n.Type, n.UserID)
+			return
+		}
+	}
+	if err := d.notifier.Notify(ctx, n); err != nil {
+		log.Printf("notify: error sending %s push to user %s: %v", n.Type, n.UserID, err)
+	}
+}
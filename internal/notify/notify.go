@@ -0,0 +1,103 @@
+// Package notify sends push notifications to users who are not connected.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"meetupr-backend/internal/models"
+)
+
+// Notification types.
+const (
+	TypeChatMessage = "chat_message"
+	TypeMatch       = "match"
+	TypeSavedSearch = "saved_search_match"
+	TypeMeetup      = "meetup_reminder"
+)
+
+// Notification is a push notification for one user. Everything but UserID is sent
+// to the client as JSON for the service worker to display.
+type Notification struct {
+	UserID string `json:"-"`
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+	ChatID int64  `json:"chat_id,omitempty"`
+	// Number of messages folded into this notification
+	Count int `json:"count,omitempty"`
+	// Tag lets the client (and the push service) replace an earlier notification
+	Tag string `json:"tag,omitempty"`
+}
+
+// Notifier delivers a notification to all of a user's registered devices.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// DefaultTimeZone is used for quiet hours when a user hasn't set a time zone.
+const DefaultTimeZone = "Asia/Tokyo"
+
+// ValidateSettings checks the quiet hours and time zone of s.
+func ValidateSettings(s models.NotificationSettings) error {
+	if (s.QuietHoursStart == "") != (s.QuietHoursEnd == "") {
+		return fmt.Errorf("quiet_hours_start and quiet_hours_end must be set together")
+	}
+	for _, value := range []string{s.QuietHoursStart, s.QuietHoursEnd} {
+		if value == "" {
+			continue
+		}
+		if _, err := parseClock(value); err != nil {
+			return fmt.Errorf("invalid quiet hours %q, expected HH:MM", value)
+		}
+	}
+	if s.TimeZone != "" {
+		if _, err := time.LoadLocation(s.TimeZone); err != nil {
+			return fmt.Errorf("invalid time_zone %q", s.TimeZone)
+		}
+	}
+	return nil
+}
+
+// Allowed reports whether a push may be sent at t under settings s.
+func Allowed(s models.NotificationSettings, t time.Time) bool {
+	if s.Muted {
+		return false
+	}
+	if s.QuietHoursStart == "" || s.QuietHoursEnd == "" {
+		return true
+	}
+	start, err1 := parseClock(s.QuietHoursStart)
+	end, err2 := parseClock(s.QuietHoursEnd)
+	if err1 != nil || err2 != nil || start == end {
+		return true
+	}
+
+	zone := s.TimeZone
+	if zone == "" {
+		zone = DefaultTimeZone
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := t.In(loc)
+	now := local.Hour()*60 + local.Minute()
+
+	if start < end {
+		return now < start || now >= end
+	}
+	// Quiet hours span midnight, e.g. 22:00-07:00
+	return now < start && now >= end
+}
+
+// parseClock converts "HH:MM" (or "HH:MM:SS" as stored by Postgres) to minutes after midnight.
+func parseClock(value string) (int, error) {
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Hour()*60 + t.Minute(), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid time of day %q", value)
+}
@@ -0,0 +1,214 @@
+package notify
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"meetupr-backend/internal/models"
+)
+
+func TestAllowed(t *testing.T) {
+	// 23:30 and 12:00 in Tokyo
+	night := time.Date(2026, 4, 1, 14, 30, 0, 0, time.UTC)
+	noon := time.Date(2026, 4, 1, 3, 0, 0, 0, time.UTC)
+
+	overnight := models.NotificationSettings{QuietHoursStart: "22:00", QuietHoursEnd: "07:00", TimeZone: "Asia/Tokyo"}
+	daytime := models.NotificationSettings{QuietHoursStart: "09:00", QuietHoursEnd: "17:00:00"}
+
+	for _, tc := range []struct {
+		name     string
+		settings models.NotificationSettings
+		at       time.Time
+		want     bool
+	}{
+		{"no settings", models.NotificationSettings{}, night, true},
+		{"muted", models.NotificationSettings{Muted: true}, noon, false},
+		{"inside overnight quiet hours", overnight, night, false},
+		{"outside overnight quiet hours", overnight, noon, true},
+		{"inside daytime quiet hours (default zone)", daytime, noon, false},
+		{"outside daytime quiet hours", daytime, night, true},
+	} {
+		if got := Allowed(tc.settings, tc.at); got != tc.want {
+			t.Errorf("%s: Allowed = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestDispatcherCoalescesPerChat(t *testing.T) {
+	recorder := &Recorder{}
+	d := NewDispatcher(recorder, nil, 50*time.Millisecond)
+
+	for _, body := range []string{"one", "two", "three"} {
+		d.Message(Notification{UserID: "user1", Type: TypeChatMessage, Title: "New message", Body: body, ChatID: 1})
+	}
+	d.Message(Notification{UserID: "user1", Type: TypeChatMessage, Title: "New message", Body: "other chat", ChatID: 2})
+	d.Message(Notification{UserID: "user2", Type: TypeChatMessage, Title: "New message", Body: "other user", ChatID: 1})
+
+	time.Sleep(150 * time.Millisecond)
+	sent := recorder.Sent()
+	if len(sent) != 3 {
+		t.Fatalf("got %d notifications, want 3: %+v", len(sent), sent)
+	}
+	for _, n := range sent {
+		if n.UserID == "user1" && n.ChatID == 1 {
+			if n.Count != 3 || n.Body != "three" || n.Tag != "chat-1" {
+				t.Errorf("unexpected coalesced notification: %+v", n)
+			}
+		} else if n.Count != 1 {
+			t.Errorf("unexpected notification: %+v", n)
+		}
+	}
+}
+
+func TestDispatcherRespectsSettingsAndFlushesOnClose(t *testing.T) {
+	recorder := &Recorder{}
+	settings := func(userID string) (models.NotificationSettings, error) {
+		return models.NotificationSettings{Muted: userID == "muted"}, nil
+	}
+	d := NewDispatcher(recorder, settings, time.Hour)
+
+	d.Message(Notification{UserID: "muted", Type: TypeChatMessage, ChatID: 1})
+	d.Message(Notification{UserID: "user1", Type: TypeChatMessage, ChatID: 1})
+	d.Send(context.Background(), Notification{UserID: "muted", Type: TypeMatch})
+
+	// Pending pushes go out on Close without waiting for the window
+	d.Close()
+	sent := recorder.Sent()
+	if len(sent) != 1 || sent[0].UserID != "user1" {
+		t.Errorf("got %+v, want only user1's push", sent)
+	}
+}
+
+// newSubscription creates a browser-side key pair and returns it with its subscription.
+func newSubscription(t *testing.T, endpoint string) (*ecdh.PrivateKey, []byte, models.PushSubscription) {
+	t.Helper()
+	uaPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authSecret := make([]byte, 16)
+	rand.Read(authSecret)
+	var sub models.PushSubscription
+	sub.Endpoint = endpoint
+	sub.Keys.P256dh = base64.RawURLEncoding.EncodeToString(uaPrivate.PublicKey().Bytes())
+	sub.Keys.Auth = base64.RawURLEncoding.EncodeToString(authSecret)
+	return uaPrivate, authSecret, sub
+}
+
+// decryptPayload is the user agent's side of RFC 8291.
+func decryptPayload(t *testing.T, uaPrivate *ecdh.PrivateKey, authSecret, body []byte) []byte {
+	t.Helper()
+	salt := body[:16]
+	if rs := binary.BigEndian.Uint32(body[16:20]); rs != recordSize {
+		t.Fatalf("record size = %d", rs)
+	}
+	keyLen := int(body[20])
+	asPublicBytes := body[21 : 21+keyLen]
+	asPublic, err := ecdh.P256().NewPublicKey(asPublicBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sharedSecret, err := uaPrivate.ECDH(asPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cek, nonce, err := deriveContentKeys(sharedSecret, authSecret, salt, uaPrivate.PublicKey().Bytes(), asPublicBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	plaintext, err := gcm.Open(nil, nonce, body[21+keyLen:], nil)
+	if err != nil {
+		t.Fatalf("decrypt failed: %v", err)
+	}
+	if plaintext[len(plaintext)-1] != 0x02 {
+		t.Fatalf("missing last record delimiter")
+	}
+	return plaintext[:len(plaintext)-1]
+}
+
+func newVAPIDKeys(t *testing.T) (publicKey, privateKey string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := key.Bytes()
+	public, _ := key.PublicKey.Bytes()
+	return base64.RawURLEncoding.EncodeToString(public), base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func TestWebPushSendsEncryptedPayload(t *testing.T) {
+	var gotBody []byte
+	var gotHeader http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header
+		gotBody, _ = io.ReadAll(r.Body)
+		if strings.HasSuffix(r.URL.Path, "/gone") {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	uaPrivate, authSecret, sub := newSubscription(t, server.URL+"/push/abc")
+	_, _, goneSub := newSubscription(t, server.URL+"/push/gone")
+	var removed []string
+
+	publicKey, privateKey := newVAPIDKeys(t)
+	webPush, err := NewWebPush(WebPushConfig{
+		PublicKey:  publicKey,
+		PrivateKey: privateKey,
+		Subject:    "mailto:admin@example.com",
+		Subscriptions: func(userID string) ([]models.PushSubscription, error) {
+			return []models.PushSubscription{sub}, nil
+		},
+		RemoveSubscription: func(endpoint string) error {
+			removed = append(removed, endpoint)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewWebPush failed: %v", err)
+	}
+
+	n := Notification{UserID: "user1", Type: TypeChatMessage, Title: "New message", Body: "こんにちは", ChatID: 3, Tag: "chat-3"}
+	if err := webPush.Notify(context.Background(), n); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	if got := string(decryptPayload(t, uaPrivate, authSecret, gotBody)); !strings.Contains(got, `"body":"こんにちは"`) {
+		t.Errorf("decrypted payload = %s", got)
+	}
+	if gotHeader.Get("Content-Encoding") != "aes128gcm" || gotHeader.Get("Topic") != "chat-3" {
+		t.Errorf("unexpected headers: %v", gotHeader)
+	}
+	if auth := gotHeader.Get("Authorization"); !strings.HasPrefix(auth, "vapid t=") || !strings.HasSuffix(auth, ", k="+publicKey) {
+		t.Errorf("unexpected Authorization header: %q", auth)
+	}
+
+	// Expired subscriptions are removed
+	webPush.config.Subscriptions = func(string) ([]models.PushSubscription, error) {
+		return []models.PushSubscription{goneSub}, nil
+	}
+	if err := webPush.Notify(context.Background(), n); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	if len(removed) != 1 || removed[0] != goneSub.Endpoint {
+		t.Errorf("removed = %v, want the gone subscription", removed)
+	}
+}
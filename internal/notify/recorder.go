@@ -0,0 +1,28 @@
+package notify
+
+import (
+	"context"
+	"sync"
+)
+
+// Recorder is a Notifier that keeps notifications in memory instead of sending them.
+// It is meant for tests.
+type Recorder struct {
+	mu   sync.Mutex
+	sent []Notification
+}
+
+// Notify records n.
+func (r *Recorder) Notify(ctx context.Context, n Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = append(r.sent, n)
+	return nil
+}
+
+// Sent returns the notifications recorded so far.
+func (r *Recorder) Sent() []Notification {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Notification(nil), r.sent...)
+}
@@ -0,0 +1,259 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"meetupr-backend/internal/models"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// How long the push service keeps a notification for an unreachable device.
+	pushTTL = 24 * time.Hour
+	// Record size advertised in the aes128gcm header (RFC 8188).
+	recordSize = 4096
+	// Push services reject payloads larger than this.
+	maxPayloadSize = 3993
+)
+
+// WebPushConfig configures a WebPush notifier.
+type WebPushConfig struct {
+	// VAPID key pair, base64url encoded: the uncompressed P-256 public key and the raw
+	// private scalar (as generated by `npx web-push generate-vapid-keys`).
+	PublicKey  string
+	PrivateKey string
+	// Contact for the push service, e.g. "mailto:admin@example.com".
+	Subject string
+	// Subscriptions returns a user's registered subscriptions.
+	Subscriptions func(userID string) ([]models.PushSubscription, error)
+	// RemoveSubscription deletes a subscription the push service reported as gone.
+	RemoveSubscription func(endpoint string) error
+}
+
+// WebPush sends notifications with the Web Push protocol (RFC 8030), encrypting
+// payloads per RFC 8291 and authenticating with VAPID (RFC 8292).
+type WebPush struct {
+	config     WebPushConfig
+	privateKey *ecdsa.PrivateKey
+	client     *http.Client
+}
+
+// NewWebPush validates the VAPID keys and creates a WebPush notifier.
+func NewWebPush(config WebPushConfig) (*WebPush, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(config.PrivateKey, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %v", err)
+	}
+	privateKey, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %v", err)
+	}
+	publicKey, err := privateKey.PublicKey.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if encoded := base64.RawURLEncoding.EncodeToString(publicKey); encoded != strings.TrimRight(config.PublicKey, "=") {
+		return nil, errors.New("VAPID public key does not match the private key")
+	}
+	if config.Subject == "" {
+		return nil, errors.New("VAPID subject is required")
+	}
+	return &WebPush{
+		config:     config,
+		privateKey: privateKey,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Notify sends n to every subscription of the user. Subscriptions the push service
+// reports as expired are removed.
+func (w *WebPush) Notify(ctx context.Context, n Notification) error {
+	subscriptions, err := w.config.Subscriptions(n.UserID)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxPayloadSize {
+		return fmt.Errorf("push payload too large (%d bytes)", len(payload))
+	}
+
+	var errs []error
+	for _, sub := range subscriptions {
+		if err := w.send(ctx, sub, payload, n.Tag); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// send encrypts payload for one subscription and posts it to the push service.
+func (w *WebPush) send(ctx context.Context, sub models.PushSubscription, payload []byte, topic string) error {
+	body, err := encryptPayload(sub, payload)
+	if err != nil {
+		return err
+	}
+	authorization, err := w.vapidAuthorization(sub.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(pushTTL.Seconds())))
+	req.Header.Set("Urgency", "normal")
+	req.Header.Set("Authorization", authorization)
+	if topic != "" {
+		// A newer message with the same topic replaces an undelivered one
+		req.Header.Set("Topic", topic)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		log.Printf("notify: push subscription expired, removing %s", sub.Endpoint)
+		if w.config.RemoveSubscription != nil {
+			return w.config.RemoveSubscription(sub.Endpoint)
+		}
+		return nil
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("push service returned %s", resp.Status)
+	}
+	return nil
+}
+
+// vapidAuthorization builds the VAPID Authorization header for an endpoint's origin.
+func (w *WebPush) vapidAuthorization(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid push endpoint: %v", err)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(12 * time.Hour).Unix(),
+		"sub": w.config.Subject,
+	})
+	signed, err := token.SignedString(w.privateKey)
+	if err != nil {
+		return "", err
+	}
+	return "vapid t=" + signed + ", k=" + strings.TrimRight(w.config.PublicKey, "="), nil
+}
+
+// encryptPayload encrypts payload for a subscription using aes128gcm content coding
+// with the key derivation from RFC 8291, as a single record.
+func encryptPayload(sub models.PushSubscription, payload []byte) ([]byte, error) {
+	uaPublicBytes, err := decodeKey(sub.Keys.P256dh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %v", err)
+	}
+	authSecret, err := decodeKey(sub.Keys.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth secret: %v", err)
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %v", err)
+	}
+
+	// Fresh application server key pair and salt for every message
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	sharedSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	cek, nonce, err := deriveContentKeys(sharedSecret, authSecret, salt, uaPublicBytes, asPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// 0x02 marks the last (and only) record; no padding
+	plaintext := append(append([]byte{}, payload...), 0x02)
+
+	header := make([]byte, 0, 16+4+1+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, recordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+// deriveContentKeys derives the content encryption key and nonce (RFC 8291 section 3.4).
+func deriveContentKeys(sharedSecret, authSecret, salt, uaPublic, asPublic []byte) (cek, nonce []byte, err error) {
+	prkKey, err := hkdf.Extract(sha256.New, sharedSecret, authSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyInfo := "WebPush: info\x00" + string(uaPublic) + string(asPublic)
+	ikm, err := hkdf.Expand(sha256.New, prkKey, keyInfo, 32)
+	if err != nil {
+		return nil, nil, err
+	}
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cek, err = hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16); err != nil {
+		return nil, nil, err
+	}
+	if nonce, err = hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12); err != nil {
+		return nil, nil, err
+	}
+	return cek, nonce, nil
+}
+
+// decodeKey decodes a base64url key as sent by browsers, with or without padding.
+func decodeKey(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
@@ -0,0 +1,94 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryBroker is an in-process Broker. It is used when no external backplane is
+// configured and by tests that run several Hubs in one process.
+type MemoryBroker struct {
+	mu     sync.RWMutex
+	topics map[string]map[*subscription]bool
+}
+
+// NewMemoryBroker creates an empty in-process broker.
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		topics: make(map[string]map[*subscription]bool),
+	}
+}
+
+// Publish queues payload for every subscriber of topic, waiting while a subscriber's
+// queue is full until ctx is done.
+func (b *MemoryBroker) Publish(ctx context.Context, topic string, payload []byte) error {
+	// Copy the subscribers so that a slow one doesn't hold the lock and block Subscribe
+	b.mu.RLock()
+	subs := make([]*subscription, 0, len(b.topics[topic]))
+	for sub := range b.topics[topic] {
+		subs = append(subs, sub)
+	}
+	b.mu.RUnlock()
+
+	for _, sub := range subs {
+		select {
+		case sub.queue <- payload:
+		case <-sub.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// PublishBatch publishes each message in turn.
+func (b *MemoryBroker) PublishBatch(ctx context.Context, messages []Message) error {
+	for _, m := range messages {
+		if err := b.Publish(ctx, m.Topic, m.Payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Subscribe registers handler for topic and starts its delivery goroutine.
+func (b *MemoryBroker) Subscribe(topic string, handler func([]byte)) (func(), error) {
+	sub := newSubscription(handler)
+
+	b.mu.Lock()
+	if b.topics[topic] == nil {
+		b.topics[topic] = make(map[*subscription]bool)
+	}
+	b.topics[topic][sub] = true
+	b.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			// Close may already have removed (and stopped) the subscription
+			if subs := b.topics[topic]; subs != nil && subs[sub] {
+				delete(subs, sub)
+				if len(subs) == 0 {
+					delete(b.topics, topic)
+				}
+				sub.stop()
+			}
+		})
+	}
+	return unsubscribe, nil
+}
+
+// Close removes all subscriptions.
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for topic, subs := range b.topics {
+		for sub := range subs {
+			sub.stop()
+		}
+		delete(b.topics, topic)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package pubsub
+
+import (
+	"context"
+	"strconv"
+)
+
+// Broker fans out payloads published on a topic to every subscriber of that topic.
+// Implementations that span processes (Redis) let any server instance deliver to any
+// connected client.
+type Broker interface {
+	// Publish sends payload to all current subscribers of topic.
+	Publish(ctx context.Context, topic string, payload []byte) error
+	// PublishBatch publishes several messages at once, in order, sparing a round trip per
+	// message where the backend allows it.
+	PublishBatch(ctx context.Context, messages []Message) error
+	// Subscribe registers handler for topic. Handlers for one subscription are called
+	// sequentially and must not block for long. The returned func removes the subscription.
+	Subscribe(topic string, handler func(payload []byte)) (unsubscribe func(), err error)
+	// Close releases the broker's resources.
+	Close() error
+}
+
+// Message is a payload to publish on a topic.
+type Message struct {
+	Topic   string
+	Payload []byte
+}
+
+// AnnouncementTopic is the topic that announcements for every connected user are published on.
+const AnnouncementTopic = "announcements"
+
+// ChatMembersTopic is the topic that changes to the members of chat rooms are published on.
+const ChatMembersTopic = "chat_members"
+
+// ChatTopic returns the topic that messages for a chat room are published on.
+func ChatTopic(chatID int64) string {
+	return "chat:" + strconv.FormatInt(chatID, 10)
+}
+
+// UserTopic returns the topic that events for all of a user's devices are published on.
+func UserTopic(userID string) string {
+	return "user:" + userID
+}
@@ -0,0 +1,139 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// channelPrefix namespaces Redis channels so the backplane can share a Redis instance.
+const channelPrefix = "meetupr:"
+
+// RedisBroker is a Broker backed by Redis PUBLISH/SUBSCRIBE. All subscriptions of one
+// instance share a single Redis connection; each subscription has its own queue and
+// goroutine, so a slow handler doesn't hold up the others. A message for a subscription
+// whose queue is full is dropped, since waiting would stall the shared connection.
+type RedisBroker struct {
+	client *redis.Client
+	pubsub *redis.PubSub
+
+	mu   sync.Mutex
+	subs map[string]map[*subscription]bool
+}
+
+// NewRedisBroker connects to the Redis server at redisURL (redis://...) and starts
+// dispatching received messages.
+func NewRedisBroker(redisURL string) (*RedisBroker, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %v", err)
+	}
+	client := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %v", err)
+	}
+
+	b := &RedisBroker{
+		client: client,
+		pubsub: client.Subscribe(context.Background()),
+		subs:   make(map[string]map[*subscription]bool),
+	}
+	go b.dispatch()
+	return b, nil
+}
+
+func (b *RedisBroker) dispatch() {
+	for msg := range b.pubsub.Channel() {
+		topic := strings.TrimPrefix(msg.Channel, channelPrefix)
+		payload := []byte(msg.Payload)
+
+		b.mu.Lock()
+		for sub := range b.subs[topic] {
+			if !sub.offer(payload) {
+				log.Printf("RedisBroker: subscriber queue for %s is full, dropping message", topic)
+			}
+		}
+		b.mu.Unlock()
+	}
+}
+
+// Publish publishes payload on the Redis channel for topic.
+func (b *RedisBroker) Publish(ctx context.Context, topic string, payload []byte) error {
+	return b.client.Publish(ctx, channelPrefix+topic, payload).Err()
+}
+
+// PublishBatch publishes the messages in a single pipeline.
+func (b *RedisBroker) PublishBatch(ctx context.Context, messages []Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	_, err := b.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, m := range messages {
+			pipe.Publish(ctx, channelPrefix+m.Topic, m.Payload)
+		}
+		return nil
+	})
+	return err
+}
+
+// Subscribe registers handler for topic, subscribing to the Redis channel on first use.
+func (b *RedisBroker) Subscribe(topic string, handler func([]byte)) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subs[topic] == nil {
+		if err := b.pubsub.Subscribe(context.Background(), channelPrefix+topic); err != nil {
+			return nil, err
+		}
+		b.subs[topic] = make(map[*subscription]bool)
+	}
+	sub := newSubscription(handler)
+	b.subs[topic][sub] = true
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			// Close may already have removed (and stopped) the subscription
+			subs := b.subs[topic]
+			if subs == nil || !subs[sub] {
+				return
+			}
+			delete(subs, sub)
+			sub.stop()
+			if len(subs) == 0 {
+				delete(b.subs, topic)
+				if err := b.pubsub.Unsubscribe(context.Background(), channelPrefix+topic); err != nil {
+					log.Printf("RedisBroker: failed to unsubscribe from %s: %v", topic, err)
+				}
+			}
+		})
+	}
+	return unsubscribe, nil
+}
+
+// Close stops every subscription and closes the subscription connection and the client.
+func (b *RedisBroker) Close() error {
+	b.mu.Lock()
+	for topic, subs := range b.subs {
+		for sub := range subs {
+			sub.stop()
+		}
+		delete(b.subs, topic)
+	}
+	b.mu.Unlock()
+	if err := b.pubsub.Close(); err != nil {
+		log.Printf("RedisBroker: error closing pubsub: %v", err)
+	}
+	return b.client.Close()
+}
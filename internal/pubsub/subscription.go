@@ -0,0 +1,49 @@
+package pubsub
+
+// subscriptionBuffer is how many undelivered payloads a subscriber may have queued.
+const subscriptionBuffer = 256
+
+// subscription delivers payloads to a handler on its own goroutine, so a slow handler
+// only delays its own subscription.
+type subscription struct {
+	queue   chan []byte
+	done    chan struct{}
+	handler func([]byte)
+}
+
+// newSubscription creates a subscription and starts its delivery goroutine.
+func newSubscription(handler func([]byte)) *subscription {
+	sub := &subscription{
+		queue:   make(chan []byte, subscriptionBuffer),
+		done:    make(chan struct{}),
+		handler: handler,
+	}
+	go func() {
+		for {
+			select {
+			case payload := <-sub.queue:
+				sub.handler(payload)
+			case <-sub.done:
+				return
+			}
+		}
+	}()
+	return sub
+}
+
+// offer queues payload without waiting. It reports false if the queue is full.
+func (s *subscription) offer(payload []byte) bool {
+	select {
+	case s.queue <- payload:
+		return true
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// stop ends delivery; queued payloads are dropped. It must be called once.
+func (s *subscription) stop() {
+	close(s.done)
+}
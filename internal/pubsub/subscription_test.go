@@ -0,0 +1,41 @@
+package pubsub
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscriptionDropsWhenFull(t *testing.T) {
+	release := make(chan struct{})
+	delivered := make(chan []byte, subscriptionBuffer+1)
+	slow := newSubscription(func(payload []byte) {
+		<-release
+		delivered <- payload
+	})
+	defer slow.stop()
+
+	// One payload is being handled, subscriptionBuffer more fit in the queue
+	accepted := 0
+	for i := 0; i < subscriptionBuffer+10; i++ {
+		if slow.offer([]byte{byte(i)}) {
+			accepted++
+		}
+	}
+	if accepted < subscriptionBuffer || accepted > subscriptionBuffer+1 {
+		t.Errorf("accepted %d payloads, want the queue size", accepted)
+	}
+
+	// Another subscription is not held up by the slow one
+	fast := make(chan []byte, 1)
+	other := newSubscription(func(payload []byte) { fast <- payload })
+	defer other.stop()
+	if !other.offer([]byte("hi")) {
+		t.Fatal("empty queue refused a payload")
+	}
+	select {
+	case <-fast:
+	case <-time.After(time.Second):
+		t.Fatal("payload not delivered while another subscription is blocked")
+	}
+	close(release)
+}
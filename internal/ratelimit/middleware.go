@@ -0,0 +1,34 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Middleware enforces the limiter per user_id (set by auth.EchoJWTMiddleware, so it must be
+// registered after it) and reports the bucket state through X-RateLimit-* headers.
+func Middleware(l *Limiter) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key, ok := c.Get("user_id").(string)
+			if !ok || key == "" {
+				key = "ip:" + c.RealIP()
+			}
+
+			res := l.Allow(key)
+			header := c.Response().Header()
+			header.Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+			header.Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			header.Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(res.Reset.Seconds()))))
+
+			if !res.Allowed {
+				header.Set("Retry-After", strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds()))))
+				return echo.NewHTTPError(http.StatusTooManyRequests, "Rate limit exceeded for "+l.policy.Name)
+			}
+			return next(c)
+		}
+	}
+}
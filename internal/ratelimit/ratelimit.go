@@ -0,0 +1,148 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy describes a token bucket: up to Burst requests at once, refilled at Rate tokens per second.
+type Policy struct {
+	Name  string
+	Rate  float64
+	Burst int
+}
+
+// Default policies. Each can be overridden with an environment variable such as
+// RATE_LIMIT_SEARCH=20/1m (20 requests per minute).
+var (
+	Search       = Policy{Name: "search", Rate: 10.0 / 60, Burst: 10}
+	ChatCreation = Policy{Name: "chat_creation", Rate: 20.0 / 60, Burst: 20}
+	MeetRequest  = Policy{Name: "meet_request", Rate: 30.0 / 3600, Burst: 30}
+	Messages     = Policy{Name: "messages", Rate: 5, Burst: 10}
+)
+
+// idleTTL is how long an untouched bucket is kept before it is swept.
+const idleTTL = 10 * time.Minute
+
+// Result is the outcome of a single Allow call.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration // time until the next token (only set when not allowed)
+	Reset      time.Duration // time until the bucket is full again
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter is a set of token buckets keyed by user ID sharing one Policy.
+type Limiter struct {
+	policy    Policy
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// New creates a Limiter for the given policy.
+func New(p Policy) *Limiter {
+	return &Limiter{
+		policy:  p,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Policy returns the policy the limiter enforces.
+func (l *Limiter) Policy() Policy {
+	return l.policy
+}
+
+// Allow consumes one token from key's bucket if available.
+func (l *Limiter) Allow(key string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.policy.Burst), last: now}
+		l.buckets[key] = b
+	} else {
+		elapsed := now.Sub(b.last).Seconds()
+		b.tokens = math.Min(float64(l.policy.Burst), b.tokens+elapsed*l.policy.Rate)
+		b.last = now
+	}
+
+	res := Result{Limit: l.policy.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = l.secondsToDuration((1 - b.tokens) / l.policy.Rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = l.secondsToDuration((float64(l.policy.Burst) - b.tokens) / l.policy.Rate)
+	return res
+}
+
+func (l *Limiter) secondsToDuration(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
+
+// sweep drops buckets that have been idle long enough to be full again.
+// Must be called with l.mu held.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < idleTTL {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > idleTTL {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// ParsePolicy parses a "<count>/<period>" string such as "10/1m" or "5/1s".
+// The count is used both as the burst size and as the refill amount per period.
+func ParsePolicy(name, s string) (Policy, error) {
+	countStr, periodStr, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return Policy{}, fmt.Errorf("invalid rate limit %q: expected <count>/<period>", s)
+	}
+	count, err := strconv.Atoi(countStr)
+	if err != nil || count <= 0 {
+		return Policy{}, fmt.Errorf("invalid rate limit count %q", countStr)
+	}
+	period, err := time.ParseDuration(periodStr)
+	if err != nil || period <= 0 {
+		return Policy{}, fmt.Errorf("invalid rate limit period %q", periodStr)
+	}
+	return Policy{Name: name, Rate: float64(count) / period.Seconds(), Burst: count}, nil
+}
+
+// FromEnv returns the policy configured in the given environment variable, or def if unset or invalid.
+func FromEnv(key string, def Policy) Policy {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	p, err := ParsePolicy(def.Name, value)
+	if err != nil {
+		log.Printf("ratelimit: %v, using default for %s", err, def.Name)
+		return def
+	}
+	return p
+}
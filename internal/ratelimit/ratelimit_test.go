@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterRefill(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New(Policy{Name: "test", Rate: 1, Burst: 2})
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if res := l.Allow("user1"); !res.Allowed {
+			t.Fatalf("request %d should be allowed", i)
+		}
+	}
+
+	res := l.Allow("user1")
+	if res.Allowed {
+		t.Fatalf("third request should be throttled")
+	}
+	if res.RetryAfter != time.Second {
+		t.Errorf("RetryAfter: got %v want %v", res.RetryAfter, time.Second)
+	}
+
+	// Other keys have their own bucket
+	if res := l.Allow("user2"); !res.Allowed {
+		t.Errorf("user2 should not be affected by user1's bucket")
+	}
+
+	now = now.Add(time.Second)
+	if res := l.Allow("user1"); !res.Allowed {
+		t.Errorf("request after refill should be allowed")
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("search", "20/1m")
+	if err != nil {
+		t.Fatalf("ParsePolicy failed: %v", err)
+	}
+	if p.Burst != 20 || p.Rate != 20.0/60 {
+		t.Errorf("got %+v", p)
+	}
+
+	for _, bad := range []string{"", "20", "x/1m", "20/x", "0/1m"} {
+		if _, err := ParsePolicy("search", bad); err == nil {
+			t.Errorf("ParsePolicy(%q) should fail", bad)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+// Package recommend ranks other users by how good a conversation partner they would be
+// for the current user, for the "おすすめ" feed.
+package recommend
+
+import (
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"meetupr-backend/internal/languages"
+	"meetupr-backend/internal/models"
+)
+
+// Factors a score is made of.
+const (
+	FactorLanguage = "language"
+	FactorInterest = "interest"
+	FactorMajor    = "major"
+	FactorActivity = "activity"
+	// How much of the candidate's profile is filled in
+	FactorCompleteness = "completeness"
+)
+
+const (
+	// A profile updated this long ago scores half as much for activity.
+	activityHalfLife = 14 * 24 * time.Hour
+	// preference_level used when a user_interests row has none.
+	defaultPreferenceLevel = 1
+	// At most this many shared interests are named in an explanation.
+	maxNamedInterests = 3
+	// Profiles at least this complete get a reason for it.
+	completeProfileScore = 80
+)
+
+// Weights sets how much each factor counts. A factor scores between 0 and 1 before
+// weighting, so a candidate's score is at most the sum of the weights.
+type Weights struct {
+	Language     float64
+	Interest     float64
+	Major        float64
+	Activity     float64
+	Completeness float64
+}
+
+// DefaultWeights favour complementary language pairs, then shared interests.
+var DefaultWeights = Weights{Language: 3, Interest: 2, Major: 1, Activity: 0.5, Completeness: 1}
+
+// WeightsFromEnv returns DefaultWeights with any of RECOMMEND_WEIGHT_LANGUAGE,
+// RECOMMEND_WEIGHT_INTEREST, RECOMMEND_WEIGHT_MAJOR, RECOMMEND_WEIGHT_ACTIVITY and
+// RECOMMEND_WEIGHT_COMPLETENESS applied.
+func WeightsFromEnv() Weights {
+	w := DefaultWeights
+	w.Language = weightFromEnv("RECOMMEND_WEIGHT_LANGUAGE", w.Language)
+	w.Interest = weightFromEnv("RECOMMEND_WEIGHT_INTEREST", w.Interest)
+	w.Major = weightFromEnv("RECOMMEND_WEIGHT_MAJOR", w.Major)
+	w.Activity = weightFromEnv("RECOMMEND_WEIGHT_ACTIVITY", w.Activity)
+	w.Completeness = weightFromEnv("RECOMMEND_WEIGHT_COMPLETENESS", w.Completeness)
+	return w
+}
+
+func weightFromEnv(key string, def float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	w, err := strconv.ParseFloat(value, 64)
+	if err != nil || w < 0 || math.IsInf(w, 0) || math.IsNaN(w) {
+		log.Printf("recommend: invalid %s=%q, using default %v", key, value, def)
+		return def
+	}
+	return w
+}
+
+// Reason is one factor's contribution to a recommendation, with a short explanation
+// in English and Japanese.
+type Reason struct {
+	Factor string  `json:"factor"`
+	Score  float64 `json:"score"`
+	Text   string  `json:"text"`
+	TextJa string  `json:"text_ja"`
+}
+
+// Recommendation is a scored candidate.
+type Recommendation struct {
+	UserID            string   `json:"user_id"`
+	Username          string   `json:"username"`
+	AvatarURL         string   `json:"avatar_url,omitempty"`
+	Major             string   `json:"major,omitempty"`
+	NativeLanguage    string   `json:"native_language,omitempty"`
+	LearningLanguages []string `json:"learning_languages,omitempty"`
+	Score             float64  `json:"score"`
+	Reasons           []Reason `json:"reasons"`
+	// The reasons joined into one sentence, e.g. "you both like anime; Aoi is learning English"
+	Explanation   string `json:"explanation"`
+	ExplanationJa string `json:"explanation_ja"`
+}
+
+// Score rates candidate as a partner for me. Factors that contribute nothing are left
+// out of the reasons.
+func Score(me, candidate models.User, w Weights, now time.Time) Recommendation {
+	rec := Recommendation{
+		UserID:            candidate.ID,
+		Username:          candidate.Username,
+		AvatarURL:         candidate.AvatarURL,
+		Major:             candidate.Major,
+		NativeLanguage:    candidate.NativeLanguage,
+		LearningLanguages: candidate.LearningLanguages,
+		Reasons:           []Reason{},
+	}
+	add := func(factor string, weight, score float64, text, textJa string) {
+		if weight == 0 || score == 0 {
+			return
+		}
+		rec.Score += weight * score
+		rec.Reasons = append(rec.Reasons, Reason{Factor: factor, Score: weight * score, Text: text, TextJa: textJa})
+	}
+
+	// Complementary languages: half for each direction of the exchange
+	teaches := candidate.NativeLanguage != "" && containsFold(me.LearningLanguages, candidate.NativeLanguage)
+	learns := me.NativeLanguage != "" && containsFold(candidate.LearningLanguages, me.NativeLanguage)
+	var languageScore float64
+	var texts, textsJa []string
+	if teaches {
+		languageScore += 0.5
+		texts = append(texts, candidate.Username+" is a native "+languageName(candidate.NativeLanguage, "en")+" speaker")
+		textsJa = append(textsJa, candidate.Username+"さんは"+languageName(candidate.NativeLanguage, "ja")+"のネイティブです")
+	}
+	if learns {
+		languageScore += 0.5
+		texts = append(texts, candidate.Username+" is learning "+languageName(me.NativeLanguage, "en"))
+		textsJa = append(textsJa, candidate.Username+"さんは"+languageName(me.NativeLanguage, "ja")+"を学んでいます")
+	}
+	add(FactorLanguage, w.Language, languageScore, strings.Join(texts, " and "), strings.Join(textsJa, "。"))
+
+	interestScore, shared := sharedInterests(me.Interests, candidate.Interests)
+	if len(shared) > maxNamedInterests {
+		shared = shared[:maxNamedInterests]
+	}
+	add(FactorInterest, w.Interest, interestScore,
+		"you both like "+strings.Join(shared, ", "),
+		"共通の趣味: "+strings.Join(shared, "、"))
+
+	if me.Major != "" && strings.EqualFold(me.Major, candidate.Major) {
+		add(FactorMajor, w.Major, 1, "you both study "+candidate.Major, "同じ専攻（"+candidate.Major+"）です")
+	}
+
+	if !candidate.LastUpdatedAt.IsZero() {
+		age := now.Sub(candidate.LastUpdatedAt)
+		activity := math.Pow(0.5, max(age, 0).Hours()/activityHalfLife.Hours())
+		// Only worth mentioning when it is actually recent
+		if activity >= 0.5 {
+			add(FactorActivity, w.Activity, activity, "recently active", "最近アクティブです")
+		} else {
+			rec.Score += w.Activity * activity
+		}
+	}
+
+	completeness := float64(candidate.Completeness) / 100
+	if candidate.Completeness >= completeProfileScore {
+		add(FactorCompleteness, w.Completeness, completeness, "has a detailed profile", "プロフィールが充実しています")
+	} else {
+		rec.Score += w.Completeness * completeness
+	}
+
+	var parts, partsJa []string
+	for _, r := range rec.Reasons {
+		parts = append(parts, r.Text)
+		partsJa = append(partsJa, r.TextJa)
+	}
+	rec.Explanation = strings.Join(parts, "; ")
+	rec.ExplanationJa = strings.Join(partsJa, "。")
+	return rec
+}
+
+// Rank scores every candidate and returns the best limit of them, highest score first.
+// Candidates with the same score are ordered by user ID so pages are stable.
+func Rank(me models.User, candidates []models.User, w Weights, now time.Time, limit int) []Recommendation {
+	recs := make([]Recommendation, 0, len(candidates))
+	for _, candidate := range candidates {
+		if candidate.ID == me.ID {
+			continue
+		}
+		recs = append(recs, Score(me, candidate, w, now))
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		if recs[i].Score != recs[j].Score {
+			return recs[i].Score > recs[j].Score
+		}
+		return recs[i].UserID < recs[j].UserID
+	})
+	if limit > 0 && len(recs) > limit {
+		recs = recs[:limit]
+	}
+	return recs
+}
+
+// sharedInterests scores the overlap of two users' interests: for each shared interest
+// the lower of the two preference levels, relative to the total of my levels. The shared
+// interest names are returned strongest first.
+func sharedInterests(mine, theirs []models.Interest) (float64, []string) {
+	theirLevels := make(map[int]int, len(theirs))
+	for _, interest := range theirs {
+		theirLevels[interest.ID] = preferenceLevel(interest)
+	}
+
+	type match struct {
+		name  string
+		level int
+	}
+	var total, overlap int
+	var matches []match
+	for _, interest := range mine {
+		level := preferenceLevel(interest)
+		total += level
+		if theirLevel, ok := theirLevels[interest.ID]; ok {
+			shared := min(level, theirLevel)
+			overlap += shared
+			matches = append(matches, match{name: interest.Name, level: shared})
+		}
+	}
+	if total == 0 {
+		return 0, nil
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].level > matches[j].level })
+	names := make([]string, len(matches))
+	for i, m := range matches {
+		names[i] = m.name
+	}
+	return float64(overlap) / float64(total), names
+}
+
+func preferenceLevel(interest models.Interest) int {
+	if interest.PreferenceLevel <= 0 {
+		return defaultPreferenceLevel
+	}
+	return interest.PreferenceLevel
+}
+
+// languageName turns a language code into its name for an explanation.
+func languageName(code, locale string) string {
+	if l, ok := languages.Lookup(strings.ToLower(code)); ok {
+		return l.Name(locale)
+	}
+	return code
+}
+
+func containsFold(values []string, target string) bool {
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSpace(v), strings.TrimSpace(target)) {
+			return true
+		}
+	}
+	return false
+}
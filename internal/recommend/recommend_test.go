@@ -0,0 +1,135 @@
+package recommend
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"meetupr-backend/internal/models"
+)
+
+func TestRankPrefersComplementaryLanguages(t *testing.T) {
+	now := time.Date(2026, 4, 1, 12, 0, 0, 0, time.UTC)
+	anime := models.Interest{ID: 1, Name: "anime", PreferenceLevel: 5}
+	music := models.Interest{ID: 2, Name: "music", PreferenceLevel: 2}
+	me := models.User{
+		ID:                "me",
+		NativeLanguage:    "ja",
+		LearningLanguages: []string{"en"},
+		Major:             "Informatics",
+		Interests:         []models.Interest{anime, music},
+	}
+	candidates := []models.User{
+		{
+			ID:                "partner",
+			Username:          "Alex",
+			NativeLanguage:    "en",
+			LearningLanguages: []string{"ja"},
+			Interests:         []models.Interest{{ID: 1, Name: "anime", PreferenceLevel: 4}},
+		},
+		{
+			// Same major and interests, but no language exchange
+			ID:             "classmate",
+			Username:       "Ken",
+			NativeLanguage: "ja",
+			Major:          "informatics",
+			Interests:      []models.Interest{anime, music},
+			LastUpdatedAt:  now.Add(-time.Hour),
+		},
+		{ID: "me"},
+		{ID: "stranger", Username: "Sam", NativeLanguage: "fr"},
+	}
+
+	recs := Rank(me, candidates, DefaultWeights, now, 2)
+	if len(recs) != 2 {
+		t.Fatalf("got %d recommendations, want 2", len(recs))
+	}
+	if recs[0].UserID != "partner" || recs[1].UserID != "classmate" {
+		t.Fatalf("unexpected order: %s, %s", recs[0].UserID, recs[1].UserID)
+	}
+
+	partner := recs[0]
+	// Full language score plus 4 of my 7 interest levels
+	if want := 3 + 2*4.0/7; partner.Score < want-1e-9 || partner.Score > want+1e-9 {
+		t.Errorf("partner score = %v, want %v", partner.Score, want)
+	}
+	for _, s := range []string{"Alex is a native English speaker", "Alex is learning Japanese", "you both like anime"} {
+		if !strings.Contains(partner.Explanation, s) {
+			t.Errorf("explanation %q does not mention %q", partner.Explanation, s)
+		}
+	}
+}
+
+func TestWeightsFromEnv(t *testing.T) {
+	t.Setenv("RECOMMEND_WEIGHT_MAJOR", "0")
+	t.Setenv("RECOMMEND_WEIGHT_ACTIVITY", "lots")
+
+	w := WeightsFromEnv()
+	if w.Major != 0 {
+		t.Errorf("Major = %v, want 0", w.Major)
+	}
+	if w.Activity != DefaultWeights.Activity || w.Language != DefaultWeights.Language {
+		t.Errorf("invalid or unset weights should keep defaults, got %+v", w)
+	}
+
+	me := models.User{ID: "me", Major: "Law"}
+	rec := Score(me, models.User{ID: "other", Major: "Law"}, w, time.Now())
+	if rec.Score != 0 || len(rec.Reasons) != 0 {
+		t.Errorf("a zero weight should not contribute: %+v", rec)
+	}
+}
+
+func TestScoreCountsCompleteness(t *testing.T) {
+	w := Weights{Completeness: 2}
+	me := models.User{ID: "me"}
+
+	rec := Score(me, models.User{ID: "full", Completeness: 90}, w, time.Now())
+	if rec.Score != 1.8 || len(rec.Reasons) != 1 || rec.Reasons[0].Factor != FactorCompleteness {
+		t.Errorf("complete profile: %+v", rec)
+	}
+	// Counted, but not worth mentioning
+	rec = Score(me, models.User{ID: "sparse", Completeness: 40}, w, time.Now())
+	if rec.Score != 0.8 || len(rec.Reasons) != 0 {
+		t.Errorf("sparse profile: %+v", rec)
+	}
+}
+
+func TestTandemReturnsMutualMatchesByFit(t *testing.T) {
+	q := TandemQuery{Teach: "Japanese", TeachLevel: models.LevelNative, Learn: "English", LearnLevel: models.LevelB1}
+	candidates := []models.User{
+		{
+			ID:                "fluent",
+			NativeLanguage:    "Korean",
+			LearningLanguages: []string{"Japanese"},
+			LanguageSkills:    []models.LanguageSkill{{Language: "English", Level: models.LevelC1}},
+		},
+		{
+			ID:                "native",
+			NativeLanguage:    "English",
+			LearningLanguages: []string{"japanese"},
+			LanguageSkills:    []models.LanguageSkill{{Language: "Japanese", Level: models.LevelB1}},
+		},
+		// Speaks English but isn't learning Japanese
+		{ID: "monolingual", NativeLanguage: "English"},
+		// Learning Japanese, but English isn't good enough to teach
+		{
+			ID:                "learner",
+			NativeLanguage:    "French",
+			LearningLanguages: []string{"Japanese"},
+			LanguageSkills:    []models.LanguageSkill{{Language: "English", Level: models.LevelB2}},
+		},
+	}
+
+	matches := Tandem(q, candidates, 0)
+	if len(matches) != 2 {
+		t.Fatalf("got %d matches, want 2: %+v", len(matches), matches)
+	}
+	best := matches[0]
+	if best.UserID != "native" || best.Fit != 1 || best.Teaches.Level != models.LevelNative || best.Learns.Level != models.LevelB1 {
+		t.Errorf("unexpected best match: %+v", best)
+	}
+	// C1 teacher (1/3) and an A1 learner against my B1 (0.6)
+	if second := matches[1]; second.UserID != "fluent" || second.Learns.Level != models.LevelA1 || second.Fit < 0.466 || second.Fit > 0.467 {
+		t.Errorf("unexpected second match: %+v", second)
+	}
+}
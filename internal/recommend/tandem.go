@@ -0,0 +1,83 @@
+package recommend
+
+import (
+	"math"
+	"sort"
+
+	"meetupr-backend/internal/models"
+)
+
+// TandemQuery is "I teach Teach (at TeachLevel), I learn Learn (currently at LearnLevel)".
+type TandemQuery struct {
+	Teach      string
+	TeachLevel string
+	Learn      string
+	LearnLevel string
+}
+
+// TandemMatch is a language exchange partner: they can teach the language the user is
+// learning and are learning the language the user teaches.
+type TandemMatch struct {
+	UserID    string `json:"user_id"`
+	Username  string `json:"username"`
+	AvatarURL string `json:"avatar_url,omitempty"`
+	// The partner's level in the language they would teach (the user's learning language)
+	Teaches models.LanguageSkill `json:"teaches"`
+	// The partner's level in the language they would learn (the user's teaching language)
+	Learns models.LanguageSkill `json:"learns"`
+	// Fit is between 0 and 1; higher is a better exchange
+	Fit float64 `json:"fit"`
+}
+
+// Tandem returns the candidates that are mutual matches for q, best fit first.
+//
+// A candidate matches when they speak q.Learn at TeachingLevel or above and have q.Teach
+// among their learning languages below the user's TeachLevel. Fit averages how well they
+// speak q.Learn with how close their level in q.Teach is to the user's level in q.Learn,
+// since exchanges work best when both sides are at a similar stage.
+func Tandem(q TandemQuery, candidates []models.User, limit int) []TandemMatch {
+	myLearnRank := max(models.LevelRank(q.LearnLevel), 1)
+	myTeachRank := models.LevelRank(q.TeachLevel)
+	minTeachRank := models.LevelRank(models.TeachingLevel)
+
+	var matches []TandemMatch
+	for _, candidate := range candidates {
+		teachesLevel := candidate.LanguageLevel(q.Learn)
+		teachesRank := models.LevelRank(teachesLevel)
+		if teachesRank < minTeachRank || !candidate.IsLearning(q.Teach) {
+			continue
+		}
+		learnsLevel := candidate.LanguageLevel(q.Teach)
+		if learnsLevel == "" {
+			// Learning it without saying how well: treat as a beginner
+			learnsLevel = models.LevelA1
+		}
+		learnsRank := models.LevelRank(learnsLevel)
+		if learnsRank >= myTeachRank {
+			continue
+		}
+
+		teachFit := float64(teachesRank-minTeachRank+1) / float64(models.MaxLevelRank-minTeachRank+1)
+		// Learner levels span A1 to C2, so the widest gap is 5
+		balance := 1 - math.Abs(float64(learnsRank-myLearnRank))/5
+		matches = append(matches, TandemMatch{
+			UserID:    candidate.ID,
+			Username:  candidate.Username,
+			AvatarURL: candidate.AvatarURL,
+			Teaches:   models.LanguageSkill{Language: q.Learn, Level: teachesLevel},
+			Learns:    models.LanguageSkill{Language: q.Teach, Level: learnsLevel},
+			Fit:       (teachFit + max(balance, 0)) / 2,
+		})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Fit != matches[j].Fit {
+			return matches[i].Fit > matches[j].Fit
+		}
+		return matches[i].UserID < matches[j].UserID
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
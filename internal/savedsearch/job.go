@@ -0,0 +1,202 @@
+// Package savedsearch checks saved searches in the background and tells their owners
+// about users who newly match them.
+package savedsearch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"meetupr-backend/internal/models"
+	"meetupr-backend/internal/search"
+)
+
+// At most this many users are named in an alert; Count has the total.
+const maxAlertUsers = 10
+
+// Audience is what decides which users the owner of a saved search can find, and what
+// of their profiles: the users they blocked or were blocked by, and their privacy view.
+type Audience struct {
+	Blocked map[string]bool
+	Viewer  models.ProfileViewer
+}
+
+// Store provides the saved searches and the users to match them against.
+type Store interface {
+	// AlertingSearches returns the saved searches whose owners want alerts.
+	AlertingSearches() ([]models.SavedSearch, error)
+	// UpdatedUsers returns every user whose profile was created or updated after since,
+	// with nothing left out or redacted.
+	UpdatedUsers(since time.Time) ([]models.User, error)
+	// Audiences returns the Audience of each owner.
+	Audiences(ownerIDs []string) (map[string]Audience, error)
+	// InterestDescendants maps each interest to its sub-interests at any depth.
+	InterestDescendants() (map[int][]int, error)
+	// KnownMatches returns the users the owner was already told match a saved search.
+	KnownMatches(savedSearchID int64) (map[string]bool, error)
+	AddMatches(savedSearchID int64, userIDs []string) error
+	// MarkChecked records when a saved search was last checked.
+	MarkChecked(savedSearchID int64, at time.Time) error
+}
+
+// NotifyFunc tells the owner of a saved search about new matches.
+type NotifyFunc func(ctx context.Context, ownerID string, alert models.SavedSearchAlert) error
+
+// Job looks for new matches of saved searches.
+type Job struct {
+	store  Store
+	notify NotifyFunc
+	now    func() time.Time
+}
+
+// NewJob creates a saved search Job.
+func NewJob(store Store, notify NotifyFunc) *Job {
+	return &Job{store: store, notify: notify, now: time.Now}
+}
+
+// Start runs the job every interval until ctx is done.
+func (j *Job) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := j.Run(ctx); err != nil {
+			log.Printf("savedsearch: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run checks every alerting saved search once.
+func (j *Job) Run(ctx context.Context) error {
+	now := j.now()
+	searches, err := j.store.AlertingSearches()
+	if err != nil {
+		return err
+	}
+	if len(searches) == 0 {
+		return nil
+	}
+	descendants, err := j.store.InterestDescendants()
+	if err != nil {
+		return err
+	}
+
+	// Only users updated since the oldest check can be new matches: they are loaded once
+	// and filtered for each owner here
+	oldest := checkedSince(searches[0])
+	var ownerIDs []string
+	seen := make(map[string]bool)
+	for _, s := range searches {
+		if since := checkedSince(s); since.Before(oldest) {
+			oldest = since
+		}
+		if !seen[s.UserID] {
+			seen[s.UserID] = true
+			ownerIDs = append(ownerIDs, s.UserID)
+		}
+	}
+	users, err := j.store.UpdatedUsers(oldest)
+	if err != nil {
+		return err
+	}
+	audiences, err := j.store.Audiences(ownerIDs)
+	if err != nil {
+		return err
+	}
+
+	// Owners with several saved searches share one candidate list per run
+	candidates := make(map[string][]models.User)
+	var errs []error
+	alerted := 0
+	for _, s := range searches {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if _, ok := candidates[s.UserID]; !ok {
+			candidates[s.UserID] = findable(s.UserID, users, audiences[s.UserID])
+		}
+		ok, err := j.check(ctx, s, candidates[s.UserID], descendants, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("saved search %d: %w", s.ID, err))
+			continue
+		}
+		if ok {
+			alerted++
+		}
+	}
+	if alerted > 0 {
+		log.Printf("savedsearch: sent %d alert(s)", alerted)
+	}
+	return errors.Join(errs...)
+}
+
+// check alerts the owner of s about users who match it, whose profile was created or
+// updated since the last check and who they haven't been told about. It reports whether
+// an alert was sent.
+func (j *Job) check(ctx context.Context, s models.SavedSearch, candidates []models.User, descendants map[int][]int, now time.Time) (bool, error) {
+	var q search.Query
+	if err := json.Unmarshal(s.Query, &q); err != nil {
+		return false, err
+	}
+	if err := q.Normalize(); err != nil {
+		return false, err
+	}
+	q.Limit = 0
+	q.IncludeSubInterests(descendants)
+
+	since := checkedSince(s)
+	known, err := j.store.KnownMatches(s.ID)
+	if err != nil {
+		return false, err
+	}
+	var newIDs []string
+	for _, r := range search.Run(q, candidates, now).Results {
+		if !known[r.ID] && r.LastUpdatedAt.After(since) {
+			newIDs = append(newIDs, r.ID)
+		}
+	}
+
+	if len(newIDs) > 0 {
+		alert := models.SavedSearchAlert{SavedSearchID: s.ID, Name: s.Name, Count: len(newIDs), UserIDs: newIDs}
+		if len(alert.UserIDs) > maxAlertUsers {
+			alert.UserIDs = alert.UserIDs[:maxAlertUsers]
+		}
+		// Notify first: if it fails, the users are still new on the next run
+		if err := j.notify(ctx, s.UserID, alert); err != nil {
+			return false, err
+		}
+		if err := j.store.AddMatches(s.ID, newIDs); err != nil {
+			return true, err
+		}
+	}
+	return len(newIDs) > 0, j.store.MarkChecked(s.ID, now)
+}
+
+// checkedSince returns when s was last checked, or created if it never was.
+func checkedSince(s models.SavedSearch) time.Time {
+	if s.LastCheckedAt != nil {
+		return *s.LastCheckedAt
+	}
+	return s.CreatedAt
+}
+
+// findable returns the users the owner can find in a search, with the fields they may not
+// see cleared, as db.GetSearchCandidates does for a single search.
+func findable(ownerID string, users []models.User, audience Audience) []models.User {
+	found := make([]models.User, 0, len(users))
+	for _, u := range users {
+		if u.ID == ownerID || audience.Blocked[u.ID] || !audience.Viewer.CanFind(u.ID) {
+			continue
+		}
+		audience.Viewer.Redact(&u)
+		found = append(found, u)
+	}
+	return found
+}
@@ -0,0 +1,167 @@
+package savedsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"meetupr-backend/internal/models"
+)
+
+type fakeStore struct {
+	searches   []models.SavedSearch
+	candidates []models.User
+	audiences  map[string]Audience
+	known      map[int64]map[string]bool
+	checked    map[int64]time.Time
+	// Arguments of the last UpdatedUsers call
+	since       time.Time
+	usersLoaded int
+}
+
+func (s *fakeStore) AlertingSearches() ([]models.SavedSearch, error) { return s.searches, nil }
+func (s *fakeStore) UpdatedUsers(since time.Time) ([]models.User, error) {
+	s.since = since
+	s.usersLoaded++
+	var users []models.User
+	for _, u := range s.candidates {
+		if u.LastUpdatedAt.After(since) {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+func (s *fakeStore) Audiences(ownerIDs []string) (map[string]Audience, error) {
+	return s.audiences, nil
+}
+func (s *fakeStore) InterestDescendants() (map[int][]int, error)    { return nil, nil }
+func (s *fakeStore) KnownMatches(id int64) (map[string]bool, error) { return s.known[id], nil }
+func (s *fakeStore) AddMatches(id int64, userIDs []string) error {
+	if s.known[id] == nil {
+		s.known[id] = make(map[string]bool)
+	}
+	for _, userID := range userIDs {
+		s.known[id][userID] = true
+	}
+	return nil
+}
+func (s *fakeStore) MarkChecked(id int64, at time.Time) error {
+	s.checked[id] = at
+	return nil
+}
+
+func TestJobAlertsNewMatchesOnce(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	lastChecked := now.Add(-time.Hour)
+
+	store := &fakeStore{
+		searches: []models.SavedSearch{{
+			ID: 1, UserID: "owner", Name: "Korean speakers", Notify: true,
+			Query:         json.RawMessage(`{"native_languages":["ko"]}`),
+			LastCheckedAt: &lastChecked,
+		}},
+		candidates: []models.User{
+			// Matches but hasn't changed since the last check
+			{ID: "old", NativeLanguage: "ko", LastUpdatedAt: now.Add(-2 * time.Hour)},
+			// Already reported
+			{ID: "known", NativeLanguage: "ko", LastUpdatedAt: now.Add(-time.Minute)},
+			{ID: "new", NativeLanguage: "ko", LastUpdatedAt: now.Add(-time.Minute)},
+			{ID: "other", NativeLanguage: "en", LastUpdatedAt: now.Add(-time.Minute)},
+		},
+		known:   map[int64]map[string]bool{1: {"known": true}},
+		checked: map[int64]time.Time{},
+	}
+	var alerts []models.SavedSearchAlert
+	job := NewJob(store, func(ctx context.Context, ownerID string, alert models.SavedSearchAlert) error {
+		if ownerID != "owner" {
+			t.Errorf("alert sent to %q", ownerID)
+		}
+		alerts = append(alerts, alert)
+		return nil
+	})
+	job.now = func() time.Time { return now }
+
+	if err := job.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 || alerts[0].Count != 1 || alerts[0].UserIDs[0] != "new" || alerts[0].Name != "Korean speakers" {
+		t.Fatalf("alerts = %+v, want one for \"new\"", alerts)
+	}
+	if !store.known[1]["new"] || !store.checked[1].Equal(now) {
+		t.Errorf("match not recorded: known=%v checked=%v", store.known[1], store.checked[1])
+	}
+
+	// Nothing changed, so the next run stays quiet
+	store.searches[0].LastCheckedAt = &now
+	job.now = func() time.Time { return now.Add(15 * time.Minute) }
+	if err := job.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 {
+		t.Errorf("second run sent %d more alert(s)", len(alerts)-1)
+	}
+}
+
+func TestJobLoadsUsersOnceAndFiltersPerOwner(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	hourAgo, dayAgo := now.Add(-time.Hour), now.Add(-24*time.Hour)
+	korean := json.RawMessage(`{"native_languages":["ko"]}`)
+
+	store := &fakeStore{
+		searches: []models.SavedSearch{
+			{ID: 1, UserID: "alice", Name: "a", Notify: true, Query: korean, LastCheckedAt: &hourAgo},
+			{ID: 2, UserID: "bob", Name: "b", Notify: true, Query: korean, LastCheckedAt: &dayAgo},
+			{ID: 3, UserID: "bob", Name: "c", Notify: true, Query: korean, CreatedAt: hourAgo},
+		},
+		candidates: []models.User{
+			{ID: "min", NativeLanguage: "ko", LastUpdatedAt: now.Add(-time.Minute)},
+			{ID: "jin", NativeLanguage: "ko", LastUpdatedAt: now.Add(-2 * time.Hour)},
+			{ID: "hidden", NativeLanguage: "ko", LastUpdatedAt: now.Add(-time.Minute)},
+			// Only chat partners see the language
+			{ID: "private", NativeLanguage: "ko", LastUpdatedAt: now.Add(-time.Minute)},
+		},
+		audiences: map[string]Audience{
+			"alice": {
+				Blocked: map[string]bool{"min": true},
+				Viewer: models.ProfileViewer{UserID: "alice", Settings: map[string]models.PrivacySettings{
+					"hidden":  {HiddenFromSearch: true},
+					"private": {Languages: models.VisibilityConnections},
+				}},
+			},
+			"bob": {
+				Viewer: models.ProfileViewer{UserID: "bob", Connections: map[string]bool{"private": true}, Settings: map[string]models.PrivacySettings{
+					"hidden":  {HiddenFromSearch: true},
+					"private": {Languages: models.VisibilityConnections},
+				}},
+			},
+		},
+		known:   map[int64]map[string]bool{},
+		checked: map[int64]time.Time{},
+	}
+	alerts := map[int64][]string{}
+	job := NewJob(store, func(ctx context.Context, ownerID string, alert models.SavedSearchAlert) error {
+		alerts[alert.SavedSearchID] = alert.UserIDs
+		return nil
+	})
+	job.now = func() time.Time { return now }
+
+	if err := job.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if store.usersLoaded != 1 || !store.since.Equal(dayAgo) {
+		t.Errorf("users loaded %d time(s) since %v, want once since the oldest check %v", store.usersLoaded, store.since, dayAgo)
+	}
+	// alice blocked min, can't find hidden and doesn't see private's language
+	if len(alerts[1]) != 0 {
+		t.Errorf("alice alerted about %v", alerts[1])
+	}
+	if got := fmt.Sprint(alerts[2]); got != "[min private jin]" {
+		t.Errorf("bob's older search alerted about %s", got)
+	}
+	// jin was updated before this search was created
+	if got := fmt.Sprint(alerts[3]); got != "[min private]" {
+		t.Errorf("bob's newer search alerted about %s", got)
+	}
+}
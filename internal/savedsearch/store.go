@@ -0,0 +1,52 @@
+package savedsearch
+
+import (
+	"time"
+
+	"meetupr-backend/internal/db"
+	"meetupr-backend/internal/models"
+)
+
+// SupabaseStore is the Store backed by the Supabase tables.
+type SupabaseStore struct{}
+
+func (SupabaseStore) AlertingSearches() ([]models.SavedSearch, error) {
+	return db.GetAlertingSavedSearches()
+}
+
+func (SupabaseStore) UpdatedUsers(since time.Time) ([]models.User, error) {
+	return db.GetUsersUpdatedSince(since)
+}
+
+func (SupabaseStore) Audiences(ownerIDs []string) (map[string]Audience, error) {
+	blocked, err := db.GetBlockedUserIDsOf(ownerIDs)
+	if err != nil {
+		return nil, err
+	}
+	// Privacy settings of every user, rather than a long list of IDs in the request
+	viewers, err := db.GetProfileViewers(ownerIDs, nil)
+	if err != nil {
+		return nil, err
+	}
+	audiences := make(map[string]Audience, len(ownerIDs))
+	for _, ownerID := range ownerIDs {
+		audiences[ownerID] = Audience{Blocked: blocked[ownerID], Viewer: viewers[ownerID]}
+	}
+	return audiences, nil
+}
+
+func (SupabaseStore) InterestDescendants() (map[int][]int, error) {
+	return db.GetInterestDescendants()
+}
+
+func (SupabaseStore) KnownMatches(savedSearchID int64) (map[string]bool, error) {
+	return db.GetSavedSearchMatchIDs(savedSearchID)
+}
+
+func (SupabaseStore) AddMatches(savedSearchID int64, userIDs []string) error {
+	return db.AddSavedSearchMatches(savedSearchID, userIDs)
+}
+
+func (SupabaseStore) MarkChecked(savedSearchID int64, at time.Time) error {
+	return db.SetSavedSearchCheckedAt(savedSearchID, at)
+}
@@ -0,0 +1,198 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"meetupr-backend/internal/models"
+)
+
+// Result is a user that matched a search.
+type Result struct {
+	models.User
+	// Only for keyword searches: relevance and where the keyword matched
+	Score      float64     `json:"score,omitempty"`
+	Highlights []Highlight `json:"highlights,omitempty"`
+}
+
+// Page is one page of search results.
+type Page struct {
+	Results []Result `json:"results"`
+	// Number of users matching the query, over all pages
+	Total int `json:"total"`
+	// Pass as cursor to get the next page; empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+	Facets     Facets `json:"facets"`
+}
+
+// Run searches candidates with a normalized query. Keyword searches are ordered by
+// relevance, others by most recently active, with incomplete profiles after complete
+// ones. A Limit of 0 returns every match.
+func Run(q Query, candidates []models.User, now time.Time) Page {
+	// Users passing every filter except the faceted ones, which are kept per user so
+	// facets can leave out their own filter
+	var pool []facetCandidate
+	for _, candidate := range candidates {
+		if q.matchesBase(candidate, now) {
+			pool = append(pool, facetCandidate{user: candidate, dims: q.matchesDimensions(candidate)})
+		}
+	}
+
+	results := make(map[string]Result, len(pool))
+	keys := make(map[string]sortKey, len(pool))
+	if q.Keyword != "" {
+		index := NewMemoryIndex(DefaultFieldWeights)
+		for _, c := range pool {
+			index.Add(profileDocument(c.user))
+		}
+		hits := index.Search(q.Keyword, 0)
+		byID := make(map[string]facetCandidate, len(pool))
+		for _, c := range pool {
+			byID[c.user.ID] = c
+		}
+		pool = pool[:0]
+		for _, hit := range hits {
+			c := byID[hit.ID]
+			pool = append(pool, c)
+			results[hit.ID] = Result{User: c.user, Score: hit.Score, Highlights: hit.Highlights}
+			keys[hit.ID] = sortKey{Incomplete: incomplete(c.user), Score: hit.Score, ID: hit.ID}
+		}
+	} else {
+		for _, c := range pool {
+			results[c.user.ID] = Result{User: c.user}
+			keys[c.user.ID] = sortKey{Incomplete: incomplete(c.user), ActiveAt: c.user.LastUpdatedAt.UnixNano(), ID: c.user.ID}
+		}
+	}
+
+	var matches []Result
+	for _, c := range pool {
+		if c.matchesAll(-1) {
+			matches = append(matches, results[c.user.ID])
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return keys[matches[i].ID].before(keys[matches[j].ID]) })
+
+	page := Page{Results: []Result{}, Total: len(matches), Facets: countFacets(pool)}
+	start := 0
+	if q.after != nil {
+		start = sort.Search(len(matches), func(i int) bool { return q.after.before(keys[matches[i].ID]) })
+	}
+	end := len(matches)
+	if q.Limit > 0 && start+q.Limit < end {
+		end = start + q.Limit
+		page.NextCursor = encodeCursor(keys[matches[end-1].ID])
+	}
+	page.Results = append(page.Results, matches[start:end]...)
+	return page
+}
+
+// incomplete reports whether u's profile is listed after complete ones.
+func incomplete(u models.User) bool {
+	return u.Completeness < models.MinCompleteScore
+}
+
+// matchesBase applies the filters that have no facet, except the keyword.
+func (q Query) matchesBase(u models.User, now time.Time) bool {
+	if q.VerifiedOnly && !u.IsOICVerified {
+		return false
+	}
+	if u.Completeness < q.MinCompleteness {
+		return false
+	}
+	if q.ActiveWithinDays > 0 && u.LastUpdatedAt.Before(now.AddDate(0, 0, -q.ActiveWithinDays)) {
+		return false
+	}
+	if !matchesFold(q.Genders, u.Gender) {
+		return false
+	}
+
+	native := func(lang string) bool { return strings.EqualFold(u.NativeLanguage, lang) }
+	spoken := func(lang string) bool {
+		if q.MinLevel != "" {
+			return u.SpeaksAtLeast(lang, q.MinLevel)
+		}
+		return native(lang) || containsFold(u.SpokenLanguages, lang)
+	}
+	anyRole := func(lang string) bool { return spoken(lang) || (q.MinLevel == "" && u.IsLearning(lang)) }
+	return matchesAny(q.Languages, anyRole) &&
+		matchesAny(q.SpokenLanguages, spoken) &&
+		matchesAny(q.LearningLanguages, u.IsLearning)
+}
+
+// matchesDimensions applies each faceted filter.
+func (q Query) matchesDimensions(u models.User) [numDimensions]bool {
+	var dims [numDimensions]bool
+	dims[dimNativeLanguage] = matchesAny(q.NativeLanguages, func(lang string) bool { return strings.EqualFold(u.NativeLanguage, lang) })
+	dims[dimResidence] = matchesFold(q.Residences, u.Residence)
+	dims[dimInterest] = q.matchesInterests(u.Interests)
+	dims[dimMajor] = matchesFold(q.Majors, u.Major)
+	return dims
+}
+
+func (q Query) matchesInterests(interests []models.Interest) bool {
+	if len(q.InterestIDs) == 0 {
+		return true
+	}
+	has := make(map[int]bool, len(interests))
+	for _, interest := range interests {
+		has[interest.ID] = true
+	}
+	for _, id := range q.InterestIDs {
+		matched := has[id]
+		for _, sub := range q.subInterests[id] {
+			matched = matched || has[sub]
+		}
+		if matched && q.InterestMatch != MatchAll {
+			return true
+		}
+		if !matched && q.InterestMatch == MatchAll {
+			return false
+		}
+	}
+	return q.InterestMatch == MatchAll
+}
+
+// matchesAny reports whether match holds for one of values, or values is empty.
+func matchesAny(values []string, match func(string) bool) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesFold reports whether value is one of values ignoring case, or values is empty.
+func matchesFold(values []string, value string) bool {
+	return len(values) == 0 || containsFold(values, value)
+}
+
+func containsFold(values []string, target string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// profileDocument turns a profile into the fields keyword search looks at.
+func profileDocument(user models.User) Document {
+	names := make([]string, len(user.Interests))
+	for i, interest := range user.Interests {
+		names[i] = interest.Name
+	}
+	return Document{
+		ID: user.ID,
+		Fields: map[string]string{
+			FieldUsername:  user.Username,
+			FieldComment:   user.Comment,
+			FieldMajor:     user.Major,
+			FieldInterests: strings.Join(names, ", "),
+		},
+	}
+}
@@ -0,0 +1,120 @@
+package search
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"meetupr-backend/internal/models"
+)
+
+// Filters that have facets.
+const (
+	dimNativeLanguage = iota
+	dimResidence
+	dimInterest
+	dimMajor
+	numDimensions
+)
+
+// Facets count the users matching the query per value of a filter, so the UI can show
+// "Korean (12)" and hide filters that would leave no results. Each facet is counted
+// with every filter of the query except its own: with native_languages=ko selected,
+// the native language facet still shows how many users the other languages would add.
+type Facets struct {
+	NativeLanguages []FacetCount `json:"native_languages"`
+	Residences      []FacetCount `json:"residences"`
+	Interests       []FacetCount `json:"interests"`
+	Majors          []FacetCount `json:"majors"`
+}
+
+// FacetCount is the number of users with a value. Values with no users are left out.
+type FacetCount struct {
+	// Language code, country code, interest ID or major as stored
+	Value string `json:"value"`
+	// Interest name; empty for the other facets
+	Label string `json:"label,omitempty"`
+	Count int    `json:"count"`
+}
+
+// facetCandidate is a user that passed the filters without facets, with whether it
+// passes each faceted filter.
+type facetCandidate struct {
+	user models.User
+	dims [numDimensions]bool
+}
+
+// matchesAll reports whether the user passes every faceted filter except the one at
+// index except (-1 for none).
+func (c facetCandidate) matchesAll(except int) bool {
+	for dim, ok := range c.dims {
+		if !ok && dim != except {
+			return false
+		}
+	}
+	return true
+}
+
+// facetCounter counts values of one facet. Values that differ only in case count as
+// one, labelled with the first spelling seen.
+type facetCounter struct {
+	counts map[string]*FacetCount
+}
+
+func (f *facetCounter) add(value, label string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	key := strings.ToLower(value)
+	if f.counts == nil {
+		f.counts = make(map[string]*FacetCount)
+	}
+	if fc := f.counts[key]; fc != nil {
+		fc.Count++
+		return
+	}
+	f.counts[key] = &FacetCount{Value: value, Label: label, Count: 1}
+}
+
+// sorted returns the counts, largest first.
+func (f *facetCounter) sorted() []FacetCount {
+	counts := make([]FacetCount, 0, len(f.counts))
+	for _, fc := range f.counts {
+		counts = append(counts, *fc)
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Value < counts[j].Value
+	})
+	return counts
+}
+
+func countFacets(pool []facetCandidate) Facets {
+	var native, residence, interest, major facetCounter
+	for _, c := range pool {
+		u := c.user
+		if c.matchesAll(dimNativeLanguage) {
+			native.add(u.NativeLanguage, "")
+		}
+		if c.matchesAll(dimResidence) {
+			residence.add(u.Residence, "")
+		}
+		if c.matchesAll(dimInterest) {
+			for _, i := range u.Interests {
+				interest.add(strconv.Itoa(i.ID), i.Name)
+			}
+		}
+		if c.matchesAll(dimMajor) {
+			major.add(u.Major, "")
+		}
+	}
+	return Facets{
+		NativeLanguages: native.sorted(),
+		Residences:      residence.sorted(),
+		Interests:       interest.sorted(),
+		Majors:          major.sorted(),
+	}
+}
@@ -0,0 +1,117 @@
+package search
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// Fields longer than this are cut down to a snippet around the first match.
+	maxSnippetRunes = 80
+	// How much text to keep before the first match in a snippet.
+	snippetLeadRunes = 20
+	ellipsis         = "…"
+)
+
+// Highlight is a field's text split into fragments, with the fragments that matched the
+// query marked, so clients can emphasise them without parsing markup.
+type Highlight struct {
+	Field     string     `json:"field"`
+	Fragments []Fragment `json:"fragments"`
+}
+
+// Fragment is a piece of highlighted text.
+type Fragment struct {
+	Text  string `json:"text"`
+	Match bool   `json:"match,omitempty"`
+}
+
+// highlight marks where terms occur in text. Overlapping CJK bigrams merge into one
+// match, so "情報理工" is marked as a whole. A word that only starts with a term has
+// that part marked ("tana" in "Tanaka"), and so does every occurrence of substring, if
+// given. It reports false if nothing matched.
+func highlight(field, text string, terms []string, substring string) (Highlight, bool) {
+	wanted := make(map[string]bool, len(terms))
+	var prefixes []string
+	for _, term := range terms {
+		wanted[term] = true
+		if isWord(term) && utf8.RuneCountInString(term) >= minPrefixRunes {
+			prefixes = append(prefixes, term)
+		}
+	}
+
+	runes := []rune(text)
+	matched := make([]bool, len(runes))
+	first := -1
+	mark := func(start, end int) {
+		for i := start; i < end; i++ {
+			matched[i] = true
+		}
+		if first < 0 || start < first {
+			first = start
+		}
+	}
+	for _, token := range Tokenize(text) {
+		if wanted[token.Term] {
+			mark(token.Start, token.End)
+			continue
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(token.Term, prefix) {
+				mark(token.Start, token.Start+utf8.RuneCountInString(prefix))
+				break
+			}
+		}
+	}
+	if substring != "" {
+		// normalize maps rune to rune, so rune offsets in it are offsets in text
+		normalized := []rune(normalize(text))
+		needle := []rune(substring)
+		for i := 0; i+len(needle) <= len(normalized); i++ {
+			if string(normalized[i:i+len(needle)]) == substring {
+				mark(i, i+len(needle))
+			}
+		}
+	}
+	if first < 0 {
+		return Highlight{}, false
+	}
+
+	start, end := 0, len(runes)
+	if len(runes) > maxSnippetRunes {
+		start = max(first-snippetLeadRunes, 0)
+		end = min(start+maxSnippetRunes, len(runes))
+	}
+
+	h := Highlight{Field: field}
+	if start > 0 {
+		h.Fragments = append(h.Fragments, Fragment{Text: ellipsis})
+	}
+	for i := start; i < end; {
+		j := i
+		for j < end && matched[j] == matched[i] {
+			j++
+		}
+		h.Fragments = append(h.Fragments, Fragment{Text: string(runes[i:j]), Match: matched[i]})
+		i = j
+	}
+	if end < len(runes) {
+		h.Fragments = append(h.Fragments, Fragment{Text: ellipsis})
+	}
+	// An ellipsis joins the unmatched text next to it
+	h.Fragments = mergeFragments(h.Fragments)
+	return h, true
+}
+
+// mergeFragments joins adjacent unmatched fragments.
+func mergeFragments(fragments []Fragment) []Fragment {
+	merged := fragments[:0]
+	for _, f := range fragments {
+		if n := len(merged); n > 0 && !merged[n-1].Match && !f.Match {
+			merged[n-1].Text += f.Text
+			continue
+		}
+		merged = append(merged, f)
+	}
+	return merged
+}
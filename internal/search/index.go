@@ -0,0 +1,352 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Profile fields that are searched.
+const (
+	FieldUsername  = "username"
+	FieldInterests = "interests"
+	FieldMajor     = "major"
+	FieldComment   = "comment"
+)
+
+// DefaultFieldWeights count a match in a name or interest more than one somewhere in a
+// long self-introduction.
+var DefaultFieldWeights = map[string]float64{
+	FieldUsername:  3,
+	FieldInterests: 2,
+	FieldMajor:     2,
+	FieldComment:   1,
+}
+
+const (
+	// BM25 parameters: how quickly repeated terms stop adding to the score, and how much
+	// a long field is penalised.
+	bm25K1 = 1.2
+	bm25B  = 0.75
+	// Multiplier for a field that contains the whole query as typed, not just its terms.
+	phraseBoost = 1.5
+	// A word that only starts with a query term ("guitarist" for "guitar") counts this
+	// much of an exact match.
+	prefixWeight = 0.5
+	// Query terms shorter than this only match whole words.
+	minPrefixRunes = 2
+	// Score of a username that contains the query only in the middle of a word ("naka"
+	// in "Tanaka"), relative to the username's field weight.
+	substringScore = 0.5
+)
+
+// Document is a searchable item, a user profile, as named fields of text.
+type Document struct {
+	ID     string
+	Fields map[string]string
+}
+
+// Hit is a document that matched a query.
+type Hit struct {
+	ID         string
+	Score      float64
+	Highlights []Highlight
+}
+
+// Index finds documents by keyword.
+type Index interface {
+	// Add indexes doc, replacing any document with the same ID.
+	Add(doc Document)
+	// Remove drops a document from the index.
+	Remove(id string)
+	// Search returns the documents containing every term of query, most relevant first.
+	// A limit of 0 returns all of them.
+	Search(query string, limit int) []Hit
+}
+
+// MemoryIndex is an in-process inverted index ranked with BM25. It is safe for
+// concurrent use.
+type MemoryIndex struct {
+	weights map[string]float64
+
+	mu sync.RWMutex
+	// term -> document ID -> field -> occurrences
+	postings map[string]map[string]map[string]int
+	// Indexed terms of scripts that use spaces, sorted, for prefix lookups
+	words []string
+	docs  map[string]indexedDoc
+	// Total length in tokens of each field over all documents, for the average
+	fieldTokens map[string]int
+}
+
+type indexedDoc struct {
+	doc     Document
+	lengths map[string]int
+	terms   []string
+}
+
+// NewMemoryIndex returns an empty index. Fields missing from weights are not searched.
+func NewMemoryIndex(weights map[string]float64) *MemoryIndex {
+	return &MemoryIndex{
+		weights:     weights,
+		postings:    make(map[string]map[string]map[string]int),
+		docs:        make(map[string]indexedDoc),
+		fieldTokens: make(map[string]int),
+	}
+}
+
+// Add implements Index.
+func (x *MemoryIndex) Add(doc Document) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.remove(doc.ID)
+	indexed := indexedDoc{doc: doc, lengths: make(map[string]int)}
+	seen := make(map[string]bool)
+	for field, text := range doc.Fields {
+		if x.weights[field] == 0 {
+			continue
+		}
+		tokens := Tokenize(text)
+		indexed.lengths[field] = len(tokens)
+		x.fieldTokens[field] += len(tokens)
+		for _, token := range tokens {
+			byDoc := x.postings[token.Term]
+			if byDoc == nil {
+				byDoc = make(map[string]map[string]int)
+				x.postings[token.Term] = byDoc
+				x.addWord(token.Term)
+			}
+			if byDoc[doc.ID] == nil {
+				byDoc[doc.ID] = make(map[string]int)
+			}
+			byDoc[doc.ID][field]++
+			if !seen[token.Term] {
+				seen[token.Term] = true
+				indexed.terms = append(indexed.terms, token.Term)
+			}
+		}
+	}
+	x.docs[doc.ID] = indexed
+}
+
+// Remove implements Index.
+func (x *MemoryIndex) Remove(id string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(id)
+}
+
+func (x *MemoryIndex) remove(id string) {
+	indexed, ok := x.docs[id]
+	if !ok {
+		return
+	}
+	for _, term := range indexed.terms {
+		delete(x.postings[term], id)
+		if len(x.postings[term]) == 0 {
+			delete(x.postings, term)
+			x.removeWord(term)
+		}
+	}
+	for field, n := range indexed.lengths {
+		x.fieldTokens[field] -= n
+	}
+	delete(x.docs, id)
+}
+
+// Len returns the number of indexed documents.
+func (x *MemoryIndex) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.docs)
+}
+
+// isWord reports whether term is from a script that uses spaces, which can be looked
+// up by prefix. CJK terms are already split into characters and bigrams.
+func isWord(term string) bool {
+	for _, r := range term {
+		return !isCJK(r)
+	}
+	return false
+}
+
+func (x *MemoryIndex) addWord(term string) {
+	if !isWord(term) {
+		return
+	}
+	i := sort.SearchStrings(x.words, term)
+	x.words = append(x.words, "")
+	copy(x.words[i+1:], x.words[i:])
+	x.words[i] = term
+}
+
+func (x *MemoryIndex) removeWord(term string) {
+	if !isWord(term) {
+		return
+	}
+	if i := sort.SearchStrings(x.words, term); i < len(x.words) && x.words[i] == term {
+		x.words = append(x.words[:i], x.words[i+1:]...)
+	}
+}
+
+// expansion is an indexed term that a query term matches, and how much it counts.
+type expansion struct {
+	term   string
+	weight float64
+}
+
+// expand returns the indexed terms matching a query term: the term itself, and for
+// words of at least minPrefixRunes characters every longer word starting with it.
+func (x *MemoryIndex) expand(term string) []expansion {
+	var expansions []expansion
+	if _, ok := x.postings[term]; ok {
+		expansions = append(expansions, expansion{term: term, weight: 1})
+	}
+	if !isWord(term) || utf8.RuneCountInString(term) < minPrefixRunes {
+		return expansions
+	}
+	for i := sort.SearchStrings(x.words, term); i < len(x.words) && strings.HasPrefix(x.words[i], term); i++ {
+		if x.words[i] != term {
+			expansions = append(expansions, expansion{term: x.words[i], weight: prefixWeight})
+		}
+	}
+	return expansions
+}
+
+// Search implements Index. Words in the query also match longer words that start with
+// them ("tana" finds "Tanaka"), and a username containing the whole query anywhere
+// matches too, with a lower score.
+func (x *MemoryIndex) Search(query string, limit int) []Hit {
+	terms := QueryTerms(query)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	// The documents matching each query term through any of its expansions
+	expansions := make([][]expansion, len(terms))
+	matching := make([]map[string]bool, len(terms))
+	for i, term := range terms {
+		expansions[i] = x.expand(term)
+		matching[i] = make(map[string]bool)
+		for _, e := range expansions[i] {
+			for id := range x.postings[e.term] {
+				matching[i][id] = true
+			}
+		}
+	}
+
+	// Start from the rarest term so the intersection stays small
+	rarest := 0
+	for i := range matching {
+		if len(matching[i]) < len(matching[rarest]) {
+			rarest = i
+		}
+	}
+	var candidates []string
+	for id := range matching[rarest] {
+		matchesAll := true
+		for i := range matching {
+			if !matching[i][id] {
+				matchesAll = false
+				break
+			}
+		}
+		if matchesAll {
+			candidates = append(candidates, id)
+		}
+	}
+
+	phrase := normalize(strings.TrimSpace(query))
+	n := float64(len(x.docs))
+	hits := make([]Hit, 0, len(candidates))
+	found := make(map[string]bool, len(candidates))
+	for _, id := range candidates {
+		indexed := x.docs[id]
+		var score float64
+		for i := range terms {
+			for _, e := range expansions[i] {
+				byField, ok := x.postings[e.term][id]
+				if !ok {
+					continue
+				}
+				df := float64(len(x.postings[e.term]))
+				idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+				for field, tf := range byField {
+					avg := float64(x.fieldTokens[field]) / n
+					norm := 1 - bm25B + bm25B*float64(indexed.lengths[field])/math.Max(avg, 1)
+					score += e.weight * x.weights[field] * idf * float64(tf) * (bm25K1 + 1) / (float64(tf) + bm25K1*norm)
+				}
+			}
+		}
+		for field, text := range indexed.doc.Fields {
+			if x.weights[field] != 0 && len(terms) > 1 && strings.Contains(normalize(text), phrase) {
+				score *= phraseBoost
+				break
+			}
+		}
+		hits = append(hits, Hit{ID: id, Score: score})
+		found[id] = true
+	}
+
+	// Usernames containing the query in the middle of a word
+	if x.weights[FieldUsername] != 0 && utf8.RuneCountInString(phrase) >= minPrefixRunes {
+		for id, indexed := range x.docs {
+			if !found[id] && strings.Contains(normalize(indexed.doc.Fields[FieldUsername]), phrase) {
+				hits = append(hits, Hit{ID: id, Score: x.weights[FieldUsername] * substringScore})
+			}
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	for i := range hits {
+		hits[i].Highlights = x.highlights(x.docs[hits[i].ID].doc, terms, phrase)
+	}
+	return hits
+}
+
+// highlights returns the highlighted snippets of doc's searched fields, in a stable
+// field order.
+func (x *MemoryIndex) highlights(doc Document, terms []string, phrase string) []Highlight {
+	fields := make([]string, 0, len(doc.Fields))
+	for field := range doc.Fields {
+		if x.weights[field] != 0 {
+			fields = append(fields, field)
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		if x.weights[fields[i]] != x.weights[fields[j]] {
+			return x.weights[fields[i]] > x.weights[fields[j]]
+		}
+		return fields[i] < fields[j]
+	})
+
+	var highlights []Highlight
+	for _, field := range fields {
+		substring := ""
+		if field == FieldUsername {
+			substring = phrase
+		}
+		if h, ok := highlight(field, doc.Fields[field], terms, substring); ok {
+			highlights = append(highlights, h)
+		}
+	}
+	return highlights
+}
+
+func normalize(text string) string {
+	return strings.Map(normalizeRune, text)
+}
@@ -0,0 +1,191 @@
+package search
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"meetupr-backend/internal/languages"
+	"meetupr-backend/internal/models"
+)
+
+// Page sizes of a search.
+const (
+	DefaultLimit = 20
+	MaxLimit     = 50
+)
+
+// How interest filters combine.
+const (
+	MatchAny = "any"
+	MatchAll = "all"
+)
+
+// ErrInvalidCursor is returned for a cursor that wasn't made by a previous page.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Query is a user search. Filters combine with AND; the values within a list filter
+// combine with OR unless noted. Every field is optional.
+type Query struct {
+	// Matched against username, comment, major and interest names
+	Keyword string `json:"keyword" query:"keyword"`
+
+	// An interest also matches users who chose one of its sub-interests, once the query
+	// knows them through IncludeSubInterests
+	InterestIDs []int `json:"interest_ids" query:"interest_ids"`
+	// "any" (default) or "all" of InterestIDs
+	InterestMatch string `json:"interest_match" query:"interest_match"`
+
+	Majors     []string `json:"majors" query:"majors"`
+	Genders    []string `json:"genders" query:"genders"`
+	Residences []string `json:"residences" query:"residences"`
+
+	// Languages by role, as ISO 639-1 codes or names. Languages matches any role.
+	Languages         []string `json:"languages" query:"languages"`
+	NativeLanguages   []string `json:"native_languages" query:"native_languages"`
+	SpokenLanguages   []string `json:"spoken_languages" query:"spoken_languages"`
+	LearningLanguages []string `json:"learning_languages" query:"learning_languages"`
+	// With Languages or SpokenLanguages: only users who speak one of them at this CEFR
+	// level or above
+	MinLevel string `json:"min_level" query:"min_level"`
+
+	// Only users verified as OIC students
+	VerifiedOnly bool `json:"verified_only" query:"verified_only"`
+	// Only users whose profile was updated in the last this many days
+	ActiveWithinDays int `json:"active_within_days" query:"active_within_days"`
+	// Only users whose profile completeness score (0-100) is at least this
+	MinCompleteness int `json:"min_completeness" query:"min_completeness"`
+
+	// next_cursor of the previous page
+	Cursor string `json:"cursor" query:"cursor"`
+	// Page size (default 20, max 50)
+	Limit int `json:"limit" query:"limit"`
+
+	after *sortKey
+	// Sub-interests of each interest, at any depth
+	subInterests map[int][]int
+	// See KeepUnknownLanguages
+	keepUnknownLanguages bool
+}
+
+// KeepUnknownLanguages makes Normalize keep language values it doesn't know as given
+// instead of rejecting them, as the old search endpoints did.
+func (q *Query) KeepUnknownLanguages() {
+	q.keepUnknownLanguages = true
+}
+
+// IncludeSubInterests makes each interest of InterestIDs also match users who chose one
+// of its sub-interests: descendants maps an interest to all of them (see
+// models.InterestDescendants).
+func (q *Query) IncludeSubInterests(descendants map[int][]int) {
+	q.subInterests = descendants
+}
+
+// Normalize trims the query, converts language names to codes, applies the default
+// page size and checks the values. The error describes the first invalid value.
+func (q *Query) Normalize() error {
+	q.Keyword = strings.TrimSpace(q.Keyword)
+	q.Majors = trimAll(q.Majors)
+	q.Genders = trimAll(q.Genders)
+	q.Residences = trimAll(q.Residences)
+
+	switch q.InterestMatch {
+	case "":
+		q.InterestMatch = MatchAny
+	case MatchAny, MatchAll:
+	default:
+		return fmt.Errorf("interest_match must be %q or %q", MatchAny, MatchAll)
+	}
+
+	for _, list := range []*[]string{&q.Languages, &q.NativeLanguages, &q.SpokenLanguages, &q.LearningLanguages} {
+		codes := trimAll(*list)
+		for i, value := range codes {
+			code, ok := languages.Normalize(value)
+			if !ok {
+				if q.keepUnknownLanguages {
+					continue
+				}
+				return fmt.Errorf("unknown language: %s", value)
+			}
+			codes[i] = code
+		}
+		*list = codes
+	}
+	if q.MinLevel != "" && !models.ValidLevel(q.MinLevel) {
+		return errors.New("min_level must be one of A1, A2, B1, B2, C1, C2, native")
+	}
+
+	if q.ActiveWithinDays < 0 {
+		return errors.New("active_within_days must not be negative")
+	}
+	if q.MinCompleteness < 0 || q.MinCompleteness > 100 {
+		return errors.New("min_completeness must be between 0 and 100")
+	}
+	switch {
+	case q.Limit < 0:
+		return errors.New("invalid limit")
+	case q.Limit == 0:
+		q.Limit = DefaultLimit
+	case q.Limit > MaxLimit:
+		q.Limit = MaxLimit
+	}
+
+	if q.Cursor != "" {
+		key, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return err
+		}
+		q.after = &key
+	}
+	return nil
+}
+
+func trimAll(values []string) []string {
+	trimmed := values[:0]
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			trimmed = append(trimmed, v)
+		}
+	}
+	return trimmed
+}
+
+// sortKey orders results: complete profiles before incomplete ones, then by score for
+// keyword searches, otherwise most recently active first, then by user ID so pages are
+// stable.
+type sortKey struct {
+	// Profile completeness is below models.MinCompleteScore
+	Incomplete bool    `json:"i,omitempty"`
+	Score      float64 `json:"s,omitempty"`
+	ActiveAt   int64   `json:"t,omitempty"`
+	ID         string  `json:"id"`
+}
+
+func (k sortKey) before(o sortKey) bool {
+	if k.Incomplete != o.Incomplete {
+		return o.Incomplete
+	}
+	if k.Score != o.Score {
+		return k.Score > o.Score
+	}
+	if k.ActiveAt != o.ActiveAt {
+		return k.ActiveAt > o.ActiveAt
+	}
+	return k.ID < o.ID
+}
+
+func encodeCursor(key sortKey) string {
+	data, _ := json.Marshal(key)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(cursor string) (sortKey, error) {
+	var key sortKey
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || json.Unmarshal(data, &key) != nil || key.ID == "" {
+		return sortKey{}, ErrInvalidCursor
+	}
+	return key, nil
+}
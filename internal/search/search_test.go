@@ -0,0 +1,313 @@
+package search
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"meetupr-backend/internal/models"
+)
+
+func TestTokenizeSplitsWordsAndCJKBigrams(t *testing.T) {
+	var terms []string
+	for _, token := range Tokenize("Ｇｕｉｔａｒ好き, 情報理工!") {
+		terms = append(terms, token.Term)
+	}
+	want := []string{"guitar", "好", "好き", "き", "情", "情報", "報", "報理", "理", "理工", "工"}
+	if !reflect.DeepEqual(terms, want) {
+		t.Errorf("Tokenize = %v, want %v", terms, want)
+	}
+
+	if got := QueryTerms("情報理工 guitar 猫 guitar"); !reflect.DeepEqual(got, []string{"情報", "報理", "理工", "guitar", "猫"}) {
+		t.Errorf("QueryTerms = %v", got)
+	}
+}
+
+func TestMemoryIndexRanksAndHighlights(t *testing.T) {
+	index := NewMemoryIndex(DefaultFieldWeights)
+	index.Add(Document{ID: "aoi", Fields: map[string]string{
+		FieldUsername:  "Aoi",
+		FieldMajor:     "情報理工学部",
+		FieldInterests: "Guitar, アニメ",
+	}})
+	index.Add(Document{ID: "ken", Fields: map[string]string{
+		FieldUsername: "Ken",
+		FieldMajor:    "経済学部",
+		FieldComment:  "最近ギターを始めました。guitar も練習中。" + strings.Repeat("よろしく", 30),
+	}})
+	index.Add(Document{ID: "mia", Fields: map[string]string{
+		FieldUsername: "Mia",
+		FieldComment:  "情報と理工の両方に興味があります",
+	}})
+
+	hits := index.Search("guitar", 0)
+	if len(hits) != 2 || hits[0].ID != "aoi" || hits[1].ID != "ken" {
+		t.Fatalf("guitar: unexpected hits %+v", hits)
+	}
+	// An interest match counts more than one in a long comment
+	if hits[0].Score <= hits[1].Score {
+		t.Errorf("guitar: interest score %v should beat comment score %v", hits[0].Score, hits[1].Score)
+	}
+	comment := hits[1].Highlights[0]
+	if comment.Field != FieldComment || !comment.Fragments[1].Match || comment.Fragments[1].Text != "guitar" {
+		t.Errorf("unexpected comment highlight: %+v", comment)
+	}
+	if last := comment.Fragments[len(comment.Fragments)-1]; !strings.HasSuffix(last.Text, ellipsis) {
+		t.Errorf("long comment should be cut to a snippet, ends with %q", last.Text)
+	}
+
+	// 情報 and 理工 both appear in Mia's comment, but not 報理
+	hits = index.Search("情報理工", 0)
+	if len(hits) != 1 || hits[0].ID != "aoi" {
+		t.Fatalf("情報理工: unexpected hits %+v", hits)
+	}
+	want := []Fragment{{Text: "情報理工", Match: true}, {Text: "学部"}}
+	if got := hits[0].Highlights[0]; got.Field != FieldMajor || !reflect.DeepEqual(got.Fragments, want) {
+		t.Errorf("情報理工: highlight = %+v", got)
+	}
+
+	index.Remove("aoi")
+	if hits := index.Search("情報理工", 0); len(hits) != 0 || index.Len() != 2 {
+		t.Errorf("removed document still found: %+v", hits)
+	}
+}
+
+func TestRunFiltersAndPaginates(t *testing.T) {
+	now := time.Date(2026, 4, 1, 12, 0, 0, 0, time.UTC)
+	guitar := models.Interest{ID: 1, Name: "guitar"}
+	anime := models.Interest{ID: 2, Name: "anime"}
+	candidates := []models.User{
+		{ID: "a", NativeLanguage: "en", LearningLanguages: []string{"ja"}, Interests: []models.Interest{guitar, anime}, IsOICVerified: true, LastUpdatedAt: now.Add(-time.Hour)},
+		{ID: "b", NativeLanguage: "ko", SpokenLanguages: []string{"en"}, Interests: []models.Interest{guitar}, IsOICVerified: true, LastUpdatedAt: now.Add(-2 * time.Hour)},
+		{ID: "c", NativeLanguage: "en", Interests: []models.Interest{guitar, anime}, IsOICVerified: true, LastUpdatedAt: now.Add(-3 * time.Hour)},
+		// Not verified
+		{ID: "d", NativeLanguage: "en", Interests: []models.Interest{guitar, anime}, LastUpdatedAt: now},
+		// Inactive for a month
+		{ID: "e", NativeLanguage: "en", Interests: []models.Interest{guitar}, IsOICVerified: true, LastUpdatedAt: now.AddDate(0, -1, 0)},
+	}
+
+	q := Query{InterestIDs: []int{1}, SpokenLanguages: []string{"English"}, VerifiedOnly: true, ActiveWithinDays: 7, Limit: 2}
+	if err := q.Normalize(); err != nil {
+		t.Fatal(err)
+	}
+	page := Run(q, candidates, now)
+	if page.Total != 3 || len(page.Results) != 2 || page.Results[0].ID != "a" || page.Results[1].ID != "b" || page.NextCursor == "" {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+
+	q.Cursor = page.NextCursor
+	if err := q.Normalize(); err != nil {
+		t.Fatal(err)
+	}
+	page = Run(q, candidates, now)
+	if page.Total != 3 || len(page.Results) != 1 || page.Results[0].ID != "c" || page.NextCursor != "" {
+		t.Fatalf("unexpected last page: %+v", page)
+	}
+
+	all := Query{InterestIDs: []int{1, 2}, InterestMatch: MatchAll, LearningLanguages: []string{"ja"}}
+	if err := all.Normalize(); err != nil {
+		t.Fatal(err)
+	}
+	if page := Run(all, candidates, now); page.Total != 1 || page.Results[0].ID != "a" {
+		t.Errorf("interest_match=all: unexpected results %+v", page.Results)
+	}
+
+	// J-Pop (3) is under music (4)
+	jpop := models.Interest{ID: 3, Name: "J-Pop", ParentID: 4}
+	fans := append(candidates, models.User{ID: "f", NativeLanguage: "ja", Interests: []models.Interest{jpop}})
+	music := Query{InterestIDs: []int{4}}
+	if err := music.Normalize(); err != nil {
+		t.Fatal(err)
+	}
+	if page := Run(music, fans, now); page.Total != 0 {
+		t.Errorf("sub-interests matched without IncludeSubInterests: %+v", page.Results)
+	}
+	music.IncludeSubInterests(models.InterestDescendants([]models.Interest{jpop, {ID: 4, Name: "music"}}))
+	if page := Run(music, fans, now); page.Total != 1 || page.Results[0].ID != "f" {
+		t.Errorf("parent interest: unexpected results %+v", page.Results)
+	}
+
+	bad := Query{Languages: []string{"Klingon"}}
+	if err := bad.Normalize(); err == nil {
+		t.Error("unknown language should be rejected")
+	}
+	bad = Query{Cursor: "not-a-cursor"}
+	if err := bad.Normalize(); err != ErrInvalidCursor {
+		t.Errorf("bad cursor: got %v", err)
+	}
+}
+
+func TestRunListsIncompleteProfilesLast(t *testing.T) {
+	now := time.Date(2026, 4, 1, 12, 0, 0, 0, time.UTC)
+	candidates := []models.User{
+		{ID: "sparse", Completeness: 30, LastUpdatedAt: now},
+		{ID: "full", Completeness: 100, LastUpdatedAt: now.Add(-48 * time.Hour)},
+		{ID: "half", Completeness: 60, LastUpdatedAt: now.Add(-time.Hour)},
+	}
+
+	q := Query{Limit: 2}
+	if err := q.Normalize(); err != nil {
+		t.Fatal(err)
+	}
+	page := Run(q, candidates, now)
+	if len(page.Results) != 2 || page.Results[0].ID != "half" || page.Results[1].ID != "full" {
+		t.Fatalf("unexpected first page: %+v", page.Results)
+	}
+	q.Cursor = page.NextCursor
+	if err := q.Normalize(); err != nil {
+		t.Fatal(err)
+	}
+	if page := Run(q, candidates, now); len(page.Results) != 1 || page.Results[0].ID != "sparse" {
+		t.Fatalf("unexpected last page: %+v", page.Results)
+	}
+
+	q = Query{MinCompleteness: 70}
+	if err := q.Normalize(); err != nil {
+		t.Fatal(err)
+	}
+	if page := Run(q, candidates, now); page.Total != 1 || page.Results[0].ID != "full" {
+		t.Errorf("min_completeness: unexpected results %+v", page.Results)
+	}
+	if bad := (Query{MinCompleteness: 101}); bad.Normalize() == nil {
+		t.Error("min_completeness above 100 should be rejected")
+	}
+}
+
+func TestFacetsLeaveOutTheirOwnFilter(t *testing.T) {
+	guitar := models.Interest{ID: 1, Name: "guitar"}
+	anime := models.Interest{ID: 2, Name: "anime"}
+	candidates := []models.User{
+		{ID: "a", NativeLanguage: "ko", Residence: "KR", Major: "Design", Interests: []models.Interest{guitar}},
+		{ID: "b", NativeLanguage: "ko", Residence: "KR", Major: "design", Interests: []models.Interest{anime}},
+		{ID: "c", NativeLanguage: "en", Residence: "US", Interests: []models.Interest{guitar, anime}},
+		{ID: "d", NativeLanguage: "ja", Residence: "JP", Interests: []models.Interest{guitar}},
+	}
+
+	q := Query{NativeLanguages: []string{"ko"}, InterestIDs: []int{1}}
+	if err := q.Normalize(); err != nil {
+		t.Fatal(err)
+	}
+	page := Run(q, candidates, time.Now())
+	if page.Total != 1 || page.Results[0].ID != "a" {
+		t.Fatalf("unexpected results: %+v", page.Results)
+	}
+
+	// Native languages of guitar players, ignoring the language filter
+	want := []FacetCount{{Value: "en", Count: 1}, {Value: "ja", Count: 1}, {Value: "ko", Count: 1}}
+	if !reflect.DeepEqual(page.Facets.NativeLanguages, want) {
+		t.Errorf("native languages = %+v, want %+v", page.Facets.NativeLanguages, want)
+	}
+	// Interests of Korean speakers, ignoring the interest filter
+	want = []FacetCount{{Value: "1", Label: "guitar", Count: 1}, {Value: "2", Label: "anime", Count: 1}}
+	if !reflect.DeepEqual(page.Facets.Interests, want) {
+		t.Errorf("interests = %+v, want %+v", page.Facets.Interests, want)
+	}
+	// Both filters apply to the other facets
+	want = []FacetCount{{Value: "KR", Count: 1}}
+	if !reflect.DeepEqual(page.Facets.Residences, want) {
+		t.Errorf("residences = %+v, want %+v", page.Facets.Residences, want)
+	}
+
+	// Majors differing in case count together
+	page = Run(Query{}, candidates, time.Now())
+	if want := []FacetCount{{Value: "Design", Count: 2}}; !reflect.DeepEqual(page.Facets.Majors, want) {
+		t.Errorf("majors = %+v, want %+v", page.Facets.Majors, want)
+	}
+}
+
+func TestMemoryIndexMatchesPartialKeywords(t *testing.T) {
+	index := NewMemoryIndex(DefaultFieldWeights)
+	index.Add(Document{ID: "tanaka", Fields: map[string]string{
+		FieldUsername:  "Tanaka",
+		FieldInterests: "Guitar",
+	}})
+	index.Add(Document{ID: "sam", Fields: map[string]string{
+		FieldUsername: "Sam",
+		FieldComment:  "I'm a guitarist in a band",
+	}})
+
+	// A word prefix matches longer words, and the typed part is highlighted
+	hits := index.Search("tana", 0)
+	if len(hits) != 1 || hits[0].ID != "tanaka" {
+		t.Fatalf("tana: unexpected hits %+v", hits)
+	}
+	want := []Fragment{{Text: "Tana", Match: true}, {Text: "ka"}}
+	if got := hits[0].Highlights[0]; got.Field != FieldUsername || !reflect.DeepEqual(got.Fragments, want) {
+		t.Errorf("tana: highlight = %+v", got)
+	}
+
+	// An exact word beats a longer word that starts with it
+	hits = index.Search("guitar", 0)
+	if len(hits) != 2 || hits[0].ID != "tanaka" || hits[1].ID != "sam" {
+		t.Fatalf("guitar: unexpected hits %+v", hits)
+	}
+
+	// A username matches anywhere, not just at the start of a word
+	hits = index.Search("NAKA", 0)
+	if len(hits) != 1 || hits[0].ID != "tanaka" {
+		t.Fatalf("naka: unexpected hits %+v", hits)
+	}
+	want = []Fragment{{Text: "Ta"}, {Text: "naka", Match: true}}
+	if got := hits[0].Highlights[0]; !reflect.DeepEqual(got.Fragments, want) {
+		t.Errorf("naka: highlight = %+v", got)
+	}
+
+	// Only usernames match in the middle of a word
+	if hits := index.Search("itarist", 0); len(hits) != 0 {
+		t.Errorf("itarist: unexpected hits %+v", hits)
+	}
+
+	// Removed words are no longer found by prefix
+	index.Remove("sam")
+	if hits := index.Search("guitari", 0); len(hits) != 0 {
+		t.Errorf("guitari: removed document still found: %+v", hits)
+	}
+}
+
+func TestQueryKeepsUnknownLanguages(t *testing.T) {
+	now := time.Date(2026, 4, 1, 12, 0, 0, 0, time.UTC)
+	candidates := []models.User{
+		{ID: "a", Username: "Tanaka", NativeLanguage: "ja", LastUpdatedAt: now.Add(-time.Hour)},
+		{ID: "b", Username: "sam", Comment: "I met Tanaka at the library", NativeLanguage: "en", LastUpdatedAt: now},
+		{ID: "c", Username: "x", SpokenLanguages: []string{"Elvish"}, LastUpdatedAt: now},
+		{ID: "d", Username: "yui", Major: "Linguistics", NativeLanguage: "ja", LastUpdatedAt: now},
+		{ID: "e", Username: "kim", Interests: []models.Interest{{ID: 1, Name: "Bouldering"}}, NativeLanguage: "ko", LastUpdatedAt: now},
+	}
+
+	// The keyword still goes through the index: comments, majors and interests match too
+	for keyword, want := range map[string][]string{
+		"tanaka":      {"a", "b"},
+		"linguistics": {"d"},
+		"boulder":     {"e"},
+	} {
+		q := Query{Keyword: keyword}
+		q.KeepUnknownLanguages()
+		if err := q.Normalize(); err != nil {
+			t.Fatal(err)
+		}
+		page := Run(q, candidates, now)
+		var got []string
+		for _, r := range page.Results {
+			got = append(got, r.ID)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("keyword %s: got %v, want %v", keyword, got, want)
+		}
+	}
+
+	// Unknown languages are kept as given, known ones still normalized
+	q := Query{Languages: []string{" Elvish ", "Japanese"}}
+	q.KeepUnknownLanguages()
+	if err := q.Normalize(); err != nil {
+		t.Fatalf("unknown language rejected: %v", err)
+	}
+	if !reflect.DeepEqual(q.Languages, []string{"Elvish", "ja"}) {
+		t.Errorf("languages = %v", q.Languages)
+	}
+	if page := Run(q, candidates, now); page.Total != 3 {
+		t.Errorf("languages: unexpected results %+v", page.Results)
+	}
+}
@@ -0,0 +1,105 @@
+// Package search is the user search engine: profile filters with cursor pagination, and
+// keyword search with a tokenizer that handles Japanese and Chinese text without a
+// dictionary, an index that ranks matches by relevance, and highlighting of the
+// matched text.
+package search
+
+import "unicode"
+
+// Token is a term found in a text, with its position in runes.
+type Token struct {
+	Term  string
+	Start int
+	End   int
+}
+
+// segment is a run of text that tokenizes the same way: a word in a script that uses
+// spaces, or a run of CJK characters.
+type segment struct {
+	runes []rune
+	start int
+	cjk   bool
+}
+
+// normalizeRune folds case and full-width ASCII (Ｇｕｉｔａｒ, １２３) so they match their
+// usual forms. It maps one rune to one rune, so positions stay valid in the original text.
+func normalizeRune(r rune) rune {
+	if r >= 0xFF01 && r <= 0xFF5E {
+		r -= 0xFEE0
+	}
+	return unicode.ToLower(r)
+}
+
+func isCJK(r rune) bool {
+	// ー (the prolonged sound mark) belongs to no script but only appears in kana words
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana) || r == 'ー'
+}
+
+func segments(text string) []segment {
+	var segs []segment
+	var current *segment
+	pos := 0
+	for _, r := range text {
+		r = normalizeRune(r)
+		cjk := isCJK(r)
+		if !cjk && !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.Is(unicode.Mn, r) {
+			current = nil
+		} else {
+			if current == nil || current.cjk != cjk {
+				segs = append(segs, segment{start: pos, cjk: cjk})
+				current = &segs[len(segs)-1]
+			}
+			current.runes = append(current.runes, r)
+		}
+		pos++
+	}
+	return segs
+}
+
+// Tokenize splits text into the terms that are indexed. Words are split on spaces and
+// punctuation. CJK text has no spaces, so each run of it becomes every character and
+// every pair of adjacent characters (bigrams): "情報理工" is indexed as 情, 報, 理, 工,
+// 情報, 報理 and 理工.
+func Tokenize(text string) []Token {
+	var tokens []Token
+	for _, seg := range segments(text) {
+		if !seg.cjk {
+			tokens = append(tokens, Token{Term: string(seg.runes), Start: seg.start, End: seg.start + len(seg.runes)})
+			continue
+		}
+		for i := range seg.runes {
+			start := seg.start + i
+			tokens = append(tokens, Token{Term: string(seg.runes[i]), Start: start, End: start + 1})
+			if i+1 < len(seg.runes) {
+				tokens = append(tokens, Token{Term: string(seg.runes[i : i+2]), Start: start, End: start + 2})
+			}
+		}
+	}
+	return tokens
+}
+
+// QueryTerms splits a query into the terms a document must contain (a word may also be
+// the start of a longer word, see MemoryIndex.Search). CJK runs of two or
+// more characters become their bigrams only, so "情報理工" needs 情報, 報理 and 理工 in that
+// order to match well, while a single character such as 猫 is looked up on its own.
+// Duplicates are removed.
+func QueryTerms(query string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	add := func(term string) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	for _, seg := range segments(query) {
+		if !seg.cjk || len(seg.runes) == 1 {
+			add(string(seg.runes))
+			continue
+		}
+		for i := 0; i+1 < len(seg.runes); i++ {
+			add(string(seg.runes[i : i+2]))
+		}
+	}
+	return terms
+}
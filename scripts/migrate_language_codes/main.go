@@ -0,0 +1,170 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"meetupr-backend/internal/db"
+	"meetupr-backend/internal/languages"
+	"meetupr-backend/internal/models"
+
+	"github.com/joho/godotenv"
+)
+
+// Levels assumed for languages that were only listed, without a level, before
+// language_skills existed. Users can correct them on their profile.
+const (
+	spokenLevelEstimate   = models.LevelB2
+	learningLevelEstimate = models.LevelA2
+)
+
+type profileLanguages struct {
+	UserID            string                 `json:"user_id"`
+	NativeLanguage    *string                `json:"native_language"`
+	SpokenLanguages   []string               `json:"spoken_languages"`
+	LearningLanguages []string               `json:"learning_languages"`
+	LanguageSkills    []models.LanguageSkill `json:"language_skills"`
+}
+
+// profileUpdate is the migrated languages of one profile.
+type profileUpdate struct {
+	userID   string
+	native   *string
+	spoken   []string
+	learning []string
+	skills   []models.LanguageSkill
+}
+
+// toCodes converts language names to ISO 639-1 codes, dropping duplicates and values
+// that don't match a language in the master list; those are counted in unknown.
+func toCodes(values []string, unknown map[string]int) []string {
+	codes := []string{}
+	seen := map[string]bool{}
+	for _, value := range values {
+		code, ok := languages.Normalize(value)
+		if !ok {
+			unknown[value]++
+			continue
+		}
+		if !seen[code] {
+			seen[code] = true
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+func main() {
+	// Load environment variables
+	err := godotenv.Load()
+	if err != nil {
+		log.Println("Error loading .env file, proceeding with environment variables")
+	}
+
+	// Initialize database
+	db.Init()
+
+	// Parse command line arguments
+	dryRun := flag.Bool("dry-run", false, "Print the changes without updating profiles")
+	dropUnknown := flag.Bool("drop-unknown", false, "Update profiles even if some values don't match a language, dropping those values")
+	flag.Parse()
+
+	fmt.Println("🌐 Migrating profile languages to ISO 639-1 codes...")
+	if *dryRun {
+		fmt.Println("   (dry run: nothing will be written)")
+	}
+	fmt.Println("")
+
+	var profiles []profileLanguages
+	err = db.Supabase.DB.From("profiles").
+		Select("user_id, native_language, spoken_languages, learning_languages, language_skills").
+		Execute(&profiles)
+	if err != nil {
+		log.Fatalf("❌ Failed to get profiles: %v", err)
+	}
+
+	unknown := map[string]int{}
+	updates := make([]profileUpdate, 0, len(profiles))
+	for _, p := range profiles {
+		var native *string
+		if p.NativeLanguage != nil && *p.NativeLanguage != "" && *p.NativeLanguage != "Unknown" {
+			if code, ok := languages.Normalize(*p.NativeLanguage); ok {
+				native = &code
+			} else {
+				unknown[*p.NativeLanguage]++
+			}
+		}
+		spoken := toCodes(p.SpokenLanguages, unknown)
+		learning := toCodes(p.LearningLanguages, unknown)
+
+		// Keep levels users already set and estimate the rest
+		skills := []models.LanguageSkill{}
+		hasSkill := map[string]bool{}
+		addSkill := func(language, level string) {
+			if hasSkill[language] {
+				return
+			}
+			hasSkill[language] = true
+			skills = append(skills, models.LanguageSkill{Language: language, Level: level})
+		}
+		for _, skill := range p.LanguageSkills {
+			if code, ok := languages.Normalize(skill.Language); ok && models.ValidLevel(skill.Level) {
+				addSkill(code, skill.Level)
+			}
+		}
+		if native != nil {
+			addSkill(*native, models.LevelNative)
+		}
+		for _, code := range spoken {
+			addSkill(code, spokenLevelEstimate)
+		}
+		for _, code := range learning {
+			addSkill(code, learningLevelEstimate)
+		}
+
+		fmt.Printf("👤 %s: native=%v spoken=%v learning=%v skills=%v\n", p.UserID, derefOr(native, "NULL"), spoken, learning, skills)
+		updates = append(updates, profileUpdate{userID: p.UserID, native: native, spoken: spoken, learning: learning, skills: skills})
+	}
+
+	fmt.Println("")
+	if len(unknown) > 0 {
+		fmt.Println("⚠️  Values that didn't match a language (they would be dropped):")
+		for value, count := range unknown {
+			fmt.Printf("   %q × %d\n", value, count)
+		}
+		// Nothing is written, so the values can be added to the master list (or fixed) first
+		if !*dryRun && !*dropUnknown {
+			log.Fatal("❌ Not updating any profile: add these languages to the master list, or rerun with -drop-unknown to drop them")
+		}
+	}
+	if *dryRun {
+		fmt.Printf("✅ Dry run: %d profiles would be updated\n", len(updates))
+		return
+	}
+
+	updated := 0
+	for _, u := range updates {
+		update := map[string]interface{}{
+			"native_language":    u.native,
+			"spoken_languages":   u.spoken,
+			"learning_languages": u.learning,
+			"language_skills":    u.skills,
+		}
+		var results []map[string]interface{}
+		err := db.Supabase.DB.From("profiles").Update(update).Eq("user_id", u.userID).Execute(&results)
+		if err != nil && err.Error() != "unexpected end of JSON input" {
+			log.Printf("❌ Failed to update %s: %v", u.userID, err)
+			continue
+		}
+		updated++
+	}
+	fmt.Printf("✅ Done: %d of %d profiles updated\n", updated, len(profiles))
+}
+
+func derefOr(s *string, def string) string {
+	if s == nil {
+		return def
+	}
+	return *s
+}
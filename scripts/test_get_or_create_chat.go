@@ -25,7 +25,7 @@ func main() {
 
 	fmt.Printf("🔍 Testing GetOrCreateChat between %s and %s\n\n", user1ID, user2ID)
 
-	chatID, err := db.GetOrCreateChat(user1ID, user2ID)
+	chatID, _, err := db.GetOrCreateChat(user1ID, user2ID)
 	if err != nil {
 		log.Fatalf("❌ Error: %v", err)
 	}